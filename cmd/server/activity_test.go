@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"woodpecker-online/internal/model"
+)
+
+func TestActivityPuzzleSolves(t *testing.T) {
+	type attempt struct {
+		timeMs    int
+		hintsUsed int
+	}
+	tests := []struct {
+		name     string
+		attempts []attempt
+		want     []int // time_ms of the puzzle_solved events, newest first
+	}{
+		{"first solve", []attempt{{5000, 0}}, []int{5000}},
+		{"slower second solve", []attempt{{5000, 0}, {7000, 0}}, []int{5000}},
+		{"faster second solve", []attempt{{5000, 0}, {3000, 0}}, []int{3000, 5000}},
+		{"solve with hints", []attempt{{5000, 1}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRouter(t)
+			seedSession(t, 1, "alice")
+			seedPuzzle(t, "p1", "easy")
+			for i, a := range tt.attempts {
+				endedAt := fmt.Sprintf("2024-03-0%d 10:00:00", i+1)
+				mustExec(t, `INSERT INTO attempts (session_id, puzzle_id, started_at, ended_at, time_ms, correct_first_move, hints_used)
+					VALUES (1, 'p1', ?, ?, ?, 1, ?)`, endedAt, endedAt, a.timeMs, a.hintsUsed)
+			}
+
+			var events []model.ActivityEvent
+			decodeBody(t, serve(t, r, "GET", "/api/me/activity", nil, "alice"), &events)
+			var got []int
+			for _, e := range events {
+				if e.Type == "puzzle_solved" {
+					got = append(got, *e.TimeMs)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("solve events = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestActivityFeed(t *testing.T) {
+	r := newTestRouter(t)
+	seedPuzzle(t, "p1", "easy")
+	mustExec(t, `INSERT INTO sets (id, user_id, name, description, difficulty_min, difficulty_max, created_at) VALUES
+		(1, 'alice', 'tactics', '', 'easy', 'easy', '2024-03-01 09:00:00'),
+		(2, 'bob', 'other', '', 'easy', 'easy', '2024-03-09 09:00:00')`)
+	mustExec(t, `INSERT INTO cycles (id, set_id, cycle_index, target_days, status, started_at, ended_at) VALUES
+		(1, 1, 1, 7, 'done', '2024-03-02 09:00:00', '2024-03-05 09:00:00'),
+		(2, 1, 2, 7, 'active', '2024-03-06 09:00:00', NULL),
+		(3, 2, 1, 7, 'active', '2024-03-09 10:00:00', NULL)`)
+	mustExec(t, `INSERT INTO sessions (id, cycle_id, target_count, started_at, ended_at) VALUES
+		(1, 1, 1, '2024-03-03 09:00:00', '2024-03-03 09:30:00')`)
+	mustExec(t, `INSERT INTO attempts (session_id, puzzle_id, started_at, ended_at, time_ms, correct_first_move)
+		VALUES (1, 'p1', '2024-03-03 09:10:00', '2024-03-03 09:10:00', 4000, 1)`)
+
+	var events []model.ActivityEvent
+	decodeBody(t, serve(t, r, "GET", "/api/me/activity", nil, "alice"), &events)
+	want := []string{"cycle_started", "cycle_completed", "session_finished", "puzzle_solved", "cycle_started", "set_created"}
+	var got []string
+	for i, e := range events {
+		got = append(got, e.Type)
+		if i > 0 && e.OccurredAt.After(events[i-1].OccurredAt.Time) {
+			t.Errorf("event %d (%s) is newer than the one before it", i, e.Type)
+		}
+		if e.SetID != 1 {
+			t.Errorf("%s event for set %d, want only alice's set 1", e.Type, e.SetID)
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("feed = %v, want %v", got, want)
+	}
+
+	decodeBody(t, serve(t, r, "GET", "/api/me/activity?limit=2", nil, "alice"), &events)
+	if len(events) != 2 || events[0].Type != "cycle_started" || *events[0].CycleIndex != 2 {
+		t.Errorf("limited feed = %+v, want the 2 newest events", events)
+	}
+
+	for _, limit := range []string{"0", "101", "many"} {
+		if rec := serve(t, r, "GET", "/api/me/activity?limit="+limit, nil, "alice"); rec.Code != 400 {
+			t.Errorf("limit=%s: status %d, want 400", limit, rec.Code)
+		}
+	}
+	if rec := serve(t, r, "GET", "/api/me/activity", nil, ""); rec.Code != 401 {
+		t.Errorf("anonymous: status %d, want 401", rec.Code)
+	}
+}
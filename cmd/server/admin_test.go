@@ -0,0 +1,325 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"woodpecker-online/internal/model"
+)
+
+func TestParseAdminEmails(t *testing.T) {
+	got := parseAdminEmails(" Admin@Example.com,,ops@example.com ")
+	want := map[string]bool{"admin@example.com": true, "ops@example.com": true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseAdminEmails = %v, want %v", got, want)
+	}
+}
+
+func TestAdminRecomputeTicks(t *testing.T) {
+	previous := adminEmails
+	adminEmails = parseAdminEmails("admin@example.com")
+	t.Cleanup(func() { adminEmails = previous })
+
+	r := newTestRouter(t)
+	mustExec(t, `INSERT INTO puzzles (id, difficulty, fen, side_to_move, solution_json, ticks_json)
+		VALUES ('p1', 'easy', ?, 'w', '{"lines":[{"san":"Ra7","isTick":true,"children":[{"san":"h6","children":[{"san":"Ra8+","isTick":true}]}]}]}', '[]')`, testPuzzleFEN)
+
+	path := "/api/admin/puzzles/p1/recompute-ticks"
+	if rec := serve(t, r, "POST", path, nil, "alice"); rec.Code != 403 {
+		t.Errorf("non-admin: status %d, want 403", rec.Code)
+	}
+	if rec := serve(t, r, "POST", path, nil, ""); rec.Code != 401 {
+		t.Errorf("anonymous: status %d, want 401", rec.Code)
+	}
+
+	var result struct {
+		Ticks []string `json:"ticks"`
+	}
+	decodeBody(t, serve(t, r, "POST", path, nil, "admin"), &result)
+	if want := []string{"Ra7", "Ra8+"}; !reflect.DeepEqual(result.Ticks, want) {
+		t.Errorf("ticks = %v, want %v", result.Ticks, want)
+	}
+
+	if rec := serve(t, r, "POST", "/api/admin/puzzles/missing/recompute-ticks", nil, "admin"); rec.Code != 404 {
+		t.Errorf("missing puzzle: status %d, want 404", rec.Code)
+	}
+}
+
+func TestAdminPuzzleStats(t *testing.T) {
+	previous := adminEmails
+	adminEmails = parseAdminEmails("admin@example.com")
+	t.Cleanup(func() { adminEmails = previous })
+
+	r := newTestRouter(t)
+	seedPuzzle(t, "e1", "easy")
+	seedPuzzle(t, "e2", "easy")
+	seedPuzzle(t, "i1", "intermediate")
+	mustExec(t, `UPDATE puzzles SET ticks_json = '["Ra8#"]' WHERE id IN ('e1', 'i1')`)
+	// Missing solutions: NULL, no lines and unparseable
+	mustExec(t, `INSERT INTO puzzles (id, difficulty, fen, side_to_move, solution_json, ticks_json) VALUES
+		('e3', 'easy', ?, 'w', NULL, NULL),
+		('a1', 'advanced', ?, 'w', '{"lines":[]}', '[]'),
+		('a2', 'advanced', ?, 'w', 'not json', 'not json')`, testPuzzleFEN, testPuzzleFEN, testPuzzleFEN)
+
+	if rec := serve(t, r, "GET", "/api/admin/puzzles/stats", nil, "alice"); rec.Code != 403 {
+		t.Errorf("non-admin: status %d, want 403", rec.Code)
+	}
+
+	var stats model.PuzzleCatalogStats
+	decodeBody(t, serve(t, r, "GET", "/api/admin/puzzles/stats", nil, "admin"), &stats)
+	want := model.PuzzleCatalogStats{
+		Total:           6,
+		WithSolution:    3,
+		MissingSolution: 3,
+		WithTicks:       2,
+		ByDifficulty:    map[string]int{"easy": 3, "intermediate": 1, "advanced": 2},
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("stats = %+v, want %+v", stats, want)
+	}
+}
+
+func TestAdminUpdatePuzzle(t *testing.T) {
+	previous := adminEmails
+	adminEmails = parseAdminEmails("admin@example.com")
+	t.Cleanup(func() { adminEmails = previous })
+
+	r := newTestRouter(t)
+	seedPuzzle(t, "p1", "easy")
+
+	solution := map[string]interface{}{
+		"lines": []map[string]interface{}{
+			{"san": "Ra7", "isTick": true, "children": []map[string]interface{}{
+				{"san": "h6", "children": []map[string]interface{}{{"san": "Ra8#", "isTick": true}}},
+			}},
+		},
+	}
+	if rec := serve(t, r, "PUT", "/api/admin/puzzles/p1", map[string]interface{}{"solution": solution}, "alice"); rec.Code != 403 {
+		t.Errorf("non-admin: status %d, want 403", rec.Code)
+	}
+
+	rec := serve(t, r, "PUT", "/api/admin/puzzles/p1", map[string]interface{}{
+		"solution": solution,
+		"ticks":    []string{"Ra8#", "Ra7"},
+	}, "admin")
+	if rec.Code != 200 {
+		t.Fatalf("valid update: status %d: %s", rec.Code, rec.Body.String())
+	}
+	var stored model.PuzzleDB
+	if err := db.Get(&stored, `SELECT id, difficulty, fen, side_to_move, solution_json, ticks_json FROM puzzles WHERE id = 'p1'`); err != nil {
+		t.Fatal(err)
+	}
+	if mainLine := stored.SolutionJSON.Solution.MainLine(); len(mainLine) != 3 || mainLine[2].SAN != "Ra8#" {
+		t.Errorf("stored main line = %+v, want Ra7 h6 Ra8#", mainLine)
+	}
+	if want := []string{"Ra8#", "Ra7"}; !reflect.DeepEqual(stored.TicksJSON.Ticks, want) {
+		t.Errorf("stored ticks = %v, want %v", stored.TicksJSON.Ticks, want)
+	}
+
+	malformed := []struct {
+		name string
+		body map[string]interface{}
+	}{
+		{"no lines", map[string]interface{}{"solution": map[string]interface{}{"lines": []interface{}{}}}},
+		{"empty root move", map[string]interface{}{"solution": map[string]interface{}{
+			"lines": []map[string]interface{}{{"san": " "}},
+		}}},
+		{"ticks not in the tree", map[string]interface{}{"solution": solution, "ticks": []string{"Ra7"}}},
+	}
+	for _, tt := range malformed {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := serve(t, r, "PUT", "/api/admin/puzzles/p1", tt.body, "admin"); rec.Code != 400 {
+				t.Errorf("status %d, want 400", rec.Code)
+			}
+		})
+	}
+
+	var ticks string
+	if err := db.Get(&ticks, `SELECT ticks_json FROM puzzles WHERE id = 'p1'`); err != nil {
+		t.Fatal(err)
+	}
+	if ticks != `["Ra8#","Ra7"]` {
+		t.Errorf("rejected updates changed ticks to %s", ticks)
+	}
+
+	if rec := serve(t, r, "PUT", "/api/admin/puzzles/missing", map[string]interface{}{"solution": solution}, "admin"); rec.Code != 404 {
+		t.Errorf("missing puzzle: status %d, want 404", rec.Code)
+	}
+}
+
+func TestAdminValidateSet(t *testing.T) {
+	previous := adminEmails
+	adminEmails = parseAdminEmails("admin@example.com")
+	t.Cleanup(func() { adminEmails = previous })
+
+	r := newTestRouter(t)
+	mustExec(t, `INSERT INTO sets (id, user_id, name, description, difficulty_min, difficulty_max, created_at)
+		VALUES (1, 'alice', 'set', '', 'easy', 'easy', CURRENT_TIMESTAMP)`)
+	seedPuzzle(t, "good", "easy")
+	// Ra8# isn't legal with the rook on b1
+	mustExec(t, `INSERT INTO puzzles (id, difficulty, fen, side_to_move, solution_json, ticks_json)
+		VALUES ('broken', 'easy', '6k1/5ppp/8/8/8/8/8/1R4K1 w - - 0 1', 'w', '{"lines":[{"san":"Ra8#"}]}', '[]')`)
+	mustExec(t, `INSERT INTO set_puzzles (set_id, puzzle_id, position) VALUES (1, 'good', 1), (1, 'broken', 2)`)
+
+	if rec := serve(t, r, "GET", "/api/admin/sets/1/validate", nil, "alice"); rec.Code != 403 {
+		t.Errorf("non-admin: status %d, want 403", rec.Code)
+	}
+
+	var result struct {
+		Puzzles  int                `json:"puzzles"`
+		Valid    bool               `json:"valid"`
+		Problems []SetPuzzleProblem `json:"problems"`
+	}
+	decodeBody(t, serve(t, r, "GET", "/api/admin/sets/1/validate", nil, "admin"), &result)
+	if result.Puzzles != 2 || result.Valid {
+		t.Errorf("result = %+v, want 2 puzzles, not valid", result)
+	}
+	if len(result.Problems) != 1 || result.Problems[0].PuzzleID != "broken" || result.Problems[0].Position != 2 ||
+		!strings.HasPrefix(result.Problems[0].Reason, "first move") {
+		t.Errorf("problems = %+v, want only broken's first move", result.Problems)
+	}
+
+	if rec := serve(t, r, "GET", "/api/admin/sets/9/validate", nil, "admin"); rec.Code != 404 {
+		t.Errorf("missing set: status %d, want 404", rec.Code)
+	}
+}
+
+func TestAdminAdoptSessions(t *testing.T) {
+	tests := []struct {
+		name        string
+		fromCycleID int
+		toCycleID   int
+		wantStatus  int
+		wantMoved   int
+	}{
+		{"cycle of the same set", 1, 3, 200, 1},
+		{"cycle of another set", 2, 3, 409, 0},
+		{"deleted cycle with the set's puzzles", 98, 3, 200, 1},
+		{"deleted cycle with other puzzles", 99, 3, 409, 0},
+		{"missing target cycle", 1, 50, 404, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := adminEmails
+			adminEmails = parseAdminEmails("admin@example.com")
+			t.Cleanup(func() { adminEmails = previous })
+
+			r := newTestRouter(t)
+			seedSession(t, 1, "alice")
+			seedSession(t, 2, "alice")
+			seedPuzzle(t, "p1", "easy")
+			seedPuzzle(t, "p2", "easy")
+			mustExec(t, `INSERT INTO set_puzzles (set_id, puzzle_id, position) VALUES (1, 'p1', 1), (2, 'p2', 1)`)
+			mustExec(t, `INSERT INTO cycles (id, set_id, cycle_index, target_days, status) VALUES (3, 1, 2, 7, 'active')`)
+			// Sessions 98 and 99 were orphaned when their cycles were deleted
+			mustExec(t, `INSERT INTO sessions (id, cycle_id, target_count) VALUES (98, 98, 1), (99, 99, 1)`)
+			mustExec(t, `INSERT INTO attempts (session_id, puzzle_id) VALUES (98, 'p1'), (99, 'p2')`)
+
+			rec := serve(t, r, "POST", fmt.Sprintf("/api/admin/cycles/%d/adopt-sessions", tt.toCycleID),
+				map[string]int{"fromCycleId": tt.fromCycleID}, "admin")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+
+			var moved int
+			if err := db.Get(&moved, `SELECT COUNT(*) FROM sessions WHERE cycle_id = 3`); err != nil {
+				t.Fatal(err)
+			}
+			if moved != tt.wantMoved {
+				t.Errorf("cycle 3 has %d sessions, want %d", moved, tt.wantMoved)
+			}
+		})
+	}
+}
+
+func TestAdminMergeUser(t *testing.T) {
+	previous := adminEmails
+	adminEmails = parseAdminEmails("admin@example.com")
+	t.Cleanup(func() { adminEmails = previous })
+
+	r := newTestRouter(t)
+	mustExec(t, `INSERT INTO users (id, email, password_hash) VALUES ('carol', 'carol@example.com', 'x')`)
+	seedSession(t, 1, "default_user")
+	mustExec(t, `INSERT INTO collections (user_id, name) VALUES ('default_user', 'forks')`)
+	mustExec(t, `INSERT INTO hints (user_id, puzzle_id, ply, level) VALUES ('default_user', 'p1', 0, 1)`)
+	mustExec(t, `INSERT INTO api_keys (user_id, prefix, key_hash) VALUES ('default_user', 'wp_', 'hash')`)
+	// Both users have progress on p1, a daily plan, settings and a p1 daily attempt today
+	mustExec(t, `INSERT INTO progress (user_id, puzzle_id, attempts, score, solved_at) VALUES
+		('default_user', 'p1', 2, 5, NULL), ('default_user', 'p2', 1, 10, CURRENT_TIMESTAMP),
+		('carol', 'p1', 1, 8, CURRENT_TIMESTAMP)`)
+	mustExec(t, `INSERT INTO daily_plans (user_id, daily_plan_json) VALUES ('default_user', 'old'), ('carol', 'new')`)
+	mustExec(t, `INSERT INTO user_settings (user_id, timezone) VALUES ('default_user', 'UTC'), ('carol', 'Europe/Paris')`)
+	mustExec(t, `INSERT INTO daily_attempts (user_id, puzzle_id, day) VALUES
+		('default_user', 'p1', DATE('now')), ('default_user', 'p2', DATE('now')), ('carol', 'p1', DATE('now'))`)
+
+	body := map[string]string{"fromUserId": "default_user", "toUserId": "carol"}
+	if rec := serve(t, r, "POST", "/api/admin/merge-user", body, "alice"); rec.Code != 403 {
+		t.Errorf("non-admin: status %d, want 403", rec.Code)
+	}
+	var resp struct {
+		Moved map[string]int `json:"moved"`
+	}
+	decodeBody(t, serve(t, r, "POST", "/api/admin/merge-user", body, "admin"), &resp)
+	wantMoved := map[string]int{
+		"sets": 1, "collections": 1, "progress": 1, "hints": 1,
+		"daily_plans": 0, "daily_attempts": 1, "user_settings": 0, "api_keys": 1,
+	}
+	if !reflect.DeepEqual(resp.Moved, wantMoved) {
+		t.Errorf("moved = %v, want %v", resp.Moved, wantMoved)
+	}
+
+	for table := range wantMoved {
+		var left int
+		if err := db.Get(&left, `SELECT COUNT(*) FROM `+table+` WHERE user_id = 'default_user'`); err != nil {
+			t.Fatal(err)
+		}
+		if left != 0 {
+			t.Errorf("%d %s rows left for default_user, want 0", left, table)
+		}
+	}
+
+	var p1 struct {
+		Attempts int     `db:"attempts"`
+		Score    int     `db:"score"`
+		SolvedAt *string `db:"solved_at"`
+	}
+	if err := db.Get(&p1, `SELECT attempts, score, solved_at FROM progress WHERE user_id = 'carol' AND puzzle_id = 'p1'`); err != nil {
+		t.Fatal(err)
+	}
+	if p1.Attempts != 3 || p1.Score != 8 || p1.SolvedAt == nil {
+		t.Errorf("merged p1 progress = %+v, want 3 attempts, score 8, solved", p1)
+	}
+	var plan, timezone string
+	if err := db.Get(&plan, `SELECT daily_plan_json FROM daily_plans WHERE user_id = 'carol'`); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Get(&timezone, `SELECT timezone FROM user_settings WHERE user_id = 'carol'`); err != nil {
+		t.Fatal(err)
+	}
+	if plan != "new" || timezone != "Europe/Paris" {
+		t.Errorf("carol's plan %q and timezone %q, want her own kept", plan, timezone)
+	}
+	var dailyAttempts int
+	if err := db.Get(&dailyAttempts, `SELECT COUNT(*) FROM daily_attempts WHERE user_id = 'carol'`); err != nil {
+		t.Fatal(err)
+	}
+	if dailyAttempts != 2 {
+		t.Errorf("carol has %d daily attempts, want 2", dailyAttempts)
+	}
+
+	for _, tt := range []struct {
+		from, to string
+		status   int
+	}{
+		{"default_user", "nobody", 404},
+		{"carol", "carol", 400},
+		{"", "carol", 400},
+	} {
+		body := map[string]string{"fromUserId": tt.from, "toUserId": tt.to}
+		if rec := serve(t, r, "POST", "/api/admin/merge-user", body, "admin"); rec.Code != tt.status {
+			t.Errorf("merge %q into %q: status %d, want %d", tt.from, tt.to, rec.Code, tt.status)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAnalyzeHanging(t *testing.T) {
+	tests := []struct {
+		name string
+		fen  string
+		want []HangingPiece
+	}{
+		{
+			"hanging queen",
+			"4k3/8/8/3q4/8/8/8/3RK3 w - - 0 1",
+			[]HangingPiece{{Square: "d5", Piece: Queen, Color: "black", Attackers: 1, Defenders: 0}},
+		},
+		{"defended queen", "4k3/8/4p3/3q4/8/8/8/3RK3 w - - 0 1", []HangingPiece{}},
+		{
+			"outnumbered defender",
+			"4k3/8/4p3/3q4/8/2N5/8/3RK3 w - - 0 1",
+			[]HangingPiece{{Square: "d5", Piece: Queen, Color: "black", Attackers: 2, Defenders: 1}},
+		},
+		{"kings are never hanging", "4k3/8/8/8/8/8/8/r3K3 w - - 0 1", []HangingPiece{}},
+		{"start position", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", []HangingPiece{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRouter(t)
+
+			var resp struct {
+				Hanging []HangingPiece `json:"hanging"`
+			}
+			decodeBody(t, serve(t, r, "POST", "/api/analyze/hanging", map[string]string{"fen": tt.fen}, ""), &resp)
+			if !reflect.DeepEqual(resp.Hanging, tt.want) {
+				t.Errorf("hanging = %+v, want %+v", resp.Hanging, tt.want)
+			}
+		})
+	}
+
+	r := newTestRouter(t)
+	if rec := serve(t, r, "POST", "/api/analyze/hanging", map[string]string{"fen": "not a fen"}, ""); rec.Code != 400 {
+		t.Errorf("invalid FEN: status %d, want 400", rec.Code)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// serveWithKey sends a request authenticated only by an API key
+func serveWithKey(t *testing.T, h http.Handler, method, path string, body interface{}, key string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := newRequest(t, method, path, body, "")
+	req.Header.Set("Authorization", "Bearer "+key)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// createAPIKey creates a key for userID through the API and returns its ID and full value
+func createAPIKey(t *testing.T, h http.Handler, userID string) (int, string) {
+	t.Helper()
+	rec := serve(t, h, "POST", "/api/me/api-keys", nil, userID)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create key: status %d: %s", rec.Code, rec.Body.String())
+	}
+	var created struct {
+		ID     int    `json:"id"`
+		Prefix string `json:"prefix"`
+		Key    string `json:"key"`
+	}
+	decodeBody(t, rec, &created)
+	if !strings.HasPrefix(created.Key, created.Prefix) || !strings.HasPrefix(created.Key, "wpk_") {
+		t.Fatalf("key %q does not start with prefix %q", created.Key, created.Prefix)
+	}
+	return created.ID, created.Key
+}
+
+func TestAPIKeyLifecycle(t *testing.T) {
+	r := newTestRouter(t)
+	mustExec(t, `INSERT INTO users (id, email, password_hash) VALUES ('alice', 'alice@example.com', 'x')`)
+
+	id, key := createAPIKey(t, r, "alice")
+
+	// Only the sha256 of the key is stored
+	sum := sha256.Sum256([]byte(key))
+	var stored struct {
+		UserID  string `db:"user_id"`
+		KeyHash string `db:"key_hash"`
+	}
+	if err := db.Get(&stored, `SELECT user_id, key_hash FROM api_keys WHERE id = ?`, id); err != nil {
+		t.Fatal(err)
+	}
+	if stored.UserID != "alice" || stored.KeyHash != hex.EncodeToString(sum[:]) {
+		t.Errorf("stored %+v, want alice with the key's sha256", stored)
+	}
+
+	list := serve(t, r, "GET", "/api/me/api-keys", nil, "alice")
+	if body := list.Body.String(); strings.Contains(body, key) || strings.Contains(body, stored.KeyHash) {
+		t.Errorf("key list exposes the key or its hash: %s", body)
+	}
+	var keys []struct {
+		ID int `json:"id"`
+	}
+	decodeBody(t, list, &keys)
+	if len(keys) != 1 || keys[0].ID != id {
+		t.Errorf("listed %+v, want key %d", keys, id)
+	}
+
+	var me struct {
+		ID string `json:"id"`
+	}
+	decodeBody(t, serveWithKey(t, r, "GET", "/api/me", nil, key), &me)
+	if me.ID != "alice" {
+		t.Errorf("key authenticated as %q, want alice", me.ID)
+	}
+
+	if rec := serve(t, r, "DELETE", "/api/me/api-keys/"+strconv.Itoa(id), nil, "bob"); rec.Code != 404 {
+		t.Errorf("revoking another user's key: status %d, want 404", rec.Code)
+	}
+	if rec := serve(t, r, "DELETE", "/api/me/api-keys/"+strconv.Itoa(id), nil, "alice"); rec.Code != 204 {
+		t.Fatalf("revoke: status %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := serveWithKey(t, r, "GET", "/api/me", nil, key); rec.Code != 401 {
+		t.Errorf("revoked key: status %d, want 401", rec.Code)
+	}
+}
+
+func TestInvalidAPIKeyIsRejected(t *testing.T) {
+	r := newTestRouter(t)
+	for _, key := range []string{"wpk_0000", "", "not-a-key"} {
+		if rec := serveWithKey(t, r, "GET", "/api/me", nil, key); rec.Code != 401 {
+			t.Errorf("key %q: status %d, want 401", key, rec.Code)
+		}
+	}
+}
+
+func TestAPIKeyOnOptionalAuthRoutes(t *testing.T) {
+	r := newTestRouter(t)
+	mustExec(t, `INSERT INTO users (id, email, password_hash) VALUES ('alice', 'alice@example.com', 'x')`)
+	mustExec(t, `INSERT INTO progress (user_id, puzzle_id, attempts, score) VALUES
+		('alice', 'p1', 1, 10), ('alice', 'p2', 1, 10), ('default_user', 'p3', 1, 10)`)
+	id, key := createAPIKey(t, r, "alice")
+
+	attempted := func(key string) int {
+		var today struct {
+			TotalAttempted int `json:"totalAttempted"`
+		}
+		decodeBody(t, serveWithKey(t, r, "GET", "/api/progress/today", nil, key), &today)
+		return today.TotalAttempted
+	}
+
+	if got := attempted(key); got != 2 {
+		t.Errorf("with a valid key: %d attempted, want alice's 2", got)
+	}
+	serve(t, r, "DELETE", "/api/me/api-keys/"+strconv.Itoa(id), nil, "alice")
+	if got := attempted(key); got != 1 {
+		t.Errorf("with a revoked key: %d attempted, want the anonymous user's 1", got)
+	}
+}
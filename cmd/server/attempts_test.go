@@ -0,0 +1,42 @@
+package main
+
+import "testing"
+
+func TestDeleteOldAttempts(t *testing.T) {
+	r := newTestRouter(t)
+	seedSession(t, 1, "alice")
+	seedSession(t, 2, "bob")
+	mustExec(t, `INSERT INTO attempts (id, session_id, puzzle_id, started_at) VALUES
+		(1, 1, 'p1', '2026-01-05T10:00:00Z'),
+		(2, 1, 'p2', '2026-02-28 23:59:59'),
+		(3, 1, 'p3', '2026-03-01T00:00:00Z'),
+		(4, 1, 'p4', '2026-06-01T12:00:00Z'),
+		(5, 2, 'p1', '2026-01-05T10:00:00Z')`)
+
+	var result struct {
+		Deleted int `json:"deleted"`
+	}
+	decodeBody(t, serve(t, r, "DELETE", "/api/me/attempts?before=2026-03-01", nil, "alice"), &result)
+	if result.Deleted != 2 {
+		t.Errorf("deleted %d attempts, want 2", result.Deleted)
+	}
+
+	var remaining []int
+	if err := db.Select(&remaining, `SELECT id FROM attempts ORDER BY id`); err != nil {
+		t.Fatal(err)
+	}
+	if len(remaining) != 3 || remaining[0] != 3 || remaining[1] != 4 || remaining[2] != 5 {
+		t.Errorf("remaining attempts %v, want alice's recent 3, 4 and bob's 5", remaining)
+	}
+
+	decodeBody(t, serve(t, r, "DELETE", "/api/me/attempts?before=2026-03-01T00:00:01Z", nil, "alice"), &result)
+	if result.Deleted != 1 {
+		t.Errorf("RFC 3339 cutoff deleted %d attempts, want 1", result.Deleted)
+	}
+
+	for _, query := range []string{"", "?before=yesterday"} {
+		if rec := serve(t, r, "DELETE", "/api/me/attempts"+query, nil, "alice"); rec.Code != 400 {
+			t.Errorf("%q: status %d, want 400", query, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"woodpecker-online/internal/auth"
+)
+
+// fakeValidator accepts a single token for a fixed user and records the tokens it was asked about
+type fakeValidator struct {
+	token  string
+	claims *auth.Claims
+	seen   []string
+}
+
+func (v *fakeValidator) ValidateToken(token string) (*auth.Claims, error) {
+	v.seen = append(v.seen, token)
+	if token != v.token {
+		return nil, errors.New("unknown token")
+	}
+	return v.claims, nil
+}
+
+func TestAuthMiddlewareUsesTokenValidator(t *testing.T) {
+	validator := &fakeValidator{token: "opaque-123", claims: &auth.Claims{UserID: "carol", Email: "carol@example.com"}}
+	previous := tokenValidator
+	tokenValidator = validator
+	t.Cleanup(func() { tokenValidator = previous })
+
+	var gotUser string
+	handler := AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUser, _ = r.Context().Value("user_id").(string)
+	}))
+
+	tests := []struct {
+		name     string
+		token    string
+		status   int
+		wantUser string
+	}{
+		{"accepted token", "opaque-123", 200, "carol"},
+		{"rejected token", "opaque-456", 401, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotUser = ""
+			req := newRequest(t, "GET", "/api/me/settings", nil, "")
+			req.AddCookie(&http.Cookie{Name: "auth_token", Value: tt.token})
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.status || gotUser != tt.wantUser {
+				t.Errorf("status %d as %q, want %d as %q", rec.Code, gotUser, tt.status, tt.wantUser)
+			}
+			if last := validator.seen[len(validator.seen)-1]; last != tt.token {
+				t.Errorf("validator saw %q, want %q", last, tt.token)
+			}
+		})
+	}
+}
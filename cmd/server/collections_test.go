@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+
+	"woodpecker-online/internal/model"
+)
+
+func TestCollections(t *testing.T) {
+	r := newTestRouter(t)
+	mustExec(t, `INSERT INTO sets (id, user_id, name, description, difficulty_min, difficulty_max, created_at) VALUES
+		(1, 'alice', 'mates in one', '', 'easy', 'easy', '2026-01-01T00:00:00Z'),
+		(2, 'alice', 'back rank', '', 'easy', 'easy', '2026-02-01T00:00:00Z'),
+		(3, 'alice', 'rook endings', '', 'easy', 'easy', '2026-03-01T00:00:00Z'),
+		(4, 'bob', 'bob''s set', '', 'easy', 'easy', '2026-04-01T00:00:00Z')`)
+
+	rec := serve(t, r, "POST", "/api/trainer/collections", map[string]string{"name": "  Mating Patterns "}, "alice")
+	if rec.Code != 201 {
+		t.Fatalf("create: status %d: %s", rec.Code, rec.Body.String())
+	}
+	var collection model.Collection
+	decodeBody(t, rec, &collection)
+	if collection.Name != "Mating Patterns" || collection.UserID != "alice" {
+		t.Errorf("created %+v", collection)
+	}
+	if rec := serve(t, r, "POST", "/api/trainer/collections", map[string]string{"name": " "}, "alice"); rec.Code != 400 {
+		t.Errorf("blank name: status %d, want 400", rec.Code)
+	}
+
+	setsPath := "/api/trainer/collections/1/sets"
+	for _, setID := range []int{1, 2, 2} {
+		if rec := serve(t, r, "POST", setsPath, map[string]int{"set_id": setID}, "alice"); rec.Code != 204 {
+			t.Fatalf("add set %d: status %d: %s", setID, rec.Code, rec.Body.String())
+		}
+	}
+	if rec := serve(t, r, "POST", setsPath, map[string]int{"set_id": 4}, "alice"); rec.Code != 403 {
+		t.Errorf("adding another user's set: status %d, want 403", rec.Code)
+	}
+
+	var sets []model.Set
+	decodeBody(t, serve(t, r, "GET", setsPath, nil, "alice"), &sets)
+	if len(sets) != 2 || sets[0].ID != 2 || sets[1].ID != 1 {
+		t.Errorf("collection sets = %+v, want sets 2 and 1", sets)
+	}
+
+	if rec := serve(t, r, "DELETE", setsPath+"/1", nil, "alice"); rec.Code != 204 {
+		t.Errorf("remove: status %d", rec.Code)
+	}
+	if rec := serve(t, r, "DELETE", setsPath+"/3", nil, "alice"); rec.Code != 404 {
+		t.Errorf("removing a set not in the collection: status %d, want 404", rec.Code)
+	}
+	decodeBody(t, serve(t, r, "GET", setsPath, nil, "alice"), &sets)
+	if len(sets) != 1 || sets[0].ID != 2 {
+		t.Errorf("after removal sets = %+v, want set 2", sets)
+	}
+
+	var collections []model.Collection
+	decodeBody(t, serve(t, r, "GET", "/api/trainer/collections", nil, "bob"), &collections)
+	if len(collections) != 0 {
+		t.Errorf("bob sees %d collections, want 0", len(collections))
+	}
+	for _, req := range []struct{ method, path string }{
+		{"GET", setsPath},
+		{"POST", setsPath},
+		{"DELETE", setsPath + "/2"},
+	} {
+		if rec := serve(t, r, req.method, req.path, map[string]int{"set_id": 4}, "bob"); rec.Code != 403 {
+			t.Errorf("bob %s %s: status %d, want 403", req.method, req.path, rec.Code)
+		}
+	}
+	if rec := serve(t, r, "GET", "/api/trainer/collections/9/sets", nil, "alice"); rec.Code != 404 {
+		t.Errorf("missing collection: status %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// cookieConfig holds the auth cookie attributes that depend on how the app is deployed
+type cookieConfig struct {
+	Domain   string
+	SameSite http.SameSite
+	Secure   bool
+}
+
+// authCookie is set from COOKIE_DOMAIN, COOKIE_SAMESITE and COOKIE_SECURE at startup
+var authCookie = cookieConfig{SameSite: http.SameSiteLaxMode}
+
+// parseSameSite reads a COOKIE_SAMESITE value: lax, strict or none
+func parseSameSite(value string) (http.SameSite, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	default:
+		return 0, fmt.Errorf("invalid SameSite %q", value)
+	}
+}
+
+// loadCookieConfig reads the auth cookie settings from the environment. Invalid values are
+// logged and ignored. SameSite=None forces Secure, since browsers drop the cookie otherwise.
+func loadCookieConfig() cookieConfig {
+	config := cookieConfig{
+		Domain:   strings.TrimSpace(os.Getenv("COOKIE_DOMAIN")),
+		SameSite: http.SameSiteLaxMode,
+	}
+
+	if v := os.Getenv("COOKIE_SAMESITE"); v != "" {
+		sameSite, err := parseSameSite(v)
+		if err != nil {
+			slog.Warn("Ignoring invalid setting", "name", "COOKIE_SAMESITE", "value", v)
+		} else {
+			config.SameSite = sameSite
+		}
+	}
+
+	config.Secure = envBool("COOKIE_SECURE", false)
+
+	if config.SameSite == http.SameSiteNoneMode && !config.Secure {
+		slog.Warn("COOKIE_SAMESITE=none requires Secure cookies; enabling COOKIE_SECURE")
+		config.Secure = true
+	}
+
+	return config
+}
+
+// newAuthCookie builds the HTTP-only auth cookie with the configured attributes. The cookie is
+// also Secure whenever the request came in over HTTPS. A negative maxAge clears the cookie.
+func newAuthCookie(r *http.Request, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     "auth_token",
+		Value:    value,
+		Path:     "/",
+		Domain:   authCookie.Domain,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   authCookie.Secure || requestScheme(r) == "https",
+		SameSite: authCookie.SameSite,
+	}
+}
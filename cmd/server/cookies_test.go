@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestLoadCookieConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		domain   string
+		sameSite string
+		secure   string
+		want     cookieConfig
+	}{
+		{"defaults", "", "", "", cookieConfig{SameSite: http.SameSiteLaxMode}},
+		{"domain and strict", " .example.com ", "Strict", "", cookieConfig{Domain: ".example.com", SameSite: http.SameSiteStrictMode}},
+		{"none forces secure", "", "none", "false", cookieConfig{SameSite: http.SameSiteNoneMode, Secure: true}},
+		{"invalid values ignored", "", "sometimes", "maybe", cookieConfig{SameSite: http.SameSiteLaxMode}},
+		{"secure", "", "lax", "true", cookieConfig{SameSite: http.SameSiteLaxMode, Secure: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("COOKIE_DOMAIN", tt.domain)
+			t.Setenv("COOKIE_SAMESITE", tt.sameSite)
+			t.Setenv("COOKIE_SECURE", tt.secure)
+			if got := loadCookieConfig(); got != tt.want {
+				t.Errorf("loadCookieConfig = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthCookieUsesConfig(t *testing.T) {
+	previous := authCookie
+	t.Cleanup(func() { authCookie = previous })
+	t.Setenv("COOKIE_DOMAIN", ".example.com")
+	t.Setenv("COOKIE_SAMESITE", "strict")
+	loadConfig()
+
+	r := newTestRouter(t)
+	credentials := map[string]string{"email": "carol@example.com", "password": "secret-password"}
+	for _, path := range []string{"/api/auth/sign-up", "/api/auth/sign-in", "/api/auth/logout"} {
+		rec := serve(t, r, "POST", path, credentials, "")
+		var cookie *http.Cookie
+		for _, c := range rec.Result().Cookies() {
+			if c.Name == "auth_token" {
+				cookie = c
+			}
+		}
+		if cookie == nil {
+			t.Fatalf("%s: no auth cookie set (status %d)", path, rec.Code)
+		}
+		if cookie.Domain != "example.com" || cookie.SameSite != http.SameSiteStrictMode || !cookie.HttpOnly {
+			t.Errorf("%s: cookie domain %q, SameSite %v, HttpOnly %v; want example.com, strict, true",
+				path, cookie.Domain, cookie.SameSite, cookie.HttpOnly)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// corsConfig lists the origins allowed to call the API from the browser and how long browsers
+// may cache a preflight answer
+type corsConfig struct {
+	Origins map[string]bool
+	MaxAge  int
+}
+
+// cors is set from CORS_ALLOWED_ORIGINS and CORS_MAX_AGE at startup. With no origins, cross-origin
+// requests get no CORS headers and browsers only allow same-origin calls.
+var cors = corsConfig{MaxAge: 600}
+
+// corsAllowedHeaders are the request headers the API reads
+const corsAllowedHeaders = "Content-Type, Authorization"
+
+// loadCORSConfig reads the allowed origins (comma separated, e.g. https://app.example.com) and
+// the preflight cache lifetime in seconds from the environment
+func loadCORSConfig() corsConfig {
+	config := corsConfig{Origins: map[string]bool{}, MaxAge: envInt("CORS_MAX_AGE", 600)}
+	for _, origin := range strings.Split(os.Getenv("CORS_ALLOWED_ORIGINS"), ",") {
+		if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+			config.Origins[origin] = true
+		}
+	}
+	return config
+}
+
+// CORS lets the configured origins call the router from the browser, with the auth cookie. It
+// answers preflight requests itself, allowing only the methods registered for the requested
+// path, so the router's 405 handling still applies to methods a route doesn't support. It wraps
+// the whole router because mux only runs middleware for requests that match a route.
+func CORS(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || !cors.Origins[origin] {
+			router.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+
+		if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+			router.ServeHTTP(w, r)
+			return
+		}
+
+		allowed := allowedMethods(router, r)
+		if len(allowed) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(allowed, ", "))
+		w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(cors.MaxAge))
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
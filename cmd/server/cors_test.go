@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestCORSPreflight(t *testing.T) {
+	previous := cors
+	cors = corsConfig{Origins: map[string]bool{"https://app.example.com": true}, MaxAge: 600}
+	t.Cleanup(func() { cors = previous })
+
+	tests := []struct {
+		name        string
+		origin      string
+		path        string
+		wantStatus  int
+		wantOrigin  string
+		wantMethods string
+	}{
+		{"collection route", "https://app.example.com", "/api/trainer/sets", 204, "https://app.example.com", "GET, POST"},
+		{"item route", "https://app.example.com", "/api/trainer/sets/1", 204, "https://app.example.com", "DELETE"},
+		{"read-only route", "https://app.example.com", "/api/stats/records", 204, "https://app.example.com", "GET"},
+		{"unknown route", "https://app.example.com", "/api/nope", 404, "https://app.example.com", ""},
+		{"origin not allowed", "https://evil.example.com", "/api/trainer/sets", 405, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestDB(t)
+			router := mux.NewRouter()
+			router.MethodNotAllowedHandler = methodNotAllowedHandler(router)
+			router.NotFoundHandler = router.MethodNotAllowedHandler
+			setupAPIRoutes(router.PathPrefix("/api").Subrouter())
+
+			req := httptest.NewRequest("OPTIONS", tt.path, nil)
+			req.Header.Set("Origin", tt.origin)
+			req.Header.Set("Access-Control-Request-Method", "POST")
+			rec := httptest.NewRecorder()
+			CORS(router).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("allowed origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Methods"); got != tt.wantMethods {
+				t.Errorf("allowed methods = %q, want %q", got, tt.wantMethods)
+			}
+			wantMaxAge := ""
+			if tt.wantMethods != "" {
+				wantMaxAge = "600"
+			}
+			if got := rec.Header().Get("Access-Control-Max-Age"); got != wantMaxAge {
+				t.Errorf("max age = %q, want %q", got, wantMaxAge)
+			}
+		})
+	}
+}
+
+func TestCORSActualRequest(t *testing.T) {
+	previous := cors
+	cors = corsConfig{Origins: map[string]bool{"https://app.example.com": true}, MaxAge: 600}
+	t.Cleanup(func() { cors = previous })
+
+	newTestDB(t)
+	router := mux.NewRouter()
+	setupAPIRoutes(router.PathPrefix("/api").Subrouter())
+
+	req := httptest.NewRequest("GET", "/api/health", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	rec := httptest.NewRecorder()
+	CORS(router).ServeHTTP(rec, req)
+
+	if rec.Code != 200 {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Errorf("allowed origin = %q, want the request's", got)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+		t.Errorf("allow credentials = %q, want true", got)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Methods"); got != "" {
+		t.Errorf("non-preflight response lists methods %q", got)
+	}
+}
+
+func TestLoadCORSConfig(t *testing.T) {
+	t.Setenv("CORS_ALLOWED_ORIGINS", " https://app.example.com/ ,,http://localhost:3000")
+	t.Setenv("CORS_MAX_AGE", "60")
+
+	config := loadCORSConfig()
+	want := map[string]bool{"https://app.example.com": true, "http://localhost:3000": true}
+	if !reflect.DeepEqual(config.Origins, want) || config.MaxAge != 60 {
+		t.Errorf("config = %+v, want origins %v and max age 60", config, want)
+	}
+}
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"woodpecker-online/internal/model"
+	"woodpecker-online/internal/repository"
+	"woodpecker-online/internal/woodpecker"
+)
+
+func TestCreateCycleChecksSet(t *testing.T) {
+	tests := []struct {
+		name   string
+		setID  int
+		userID string
+		status int
+	}{
+		{"own set", 1, "alice", 200},
+		{"another user's set", 1, "bob", 403},
+		{"nonexistent set", 99, "alice", 404},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRouter(t)
+			mustExec(t, `INSERT INTO sets (id, user_id, name, description, difficulty_min, difficulty_max, created_at)
+				VALUES (1, 'alice', 'set', '', 'easy', 'easy', CURRENT_TIMESTAMP)`)
+
+			rec := serve(t, r, "POST", "/api/trainer/cycles", map[string]interface{}{
+				"set_id":      tt.setID,
+				"index":       1,
+				"target_days": 7,
+				"status":      "active",
+			}, tt.userID)
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.status, rec.Body.String())
+			}
+
+			var cycles int
+			if err := db.Get(&cycles, `SELECT COUNT(*) FROM cycles`); err != nil {
+				t.Fatal(err)
+			}
+			want := 0
+			if tt.status == 200 {
+				want = 1
+			}
+			if cycles != want {
+				t.Errorf("%d cycles stored, want %d", cycles, want)
+			}
+		})
+	}
+}
+
+func TestCycleNextPuzzleFollowsShuffledOrder(t *testing.T) {
+	r := newTestRouter(t)
+	seedSession(t, 1, "alice")
+	for i, id := range []string{"p1", "p2", "p3"} {
+		seedPuzzle(t, id, "easy")
+		mustExec(t, `INSERT INTO set_puzzles (set_id, puzzle_id, position) VALUES (1, ?, ?)`, id, i)
+	}
+	order := woodpecker.NewService(db).ShuffleForCycle(1, 1)
+
+	for _, want := range order {
+		var next struct {
+			ID   string `json:"id"`
+			Done bool   `json:"done"`
+		}
+		decodeBody(t, serve(t, r, "GET", "/api/trainer/cycles/1/next-puzzle", nil, "alice"), &next)
+		if next.ID != want || next.Done {
+			t.Fatalf("next = %+v, want %s", next, want)
+		}
+		mustExec(t, `INSERT INTO attempts (session_id, puzzle_id) VALUES (1, ?)`, want)
+	}
+
+	var next struct {
+		Done bool `json:"done"`
+	}
+	decodeBody(t, serve(t, r, "GET", "/api/trainer/cycles/1/next-puzzle", nil, "alice"), &next)
+	if !next.Done {
+		t.Error("cycle with every puzzle attempted is not done")
+	}
+
+	if rec := serve(t, r, "GET", "/api/trainer/cycles/1/next-puzzle", nil, "bob"); rec.Code != 403 {
+		t.Errorf("another user's cycle: status %d, want 403", rec.Code)
+	}
+	if rec := serve(t, r, "GET", "/api/trainer/cycles/9/next-puzzle", nil, "alice"); rec.Code != 404 {
+		t.Errorf("missing cycle: status %d, want 404", rec.Code)
+	}
+}
+
+func TestSetCyclesSummaries(t *testing.T) {
+	r := newTestRouter(t)
+	mustExec(t, `INSERT INTO sets (id, user_id, name, description, difficulty_min, difficulty_max, created_at)
+		VALUES (1, 'alice', 'set', '', 'easy', 'easy', CURRENT_TIMESTAMP)`)
+	for i, id := range []string{"p1", "p2", "p3", "p4"} {
+		mustExec(t, `INSERT INTO set_puzzles (set_id, puzzle_id, position) VALUES (1, ?, ?)`, id, i)
+	}
+	// Inserted out of order to check the response is ordered by cycle index
+	mustExec(t, `INSERT INTO cycles (id, set_id, cycle_index, target_days, status, started_at)
+		VALUES (3, 1, 3, 7, 'planned', NULL),
+		       (1, 1, 1, 28, 'done', '2026-01-01T00:00:00Z'),
+		       (2, 1, 2, 14, 'active', '2026-02-01T00:00:00Z')`)
+	mustExec(t, `INSERT INTO sessions (id, cycle_id, target_count) VALUES (1, 1, 4), (2, 1, 4), (3, 2, 4)`)
+	// Cycle 1 attempts every puzzle across two sessions, one twice; cycle 2 attempts one set
+	// puzzle and one puzzle outside the set
+	mustExec(t, `INSERT INTO attempts (session_id, puzzle_id) VALUES
+		(1, 'p1'), (1, 'p2'), (2, 'p2'), (2, 'p3'), (2, 'p4'),
+		(3, 'p1'), (3, 'other')`)
+
+	var summaries []CycleSummary
+	decodeBody(t, serve(t, r, "GET", "/api/trainer/sets/1/cycles", nil, "alice"), &summaries)
+
+	want := []struct {
+		index      int
+		status     string
+		targetDays int
+		attempted  int
+		percent    float64
+	}{
+		{1, "done", 28, 4, 100},
+		{2, "active", 14, 1, 25},
+		{3, "planned", 7, 0, 0},
+	}
+	if len(summaries) != len(want) {
+		t.Fatalf("got %d cycles, want %d", len(summaries), len(want))
+	}
+	for i, w := range want {
+		got := summaries[i]
+		if got.Index != w.index || got.Status != w.status || got.TargetDays != w.targetDays ||
+			got.PuzzlesTotal != 4 || got.PuzzlesAttempted != w.attempted || got.CompletionPercent != w.percent {
+			t.Errorf("cycle %d = %+v %+v, want %+v", i, *got.Cycle, got, w)
+		}
+	}
+	if summaries[2].StartedAt != nil {
+		t.Errorf("planned cycle started at %v", *summaries[2].StartedAt)
+	}
+
+	if rec := serve(t, r, "GET", "/api/trainer/sets/1/cycles", nil, "bob"); rec.Code != 403 {
+		t.Errorf("another user's set: status %d, want 403", rec.Code)
+	}
+	if rec := serve(t, r, "GET", "/api/trainer/sets/9/cycles", nil, "alice"); rec.Code != 404 {
+		t.Errorf("missing set: status %d, want 404", rec.Code)
+	}
+}
+
+func TestTrainerDashboard(t *testing.T) {
+	r := newTestRouter(t)
+	mustExec(t, `INSERT INTO sets (id, user_id, name, description, difficulty_min, difficulty_max, created_at) VALUES
+		(1, 'alice', 'first', '', 'easy', 'easy', '2026-01-01 00:00:00'),
+		(2, 'alice', 'second', '', 'easy', 'easy', '2026-02-01 00:00:00'),
+		(3, 'alice', 'third', '', 'easy', 'easy', '2026-03-01 00:00:00'),
+		(4, 'bob', 'other', '', 'easy', 'easy', '2026-04-01 00:00:00')`)
+	mustExec(t, `INSERT INTO set_puzzles (set_id, puzzle_id, position) VALUES
+		(1, 'p1', 1), (1, 'p2', 2), (2, 'p1', 1), (2, 'p2', 2), (2, 'p3', 3), (2, 'p4', 4), (3, 'p1', 1)`)
+	// Set 1 finished cycle 1 and is on cycle 2; set 2 has only a done cycle; set 3 has none
+	mustExec(t, `INSERT INTO cycles (id, set_id, cycle_index, target_days, status) VALUES
+		(1, 1, 1, 28, 'done'), (2, 1, 2, 14, 'active'), (3, 2, 1, 28, 'done')`)
+	mustExec(t, `INSERT INTO sessions (id, cycle_id, target_count) VALUES (1, 1, 2), (2, 2, 2), (3, 3, 4)`)
+	mustExec(t, `INSERT INTO attempts (session_id, puzzle_id) VALUES (1, 'p1'), (1, 'p2'), (2, 'p2'), (3, 'p1')`)
+
+	var dashboard []struct {
+		ID           int           `json:"id"`
+		Name         string        `json:"name"`
+		PuzzlesTotal int           `json:"puzzles_total"`
+		ActiveCycle  *CycleSummary `json:"active_cycle"`
+	}
+	decodeBody(t, serve(t, r, "GET", "/api/trainer/dashboard", nil, "alice"), &dashboard)
+
+	if len(dashboard) != 3 {
+		t.Fatalf("got %d sets, want alice's 3", len(dashboard))
+	}
+	// Newest set first
+	if dashboard[0].ID != 3 || dashboard[1].ID != 2 || dashboard[2].ID != 1 {
+		t.Errorf("set order %d, %d, %d, want 3, 2, 1", dashboard[0].ID, dashboard[1].ID, dashboard[2].ID)
+	}
+	for _, set := range dashboard[:2] {
+		if set.ActiveCycle != nil {
+			t.Errorf("set %d has active cycle %+v, want null", set.ID, *set.ActiveCycle.Cycle)
+		}
+	}
+	if dashboard[1].PuzzlesTotal != 4 {
+		t.Errorf("set 2 has %d puzzles, want 4", dashboard[1].PuzzlesTotal)
+	}
+
+	active := dashboard[2].ActiveCycle
+	if active == nil {
+		t.Fatal("set 1 has no active cycle")
+	}
+	if active.ID != 2 || active.Index != 2 || active.Status != "active" ||
+		active.PuzzlesTotal != 2 || active.PuzzlesAttempted != 1 || active.CompletionPercent != 50 {
+		t.Errorf("set 1 active cycle = %+v %+v, want cycle 2 at 50%%", *active.Cycle, *active)
+	}
+}
+
+func TestCycleRemaining(t *testing.T) {
+	r := newTestRouter(t)
+	mustExec(t, `INSERT INTO sets (id, user_id, name, description, difficulty_min, difficulty_max, created_at) VALUES
+		(1, 'alice', 'set', '', 'easy', 'easy', CURRENT_TIMESTAMP),
+		(2, 'alice', 'other', '', 'easy', 'easy', CURRENT_TIMESTAMP)`)
+	for i, id := range []string{"p1", "p2", "p3", "p4"} {
+		mustExec(t, `INSERT INTO set_puzzles (set_id, puzzle_id, position) VALUES (1, ?, ?)`, id, i)
+	}
+	mustExec(t, `INSERT INTO cycles (id, set_id, cycle_index, target_days, status) VALUES
+		(1, 1, 1, 28, 'done'), (2, 1, 2, 14, 'active'), (3, 2, 1, 28, 'active')`)
+	mustExec(t, `INSERT INTO sessions (id, cycle_id, target_count) VALUES (1, 1, 4), (2, 2, 4), (3, 2, 4)`)
+	// Cycle 2 attempts p1 twice, p2 once and a puzzle outside the set; cycle 1's attempts don't count
+	mustExec(t, `INSERT INTO attempts (session_id, puzzle_id) VALUES
+		(1, 'p3'), (1, 'p4'), (2, 'p1'), (3, 'p1'), (3, 'p2'), (3, 'other')`)
+
+	var remaining map[string]int
+	decodeBody(t, serve(t, r, "GET", "/api/trainer/sets/1/cycles/2/remaining", nil, "alice"), &remaining)
+	if remaining["total"] != 4 || remaining["attempted"] != 2 || remaining["remaining"] != 2 {
+		t.Errorf("remaining = %v, want 2 of 4 left", remaining)
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		userID string
+		status int
+	}{
+		{"another user's set", "/api/trainer/sets/1/cycles/2/remaining", "bob", 403},
+		{"missing set", "/api/trainer/sets/9/cycles/2/remaining", "alice", 404},
+		{"missing cycle", "/api/trainer/sets/1/cycles/9/remaining", "alice", 404},
+		{"cycle of another set", "/api/trainer/sets/1/cycles/3/remaining", "alice", 404},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := serve(t, r, "GET", tt.path, nil, tt.userID); rec.Code != tt.status {
+				t.Errorf("status %d, want %d", rec.Code, tt.status)
+			}
+		})
+	}
+}
+
+func TestDeleteCycleCascades(t *testing.T) {
+	count := func(t *testing.T, table string) int {
+		var n int
+		if err := db.Get(&n, `SELECT COUNT(*) FROM `+table); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	seed := func(t *testing.T) {
+		newTestDB(t)
+		seedSession(t, 1, "alice")
+		seedSession(t, 2, "alice")
+		mustExec(t, `INSERT INTO attempts (session_id, puzzle_id) VALUES (1, 'p1'), (1, 'p2'), (2, 'p1')`)
+	}
+
+	t.Run("removes sessions and attempts", func(t *testing.T) {
+		seed(t)
+		if err := repository.NewSQLiteRepository(db).DeleteCycle(1); err != nil {
+			t.Fatal(err)
+		}
+		if cycles, sessions, attempts := count(t, "cycles"), count(t, "sessions"), count(t, "attempts"); cycles != 1 || sessions != 1 || attempts != 1 {
+			t.Errorf("left %d cycles, %d sessions, %d attempts; want only cycle 2's", cycles, sessions, attempts)
+		}
+	})
+
+	t.Run("rolls back on failure", func(t *testing.T) {
+		seed(t)
+		// Deleting the cycle row itself fails, after its sessions and attempts were deleted
+		mustExec(t, `CREATE TRIGGER keep_cycles BEFORE DELETE ON cycles BEGIN SELECT RAISE(ABORT, 'kept'); END`)
+		if err := repository.NewSQLiteRepository(db).DeleteCycle(1); err == nil {
+			t.Fatal("DeleteCycle succeeded despite the trigger")
+		}
+		if cycles, sessions, attempts := count(t, "cycles"), count(t, "sessions"), count(t, "attempts"); cycles != 2 || sessions != 2 || attempts != 3 {
+			t.Errorf("left %d cycles, %d sessions, %d attempts; want everything kept", cycles, sessions, attempts)
+		}
+	})
+}
+
+func TestEndCycle(t *testing.T) {
+	r := newTestRouter(t)
+	seedSession(t, 1, "alice")
+	mustExec(t, `INSERT INTO sessions (id, cycle_id, target_count, started_at, ended_at)
+		VALUES (2, 1, 10, CURRENT_TIMESTAMP, '2026-01-02 03:04:05')`)
+
+	if rec := serve(t, r, "POST", "/api/trainer/cycles/1/end", nil, "bob"); rec.Code != 403 {
+		t.Errorf("another user's cycle: status %d, want 403", rec.Code)
+	}
+	if rec := serve(t, r, "POST", "/api/trainer/cycles/9/end", nil, "alice"); rec.Code != 404 {
+		t.Errorf("missing cycle: status %d, want 404", rec.Code)
+	}
+
+	if rec := serve(t, r, "POST", "/api/trainer/cycles/1/end", nil, "alice"); rec.Code != 200 {
+		t.Fatalf("end: status %d: %s", rec.Code, rec.Body.String())
+	}
+	var cycle struct {
+		Status  string  `db:"status"`
+		EndedAt *string `db:"ended_at"`
+	}
+	if err := db.Get(&cycle, `SELECT status, ended_at FROM cycles WHERE id = 1`); err != nil {
+		t.Fatal(err)
+	}
+	if cycle.Status != "done" || cycle.EndedAt == nil {
+		t.Errorf("cycle = %s ended %v, want done with an end time", cycle.Status, cycle.EndedAt)
+	}
+	var openSessions int
+	if err := db.Get(&openSessions, `SELECT COUNT(*) FROM sessions WHERE cycle_id = 1 AND ended_at IS NULL`); err != nil {
+		t.Fatal(err)
+	}
+	if openSessions != 0 {
+		t.Errorf("%d sessions still open, want 0", openSessions)
+	}
+
+	// Ending it again changes nothing, including the earlier session's end
+	if rec := serve(t, r, "POST", "/api/trainer/cycles/1/end", nil, "alice"); rec.Code != 200 {
+		t.Errorf("ending a done cycle: status %d, want 200", rec.Code)
+	}
+	var again, earlier string
+	if err := db.Get(&again, `SELECT ended_at FROM cycles WHERE id = 1`); err != nil {
+		t.Fatal(err)
+	}
+	if again != *cycle.EndedAt {
+		t.Errorf("ended_at moved from %s to %s", *cycle.EndedAt, again)
+	}
+	if err := db.Get(&earlier, `SELECT ended_at FROM sessions WHERE id = 2`); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(earlier, "2026-01-02") {
+		t.Errorf("already ended session now ended at %s", earlier)
+	}
+}
+
+func TestActiveCycleNotFound(t *testing.T) {
+	r := newTestRouter(t)
+	seedSession(t, 1, "alice")
+	mustExec(t, `INSERT INTO sets (id, user_id, name, description, difficulty_min, difficulty_max, created_at)
+		VALUES (2, 'alice', 'set', '', 'easy', 'easy', CURRENT_TIMESTAMP)`)
+
+	var cycle struct {
+		ID    int `json:"id"`
+		Index int `json:"index"`
+	}
+	decodeBody(t, serve(t, r, "GET", "/api/trainer/cycles/active?set_id=1", nil, "alice"), &cycle)
+	if cycle.ID != 1 || cycle.Index != 1 {
+		t.Errorf("active cycle = %+v, want cycle 1", cycle)
+	}
+	if rec := serve(t, r, "GET", "/api/trainer/cycles/active?set_id=2", nil, "alice"); rec.Code != 404 {
+		t.Errorf("set without an active cycle: status %d, want 404", rec.Code)
+	}
+
+	db.Close()
+	if rec := serve(t, r, "GET", "/api/trainer/cycles/active?set_id=1", nil, "alice"); rec.Code != 500 {
+		t.Errorf("closed database: status %d, want 500", rec.Code)
+	}
+}
+
+func TestUpdateCycle(t *testing.T) {
+	r := newTestRouter(t)
+	seedSession(t, 1, "alice")
+
+	var cycle model.Cycle
+	decodeBody(t, serve(t, r, "PUT", "/api/trainer/cycles/1", map[string]string{
+		"name": "  speed run ", "notes": "Under 10 seconds a puzzle",
+	}, "alice"), &cycle)
+	if cycle.Name != "speed run" || cycle.Notes != "Under 10 seconds a puzzle" {
+		t.Errorf("updated cycle = %q / %q, want the trimmed name and the notes", cycle.Name, cycle.Notes)
+	}
+
+	// Leaving notes out keeps them
+	decodeBody(t, serve(t, r, "PUT", "/api/trainer/cycles/1", map[string]string{"name": "sprint"}, "alice"), &cycle)
+	if cycle.Name != "sprint" || cycle.Notes != "Under 10 seconds a puzzle" {
+		t.Errorf("renamed cycle = %q / %q, want notes kept", cycle.Name, cycle.Notes)
+	}
+
+	var summaries []CycleSummary
+	decodeBody(t, serve(t, r, "GET", "/api/trainer/sets/1/cycles", nil, "alice"), &summaries)
+	if len(summaries) != 1 || summaries[0].Name != "sprint" || summaries[0].Notes != "Under 10 seconds a puzzle" {
+		t.Errorf("cycle list = %+v, want the name and notes", summaries)
+	}
+	var dashboard []struct {
+		ActiveCycle *CycleSummary `json:"active_cycle"`
+	}
+	decodeBody(t, serve(t, r, "GET", "/api/trainer/dashboard", nil, "alice"), &dashboard)
+	if len(dashboard) != 1 || dashboard[0].ActiveCycle == nil || dashboard[0].ActiveCycle.Name != "sprint" {
+		t.Errorf("dashboard = %+v, want the active cycle named sprint", dashboard)
+	}
+
+	for _, tt := range []struct {
+		path   string
+		userID string
+		status int
+	}{
+		{"/api/trainer/cycles/1", "bob", 403},
+		{"/api/trainer/cycles/9", "alice", 404},
+		{"/api/trainer/cycles/x", "alice", 400},
+		{"/api/trainer/cycles/1", "", 401},
+	} {
+		rec := serve(t, r, "PUT", tt.path, map[string]string{"name": "mine"}, tt.userID)
+		if rec.Code != tt.status {
+			t.Errorf("%s as %q: status %d, want %d", tt.path, tt.userID, rec.Code, tt.status)
+		}
+	}
+	var name string
+	if err := db.Get(&name, `SELECT name FROM cycles WHERE id = 1`); err != nil {
+		t.Fatal(err)
+	}
+	if name != "sprint" {
+		t.Errorf("name = %q after rejected updates, want sprint", name)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"woodpecker-online/internal/woodpecker"
+)
+
+func TestDailyRemaining(t *testing.T) {
+	r := newTestRouter(t)
+	for _, id := range []string{"p1", "p2", "p3"} {
+		seedPuzzle(t, id, "easy")
+	}
+	mustExec(t, `INSERT INTO daily_plans (user_id, daily_plan_json) VALUES
+		('alice', '{"difficulty":"easy","dailySize":3,"todayBatch":["p3","p1","p2"]}')`)
+	// Solved before today, so still due
+	mustExec(t, `INSERT INTO progress (user_id, puzzle_id, attempts, score, updated_at) VALUES ('alice', 'p1', 1, 5, '2020-01-01 00:00:00')`)
+
+	type remainingResponse struct {
+		Total     int               `json:"total"`
+		Remaining []RemainingPuzzle `json:"remaining"`
+	}
+	ids := func(resp remainingResponse) []string {
+		ids := []string{}
+		for _, p := range resp.Remaining {
+			ids = append(ids, p.ID)
+		}
+		return ids
+	}
+
+	var resp remainingResponse
+	decodeBody(t, serve(t, r, "GET", "/api/daily/remaining", nil, "alice"), &resp)
+	if got := ids(resp); resp.Total != 3 || len(got) != 3 || got[0] != "p3" || got[1] != "p1" || got[2] != "p2" {
+		t.Fatalf("remaining = %v of %d, want p3, p1, p2 of 3", got, resp.Total)
+	}
+	if p := resp.Remaining[0]; p.FEN != testPuzzleFEN || p.SideToMove != "w" {
+		t.Errorf("p3 = %+v, want its FEN with white to move", p)
+	}
+
+	// A wrong answer doesn't count as solved
+	serve(t, r, "POST", "/api/puzzles/grade-line", map[string]interface{}{"puzzleId": "p3", "typedSans": []string{"Ra7"}}, "alice")
+	serve(t, r, "POST", "/api/puzzles/grade-line", map[string]interface{}{"puzzleId": "p1", "typedSans": []string{"Ra8#"}}, "alice")
+
+	decodeBody(t, serve(t, r, "GET", "/api/daily/remaining", nil, "alice"), &resp)
+	if got := ids(resp); resp.Total != 3 || len(got) != 2 || got[0] != "p3" || got[1] != "p2" {
+		t.Errorf("after solving p1 remaining = %v of %d, want p3, p2 of 3", got, resp.Total)
+	}
+
+	// A skipped puzzle moves to the back of the queue
+	serve(t, r, "POST", "/api/puzzles/p3/skip", nil, "alice")
+	decodeBody(t, serve(t, r, "GET", "/api/daily/remaining", nil, "alice"), &resp)
+	if got := ids(resp); len(got) != 2 || got[0] != "p2" || got[1] != "p3" {
+		t.Errorf("after skipping p3 remaining = %v, want p2, p3", got)
+	}
+
+	if rec := serve(t, r, "GET", "/api/daily/remaining", nil, "bob"); rec.Code != 404 {
+		t.Errorf("user without a plan: status %d, want 404", rec.Code)
+	}
+}
+
+func TestDailyDifficulty(t *testing.T) {
+	tests := []struct {
+		name       string
+		userID     string
+		difficulty string
+		wantStatus int
+		wantStored string
+	}{
+		{"switch to intermediate", "alice", "intermediate", 200, "intermediate"},
+		{"switch to advanced", "alice", "advanced", 200, "advanced"},
+		{"mixed case", "alice", " Advanced ", 200, "advanced"},
+		{"invalid difficulty", "alice", "impossible", 400, "easy"},
+		{"empty difficulty", "alice", "", 400, "easy"},
+		{"anonymous", "", "intermediate", 401, "easy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRouter(t)
+			mustExec(t, `INSERT INTO daily_plans (user_id, daily_plan_json) VALUES
+				('alice', '{"difficulty":"easy","dailySize":3,"todayBatch":[]}')`)
+
+			rec := serve(t, r, "PUT", "/api/daily/difficulty", map[string]string{"difficulty": tt.difficulty}, tt.userID)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+
+			var planJSON string
+			if err := db.Get(&planJSON, `SELECT daily_plan_json FROM daily_plans WHERE user_id = 'alice'`); err != nil {
+				t.Fatal(err)
+			}
+			var plan woodpecker.DailyPlan
+			if err := json.Unmarshal([]byte(planJSON), &plan); err != nil {
+				t.Fatal(err)
+			}
+			if plan.Difficulty != tt.wantStored {
+				t.Errorf("stored difficulty = %q, want %q", plan.Difficulty, tt.wantStored)
+			}
+		})
+	}
+}
+
+func TestDailyPlanSummary(t *testing.T) {
+	r := newTestRouter(t)
+	for _, id := range []string{"p1", "p2", "p3"} {
+		seedPuzzle(t, id, "easy")
+	}
+	mustExec(t, `INSERT INTO daily_plans (user_id, daily_plan_json) VALUES
+		('alice', '{"difficulty":"easy","dailySize":3,"todayBatch":["p3","p1","p2"]}')`)
+	mustExec(t, `INSERT INTO progress (user_id, puzzle_id, attempts, score) VALUES ('alice', 'p1', 1, 10)`)
+
+	var summary DailyPlanSummary
+	decodeBody(t, serve(t, r, "GET", "/api/daily/plan", nil, "alice"), &summary)
+
+	service := woodpecker.NewService(db)
+	plan, err := service.GetOrCreateDailyPlan("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := service.GetDailyStatus("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := DailyPlanSummary{Difficulty: plan.Difficulty, TargetSize: status.PerDay, BatchSize: len(plan.TodayBatch)}
+	for _, id := range plan.TodayBatch {
+		if id != "p1" {
+			want.Remaining++
+		}
+	}
+	if summary != want {
+		t.Errorf("summary = %+v, want %+v from the stored plan", summary, want)
+	}
+}
+
+func TestDailyGoalOverrides(t *testing.T) {
+	tests := []struct {
+		name       string
+		updates    []map[string]interface{}
+		wantStatus int
+		wantGoals  map[string]int
+		wantMet    map[string]bool
+	}{
+		{"global goal only", []map[string]interface{}{
+			{"daily_goal_minutes": 20},
+		}, 200, map[string]int{"easy": 20, "intermediate": 20, "advanced": 20},
+			map[string]bool{"easy": true, "intermediate": false, "advanced": false}},
+		{"override raises one goal", []map[string]interface{}{
+			{"daily_goal_minutes": 20, "difficulty_goal_minutes": map[string]int{"easy": 30}},
+		}, 200, map[string]int{"easy": 30, "intermediate": 20, "advanced": 20},
+			map[string]bool{"easy": false, "intermediate": false, "advanced": false}},
+		{"zero goal is met", []map[string]interface{}{
+			{"daily_goal_minutes": 20, "difficulty_goal_minutes": map[string]int{"advanced": 0}},
+		}, 200, map[string]int{"easy": 20, "intermediate": 20, "advanced": 0},
+			map[string]bool{"easy": true, "intermediate": false, "advanced": true}},
+		{"difficulty name is normalized", []map[string]interface{}{
+			{"daily_goal_minutes": 20, "difficulty_goal_minutes": map[string]int{"Intermediate": 5}},
+		}, 200, map[string]int{"easy": 20, "intermediate": 5, "advanced": 20},
+			map[string]bool{"easy": true, "intermediate": true, "advanced": false}},
+		{"null removes an override", []map[string]interface{}{
+			{"daily_goal_minutes": 20, "difficulty_goal_minutes": map[string]int{"easy": 30}},
+			{"difficulty_goal_minutes": map[string]interface{}{"easy": nil}},
+		}, 200, map[string]int{"easy": 20, "intermediate": 20, "advanced": 20},
+			map[string]bool{"easy": true, "intermediate": false, "advanced": false}},
+		{"unknown difficulty", []map[string]interface{}{
+			{"difficulty_goal_minutes": map[string]int{"expert": 10}},
+		}, 400, nil, nil},
+		{"negative goal", []map[string]interface{}{
+			{"difficulty_goal_minutes": map[string]int{"easy": -1}},
+		}, 400, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRouter(t)
+			seedSession(t, 1, "alice")
+			seedPuzzle(t, "p1", "easy")
+			seedPuzzle(t, "p2", "intermediate")
+			// 25 minutes on easy and 10 on intermediate today
+			mustExec(t, `INSERT INTO attempts (session_id, puzzle_id, started_at, time_ms)
+				VALUES (1, 'p1', CURRENT_TIMESTAMP, 1500000), (1, 'p2', CURRENT_TIMESTAMP, 600000)`)
+
+			var rec *httptest.ResponseRecorder
+			for _, update := range tt.updates {
+				rec = serve(t, r, "PUT", "/api/me/settings", update, "alice")
+			}
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus != 200 {
+				return
+			}
+
+			var goal struct {
+				Difficulties []DifficultyGoalProgress `json:"difficulties"`
+			}
+			decodeBody(t, serve(t, r, "GET", "/api/daily/goal", nil, "alice"), &goal)
+			if len(goal.Difficulties) != len(tt.wantGoals) {
+				t.Fatalf("got %d difficulties, want %d", len(goal.Difficulties), len(tt.wantGoals))
+			}
+			for _, d := range goal.Difficulties {
+				if d.GoalMinutes != tt.wantGoals[d.Difficulty] || d.Met != tt.wantMet[d.Difficulty] {
+					t.Errorf("%s: goal %d (met: %v), want %d (met: %v)",
+						d.Difficulty, d.GoalMinutes, d.Met, tt.wantGoals[d.Difficulty], tt.wantMet[d.Difficulty])
+				}
+			}
+		})
+	}
+}
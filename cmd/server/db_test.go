@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestJournalModeSetting(t *testing.T) {
+	tests := []struct {
+		setting string
+		want    string
+	}{
+		{"", "wal"},
+		{"delete", "delete"},
+		{"TRUNCATE", "truncate"},
+		{"WAL)&_pragma=foreign_keys(0", "wal"},
+		{"bogus", "wal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.setting, func(t *testing.T) {
+			t.Setenv("DATABASE_PATH", filepath.Join(t.TempDir(), "test.db"))
+			t.Setenv("SQLITE_JOURNAL_MODE", tt.setting)
+
+			testDB, err := initDatabase()
+			if err != nil {
+				t.Fatalf("initDatabase: %v", err)
+			}
+			defer testDB.Close()
+
+			var mode string
+			if err := testDB.Get(&mode, `PRAGMA journal_mode`); err != nil {
+				t.Fatal(err)
+			}
+			if mode != tt.want {
+				t.Errorf("journal_mode = %q, want %q", mode, tt.want)
+			}
+		})
+	}
+}
+
+func TestConcurrentWrites(t *testing.T) {
+	for _, conns := range []string{"1", "4"} {
+		t.Run("max open conns "+conns, func(t *testing.T) {
+			t.Setenv("DATABASE_PATH", filepath.Join(t.TempDir(), "test.db"))
+			t.Setenv("DB_MAX_OPEN_CONNS", conns)
+
+			testDB, err := initDatabase()
+			if err != nil {
+				t.Fatalf("initDatabase: %v", err)
+			}
+			defer testDB.Close()
+
+			const writers, writes = 8, 25
+			var wg sync.WaitGroup
+			errs := make(chan error, writers*writes)
+			for w := 0; w < writers; w++ {
+				wg.Add(1)
+				go func(w int) {
+					defer wg.Done()
+					for i := 0; i < writes; i++ {
+						_, err := testDB.Exec(`INSERT INTO progress (user_id, puzzle_id, attempts, score) VALUES (?, ?, 1, 1)
+							ON CONFLICT(user_id, puzzle_id) DO UPDATE SET attempts = attempts + 1`,
+							fmt.Sprintf("user%d", w), fmt.Sprintf("p%d", i%5))
+						if err != nil {
+							errs <- err
+						}
+					}
+				}(w)
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				t.Errorf("concurrent write: %v", err)
+			}
+
+			var total int
+			if err := testDB.Get(&total, `SELECT SUM(attempts) FROM progress`); err != nil {
+				t.Fatal(err)
+			}
+			if total != writers*writes {
+				t.Errorf("recorded %d attempts, want %d", total, writers*writes)
+			}
+		})
+	}
+}
+
+func TestNormalizeTimestamps(t *testing.T) {
+	tests := []struct {
+		stored string
+		want   string
+	}{
+		{"2024-03-01T10:30:00Z", "2024-03-01 10:30:00"},
+		{"2024-03-01T12:30:00+02:00", "2024-03-01 10:30:00"},
+		{"2024-03-01T10:30:00.123456Z", "2024-03-01 10:30:00"},
+		{"2024-03-01 10:30:00", "2024-03-01 10:30:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.stored, func(t *testing.T) {
+			newTestDB(t)
+			mustExec(t, `INSERT INTO sets (id, user_id, name, description, difficulty_min, difficulty_max, created_at)
+				VALUES (1, 'alice', 'set', '', 'easy', 'easy', ?)`, tt.stored)
+
+			if err := normalizeTimestamps(db); err != nil {
+				t.Fatal(err)
+			}
+			var got string
+			if err := db.Get(&got, `SELECT CAST(created_at AS TEXT) FROM sets WHERE id = 1`); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("created_at = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"sync"
+
+	"woodpecker-online/internal/model"
+)
+
+// easySolution is the entry type produced by the generated SolutionsEasy
+type easySolution = struct {
+	Solution model.Solution
+	Ticks    []string
+}
+
+var (
+	easySolutionsOnce sync.Once
+	easySolutionsMap  map[string]easySolution
+)
+
+// CachedSolutionsEasy returns the SolutionsEasy mapping, building it only once.
+// SolutionsEasy is generated code and rebuilds the map on every call, so callers should use this instead.
+func CachedSolutionsEasy() map[string]easySolution {
+	easySolutionsOnce.Do(func() {
+		easySolutionsMap = SolutionsEasy()
+	})
+	return easySolutionsMap
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// TestEmbeddedSolutionsConcurrent checks that concurrent callers all get the same populated map.
+// Run with -race to catch unsynchronized initialization.
+func TestEmbeddedSolutionsConcurrent(t *testing.T) {
+	tests := []struct {
+		name string
+		load func() interface{}
+	}{
+		{"CachedSolutionsEasy", func() interface{} { return CachedSolutionsEasy() }},
+		{"SolutionsTextEasy", func() interface{} { return SolutionsTextEasy() }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const callers = 16
+			maps := make([]interface{}, callers)
+			var wg sync.WaitGroup
+			for i := 0; i < callers; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					maps[i] = tt.load()
+				}(i)
+			}
+			wg.Wait()
+
+			first := reflect.ValueOf(maps[0])
+			if first.Len() == 0 {
+				t.Fatal("map is empty")
+			}
+			for i, m := range maps {
+				if reflect.ValueOf(m).Pointer() != first.Pointer() {
+					t.Errorf("caller %d got a different map", i)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkSolutionsEasy builds the generated map on every call, for comparison with the cached accessor
+func BenchmarkSolutionsEasy(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = SolutionsEasy()
+	}
+}
+
+// BenchmarkCachedSolutionsEasy shows repeated calls return the cached map without rebuilding it
+func BenchmarkCachedSolutionsEasy(b *testing.B) {
+	CachedSolutionsEasy()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = CachedSolutionsEasy()
+	}
+}
+
+// BenchmarkSolutionsTextEasy shows repeated calls don't unmarshal the embedded JSON again
+func BenchmarkSolutionsTextEasy(b *testing.B) {
+	SolutionsTextEasy()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = SolutionsTextEasy()
+	}
+}
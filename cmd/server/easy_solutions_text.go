@@ -3,6 +3,8 @@ package main
 import (
 	_ "embed"
 	"encoding/json"
+	"fmt"
+	"log/slog"
 	"strings"
 	"sync"
 )
@@ -13,6 +15,9 @@ var easySolutionsTextJSON []byte
 var (
 	easySolutionsTextOnce sync.Once
 	easySolutionsTextMap  map[string]string
+	// solutionTextLoadErr is set when the embedded solution text can't be parsed, in which case
+	// SolutionsTextEasy returns an empty map
+	solutionTextLoadErr error
 )
 
 // SolutionsTextEasy returns a mapping from Woodpecker Easy ID (wpm_easy_001..wpm_easy_222) to solution text descriptions.
@@ -20,7 +25,9 @@ func SolutionsTextEasy() map[string]string {
 	easySolutionsTextOnce.Do(func() {
 		m := make(map[string]string)
 		if err := json.Unmarshal(easySolutionsTextJSON, &m); err != nil {
-			easySolutionsTextMap = m
+			solutionTextLoadErr = fmt.Errorf("parse easy_solutions_text.json: %w", err)
+			slog.Error("Failed to load solution text; solution text endpoints will fail", "error", solutionTextLoadErr)
+			easySolutionsTextMap = map[string]string{}
 			return
 		}
 		// Trim wpm_easy_222 if it contains spillover from next chapter
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// loadSolutionText reparses data as the embedded solution text, restoring the real text afterwards
+func loadSolutionText(t *testing.T, data []byte) {
+	t.Helper()
+	previous := easySolutionsTextJSON
+	reset := func() {
+		easySolutionsTextOnce = sync.Once{}
+		easySolutionsTextMap = nil
+		solutionTextLoadErr = nil
+	}
+	easySolutionsTextJSON = data
+	reset()
+	t.Cleanup(func() {
+		easySolutionsTextJSON = previous
+		reset()
+	})
+}
+
+func TestSolutionTextLoadError(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		path   string
+		status int
+	}{
+		{"valid text", []byte(`{"wpm_easy_001": "1.Ra8#"}`), "/api/puzzles/solution-text/wpm_easy_001", 200},
+		{"valid text, unknown puzzle", []byte(`{"wpm_easy_001": "1.Ra8#"}`), "/api/puzzles/solution-text/wpm_easy_002", 404},
+		{"broken text", []byte(`{"wpm_easy_001": `), "/api/puzzles/solution-text/wpm_easy_001", 500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loadSolutionText(t, tt.data)
+			r := newTestRouter(t)
+
+			if rec := serve(t, r, "GET", tt.path, nil, ""); rec.Code != tt.status {
+				t.Errorf("status %d, want %d: %s", rec.Code, tt.status, rec.Body.String())
+			}
+			if broken := solutionTextLoadErr != nil; broken != (tt.status == 500) {
+				t.Errorf("load error = %v", solutionTextLoadErr)
+			}
+		})
+	}
+}
+
+func TestSolutionTextBatch(t *testing.T) {
+	loadSolutionText(t, []byte(`{"wpm_easy_001": "1.Ra8#", "wpm_easy_002": "1.Qh7+ Kf8 2.Qh8#"}`))
+	r := newTestRouter(t)
+
+	var texts map[string]string
+	decodeBody(t, serve(t, r, "POST", "/api/puzzles/solution-text/batch", map[string][]string{
+		"ids": {"wpm_easy_002", "wpm_easy_999", "wpm_easy_001"},
+	}, ""), &texts)
+	want := map[string]string{"wpm_easy_001": "1.Ra8#", "wpm_easy_002": "1.Qh7+ Kf8 2.Qh8#"}
+	if !reflect.DeepEqual(texts, want) {
+		t.Errorf("texts = %v, want %v", texts, want)
+	}
+
+	tooMany := make([]string, maxSolutionTextBatch+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("wpm_easy_%03d", i)
+	}
+	for name, ids := range map[string][]string{"empty": {}, "over the cap": tooMany} {
+		if rec := serve(t, r, "POST", "/api/puzzles/solution-text/batch", map[string][]string{"ids": ids}, ""); rec.Code != 400 {
+			t.Errorf("%s: status %d, want 400", name, rec.Code)
+		}
+	}
+}
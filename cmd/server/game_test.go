@@ -0,0 +1,448 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// algebraicMove converts squares like "e2", "e4" to a Move on the game board, which has rank 8 in row 0
+func algebraicMove(from, to string) Move {
+	return Move{
+		FromRow: int('8' - from[1]), FromCol: int(from[0] - 'a'),
+		ToRow: int('8' - to[1]), ToCol: int(to[0] - 'a'),
+	}
+}
+
+func TestGameMaterial(t *testing.T) {
+	tests := []struct {
+		name          string
+		moves         [][2]string
+		white, black  int
+		difference    int
+		whiteCaptured map[PieceType]int
+		blackCaptured map[PieceType]int
+	}{
+		{"start position", nil, 39, 39, 0, map[PieceType]int{}, map[PieceType]int{}},
+		{
+			"queen trade after winning a pawn",
+			// 1. d4 e5 2. dxe5 d6 3. exd6 Qxd6 4. Qxd6 cxd6
+			[][2]string{{"d2", "d4"}, {"e7", "e5"}, {"d4", "e5"}, {"d7", "d6"}, {"e5", "d6"}, {"d8", "d6"}, {"d1", "d6"}, {"c7", "d6"}},
+			29, 28, 1,
+			map[PieceType]int{Pawn: 2, Queen: 1},
+			map[PieceType]int{Pawn: 1, Queen: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRouter(t)
+			initializeGame()
+
+			for _, m := range tt.moves {
+				if rec := serve(t, r, "POST", "/api/move", algebraicMove(m[0], m[1]), ""); rec.Code != 200 {
+					t.Fatalf("move %s-%s: status %d: %s", m[0], m[1], rec.Code, rec.Body.String())
+				}
+			}
+
+			var balance MaterialBalance
+			decodeBody(t, serve(t, r, "GET", "/api/game/material", nil, ""), &balance)
+			if balance.White.Material != tt.white || balance.Black.Material != tt.black || balance.Difference != tt.difference {
+				t.Errorf("material = %d v %d (%+d), want %d v %d (%+d)",
+					balance.White.Material, balance.Black.Material, balance.Difference, tt.white, tt.black, tt.difference)
+			}
+			if !reflect.DeepEqual(balance.White.Captured, tt.whiteCaptured) || !reflect.DeepEqual(balance.Black.Captured, tt.blackCaptured) {
+				t.Errorf("captured = %v / %v, want %v / %v",
+					balance.White.Captured, balance.Black.Captured, tt.whiteCaptured, tt.blackCaptured)
+			}
+			if want := 39 - tt.black; balance.White.CapturedValue != want {
+				t.Errorf("white captured value = %d, want %d", balance.White.CapturedValue, want)
+			}
+		})
+	}
+}
+
+func TestResign(t *testing.T) {
+	r := newTestRouter(t)
+	initializeGame()
+	if rec := serve(t, r, "POST", "/api/move", algebraicMove("e2", "e4"), ""); rec.Code != 200 {
+		t.Fatalf("move: status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var state ChessGame
+	decodeBody(t, serve(t, r, "POST", "/api/game/resign", nil, ""), &state)
+	if !state.GameOver || state.GameResult != "resignation" || state.Winner != "white" {
+		t.Errorf("after black resigns: over %v, result %q, winner %q", state.GameOver, state.GameResult, state.Winner)
+	}
+
+	if rec := serve(t, r, "POST", "/api/move", algebraicMove("e7", "e5"), ""); rec.Code != 400 {
+		t.Errorf("move after resignation: status %d, want 400", rec.Code)
+	}
+	if rec := serve(t, r, "POST", "/api/game/resign", nil, ""); rec.Code != 400 {
+		t.Errorf("second resignation: status %d, want 400", rec.Code)
+	}
+}
+
+func TestDrawOfferResponses(t *testing.T) {
+	tests := []struct {
+		name       string
+		action     string
+		moveFirst  bool
+		wantStatus int
+		wantOver   bool
+	}{
+		{"offerer can't accept", "accept", false, 409, false},
+		{"offerer can't decline", "decline", false, 409, false},
+		{"opponent accepts", "accept", true, 200, true},
+		{"opponent declines", "decline", true, 200, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRouter(t)
+			initializeGame()
+
+			if rec := serve(t, r, "POST", "/api/game/draw", map[string]string{"action": "offer"}, ""); rec.Code != 200 {
+				t.Fatalf("offer: status %d: %s", rec.Code, rec.Body.String())
+			}
+			if tt.moveFirst {
+				if rec := serve(t, r, "POST", "/api/move", algebraicMove("e2", "e4"), ""); rec.Code != 200 {
+					t.Fatalf("move: status %d: %s", rec.Code, rec.Body.String())
+				}
+			}
+
+			rec := serve(t, r, "POST", "/api/game/draw", map[string]string{"action": tt.action}, "")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if game.GameOver != tt.wantOver {
+				t.Errorf("game over = %v, want %v", game.GameOver, tt.wantOver)
+			}
+			if tt.wantOver && game.GameResult != "agreed-draw" {
+				t.Errorf("result = %q, want agreed-draw", game.GameResult)
+			}
+		})
+	}
+}
+
+func TestMoveDeclinesDrawOffer(t *testing.T) {
+	r := newTestRouter(t)
+	initializeGame()
+	serve(t, r, "POST", "/api/game/draw", map[string]string{"action": "offer"}, "")
+	serve(t, r, "POST", "/api/move", algebraicMove("e2", "e4"), "")
+	if game.DrawOfferedBy != "white" {
+		t.Fatalf("offerer's own move withdrew the offer")
+	}
+	serve(t, r, "POST", "/api/move", algebraicMove("e7", "e5"), "")
+	if game.DrawOfferedBy != "" {
+		t.Errorf("offer still pending from %q after the opponent moved", game.DrawOfferedBy)
+	}
+}
+
+func TestGameMobility(t *testing.T) {
+	r := newTestRouter(t)
+	initializeGame()
+
+	var mobility map[string]int
+	decodeBody(t, serve(t, r, "GET", "/api/game/mobility", nil, ""), &mobility)
+	if mobility["white"] != 20 || mobility["black"] != 20 {
+		t.Errorf("start position mobility = %v, want 20 each", mobility)
+	}
+
+	serve(t, r, "POST", "/api/move", algebraicMove("e2", "e4"), "")
+	decodeBody(t, serve(t, r, "GET", "/api/game/mobility", nil, ""), &mobility)
+	if mobility["white"] != 30 || mobility["black"] != 20 {
+		t.Errorf("after 1. e4 mobility = %v, want white 30, black 20", mobility)
+	}
+}
+
+func TestReplayLoadedFEN(t *testing.T) {
+	r := newTestRouter(t)
+	game = ChessGame{}
+	initializeGame()
+
+	rec := serve(t, r, "POST", "/api/game/replay", nil, "")
+	if rec.Code != 409 || !strings.Contains(rec.Body.String(), "No FEN has been loaded") {
+		t.Errorf("replay without a load: status %d %q, want 409 explaining why", rec.Code, rec.Body.String())
+	}
+
+	fen := "r3k3/8/8/8/8/8/5PPP/6K1 b q - 0 1"
+	if rec := serve(t, r, "POST", "/api/load-fen", map[string]string{"fen": fen}, ""); rec.Code != 200 {
+		t.Fatalf("load-fen: status %d: %s", rec.Code, rec.Body.String())
+	}
+	loaded := game.Board
+
+	// Play on to a finished game, then replay
+	if rec := serve(t, r, "POST", "/api/move", algebraicMove("a8", "a1"), ""); rec.Code != 200 {
+		t.Fatalf("move: status %d: %s", rec.Code, rec.Body.String())
+	}
+	serve(t, r, "POST", "/api/game/resign", nil, "")
+
+	var state ChessGame
+	decodeBody(t, serve(t, r, "POST", "/api/game/replay", nil, ""), &state)
+	if !reflect.DeepEqual(state.Board, loaded) {
+		t.Error("replay did not restore the loaded position")
+	}
+	if state.CurrentPlayer != "black" || state.GameOver || state.GameResult != "" || len(state.MoveHistory) != 0 {
+		t.Errorf("replayed game = to move %s, over %v, result %q, %d moves; want a fresh game with black to move",
+			state.CurrentPlayer, state.GameOver, state.GameResult, len(state.MoveHistory))
+	}
+	if state.LoadedFEN != fen {
+		t.Errorf("loaded FEN = %q, want %q", state.LoadedFEN, fen)
+	}
+
+	if rec := serve(t, r, "POST", "/api/load-fen", map[string]string{"fen": "8/8/8 w - - 0 1"}, ""); rec.Code != 400 {
+		t.Errorf("invalid FEN: status %d, want 400", rec.Code)
+	}
+	if game.LoadedFEN != fen {
+		t.Errorf("invalid load replaced the replay FEN with %q", game.LoadedFEN)
+	}
+}
+
+func TestLoadFinishedPosition(t *testing.T) {
+	tests := []struct {
+		name   string
+		fen    string
+		result string
+		winner string
+	}{
+		{"checkmate", "rnb1kbnr/pppp1ppp/8/4p3/6Pq/5P2/PPPPP2P/RNBQKBNR w KQkq - 1 3", "checkmate", "black"},
+		{"stalemate", "7k/5Q2/6K1/8/8/8/8/8 b - - 0 1", "stalemate", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRouter(t)
+			game = ChessGame{}
+			initializeGame()
+
+			var state ChessGame
+			decodeBody(t, serve(t, r, "POST", "/api/load-fen", map[string]string{"fen": tt.fen}, ""), &state)
+			if !state.GameOver || state.GameResult != tt.result || state.Winner != tt.winner {
+				t.Errorf("loaded game = over %v, result %q, winner %q; want over, %q, %q",
+					state.GameOver, state.GameResult, state.Winner, tt.result, tt.winner)
+			}
+
+			rec := serve(t, r, "POST", "/api/move", algebraicMove("e2", "e3"), "")
+			if rec.Code != 400 || !strings.Contains(strings.ToLower(rec.Body.String()), "game is over") {
+				t.Errorf("move: status %d %q, want 400 game is over", rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestDrawClaims(t *testing.T) {
+	knightShuffle := [][2]string{{"g1", "f3"}, {"g8", "f6"}, {"f3", "g1"}, {"f6", "g8"}}
+	tests := []struct {
+		name  string
+		fen   string
+		moves [][2]string
+		want  DrawClaims
+	}{
+		{"fifty-move claim", "8/8/8/4k3/8/8/4K3/R7 w - - 99 80", [][2]string{{"a1", "a2"}},
+			DrawClaims{FiftyMove: true, Repetitions: 1, HalfmoveClock: 100}},
+		{"one ply short of fifty moves", "8/8/8/4k3/8/8/4K3/R7 w - - 98 80", [][2]string{{"a1", "a2"}},
+			DrawClaims{Repetitions: 1, HalfmoveClock: 99}},
+		{"pawn move resets the clock", "8/8/8/4k3/8/8/P3K3/8 w - - 99 80", [][2]string{{"a2", "a3"}},
+			DrawClaims{Repetitions: 1, HalfmoveClock: 0}},
+		{"position repeated twice", "", knightShuffle,
+			DrawClaims{Repetitions: 2, HalfmoveClock: 4}},
+		{"threefold repetition", "", append(append([][2]string{}, knightShuffle...), knightShuffle...),
+			DrawClaims{Threefold: true, Repetitions: 3, HalfmoveClock: 8}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRouter(t)
+			game = ChessGame{}
+			initializeGame()
+			if tt.fen != "" {
+				if rec := serve(t, r, "POST", "/api/load-fen", map[string]string{"fen": tt.fen}, ""); rec.Code != 200 {
+					t.Fatalf("load-fen: status %d: %s", rec.Code, rec.Body.String())
+				}
+			}
+			for _, m := range tt.moves {
+				if rec := serve(t, r, "POST", "/api/move", algebraicMove(m[0], m[1]), ""); rec.Code != 200 {
+					t.Fatalf("move %s-%s: status %d: %s", m[0], m[1], rec.Code, rec.Body.String())
+				}
+			}
+
+			var claims DrawClaims
+			decodeBody(t, serve(t, r, "GET", "/api/game/draw-claims", nil, ""), &claims)
+			if claims != tt.want {
+				t.Errorf("claims = %+v, want %+v", claims, tt.want)
+			}
+		})
+	}
+}
+
+// replayPGN resolves a PGN's movetext from its start position, returning the moves it holds
+func replayPGN(t *testing.T, pgn string) []Move {
+	t.Helper()
+	fen := standardStartFEN
+	var movetext []string
+	for _, line := range strings.Split(pgn, "\n") {
+		if strings.HasPrefix(line, "[FEN ") {
+			fen = strings.Trim(strings.TrimPrefix(line, "[FEN "), `"]`)
+		} else if !strings.HasPrefix(line, "[") {
+			movetext = append(movetext, strings.Fields(line)...)
+		}
+	}
+
+	pos := mustParseFEN(t, fen)
+	var moves []Move
+	for _, token := range movetext {
+		if strings.HasSuffix(token, ".") || token == "*" || token == "1-0" || token == "0-1" || token == "1/2-1/2" {
+			continue
+		}
+		move, err := resolveSAN(pos, token)
+		if err != nil {
+			t.Fatalf("PGN move %q doesn't resolve: %v\n%s", token, err, pgn)
+		}
+		moves = append(moves, move)
+		pos = pos.applyMove(move)
+	}
+	return moves
+}
+
+func TestGamePGN(t *testing.T) {
+	r := newTestRouter(t)
+	game = ChessGame{}
+	initializeGame()
+	play := func(m [2]string) {
+		if rec := serve(t, r, "POST", "/api/move", algebraicMove(m[0], m[1]), ""); rec.Code != 200 {
+			t.Fatalf("move %s-%s: status %d: %s", m[0], m[1], rec.Code, rec.Body.String())
+		}
+	}
+	moves := [][2]string{{"f2", "f3"}, {"e7", "e5"}, {"g2", "g4"}, {"d8", "h4"}}
+	for _, m := range moves[:3] {
+		play(m)
+	}
+
+	if pgn := serve(t, r, "GET", "/api/game/pgn", nil, "").Body.String(); !strings.Contains(pgn, `[Result "*"]`) {
+		t.Errorf("game in progress isn't tagged *:\n%s", pgn)
+	}
+
+	// Qh4# ends the game
+	play(moves[3])
+	rec := serve(t, r, "GET", "/api/game/pgn", nil, "")
+	pgn := rec.Body.String()
+	for _, tag := range []string{`[Event "?"]`, `[Site "?"]`, `[Date "????.??.??"]`, `[Round "?"]`, `[White "?"]`, `[Black "?"]`, `[Result "0-1"]`} {
+		if !strings.Contains(pgn, tag+"\n") {
+			t.Errorf("PGN is missing %s:\n%s", tag, pgn)
+		}
+	}
+	if strings.Contains(pgn, "[FEN ") {
+		t.Errorf("game from the start position has a FEN tag:\n%s", pgn)
+	}
+	if !strings.HasSuffix(pgn, " 0-1\n") {
+		t.Errorf("movetext doesn't end with the result:\n%s", pgn)
+	}
+	if replayed := replayPGN(t, pgn); len(replayed) != len(moves) {
+		t.Errorf("PGN replays %d moves, want %d", len(replayed), len(moves))
+	}
+}
+
+func TestGamePGNFromFEN(t *testing.T) {
+	r := newTestRouter(t)
+	game = ChessGame{}
+	initializeGame()
+	fen := "4k3/8/8/8/8/8/4P3/4K3 b - - 0 12"
+	serve(t, r, "POST", "/api/load-fen", map[string]string{"fen": fen}, "")
+	serve(t, r, "POST", "/api/move", algebraicMove("e8", "d8"), "")
+	serve(t, r, "POST", "/api/move", algebraicMove("e2", "e4"), "")
+
+	pgn := serve(t, r, "GET", "/api/game/pgn", nil, "").Body.String()
+	if !strings.Contains(pgn, `[SetUp "1"]`) || !strings.Contains(pgn, `[FEN "`+fen+`"]`) {
+		t.Errorf("PGN from a loaded position lacks SetUp and FEN tags:\n%s", pgn)
+	}
+	if !strings.Contains(pgn, "12... Kd8 13. e4 *") {
+		t.Errorf("movetext isn't numbered from the FEN:\n%s", pgn)
+	}
+	if moves := replayPGN(t, pgn); len(moves) != 2 {
+		t.Errorf("PGN replays %d moves, want 2", len(moves))
+	}
+}
+
+func TestLoadPartialFEN(t *testing.T) {
+	r := newTestRouter(t)
+	game = ChessGame{}
+	initializeGame()
+	if rec := serve(t, r, "POST", "/api/load-fen", map[string]string{"fen": "4k3/8/8/8/8/8/4P3/4K3 b"}, ""); rec.Code != 200 {
+		t.Fatalf("load-fen: status %d: %s", rec.Code, rec.Body.String())
+	}
+	if game.CurrentPlayer != "black" || game.HalfmoveClock != 0 || game.StartFEN != "4k3/8/8/8/8/8/4P3/4K3 b - - 0 1" {
+		t.Errorf("loaded %s to move, clock %d, start %q", game.CurrentPlayer, game.HalfmoveClock, game.StartFEN)
+	}
+}
+
+func TestMoveCoordinateBounds(t *testing.T) {
+	r := newTestRouter(t)
+	game = ChessGame{}
+	initializeGame()
+	tests := []struct {
+		name string
+		move Move
+		want string
+	}{
+		{"negative row", Move{FromRow: -1, FromCol: 4, ToRow: 4, ToCol: 4}, "fromRow must be between 0 and 7, got -1"},
+		{"negative column", Move{FromRow: 6, FromCol: 4, ToRow: 4, ToCol: -3}, "toCol must be between 0 and 7, got -3"},
+		{"row past the board", Move{FromRow: 6, FromCol: 4, ToRow: 8, ToCol: 4}, "toRow must be between 0 and 7, got 8"},
+		{"huge column", Move{FromRow: 6, FromCol: 1 << 40, ToRow: 4, ToCol: 4}, "fromCol must be between 0 and 7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(t, r, "POST", "/api/move", tt.move, "")
+			if rec.Code != 400 || !strings.Contains(rec.Body.String(), tt.want) {
+				t.Errorf("status %d %q, want 400 with %q", rec.Code, rec.Body.String(), tt.want)
+			}
+		})
+	}
+	if len(game.MoveHistory) != 0 {
+		t.Errorf("out-of-range moves changed the game: %v", game.MoveHistory)
+	}
+	if err := algebraicMove("a1", "h8").Validate(); err != nil {
+		t.Errorf("corner-to-corner move rejected: %v", err)
+	}
+}
+
+func TestGameOverSummary(t *testing.T) {
+	tests := []struct {
+		name       string
+		moves      [][2]string
+		resign     bool // the player to move resigns after the moves
+		winner     string
+		reason     string
+		moveCount  int
+		difference int
+	}{
+		// 1. f3 e5 2. g4 Qh4#
+		{"fool's mate", [][2]string{{"f2", "f3"}, {"e7", "e5"}, {"g2", "g4"}, {"d8", "h4"}}, false, "black", "checkmate", 4, 0},
+		// 1. e4 d5 2. exd5, then black resigns a pawn down
+		{"resignation", [][2]string{{"e2", "e4"}, {"d7", "d5"}, {"e4", "d5"}}, true, "white", "resignation", 3, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRouter(t)
+			game = ChessGame{}
+			initializeGame()
+
+			var state ChessGame
+			for _, m := range tt.moves {
+				decodeBody(t, serve(t, r, "POST", "/api/move", algebraicMove(m[0], m[1]), ""), &state)
+			}
+			if tt.resign {
+				decodeBody(t, serve(t, r, "POST", "/api/game/resign", nil, ""), &state)
+			}
+
+			result := state.Result
+			if !state.GameOver || result == nil {
+				t.Fatalf("game over %v with result %+v, want a summary", state.GameOver, result)
+			}
+			if result.Winner != tt.winner || result.Reason != tt.reason || result.Moves != tt.moveCount {
+				t.Errorf("result = %s by %s after %d moves, want %s by %s after %d",
+					result.Winner, result.Reason, result.Moves, tt.winner, tt.reason, tt.moveCount)
+			}
+			if result.Material.Difference != tt.difference || result.Material.White.CapturedValue != tt.difference {
+				t.Errorf("material = %+v, want white %d up from captures", result.Material, tt.difference)
+			}
+		})
+	}
+}
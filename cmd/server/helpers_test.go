@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"woodpecker-online/internal/auth"
+)
+
+// newTestDB points the package db at a fresh in-memory database with the full schema
+func newTestDB(t *testing.T) {
+	t.Helper()
+	t.Setenv("DATABASE_PATH", ":memory:")
+	t.Setenv("DB_MAX_OPEN_CONNS", "1")
+
+	testDB, err := initDatabase()
+	if err != nil {
+		t.Fatalf("initDatabase: %v", err)
+	}
+	previous, previousCache := db, cachedPuzzles
+	db = testDB
+	// Tests that want the cache enable it themselves, after this
+	cachedPuzzles = nil
+	t.Cleanup(func() {
+		testDB.Close()
+		db, cachedPuzzles = previous, previousCache
+	})
+}
+
+// newTestRouter returns the API routes on a fresh in-memory database, set up as in main
+func newTestRouter(t *testing.T) http.Handler {
+	t.Helper()
+	newTestDB(t)
+
+	r := mux.NewRouter()
+	r.MethodNotAllowedHandler = methodNotAllowedHandler(r)
+	r.NotFoundHandler = r.MethodNotAllowedHandler
+	r.Use(ResolveClientAddr)
+	r.Use(LimitRequestBody)
+	setupAPIRoutes(r.PathPrefix("/api").Subrouter())
+	return TrimTrailingSlash(r)
+}
+
+// newRequest builds a request with body encoded as JSON, signed in as userID unless it is empty
+func newRequest(t *testing.T, method, path string, body interface{}, userID string) *http.Request {
+	t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if userID != "" {
+		token, err := auth.GenerateJWT(userID, userID+"@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.AddCookie(&http.Cookie{Name: "auth_token", Value: token})
+	}
+	return req
+}
+
+// serve sends a request built by newRequest and records the response
+func serve(t *testing.T, h http.Handler, method, path string, body interface{}, userID string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, newRequest(t, method, path, body, userID))
+	return rec
+}
+
+// decodeBody decodes a JSON response into dst, failing the test on a non-2xx status
+func decodeBody(t *testing.T, rec *httptest.ResponseRecorder, dst interface{}) {
+	t.Helper()
+	if rec.Code < 200 || rec.Code >= 300 {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), dst); err != nil {
+		t.Fatalf("decode %q: %v", rec.Body.String(), err)
+	}
+}
+
+// mustExec runs a statement against the test database
+func mustExec(t *testing.T, query string, args ...interface{}) {
+	t.Helper()
+	if _, err := db.Exec(query, args...); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+}
+
+// seedSession inserts a set owned by userID with one active cycle and an open session, with the
+// given ID used for all three
+func seedSession(t *testing.T, id int, userID string) {
+	t.Helper()
+	mustExec(t, `INSERT INTO sets (id, user_id, name, description, difficulty_min, difficulty_max, created_at)
+		VALUES (?, ?, 'set', '', 'easy', 'easy', CURRENT_TIMESTAMP)`, id, userID)
+	mustExec(t, `INSERT INTO cycles (id, set_id, cycle_index, target_days, status) VALUES (?, ?, 1, 7, 'active')`, id, id)
+	mustExec(t, `INSERT INTO sessions (id, cycle_id, target_count, started_at) VALUES (?, ?, 10, CURRENT_TIMESTAMP)`, id, id)
+}
+
+// testPuzzleFEN is a back-rank mate in one: white plays Ra8#
+const testPuzzleFEN = "6k1/5ppp/8/8/8/8/8/R3K3 w Q - 0 1"
+
+// seedPuzzle inserts a puzzle whose solution is the single move Ra8#
+func seedPuzzle(t *testing.T, id, difficulty string) {
+	t.Helper()
+	mustExec(t, `INSERT INTO puzzles (id, difficulty, fen, side_to_move, solution_json, ticks_json)
+		VALUES (?, ?, ?, 'w', '{"lines":[{"san":"Ra8#"}]}', '[]')`, id, difficulty, testPuzzleFEN)
+}
+
+// intPtr returns a pointer to i, for comparing optional fields
+func intPtr(i int) *int { return &i }
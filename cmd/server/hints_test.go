@@ -0,0 +1,193 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+// seedHintPuzzle inserts a puzzle whose main line is Ra7 h6 Ra8+
+func seedHintPuzzle(t *testing.T) {
+	t.Helper()
+	mustExec(t, `INSERT INTO puzzles (id, difficulty, fen, side_to_move, solution_json, ticks_json)
+		VALUES ('p1', 'easy', ?, 'w', '{"lines":[{"san":"Ra7"},{"san":"h6"},{"san":"Ra8+"}]}', '[]')`, testPuzzleFEN)
+}
+
+// requestHint asks for a hint on p1 as alice after the played moves
+func requestHint(t *testing.T, r http.Handler, played []string) HintResponse {
+	t.Helper()
+	var hint HintResponse
+	decodeBody(t, serve(t, r, "POST", "/api/puzzles/p1/hint", map[string][]string{"playedSans": played}, "alice"), &hint)
+	return hint
+}
+
+func TestProgressiveHints(t *testing.T) {
+	r := newTestRouter(t)
+	seedHintPuzzle(t)
+
+	want := []HintResponse{
+		{PuzzleID: "p1", Ply: 0, Level: 1, PieceType: Rook},
+		{PuzzleID: "p1", Ply: 0, Level: 2, PieceType: Rook, FromSquare: "a1"},
+		{PuzzleID: "p1", Ply: 0, Level: 3, PieceType: Rook, FromSquare: "a1", ToSquare: "a7", Move: "Ra7"},
+		// The full move stays revealed on further calls
+		{PuzzleID: "p1", Ply: 0, Level: 3, PieceType: Rook, FromSquare: "a1", ToSquare: "a7", Move: "Ra7"},
+	}
+	for i, w := range want {
+		if got := requestHint(t, r, nil); got != w {
+			t.Errorf("hint %d = %+v, want %+v", i+1, got, w)
+		}
+	}
+}
+
+func TestHintsForPartialLines(t *testing.T) {
+	tests := []struct {
+		name   string
+		played []string
+		want   []HintResponse
+	}{
+		{"after the first exchange", []string{"Ra7", "h6"}, []HintResponse{
+			{PuzzleID: "p1", Ply: 2, Level: 1, PieceType: Rook},
+			{PuzzleID: "p1", Ply: 2, Level: 2, PieceType: Rook, FromSquare: "a7"},
+			{PuzzleID: "p1", Ply: 2, Level: 3, PieceType: Rook, FromSquare: "a7", ToSquare: "a8", Move: "Ra8+"},
+		}},
+		{"a move off the main line", []string{"Ra7", "h5", "Ra8+"}, []HintResponse{
+			{PuzzleID: "p1", Ply: 1, Level: 1, PieceType: Pawn},
+			{PuzzleID: "p1", Ply: 1, Level: 2, PieceType: Pawn, FromSquare: "h7"},
+			{PuzzleID: "p1", Ply: 1, Level: 3, PieceType: Pawn, FromSquare: "h7", ToSquare: "h6", Move: "h6"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRouter(t)
+			seedHintPuzzle(t)
+			for i, w := range tt.want {
+				if got := requestHint(t, r, tt.played); got != w {
+					t.Errorf("hint %d = %+v, want %+v", i+1, got, w)
+				}
+			}
+		})
+	}
+}
+
+func TestHintsAreRecordedAndReset(t *testing.T) {
+	r := newTestRouter(t)
+	seedHintPuzzle(t)
+
+	requestHint(t, r, nil)
+	requestHint(t, r, nil)
+	var recorded int
+	if err := db.Get(&recorded, `SELECT COUNT(*) FROM hints WHERE user_id = 'alice' AND puzzle_id = 'p1'`); err != nil {
+		t.Fatal(err)
+	}
+	if recorded != 2 {
+		t.Errorf("%d hints recorded, want 2", recorded)
+	}
+
+	// Grading the puzzle starts the hints over
+	mustExec(t, `INSERT INTO progress (user_id, puzzle_id, updated_at) VALUES ('alice', 'p1', datetime('now', '+1 second'))`)
+	if got := requestHint(t, r, nil); got.Level != 1 {
+		t.Errorf("hint after grading has level %d, want 1", got.Level)
+	}
+}
+
+func TestHintErrors(t *testing.T) {
+	r := newTestRouter(t)
+	seedHintPuzzle(t)
+
+	if rec := serve(t, r, "POST", "/api/puzzles/p1/hint", map[string][]string{"playedSans": {"Ra7", "h6", "Ra8+"}}, "alice"); rec.Code != 400 {
+		t.Errorf("solved line: status %d, want 400", rec.Code)
+	}
+	if rec := serve(t, r, "POST", "/api/puzzles/nope/hint", map[string][]string{}, "alice"); rec.Code != 404 {
+		t.Errorf("missing puzzle: status %d, want 404", rec.Code)
+	}
+
+	mustExec(t, `INSERT INTO puzzles (id, difficulty, fen, side_to_move, solution_json, ticks_json)
+		VALUES ('bad', 'easy', ?, 'w', '{"lines":[{"san":"Qd8"}]}', '[]')`, testPuzzleFEN)
+	if rec := serve(t, r, "POST", "/api/puzzles/bad/hint", map[string][]string{}, "alice"); rec.Code != 422 {
+		t.Errorf("unplayable solution: status %d, want 422", rec.Code)
+	}
+}
+
+func TestScorePuzzle(t *testing.T) {
+	previous := hintPenalty
+	t.Cleanup(func() { hintPenalty = previous })
+
+	tests := []struct {
+		penalty      int
+		correct      bool
+		ticksMatched int
+		hintsUsed    int
+		want         int
+	}{
+		{1, true, 2, 0, 3},
+		{1, true, 2, 1, 2},
+		{1, true, 2, 2, 1},
+		{1, true, 2, 3, 0},
+		{1, true, 2, 6, 0},
+		{2, true, 2, 1, 1},
+		{2, true, 0, 3, 0},
+		{1, false, 2, 0, 0},
+	}
+	for _, tt := range tests {
+		hintPenalty = tt.penalty
+		if got := ScorePuzzle(tt.correct, tt.ticksMatched, tt.hintsUsed); got != tt.want {
+			t.Errorf("penalty %d: ScorePuzzle(%v, %d, %d) = %d, want %d",
+				tt.penalty, tt.correct, tt.ticksMatched, tt.hintsUsed, got, tt.want)
+		}
+	}
+}
+
+func TestGradeLineHintPenaltyIsComputedFromHints(t *testing.T) {
+	tests := []struct {
+		name      string
+		hints     int
+		wantScore int
+	}{
+		{"no hints", 0, 2},
+		{"piece hint", 1, 1},
+		{"from-square hint", 2, 0},
+		{"full move never goes negative", 3, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRouter(t)
+			mustExec(t, `INSERT INTO puzzles (id, difficulty, fen, side_to_move, solution_json, ticks_json)
+				VALUES ('p1', 'easy', ?, 'w', '{"lines":[{"san":"Ra7","isTick":true},{"san":"h6"},{"san":"Ra8+"}]}', '["Ra7"]')`, testPuzzleFEN)
+			for i := 0; i < tt.hints; i++ {
+				requestHint(t, r, nil)
+			}
+
+			// A client-supplied hint count is ignored
+			var graded GradeLineResponse
+			decodeBody(t, serve(t, r, "POST", "/api/puzzles/grade-line", map[string]interface{}{
+				"puzzleId":  "p1",
+				"typedSans": []string{"Ra7", "h6", "Ra8+"},
+				"hintsUsed": 0,
+			}, "alice"), &graded)
+			if graded.Score != tt.wantScore {
+				t.Errorf("score = %d, want %d", graded.Score, tt.wantScore)
+			}
+		})
+	}
+}
+
+func TestHintLevelsUsed(t *testing.T) {
+	r := newTestRouter(t)
+	seedHintPuzzle(t)
+
+	// Three calls at ply 0 reach level 3; one at ply 2 reaches level 1. Bob's hint doesn't count.
+	for i := 0; i < 3; i++ {
+		requestHint(t, r, nil)
+	}
+	requestHint(t, r, []string{"Ra7", "h6"})
+	serve(t, r, "POST", "/api/puzzles/p1/hint", map[string][]string{}, "bob")
+
+	if got, err := hintLevelsUsed("alice", "p1"); err != nil || got != 4 {
+		t.Errorf("hintLevelsUsed = %d, %v, want 4", got, err)
+	}
+
+	// Grading starts the count over
+	mustExec(t, `INSERT INTO progress (user_id, puzzle_id, updated_at) VALUES ('alice', 'p1', datetime('now', '+1 second'))`)
+	if got, err := hintLevelsUsed("alice", "p1"); err != nil || got != 0 {
+		t.Errorf("hintLevelsUsed after grading = %d, %v, want 0", got, err)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"woodpecker-online/internal/model"
+)
+
+// Lichess ratings below these bounds map to easy and intermediate; anything higher is advanced
+const (
+	lichessEasyMaxRating         = 1500
+	lichessIntermediateMaxRating = 2000
+)
+
+// LichessPuzzle is one row of the Lichess puzzle CSV converted to a puzzle, with its themes as tags
+type LichessPuzzle struct {
+	Puzzle *model.Puzzle
+	Rating int
+	Themes []string
+}
+
+// lichessDifficulty maps a Lichess puzzle rating to a difficulty bucket
+func lichessDifficulty(rating int) string {
+	switch {
+	case rating < lichessEasyMaxRating:
+		return "easy"
+	case rating < lichessIntermediateMaxRating:
+		return "intermediate"
+	default:
+		return "advanced"
+	}
+}
+
+// ParseLichessCSV reads the Lichess puzzle database format
+// (PuzzleId,FEN,Moves,Rating,RatingDeviation,Popularity,NbPlays,Themes,GameUrl,OpeningTags).
+// A header row is skipped if present. Lichess FENs are the position before the opponent's
+// move, so the first UCI move is played to get the puzzle position and the rest become the
+// solution line in SAN, with the key move ticked.
+func ParseLichessCSV(r io.Reader) ([]LichessPuzzle, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	var puzzles []LichessPuzzle
+	for rowNum := 1; ; rowNum++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", rowNum, err)
+		}
+		if rowNum == 1 && len(record) > 0 && record[0] == "PuzzleId" {
+			continue
+		}
+
+		puzzle, err := parseLichessRecord(record)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", rowNum, err)
+		}
+		puzzles = append(puzzles, *puzzle)
+	}
+
+	return puzzles, nil
+}
+
+// parseLichessRecord converts one CSV record to a puzzle
+func parseLichessRecord(record []string) (*LichessPuzzle, error) {
+	if len(record) < 4 {
+		return nil, fmt.Errorf("expected at least 4 columns, got %d", len(record))
+	}
+	id, fen, movesField, ratingField := record[0], record[1], record[2], record[3]
+	if id == "" {
+		return nil, errors.New("missing puzzle ID")
+	}
+
+	rating, err := strconv.Atoi(ratingField)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rating %q", ratingField)
+	}
+
+	moves := strings.Fields(movesField)
+	if len(moves) < 2 {
+		return nil, errors.New("expected the opponent's move and at least one solution move")
+	}
+
+	pos, err := ParseFEN(fen)
+	if err != nil {
+		return nil, fmt.Errorf("invalid FEN: %w", err)
+	}
+
+	setup, err := resolveUCI(pos, moves[0])
+	if err != nil {
+		return nil, err
+	}
+	pos = pos.applyMove(setup)
+	start := pos.FEN()
+
+	var lines []model.Line
+	for i, uci := range moves[1:] {
+		move, err := resolveUCI(pos, uci)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, model.Line{SAN: moveToSAN(pos, move), IsTick: i == 0})
+		pos = pos.applyMove(move)
+	}
+
+	var themes []string
+	if len(record) > 7 {
+		themes = strings.Fields(record[7])
+	}
+
+	solution := model.Solution{Lines: lines}
+	return &LichessPuzzle{
+		Puzzle: &model.Puzzle{
+			ID:         "lichess_" + id,
+			Difficulty: lichessDifficulty(rating),
+			FEN:        start,
+			Solution:   solution,
+			Ticks:      solution.TickSANs(),
+		},
+		Rating: rating,
+		Themes: themes,
+	}, nil
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const lichessSampleCSV = `PuzzleId,FEN,Moves,Rating,RatingDeviation,Popularity,NbPlays,Themes,GameUrl,OpeningTags
+00sHx,q3k1nr/1pp1nQpp/3p4/1P2p3/4P3/B1PP1b2/B5PP/5K2 b k - 0 17,e8d7 a2e6 d7d8 f7f8,1760,80,83,72,mate mateIn2 middlegame short,https://lichess.org/yyznGmXs/black#34,Italian_Game
+00008,r6k/pp2r2p/4Rp1Q/3p4/8/1N1P2R1/PqP2bPP/7K b - - 0 24,f2g3 e6e7 b2b1 b3c1 b1c1 h6c1,1407,75,91,634,crushing hangingPiece long middlegame,https://lichess.org/787zsVup/black#48,
+`
+
+func TestParseLichessCSV(t *testing.T) {
+	puzzles, err := ParseLichessCSV(strings.NewReader(lichessSampleCSV))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(puzzles) != 2 {
+		t.Fatalf("parsed %d puzzles, want 2", len(puzzles))
+	}
+
+	tests := []struct {
+		id         string
+		difficulty string
+		fen        string
+		sans       []string
+		themes     []string
+	}{
+		{
+			"lichess_00sHx", "intermediate",
+			"q5nr/1ppknQpp/3p4/1P2p3/4P3/B1PP1b2/B5PP/5K2 w - - 1 18",
+			[]string{"Be6+", "Kd8", "Qf8#"},
+			[]string{"mate", "mateIn2", "middlegame", "short"},
+		},
+		{
+			"lichess_00008", "easy",
+			"r6k/pp2r2p/4Rp1Q/3p4/8/1N1P2b1/PqP3PP/7K w - - 0 25",
+			[]string{"Rxe7", "Qb1+", "Nc1", "Qxc1+", "Qxc1"},
+			[]string{"crushing", "hangingPiece", "long", "middlegame"},
+		},
+	}
+	for i, tt := range tests {
+		got := puzzles[i]
+		if got.Puzzle.ID != tt.id || got.Puzzle.Difficulty != tt.difficulty || got.Puzzle.FEN != tt.fen {
+			t.Errorf("puzzle %d = %s %s %q, want %s %s %q", i, got.Puzzle.ID, got.Puzzle.Difficulty, got.Puzzle.FEN,
+				tt.id, tt.difficulty, tt.fen)
+		}
+		var sans []string
+		for j, line := range got.Puzzle.Solution.Lines {
+			sans = append(sans, line.SAN)
+			if line.IsTick != (j == 0) {
+				t.Errorf("%s move %d %s ticked = %v, want only the key move ticked", tt.id, j, line.SAN, line.IsTick)
+			}
+		}
+		if !reflect.DeepEqual(sans, tt.sans) {
+			t.Errorf("%s solution = %v, want %v", tt.id, sans, tt.sans)
+		}
+		if !reflect.DeepEqual(got.Puzzle.Ticks, tt.sans[:1]) {
+			t.Errorf("%s ticks = %v, want %v", tt.id, got.Puzzle.Ticks, tt.sans[:1])
+		}
+		if !reflect.DeepEqual(got.Themes, tt.themes) {
+			t.Errorf("%s themes = %v, want %v", tt.id, got.Themes, tt.themes)
+		}
+	}
+}
+
+func TestParseLichessCSVErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		row  string
+		want error
+	}{
+		{"too few columns", "abc,8/8/8/8/8/8/8/8 w - - 0 1", nil},
+		{"bad rating", "abc,6k1/5ppp/8/8/8/8/8/R3K3 b - - 0 1,g8h8 a1a8,high", nil},
+		{"single move", "abc,6k1/5ppp/8/8/8/8/8/R3K3 b - - 0 1,g8h8,1200", nil},
+		{"bad FEN", "abc,not a fen,g8h8 a1a8,1200", nil},
+		{"illegal move", "abc,6k1/5ppp/8/8/8/8/8/R3K3 b - - 0 1,g8h8 a1a9,1200", ErrInvalidSAN},
+		{"move that isn't legal", "abc,6k1/5ppp/8/8/8/8/8/R3K3 b - - 0 1,g8h8 a1b2,1200", ErrIllegalSAN},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseLichessCSV(strings.NewReader(tt.row + "\n"))
+			if err == nil {
+				t.Fatal("parsed an invalid row")
+			}
+			if !strings.Contains(err.Error(), "row 1") {
+				t.Errorf("error %q does not name the row", err)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("error %q, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLichessDifficulty(t *testing.T) {
+	for rating, want := range map[int]string{
+		600: "easy", 1499: "easy", 1500: "intermediate", 1999: "intermediate", 2000: "advanced", 2900: "advanced",
+	} {
+		if got := lichessDifficulty(rating); got != want {
+			t.Errorf("lichessDifficulty(%d) = %s, want %s", rating, got, want)
+		}
+	}
+}
+
+func TestMoveToSAN(t *testing.T) {
+	tests := []struct {
+		name string
+		fen  string
+		uci  string
+		want string
+	}{
+		{"pawn push", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "e2e4", "e4"},
+		{"knight", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "g1f3", "Nf3"},
+		{"castling kingside", "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "e1g1", "O-O"},
+		{"castling queenside", "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "e1c1", "O-O-O"},
+		{"file disambiguation", "4k3/8/8/8/8/8/4K3/R6R w - - 0 1", "a1d1", "Rad1"},
+		{"rank disambiguation", "4k3/8/8/R7/8/8/4K3/R7 w - - 0 1", "a1a3", "R1a3"},
+		{"pawn capture", "4k3/8/8/3p4/4P3/8/8/4K3 w - - 0 1", "e4d5", "exd5"},
+		{"en passant", "4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1", "e5d6", "exd6"},
+		{"promotion with check", "8/P7/8/8/8/8/8/k3K3 w - - 0 1", "a7a8q", "a8=Q+"},
+		{"mate", "6k1/5ppp/8/8/8/8/8/R3K3 w Q - 0 1", "a1a8", "Ra8#"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pos := mustParseFEN(t, tt.fen)
+			move, err := resolveUCI(pos, tt.uci)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := moveToSAN(pos, move); got != tt.want {
+				t.Errorf("moveToSAN(%s) = %q, want %q", tt.uci, got, tt.want)
+			}
+			// The SAN reads back as the same move
+			if back, err := resolveSAN(pos, tt.want); err != nil || back != move {
+				t.Errorf("resolveSAN(%q) = %v, %v; want %v", tt.want, back, err, move)
+			}
+		})
+	}
+}
+
+func TestAdminImportLichess(t *testing.T) {
+	previous := adminEmails
+	adminEmails = parseAdminEmails("admin@example.com")
+	t.Cleanup(func() { adminEmails = previous })
+
+	importCSV := func(t *testing.T, r http.Handler, csv, userID string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := newRequest(t, "POST", "/api/admin/puzzles/import-lichess", nil, userID)
+		req.Body = io.NopCloser(strings.NewReader(csv))
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("imports puzzles and tags", func(t *testing.T) {
+		r := newTestRouter(t)
+		var result map[string]int
+		decodeBody(t, importCSV(t, r, lichessSampleCSV, "admin"), &result)
+		if result["imported"] != 2 || result["skipped"] != 0 {
+			t.Errorf("result = %v, want 2 imported", result)
+		}
+
+		var tags []string
+		if err := db.Select(&tags, `SELECT tag FROM puzzle_tags WHERE puzzle_id = 'lichess_00sHx' ORDER BY tag`); err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"mate", "mateIn2", "middlegame", "short"}; !reflect.DeepEqual(tags, want) {
+			t.Errorf("tags = %v, want %v", tags, want)
+		}
+		var difficulty string
+		if err := db.Get(&difficulty, `SELECT difficulty FROM puzzles WHERE id = 'lichess_00008'`); err != nil {
+			t.Fatal(err)
+		}
+		if difficulty != "easy" {
+			t.Errorf("difficulty = %q, want easy", difficulty)
+		}
+
+		// Importing again skips the existing puzzles
+		decodeBody(t, importCSV(t, r, lichessSampleCSV, "admin"), &result)
+		if result["imported"] != 0 || result["skipped"] != 2 {
+			t.Errorf("second import = %v, want 2 skipped", result)
+		}
+	})
+
+	t.Run("a failed insert imports nothing", func(t *testing.T) {
+		r := newTestRouter(t)
+		mustExec(t, `DROP TABLE puzzle_tags`)
+		if rec := importCSV(t, r, lichessSampleCSV, "admin"); rec.Code != 500 {
+			t.Errorf("status %d, want 500", rec.Code)
+		}
+		var puzzles int
+		if err := db.Get(&puzzles, `SELECT COUNT(*) FROM puzzles WHERE id LIKE 'lichess_%'`); err != nil {
+			t.Fatal(err)
+		}
+		if puzzles != 0 {
+			t.Errorf("%d puzzles left by the failed import, want 0", puzzles)
+		}
+	})
+
+	t.Run("invalid CSV", func(t *testing.T) {
+		r := newTestRouter(t)
+		if rec := importCSV(t, r, "abc,not a fen,e2e4 e7e5,1200\n", "admin"); rec.Code != 400 {
+			t.Errorf("status %d, want 400", rec.Code)
+		}
+	})
+
+	t.Run("non-admin", func(t *testing.T) {
+		r := newTestRouter(t)
+		if rec := importCSV(t, r, lichessSampleCSV, "alice"); rec.Code != 403 {
+			t.Errorf("status %d, want 403", rec.Code)
+		}
+	})
+}
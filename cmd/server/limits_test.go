@@ -0,0 +1,38 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRequestBodyLimit(t *testing.T) {
+	previous := maxRequestBodyBytes
+	maxRequestBodyBytes = 1024
+	t.Cleanup(func() { maxRequestBodyBytes = previous })
+
+	r := newTestRouter(t)
+	seedPuzzle(t, "p1", "easy")
+
+	oversized := []string{strings.Repeat("a", 2048)}
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   interface{}
+		status int
+	}{
+		{"oversized grade-line", "POST", "/api/puzzles/grade-line", map[string]interface{}{"puzzleId": "p1", "typedSans": oversized}, 413},
+		{"oversized settings", "PUT", "/api/me/settings", map[string]interface{}{"timezone": oversized[0]}, 413},
+		{"normal settings", "PUT", "/api/me/settings", map[string]interface{}{"timezone": "Europe/London"}, 200},
+		{"malformed settings", "PUT", "/api/me/settings", "not an object", 400},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(t, r, tt.method, tt.path, tt.body, "alice")
+			if rec.Code != tt.status {
+				t.Errorf("status %d, want %d: %s", rec.Code, tt.status, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// parseLogLevel maps LOG_LEVEL (debug, info, warn or error) to a slog level, defaulting to info
+func parseLogLevel(value string) slog.Level {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// newLogger builds the leveled text logger used across the server
+func newLogger(w io.Writer, level slog.Level) *slog.Logger {
+	return slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: level}))
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// captureLogs sends the default logger to a buffer at the given level for the rest of the test
+func captureLogs(t *testing.T, level slog.Level) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(newLogger(&buf, level))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+func TestParseLogLevel(t *testing.T) {
+	tests := []struct {
+		value string
+		want  slog.Level
+	}{
+		{"debug", slog.LevelDebug},
+		{" DEBUG ", slog.LevelDebug},
+		{"info", slog.LevelInfo},
+		{"warn", slog.LevelWarn},
+		{"warning", slog.LevelWarn},
+		{"error", slog.LevelError},
+		{"", slog.LevelInfo},
+		{"verbose", slog.LevelInfo},
+	}
+	for _, tt := range tests {
+		if got := parseLogLevel(tt.value); got != tt.want {
+			t.Errorf("parseLogLevel(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestAuthRequestLogLevel(t *testing.T) {
+	tests := []struct {
+		level      slog.Level
+		wantLogged bool
+	}{
+		{slog.LevelInfo, false},
+		{slog.LevelDebug, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.level.String(), func(t *testing.T) {
+			r := newTestRouter(t)
+			logs := captureLogs(t, tt.level)
+
+			if rec := serve(t, r, "GET", "/api/me/settings", nil, "alice"); rec.Code != 200 {
+				t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+			}
+			if logged := strings.Contains(logs.String(), "valid_token=true"); logged != tt.wantLogged {
+				t.Errorf("authenticated request logged = %v, want %v:\n%s", logged, tt.wantLogged, logs)
+			}
+		})
+	}
+}
+
+func TestAuthLogsLeaveOutTokens(t *testing.T) {
+	r := newTestRouter(t)
+	logs := captureLogs(t, slog.LevelDebug)
+
+	credentials := map[string]string{"email": "alice@example.com", "password": "secret-password"}
+	if rec := serve(t, r, "POST", "/api/auth/sign-up", credentials, ""); rec.Code != 200 && rec.Code != 201 {
+		t.Fatalf("sign-up: status %d: %s", rec.Code, rec.Body.String())
+	}
+	signIn := serve(t, r, "POST", "/api/auth/sign-in", credentials, "")
+	if signIn.Code != 200 {
+		t.Fatalf("sign-in: status %d: %s", signIn.Code, signIn.Body.String())
+	}
+
+	// Cookie from sign-in, a freshly signed token and an API key, each used on an authenticated route
+	var secrets []string
+	for _, cookie := range signIn.Result().Cookies() {
+		secrets = append(secrets, cookie.Value)
+		req := newRequest(t, "GET", "/api/me/settings", nil, "")
+		req.AddCookie(cookie)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != 200 {
+			t.Fatalf("cookie from sign-in: status %d", rec.Code)
+		}
+	}
+	if len(secrets) == 0 {
+		t.Fatal("sign-in set no cookie")
+	}
+	req := newRequest(t, "GET", "/api/me/settings", nil, "bob")
+	secrets = append(secrets, req.Cookies()[0].Value)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != 200 {
+		t.Fatalf("signed cookie: status %d", rec.Code)
+	}
+	mustExec(t, `INSERT INTO users (id, email, password_hash) VALUES ('bob', 'bob@example.com', 'x')`)
+	_, key := createAPIKey(t, r, "bob")
+	secrets = append(secrets, key)
+	if rec := serveWithKey(t, r, "GET", "/api/me/settings", nil, key); rec.Code != 200 {
+		t.Fatalf("API key: status %d", rec.Code)
+	}
+	// Rejected credentials aren't logged either
+	secrets = append(secrets, "wpk_not-a-real-key", "not.a.jwt")
+	serveWithKey(t, r, "GET", "/api/me/settings", nil, "wpk_not-a-real-key")
+	bad := newRequest(t, "GET", "/api/me/settings", nil, "")
+	bad.AddCookie(&http.Cookie{Name: "auth_token", Value: "not.a.jwt"})
+	r.ServeHTTP(httptest.NewRecorder(), bad)
+
+	for _, secret := range secrets {
+		if strings.Contains(logs.String(), secret) {
+			t.Errorf("logs contain credential %q:\n%s", secret, logs)
+		}
+	}
+	if !strings.Contains(logs.String(), "valid_token=false") {
+		t.Errorf("rejected requests not logged:\n%s", logs)
+	}
+}
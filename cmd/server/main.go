@@ -2,11 +2,19 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -47,14 +55,47 @@ type Move struct {
 	FromCol int `json:"fromCol"`
 	ToRow   int `json:"toRow"`
 	ToCol   int `json:"toCol"`
+	// Promotion is the piece a pawn promotes to, empty for other moves
+	Promotion PieceType `json:"promotion,omitempty"`
+}
+
+// Validate checks that the move's squares are on the board, so a decoded payload can be
+// rejected before it is looked up on the board
+func (m Move) Validate() error {
+	coords := []struct {
+		name  string
+		value int
+	}{
+		{"fromRow", m.FromRow},
+		{"fromCol", m.FromCol},
+		{"toRow", m.ToRow},
+		{"toCol", m.ToCol},
+	}
+	for _, c := range coords {
+		if c.value < 0 || c.value > 7 {
+			return fmt.Errorf("%s must be between 0 and 7, got %d", c.name, c.value)
+		}
+	}
+	return nil
 }
 
 type ChessGame struct {
 	Board          [8][8]*Piece       `json:"board"`
 	CurrentPlayer  string             `json:"currentPlayer"`
 	GameOver       bool               `json:"gameOver"`
+	GameResult     string             `json:"gameResult,omitempty"` // checkmate|stalemate|resignation|agreed-draw
+	Winner         string             `json:"winner,omitempty"`
+	Result         *GameSummary       `json:"result,omitempty"`        // set once the game is over
+	DrawOfferedBy  string             `json:"drawOfferedBy,omitempty"` // color with a pending draw offer
+	LoadedFEN      string             `json:"loadedFen,omitempty"`     // last FEN loaded via /api/load-fen, used by replay
 	MoveHistory    []Move             `json:"moveHistory"`
+	SANHistory     []string           `json:"sanHistory"` // MoveHistory in SAN, for PGN export
 	CapturedPieces map[string][]Piece `json:"capturedPieces"`
+	HalfmoveClock  int                `json:"halfmoveClock"` // plies since the last capture or pawn move
+	// PositionHistory holds positionKey for the start position and after every move, for repetition claims
+	PositionHistory []string `json:"-"`
+	// StartFEN is the position the game started from, for PGN export
+	StartFEN string `json:"-"`
 }
 
 // Global game state
@@ -64,11 +105,29 @@ var gameLock sync.RWMutex
 // Global database connection
 var db *sqlx.DB
 
-// AuthMiddleware checks for valid JWT token
+// tokenValidator checks the auth cookie's token for AuthMiddleware. Swapping in a
+// validator backed by stored sessions would allow revoking them.
+var tokenValidator auth.TokenValidator = auth.JWTValidator{}
+
+// AuthMiddleware checks for an API key or a valid auth token
 func AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Log all cookies for debugging
-		log.Printf("AuthMiddleware: Request to %s, cookies: %v", r.URL.Path, r.Cookies())
+		// API keys take precedence over cookies for programmatic access
+		if authHeader := r.Header.Get("Authorization"); strings.HasPrefix(authHeader, "Bearer ") {
+			userID, email, err := authenticateAPIKey(strings.TrimPrefix(authHeader, "Bearer "))
+			if err != nil {
+				slog.Info("AuthMiddleware: request", "path", r.URL.Path, "valid_token", false)
+				slog.Debug("AuthMiddleware: invalid API key", "error", err)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			slog.Debug("AuthMiddleware: request", "path", r.URL.Path, "valid_token", true)
+			ctx := context.WithValue(r.Context(), "user_id", userID)
+			ctx = context.WithValue(ctx, "user_email", email)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
 
 		// Get token from cookie - try both possible cookie names
 		var cookie *http.Cookie
@@ -79,7 +138,8 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			// Try alternative cookie name for debugging
 			cookie, err = r.Cookie("woodpecker_auth")
 			if err != nil {
-				log.Printf("AuthMiddleware: No auth cookie found (tried both auth_token and woodpecker_auth): %v", err)
+				slog.Info("AuthMiddleware: request", "path", r.URL.Path, "valid_token", false)
+				slog.Debug("AuthMiddleware: no auth cookie found (tried both auth_token and woodpecker_auth)")
 				// For API endpoints, return 401 instead of redirect
 				if strings.HasPrefix(r.URL.Path, "/api/") {
 					http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -88,13 +148,14 @@ func AuthMiddleware(next http.Handler) http.Handler {
 				http.Redirect(w, r, "/auth/sign-in", http.StatusSeeOther)
 				return
 			}
-			log.Printf("AuthMiddleware: Found woodpecker_auth cookie instead of auth_token")
+			slog.Debug("AuthMiddleware: found woodpecker_auth cookie instead of auth_token")
 		}
 
 		// Validate token
-		claims, err := auth.ValidateJWT(cookie.Value)
+		claims, err := tokenValidator.ValidateToken(cookie.Value)
 		if err != nil {
-			log.Printf("AuthMiddleware: Invalid JWT token: %v", err)
+			slog.Info("AuthMiddleware: request", "path", r.URL.Path, "valid_token", false)
+			slog.Debug("AuthMiddleware: invalid token", "error", err)
 			// For API endpoints, return 401 instead of redirect
 			if strings.HasPrefix(r.URL.Path, "/api/") {
 				http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -104,7 +165,7 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		log.Printf("AuthMiddleware: Valid token for user %s", claims.Email)
+		slog.Debug("AuthMiddleware: request", "path", r.URL.Path, "valid_token", true)
 		// Add user info to request context
 		ctx := context.WithValue(r.Context(), "user_id", claims.UserID)
 		ctx = context.WithValue(ctx, "user_email", claims.Email)
@@ -112,31 +173,221 @@ func AuthMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// adminEmails lists the accounts allowed to call /api/admin endpoints (ADMIN_EMAILS, comma-separated)
+var adminEmails = map[string]bool{}
+
+// parseAdminEmails reads ADMIN_EMAILS into a lookup of lowercased addresses
+func parseAdminEmails(value string) map[string]bool {
+	emails := map[string]bool{}
+	for _, email := range strings.Split(value, ",") {
+		if email = strings.ToLower(strings.TrimSpace(email)); email != "" {
+			emails[email] = true
+		}
+	}
+	return emails
+}
+
+// AdminMiddleware authenticates the request like AuthMiddleware and then requires an admin account
+func AdminMiddleware(next http.Handler) http.Handler {
+	return AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		email, _ := r.Context().Value("user_email").(string)
+		if !adminEmails[strings.ToLower(email)] {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// authenticateAPIKey resolves an API key to its owner's ID and email
+func authenticateAPIKey(key string) (string, string, error) {
+	repo := repository.NewSQLiteRepository(db)
+	apiKey, err := repo.GetAPIKeyByHash(auth.HashAPIKey(key))
+	if err != nil {
+		return "", "", err
+	}
+
+	owner, err := repo.GetUserByID(apiKey.UserID)
+	if err != nil {
+		return "", "", err
+	}
+
+	return owner.ID, owner.Email, nil
+}
+
+// envInt reads a positive integer from the environment, falling back to def when unset or invalid
+func envInt(name string, def int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		slog.Warn("Ignoring invalid setting", "name", name, "value", v)
+		return def
+	}
+	return n
+}
+
+// envBool reads a boolean from the environment, falling back to def when unset or invalid
+func envBool(name string, def bool) bool {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		slog.Warn("Ignoring invalid setting", "name", name, "value", v)
+		return def
+	}
+	return b
+}
+
+// maxRequestBodyBytes caps the size of request bodies (MAX_REQUEST_BODY_BYTES, default 1 MiB)
+var maxRequestBodyBytes int64 = 1 << 20
+
+// LimitRequestBody wraps request bodies so reads fail once maxRequestBodyBytes is exceeded
+func LimitRequestBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body != nil {
+			r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodyBytes)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// TrimTrailingSlash routes /api/path/ as /api/path. The path is rewritten rather than redirected
+// so POST and PUT bodies aren't lost, and only under /api so file server directories still
+// redirect as usual.
+func TrimTrailingSlash(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/") && strings.HasSuffix(r.URL.Path, "/") {
+			r = r.Clone(r.Context())
+			r.URL.Path = strings.TrimSuffix(r.URL.Path, "/")
+			r.URL.RawPath = ""
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// methodNotAllowedHandler answers requests whose path matched a route but whose method didn't,
+// with a JSON 405 and an Allow header listing the methods the path does accept. Anything else
+// gets a plain 404. It is also installed as the NotFoundHandler, because mux v1.8 loses the
+// method mismatch when a later route in the same subrouter shares its path prefix.
+func methodNotAllowedHandler(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowed := allowedMethods(router, r)
+		if len(allowed) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":   "method not allowed",
+			"allowed": allowed,
+		})
+	})
+}
+
+// allowedMethods returns the methods registered for the request's path, found by matching the
+// request against the router with each method in turn
+func allowedMethods(router *mux.Router, r *http.Request) []string {
+	allowed := []string{}
+	for _, method := range []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"} {
+		probe := r.Clone(r.Context())
+		probe.Method = method
+		var match mux.RouteMatch
+		if router.Match(probe, &match) && match.MatchErr == nil {
+			allowed = append(allowed, method)
+		}
+	}
+	return allowed
+}
+
+// decodeJSON decodes the request body into dst. On failure it writes 413 if the body was too
+// large, or 400 with message otherwise, and returns false.
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}, message string) bool {
+	err := json.NewDecoder(r.Body).Decode(dst)
+	if err == nil {
+		return true
+	}
+
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return false
+	}
+
+	http.Error(w, message, http.StatusBadRequest)
+	return false
+}
+
+// loadConfig reads the app settings from the environment into their package variables
+func loadConfig() {
+	if path := os.Getenv("PUZZLE_SEED_FILE"); path != "" {
+		seedFile = path
+	}
+	seedMax = seedMaxFromEnv(seedMax)
+	seedDifficulty = seedDifficultyFromEnv(seedDifficulty)
+	maxRequestBodyBytes = int64(envInt("MAX_REQUEST_BODY_BYTES", int(maxRequestBodyBytes)))
+	maxSetSize = envInt("MAX_SET_SIZE", maxSetSize)
+	hintPenalty = envInt("HINT_PENALTY", hintPenalty)
+	adminEmails = parseAdminEmails(os.Getenv("ADMIN_EMAILS"))
+	trustProxy = envBool("TRUST_PROXY", trustProxy)
+	strictFEN = envBool("STRICT_FEN", strictFEN)
+	devMode = os.Getenv("ENV") == "development"
+	dailyPlanWorkers = max(envInt("DAILY_PLAN_WORKERS", dailyPlanWorkers), 1)
+	authCookie = loadCookieConfig()
+	cors = loadCORSConfig()
+	if size := envInt("PUZZLE_CACHE_SIZE", 0); size > 0 {
+		cachedPuzzles = newPuzzleCache(size)
+	}
+	if url := os.Getenv("CYCLE_WEBHOOK_URL"); url != "" {
+		timeout := time.Duration(envInt("CYCLE_WEBHOOK_TIMEOUT_SECONDS", 5)) * time.Second
+		notifier = newWebhookNotifier(url, timeout)
+	}
+	model.DefaultDailyGoalMinutes = envInt("DEFAULT_DAILY_GOAL_MINUTES", model.DefaultDailyGoalMinutes)
+	woodpecker.AutoDifficulty.AccuracyPercent = envInt("AUTO_DIFFICULTY_ACCURACY_PERCENT", woodpecker.AutoDifficulty.AccuracyPercent)
+	woodpecker.AutoDifficulty.MinSample = envInt("AUTO_DIFFICULTY_MIN_SAMPLE", woodpecker.AutoDifficulty.MinSample)
+	woodpecker.AutoDifficulty.PromotePercent = envInt("AUTO_DIFFICULTY_PROMOTE_PERCENT", woodpecker.AutoDifficulty.PromotePercent)
+}
+
 func main() {
+	// Leveled logging (LOG_LEVEL: debug, info, warn or error; default info)
+	slog.SetDefault(newLogger(os.Stderr, parseLogLevel(os.Getenv("LOG_LEVEL"))))
+
+	// Read settings before seeding, since seeding uses some of them
+	loadConfig()
+
 	// Initialize database
 	var err error
 	db, err = initDatabase()
 	if err != nil {
-		log.Fatal("Failed to initialize database:", err)
+		slog.Error("Failed to initialize database", "error", err)
+		os.Exit(1)
 	}
 	defer db.Close()
 
 	// Seed puzzles
 	if err := seedPuzzles(db); err != nil {
-		log.Printf("Warning: Failed to seed puzzles: %v", err)
+		slog.Warn("Failed to seed puzzles", "error", err)
 	}
 
 	// Seed test user
-	log.Println("Starting to seed test user...")
+	slog.Info("Starting to seed test user")
 	if err := seedTestUser(db); err != nil {
-		log.Printf("Warning: Failed to seed test user: %v", err)
+		slog.Warn("Failed to seed test user", "error", err)
 	} else {
-		log.Println("Test user seeding completed successfully")
+		slog.Info("Test user seeding completed successfully")
 	}
 
 	// Seed demo set
 	if err := seedDemoSet(db); err != nil {
-		log.Printf("Warning: Failed to seed demo set: %v", err)
+		slog.Warn("Failed to seed demo set", "error", err)
 	}
 
 	// Initialize the chess game
@@ -144,17 +395,20 @@ func main() {
 
 	// Initialize woodpecker service
 	woodpeckerService := woodpecker.NewService(db)
+	planQueue = newPlanRebuildQueue(dailyPlanWorkers, func(userID string) error {
+		return rebuildDailyPlan(woodpeckerService, userID)
+	})
 
 	// Initialize cron job for daily plan updates
 	c := cron.New(cron.WithLocation(time.Local))
 
 	// Add cron job to run at 00:05 every day
 	_, err = c.AddFunc("5 0 * * *", func() {
-		log.Println("Running daily plan update cron job")
-		updateDailyPlans(woodpeckerService)
+		slog.Info("Running daily plan update cron job")
+		updateDailyPlans()
 	})
 	if err != nil {
-		log.Printf("Failed to add cron job: %v", err)
+		slog.Error("Failed to add cron job", "error", err)
 	}
 
 	// Start cron scheduler
@@ -162,6 +416,10 @@ func main() {
 
 	// Create a new router
 	r := mux.NewRouter()
+	r.MethodNotAllowedHandler = methodNotAllowedHandler(r)
+	r.NotFoundHandler = r.MethodNotAllowedHandler
+	r.Use(ResolveClientAddr)
+	r.Use(LimitRequestBody)
 
 	// Serve static files from /web directory
 	webDir := "web"
@@ -180,6 +438,7 @@ func main() {
 	apiRouter.HandleFunc("/dev/first-puzzle", devsvc.FirstPuzzle).Methods("GET")
 	apiRouter.HandleFunc("/dev/next-puzzle", devsvc.NextPuzzle).Methods("GET")
 	apiRouter.HandleFunc("/dev/grade-first-move", devsvc.GradeFirstMove).Methods("POST")
+	apiRouter.HandleFunc("/dev/reseed", handleDevReseed).Methods("POST")
 
 	// Serve static files
 	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir(filepath.Join(webDir, "static")))))
@@ -228,8 +487,11 @@ func main() {
 	if len(port) > 0 && port[0] != ':' {
 		port = ":" + port
 	}
-	log.Printf("Server starting on http://localhost%s", port)
-	log.Fatal(http.ListenAndServe(port, r))
+	slog.Info("Server starting", "url", "http://localhost"+port)
+	if err := http.ListenAndServe(port, TrimTrailingSlash(CORS(r))); err != nil {
+		slog.Error("Server stopped", "error", err)
+		os.Exit(1)
+	}
 }
 
 func setupAPIRoutes(apiRouter *mux.Router) {
@@ -242,6 +504,14 @@ func setupAPIRoutes(apiRouter *mux.Router) {
 
 	// Chess game endpoints
 	apiRouter.HandleFunc("/game", handleGameState).Methods("GET")
+	apiRouter.HandleFunc("/game/material", handleGameMaterial).Methods("GET")
+	apiRouter.HandleFunc("/game/mobility", handleGameMobility).Methods("GET")
+	apiRouter.HandleFunc("/game/resign", handleResign).Methods("POST")
+	apiRouter.HandleFunc("/game/draw", handleDraw).Methods("POST")
+	apiRouter.HandleFunc("/game/draw-claims", handleDrawClaims).Methods("GET")
+	apiRouter.HandleFunc("/game/pgn", handleGamePGN).Methods("GET")
+	apiRouter.HandleFunc("/game/replay", handleReplay).Methods("POST")
+	apiRouter.HandleFunc("/load-fen", handleLoadFEN).Methods("POST")
 	apiRouter.HandleFunc("/move", handleMove).Methods("POST")
 	apiRouter.HandleFunc("/new-game", handleNewGame).Methods("POST")
 	apiRouter.HandleFunc("/reset", handleReset).Methods("POST")
@@ -250,25 +520,82 @@ func setupAPIRoutes(apiRouter *mux.Router) {
 	apiRouter.HandleFunc("/puzzles/next", handleNextPuzzle).Methods("GET")
 	apiRouter.HandleFunc("/puzzles/grade", handleGradePuzzle).Methods("POST")
 	apiRouter.HandleFunc("/puzzles/grade-line", handleGradeLine).Methods("POST")
+	apiRouter.HandleFunc("/puzzles/solution-text/batch", handleSolutionTextBatch).Methods("POST")
 	apiRouter.HandleFunc("/puzzles/solution-text/{puzzleId}", handleSolutionText).Methods("GET")
+	apiRouter.HandleFunc("/puzzles/{puzzleId}/neighbors", handlePuzzleNeighbors).Methods("GET")
+	apiRouter.HandleFunc("/puzzles/{puzzleId}/length", handlePuzzleLength).Methods("GET")
+	apiRouter.HandleFunc("/puzzles/{puzzleId}/only-move", handlePuzzleOnlyMove).Methods("GET")
+	apiRouter.HandleFunc("/puzzles/{puzzleId}/hint", handlePuzzleHint).Methods("POST")
+	apiRouter.HandleFunc("/puzzles/{puzzleId}/trace", handlePuzzleTrace).Methods("POST")
+	apiRouter.HandleFunc("/puzzles/{puzzleId}/is-tick", handlePuzzleIsTick).Methods("POST")
+	apiRouter.HandleFunc("/puzzles/{puzzleId}/skip", handlePuzzleSkip).Methods("POST")
+	apiRouter.HandleFunc("/puzzles/{puzzleId}/time-stats", handlePuzzleTimeStats).Methods("GET")
+	apiRouter.HandleFunc("/puzzles/{puzzleId}/score-distribution", handlePuzzleScoreDistribution).Methods("GET")
+	apiRouter.HandleFunc("/puzzles/{puzzleId}/full", AuthMiddleware(http.HandlerFunc(handlePuzzleFull)).ServeHTTP).Methods("GET")
+
+	// Analysis endpoints
+	apiRouter.HandleFunc("/analyze/hanging", handleAnalyzeHanging).Methods("POST")
+	apiRouter.HandleFunc("/san/resolve", handleResolveSAN).Methods("POST")
+	apiRouter.HandleFunc("/san/normalize", handleNormalizeSAN).Methods("POST")
 
 	// Stats endpoints
 	apiRouter.HandleFunc("/stats", handleStats).Methods("GET")
+	apiRouter.HandleFunc("/stats/completion", AuthMiddleware(http.HandlerFunc(handleCompletionStats)).ServeHTTP).Methods("GET")
+	apiRouter.HandleFunc("/stats/active-days", AuthMiddleware(http.HandlerFunc(handleActiveDays)).ServeHTTP).Methods("GET")
+	apiRouter.HandleFunc("/stats/heatmap", AuthMiddleware(http.HandlerFunc(handleHeatmap)).ServeHTTP).Methods("GET")
+	apiRouter.HandleFunc("/stats/motifs", AuthMiddleware(http.HandlerFunc(handleMotifStats)).ServeHTTP).Methods("GET")
+	apiRouter.HandleFunc("/stats/records", AuthMiddleware(http.HandlerFunc(handleRecords)).ServeHTTP).Methods("GET")
+	apiRouter.HandleFunc("/stats/woodpecker-gain", AuthMiddleware(http.HandlerFunc(handleWoodpeckerGain)).ServeHTTP).Methods("GET")
+	apiRouter.HandleFunc("/stats/cycle-progression", AuthMiddleware(http.HandlerFunc(handleCycleProgression)).ServeHTTP).Methods("GET")
 	apiRouter.HandleFunc("/progress/today", handleTodayProgress).Methods("GET")
 
 	// Daily plan endpoints
 	apiRouter.HandleFunc("/daily", handleDailyStatus).Methods("GET")
+	apiRouter.HandleFunc("/daily/plan", handleDailyPlan).Methods("GET")
+	apiRouter.HandleFunc("/daily/remaining", handleDailyRemaining).Methods("GET")
+	apiRouter.HandleFunc("/daily/goal", AuthMiddleware(http.HandlerFunc(handleDailyGoal)).ServeHTTP).Methods("GET")
+	apiRouter.HandleFunc("/daily/difficulty", AuthMiddleware(http.HandlerFunc(handleDailyDifficulty)).ServeHTTP).Methods("PUT")
 
 	// Auth endpoints
 	apiRouter.HandleFunc("/auth/sign-up", handleSignUp).Methods("POST")
 	apiRouter.HandleFunc("/auth/sign-in", handleSignIn).Methods("POST")
 	apiRouter.HandleFunc("/auth/logout", handleLogout).Methods("POST")
 	apiRouter.HandleFunc("/me", AuthMiddleware(http.HandlerFunc(handleGetMe)).ServeHTTP).Methods("GET")
+	apiRouter.HandleFunc("/me/activity", AuthMiddleware(http.HandlerFunc(handleActivity)).ServeHTTP).Methods("GET")
+	apiRouter.HandleFunc("/me/schedule", AuthMiddleware(http.HandlerFunc(handleReviewSchedule)).ServeHTTP).Methods("GET")
+	apiRouter.HandleFunc("/me/unattempted", AuthMiddleware(http.HandlerFunc(handleUnattempted)).ServeHTTP).Methods("GET")
+	apiRouter.HandleFunc("/me/api-keys", AuthMiddleware(http.HandlerFunc(handleAPIKeys)).ServeHTTP).Methods("GET", "POST")
+	apiRouter.HandleFunc("/me/api-keys/{id}", AuthMiddleware(http.HandlerFunc(handleDeleteAPIKey)).ServeHTTP).Methods("DELETE")
+	apiRouter.HandleFunc("/me/attempts", AuthMiddleware(http.HandlerFunc(handleDeleteOldAttempts)).ServeHTTP).Methods("DELETE")
+	apiRouter.HandleFunc("/me/settings", AuthMiddleware(http.HandlerFunc(handleUserSettings)).ServeHTTP).Methods("GET", "PUT")
+
+	// Admin endpoints
+	apiRouter.HandleFunc("/admin/merge-user", AdminMiddleware(http.HandlerFunc(handleAdminMergeUser)).ServeHTTP).Methods("POST")
+	apiRouter.HandleFunc("/admin/sets/{id}/validate", AdminMiddleware(http.HandlerFunc(handleAdminValidateSet)).ServeHTTP).Methods("GET")
+	apiRouter.HandleFunc("/admin/cycles/{id}/adopt-sessions", AdminMiddleware(http.HandlerFunc(handleAdminAdoptSessions)).ServeHTTP).Methods("POST")
+	apiRouter.HandleFunc("/admin/puzzles/stats", AdminMiddleware(http.HandlerFunc(handleAdminPuzzleStats)).ServeHTTP).Methods("GET")
+	apiRouter.HandleFunc("/admin/puzzles/import-lichess", AdminMiddleware(http.HandlerFunc(handleAdminImportLichess)).ServeHTTP).Methods("POST")
+	apiRouter.HandleFunc("/admin/puzzles/{id}", AdminMiddleware(http.HandlerFunc(handleAdminUpdatePuzzle)).ServeHTTP).Methods("PUT")
+	apiRouter.HandleFunc("/admin/puzzles/{id}/recompute-ticks", AdminMiddleware(http.HandlerFunc(handleAdminRecomputeTicks)).ServeHTTP).Methods("POST")
 
 	// Trainer endpoints
 	apiRouter.HandleFunc("/trainer/sets", AuthMiddleware(http.HandlerFunc(handleTrainerSets)).ServeHTTP).Methods("GET", "POST")
+	apiRouter.HandleFunc("/trainer/dashboard", AuthMiddleware(http.HandlerFunc(handleTrainerDashboard)).ServeHTTP).Methods("GET")
+	apiRouter.HandleFunc("/trainer/sets/preview", AuthMiddleware(http.HandlerFunc(handleTrainerSetPreview)).ServeHTTP).Methods("GET")
+	apiRouter.HandleFunc("/trainer/sets/from-daily", AuthMiddleware(http.HandlerFunc(handleTrainerSetFromDaily)).ServeHTTP).Methods("POST")
+	apiRouter.HandleFunc("/trainer/sets/{id}", AuthMiddleware(http.HandlerFunc(handleTrainerSetDelete)).ServeHTTP).Methods("DELETE")
+	apiRouter.HandleFunc("/trainer/sets/{id}/restore", AuthMiddleware(http.HandlerFunc(handleTrainerSetRestore)).ServeHTTP).Methods("POST")
 	apiRouter.HandleFunc("/trainer/sets/{id}/puzzles", AuthMiddleware(http.HandlerFunc(handleTrainerSetPuzzles)).ServeHTTP).Methods("GET")
+	apiRouter.HandleFunc("/trainer/sets/{id}/puzzles", AuthMiddleware(http.HandlerFunc(handleTrainerSetAddPuzzles)).ServeHTTP).Methods("POST")
+	apiRouter.HandleFunc("/trainer/sets/{id}/cycles", AuthMiddleware(http.HandlerFunc(handleTrainerSetCycles)).ServeHTTP).Methods("GET")
+	apiRouter.HandleFunc("/trainer/sets/{id}/cycles/{cycleId}/remaining", AuthMiddleware(http.HandlerFunc(handleTrainerCycleRemaining)).ServeHTTP).Methods("GET")
+	apiRouter.HandleFunc("/trainer/collections", AuthMiddleware(http.HandlerFunc(handleTrainerCollections)).ServeHTTP).Methods("GET", "POST")
+	apiRouter.HandleFunc("/trainer/collections/{id}/sets", AuthMiddleware(http.HandlerFunc(handleTrainerCollectionSets)).ServeHTTP).Methods("GET", "POST")
+	apiRouter.HandleFunc("/trainer/collections/{id}/sets/{setId}", AuthMiddleware(http.HandlerFunc(handleTrainerCollectionRemoveSet)).ServeHTTP).Methods("DELETE")
 	apiRouter.HandleFunc("/trainer/cycles", AuthMiddleware(http.HandlerFunc(handleTrainerCycles)).ServeHTTP).Methods("POST")
+	apiRouter.HandleFunc("/trainer/cycles/{id}/end", AuthMiddleware(http.HandlerFunc(handleTrainerCycleEnd)).ServeHTTP).Methods("POST")
+	apiRouter.HandleFunc("/trainer/cycles/{id}", AuthMiddleware(http.HandlerFunc(handleTrainerCycleUpdate)).ServeHTTP).Methods("PUT")
+	apiRouter.HandleFunc("/trainer/cycles/{id}/next-puzzle", AuthMiddleware(http.HandlerFunc(handleTrainerCycleNextPuzzle)).ServeHTTP).Methods("GET")
 	apiRouter.HandleFunc("/trainer/cycles/active", AuthMiddleware(http.HandlerFunc(handleTrainerActiveCycle)).ServeHTTP).Methods("GET")
 	apiRouter.HandleFunc("/trainer/sessions", AuthMiddleware(http.HandlerFunc(handleTrainerSessions)).ServeHTTP).Methods("POST")
 	apiRouter.HandleFunc("/trainer/sessions/{id}", AuthMiddleware(http.HandlerFunc(handleTrainerSessionUpdate)).ServeHTTP).Methods("PUT")
@@ -287,11 +614,31 @@ func initDatabase() (*sqlx.DB, error) {
 	if dbPath == "" {
 		dbPath = "woodpecker.db"
 	}
-	db, err := sqlx.Connect("sqlite", dbPath)
+
+	// Pragmas in the DSN are applied to every pooled connection
+	// The mode is interpolated into the DSN, so only the modes SQLite knows are accepted
+	journalMode := strings.ToUpper(os.Getenv("SQLITE_JOURNAL_MODE"))
+	switch journalMode {
+	case "WAL", "DELETE", "TRUNCATE", "PERSIST", "MEMORY", "OFF":
+	case "":
+		journalMode = "WAL"
+	default:
+		slog.Warn("Ignoring invalid setting", "name", "SQLITE_JOURNAL_MODE", "value", journalMode)
+		journalMode = "WAL"
+	}
+	busyTimeoutMs := envInt("SQLITE_BUSY_TIMEOUT_MS", 5000)
+	dsn := fmt.Sprintf("%s?_pragma=busy_timeout(%d)&_pragma=journal_mode(%s)", dbPath, busyTimeoutMs, journalMode)
+
+	db, err := sqlx.Connect("sqlite", dsn)
 	if err != nil {
 		return nil, err
 	}
 
+	// SQLite allows a single writer, so serialize access by default to avoid "database is locked"
+	maxOpenConns := envInt("DB_MAX_OPEN_CONNS", 1)
+	db.SetMaxOpenConns(maxOpenConns)
+	db.SetMaxIdleConns(maxOpenConns)
+
 	// Create users table if it doesn't exist
 	_, err = db.Exec(`
 		CREATE TABLE IF NOT EXISTS users (
@@ -331,6 +678,7 @@ func initDatabase() (*sqlx.DB, error) {
 			score INTEGER DEFAULT 0,
 			solved_at DATETIME,
 			typed_json TEXT,
+			skipped_at DATETIME,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			UNIQUE(user_id, puzzle_id)
@@ -356,6 +704,21 @@ func initDatabase() (*sqlx.DB, error) {
 		return nil, err
 	}
 
+	// Create daily_attempts table if it doesn't exist; one row per daily batch puzzle attempted per day
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS daily_attempts (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id TEXT NOT NULL,
+			puzzle_id TEXT NOT NULL,
+			day DATE NOT NULL,
+			attempted_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(user_id, puzzle_id, day)
+		)
+	`)
+	if err != nil {
+		return nil, err
+	}
+
 	// Create users table if it doesn't exist
 	_, err = db.Exec(`
 		CREATE TABLE IF NOT EXISTS users (
@@ -380,6 +743,7 @@ func initDatabase() (*sqlx.DB, error) {
 			difficulty_min TEXT,
 			difficulty_max TEXT,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			deleted_at DATETIME,
 			FOREIGN KEY (user_id) REFERENCES users(id)
 		)
 	`)
@@ -412,6 +776,8 @@ func initDatabase() (*sqlx.DB, error) {
 			started_at DATETIME,
 			ended_at DATETIME,
 			status TEXT NOT NULL DEFAULT 'planned',
+			name TEXT,
+			notes TEXT,
 			FOREIGN KEY (set_id) REFERENCES sets(id)
 		)
 	`)
@@ -427,6 +793,7 @@ func initDatabase() (*sqlx.DB, error) {
 			started_at DATETIME,
 			ended_at DATETIME,
 			target_count INTEGER NOT NULL,
+			time_limit_seconds INTEGER,
 			FOREIGN KEY (cycle_id) REFERENCES cycles(id)
 		)
 	`)
@@ -447,6 +814,8 @@ func initDatabase() (*sqlx.DB, error) {
 			total_points INTEGER DEFAULT 0,
 			time_ms INTEGER DEFAULT 0,
 			correct_first_move BOOLEAN DEFAULT 0,
+			hints_used INTEGER DEFAULT 0,
+			skipped BOOLEAN DEFAULT 0,
 			FOREIGN KEY (session_id) REFERENCES sessions(id),
 			FOREIGN KEY (puzzle_id) REFERENCES puzzles(id)
 		)
@@ -455,6 +824,94 @@ func initDatabase() (*sqlx.DB, error) {
 		return nil, err
 	}
 
+	// Create idempotency_keys table if it doesn't exist
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS idempotency_keys (
+			user_id TEXT NOT NULL,
+			idempotency_key TEXT NOT NULL,
+			session_id INTEGER NOT NULL,
+			fingerprint TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (user_id, idempotency_key),
+			FOREIGN KEY (session_id) REFERENCES sessions(id)
+		)
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create api_keys table if it doesn't exist
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS api_keys (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id TEXT NOT NULL,
+			prefix TEXT NOT NULL,
+			key_hash TEXT UNIQUE NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create collections table if it doesn't exist
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS collections (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id TEXT NOT NULL,
+			name TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create puzzle_tags table if it doesn't exist
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS puzzle_tags (
+			puzzle_id TEXT NOT NULL,
+			tag TEXT NOT NULL,
+			PRIMARY KEY (puzzle_id, tag),
+			FOREIGN KEY (puzzle_id) REFERENCES puzzles(id)
+		)
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create set_collections table if it doesn't exist
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS set_collections (
+			collection_id INTEGER NOT NULL,
+			set_id INTEGER NOT NULL,
+			PRIMARY KEY (collection_id, set_id),
+			FOREIGN KEY (collection_id) REFERENCES collections(id),
+			FOREIGN KEY (set_id) REFERENCES sets(id)
+		)
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create hints table if it doesn't exist
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS hints (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id TEXT NOT NULL,
+			puzzle_id TEXT NOT NULL,
+			ply INTEGER NOT NULL,
+			level INTEGER NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (puzzle_id) REFERENCES puzzles(id)
+		)
+	`)
+	if err != nil {
+		return nil, err
+	}
+
 	// Create user_settings table if it doesn't exist
 	_, err = db.Exec(`
 		CREATE TABLE IF NOT EXISTS user_settings (
@@ -462,6 +919,8 @@ func initDatabase() (*sqlx.DB, error) {
 			daily_goal_minutes INTEGER DEFAULT 30,
 			reminders_enabled BOOLEAN DEFAULT 1,
 			timezone TEXT DEFAULT 'UTC',
+			board_orientation TEXT DEFAULT 'auto',
+			difficulty_goal_minutes TEXT,
 			FOREIGN KEY (user_id) REFERENCES users(id)
 		)
 	`)
@@ -469,9 +928,111 @@ func initDatabase() (*sqlx.DB, error) {
 		return nil, err
 	}
 
+	// Create cron_runs table if it doesn't exist
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS cron_runs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			job TEXT NOT NULL,
+			started_at DATETIME NOT NULL,
+			finished_at DATETIME NOT NULL,
+			jobs INTEGER NOT NULL,
+			failed INTEGER NOT NULL,
+			errors_json TEXT
+		)
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	// Add columns introduced after the initial schema to existing databases
+	if err := addColumnIfMissing(db, "user_settings", "board_orientation", "TEXT DEFAULT 'auto'"); err != nil {
+		return nil, err
+	}
+	if err := addColumnIfMissing(db, "attempts", "hints_used", "INTEGER DEFAULT 0"); err != nil {
+		return nil, err
+	}
+	if err := addColumnIfMissing(db, "attempts", "skipped", "BOOLEAN DEFAULT 0"); err != nil {
+		return nil, err
+	}
+	if err := addColumnIfMissing(db, "progress", "skipped_at", "DATETIME"); err != nil {
+		return nil, err
+	}
+	if err := addColumnIfMissing(db, "sets", "deleted_at", "DATETIME"); err != nil {
+		return nil, err
+	}
+	if err := addColumnIfMissing(db, "sessions", "time_limit_seconds", "INTEGER"); err != nil {
+		return nil, err
+	}
+	if err := addColumnIfMissing(db, "puzzles", "edited_at", "DATETIME"); err != nil {
+		return nil, err
+	}
+	if err := addColumnIfMissing(db, "progress", "interval_days", "INTEGER DEFAULT 0"); err != nil {
+		return nil, err
+	}
+	if err := addColumnIfMissing(db, "progress", "ease", "REAL DEFAULT 2.5"); err != nil {
+		return nil, err
+	}
+	if err := addColumnIfMissing(db, "progress", "next_review_at", "DATETIME"); err != nil {
+		return nil, err
+	}
+	if err := addColumnIfMissing(db, "cycles", "name", "TEXT"); err != nil {
+		return nil, err
+	}
+	if err := addColumnIfMissing(db, "cycles", "notes", "TEXT"); err != nil {
+		return nil, err
+	}
+	if err := addColumnIfMissing(db, "user_settings", "difficulty_goal_minutes", "TEXT"); err != nil {
+		return nil, err
+	}
+	if err := normalizeTimestamps(db); err != nil {
+		return nil, err
+	}
+
 	return db, nil
 }
 
+// timestampColumns are the columns app code used to write as RFC3339 strings
+var timestampColumns = []struct{ table, column string }{
+	{"sets", "created_at"},
+	{"sets", "deleted_at"},
+	{"cycles", "started_at"},
+	{"cycles", "ended_at"},
+	{"sessions", "started_at"},
+	{"sessions", "ended_at"},
+	{"attempts", "started_at"},
+	{"attempts", "ended_at"},
+	{"api_keys", "created_at"},
+	{"collections", "created_at"},
+}
+
+// normalizeTimestamps rewrites RFC3339 values in timestampColumns to the UTC "YYYY-MM-DD HH:MM:SS"
+// format of CURRENT_TIMESTAMP, so columns sort and compare correctly as text. Values already in
+// that format don't match and are left alone, so this is a no-op after the first run.
+func normalizeTimestamps(db *sqlx.DB) error {
+	for _, c := range timestampColumns {
+		_, err := db.Exec(fmt.Sprintf(`UPDATE %[1]s SET %[2]s = datetime(%[2]s) WHERE %[2]s LIKE '____-__-__T%%' AND datetime(%[2]s) IS NOT NULL`, c.table, c.column))
+		if err != nil {
+			return fmt.Errorf("normalizing %s.%s: %w", c.table, c.column, err)
+		}
+	}
+	return nil
+}
+
+// addColumnIfMissing adds a column to an existing table, since CREATE TABLE IF NOT EXISTS leaves old tables unchanged
+func addColumnIfMissing(db *sqlx.DB, table, column, definition string) error {
+	var count int
+	err := db.Get(&count, `SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
 func initializeGame() {
 	gameLock.Lock()
 	defer gameLock.Unlock()
@@ -522,64 +1083,483 @@ func setupPieces() {
 
 	game.CurrentPlayer = "white"
 	game.GameOver = false
+	game.GameResult = ""
+	game.Winner = ""
+	game.Result = nil
+	game.DrawOfferedBy = ""
 	game.MoveHistory = []Move{}
+	game.SANHistory = []string{}
+	game.HalfmoveClock = 0
+	game.PositionHistory = []string{positionKey(&game.Board, game.CurrentPlayer)}
+	game.StartFEN = standardStartFEN
 }
 
-func handleGameState(w http.ResponseWriter, r *http.Request) {
-	gameLock.RLock()
-	defer gameLock.RUnlock()
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(game)
+// positionKey identifies a position for repetition: placement, side to move and castling
+// rights, as in the first fields of a FEN
+func positionKey(board *[8][8]*Piece, sideToMove string) string {
+	pos := &Position{Board: *board, SideToMove: sideToMove, Castling: inferCastlingRights(board), EnPassant: "-"}
+	fields := strings.Fields(pos.FEN())
+	return strings.Join(fields[:3], " ")
 }
 
-func handleMove(w http.ResponseWriter, r *http.Request) {
-	var move Move
-	if err := json.NewDecoder(r.Body).Decode(&move); err != nil {
-		http.Error(w, "Invalid move data", http.StatusBadRequest)
-		return
-	}
+// loadPosition replaces the game with a position, clearing history and captures. A position
+// that is already checkmate or stalemate starts out over.
+func loadPosition(pos *Position) {
+	game.Board = pos.Board
+	game.CurrentPlayer = pos.SideToMove
+	game.GameOver = false
+	game.GameResult = ""
+	game.Winner = ""
+	game.Result = nil
+	game.DrawOfferedBy = ""
+	game.MoveHistory = []Move{}
+	game.SANHistory = []string{}
+	game.CapturedPieces = map[string][]Piece{"white": {}, "black": {}}
+	game.HalfmoveClock = pos.HalfmoveClock
+	game.PositionHistory = []string{positionKey(&pos.Board, pos.SideToMove)}
+	game.StartFEN = pos.FEN()
 
-	gameLock.Lock()
-	defer gameLock.Unlock()
+	checkGameEnd(pos)
+}
 
-	if game.GameOver {
-		http.Error(w, "Game is over", http.StatusBadRequest)
+// checkGameEnd ends the game when the side to move in pos has no legal moves
+func checkGameEnd(pos *Position) {
+	if len(pos.LegalMoves()) > 0 {
 		return
 	}
-
-	// Validate move
-	if !isValidMove(move) {
-		http.Error(w, "Invalid move", http.StatusBadRequest)
-		return
+	if inCheck(&pos.Board, pos.SideToMove) {
+		endGame("checkmate", opponent(pos.SideToMove))
+	} else {
+		endGame("stalemate", "")
 	}
+}
 
-	// Make the move
-	makeMove(move)
+// GameSummary sums up a finished game: who won or why it was drawn, how long it lasted and
+// the material each side captured
+type GameSummary struct {
+	Winner   string          `json:"winner,omitempty"` // empty for a draw
+	Reason   string          `json:"reason"`           // checkmate|stalemate|resignation|agreed-draw
+	Moves    int             `json:"moves"`            // moves played by both sides together
+	Material MaterialBalance `json:"material"`
+}
 
-	// Check for game over
-	if isCheckmate() {
-		game.GameOver = true
+// endGame marks the game over for the given reason, with winner empty for a draw
+func endGame(reason, winner string) {
+	game.GameOver = true
+	game.GameResult = reason
+	game.Winner = winner
+	game.Result = &GameSummary{
+		Winner:   winner,
+		Reason:   reason,
+		Moves:    len(game.MoveHistory),
+		Material: materialBalance(&game.Board, game.CapturedPieces),
 	}
+}
 
-	// Switch players
-	if game.CurrentPlayer == "white" {
-		game.CurrentPlayer = "black"
-	} else {
-		game.CurrentPlayer = "white"
-	}
+func handleGameState(w http.ResponseWriter, r *http.Request) {
+	gameLock.RLock()
+	defer gameLock.RUnlock()
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(game)
 }
 
-func handleNewGame(w http.ResponseWriter, r *http.Request) {
-	gameLock.Lock()
-	defer gameLock.Unlock()
+// pieceValues are the standard material values; the king is not counted
+var pieceValues = map[PieceType]int{
+	Queen:  9,
+	Rook:   5,
+	Bishop: 3,
+	Knight: 3,
+	Pawn:   1,
+}
 
-	setupPieces()
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(game)
+// SideMaterial is one side's material on the board and the opponent pieces it has captured
+type SideMaterial struct {
+	Material      int               `json:"material"`
+	Captured      map[PieceType]int `json:"captured"`
+	CapturedValue int               `json:"capturedValue"`
+}
+
+// MaterialBalance reports both sides' material and the difference from white's point of view
+type MaterialBalance struct {
+	White      SideMaterial `json:"white"`
+	Black      SideMaterial `json:"black"`
+	Difference int          `json:"difference"`
+}
+
+// materialBalance computes material from the board and tallies captures, keyed by the capturing color
+func materialBalance(board *[8][8]*Piece, captured map[string][]Piece) MaterialBalance {
+	sides := map[string]*SideMaterial{
+		"white": {Captured: map[PieceType]int{}},
+		"black": {Captured: map[PieceType]int{}},
+	}
+
+	for row := 0; row < 8; row++ {
+		for col := 0; col < 8; col++ {
+			if piece := board[row][col]; piece != nil {
+				sides[piece.Color].Material += pieceValues[piece.Type]
+			}
+		}
+	}
+
+	for color, pieces := range captured {
+		side, ok := sides[color]
+		if !ok {
+			continue
+		}
+		for _, piece := range pieces {
+			side.Captured[piece.Type]++
+			side.CapturedValue += pieceValues[piece.Type]
+		}
+	}
+
+	return MaterialBalance{
+		White:      *sides["white"],
+		Black:      *sides["black"],
+		Difference: sides["white"].Material - sides["black"].Material,
+	}
+}
+
+func handleGameMaterial(w http.ResponseWriter, r *http.Request) {
+	gameLock.RLock()
+	defer gameLock.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(materialBalance(&game.Board, game.CapturedPieces))
+}
+
+// handleGameMobility returns the number of legal moves available to each side
+func handleGameMobility(w http.ResponseWriter, r *http.Request) {
+	gameLock.RLock()
+	defer gameLock.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{
+		"white": CountLegalMoves(game.Board, "white"),
+		"black": CountLegalMoves(game.Board, "black"),
+	})
+}
+
+// HangingPiece is a piece attacked by more opponent pieces than defend it
+type HangingPiece struct {
+	Square    string    `json:"square"`
+	Piece     PieceType `json:"piece"`
+	Color     string    `json:"color"`
+	Attackers int       `json:"attackers"`
+	Defenders int       `json:"defenders"`
+}
+
+// hangingPieces lists every non-king piece whose attackers outnumber its defenders
+func hangingPieces(board *[8][8]*Piece) []HangingPiece {
+	hanging := []HangingPiece{}
+	for row := 0; row < 8; row++ {
+		for col := 0; col < 8; col++ {
+			piece := board[row][col]
+			if piece == nil || piece.Type == King {
+				continue
+			}
+			attackers := countAttackers(board, row, col, opponent(piece.Color))
+			defenders := countAttackers(board, row, col, piece.Color)
+			if attackers > defenders {
+				hanging = append(hanging, HangingPiece{
+					Square:    squareName(row, col),
+					Piece:     piece.Type,
+					Color:     piece.Color,
+					Attackers: attackers,
+					Defenders: defenders,
+				})
+			}
+		}
+	}
+	return hanging
+}
+
+// handleAnalyzeHanging reports the hanging pieces in a FEN position
+func handleAnalyzeHanging(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		FEN string `json:"fen"`
+	}
+	if !decodeJSON(w, r, &req, "Invalid request body") {
+		return
+	}
+
+	pos, err := ParseFEN(req.FEN)
+	if err != nil {
+		http.Error(w, "Invalid FEN: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"hanging": hangingPieces(&pos.Board),
+	})
+}
+
+// ResolvedSAN is the legal move a SAN string names in a position, with squares in algebraic
+// notation and the move rewritten as canonical SAN
+type ResolvedSAN struct {
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Promotion PieceType `json:"promotion,omitempty"`
+	SAN       string    `json:"san"`
+}
+
+// handleResolveSAN checks a typed SAN against the legal moves of a FEN position, for practice
+// outside of a puzzle. Malformed SAN is a 400; SAN that is well-formed but illegal or ambiguous
+// in the position is a 422.
+func handleResolveSAN(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		FEN string `json:"fen"`
+		SAN string `json:"san"`
+	}
+	if !decodeJSON(w, r, &req, "Invalid request body") {
+		return
+	}
+
+	pos, err := ParseFEN(req.FEN)
+	if err != nil {
+		http.Error(w, "Invalid FEN: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The FEN gives castling and en passant rights, so resolve against the full position
+	// rather than through ResolveSAN, which has to guess them from the board
+	move, err := resolveSAN(pos, req.SAN)
+	if err != nil {
+		status := http.StatusUnprocessableEntity
+		if errors.Is(err, ErrInvalidSAN) {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ResolvedSAN{
+		From:      squareName(move.FromRow, move.FromCol),
+		To:        squareName(move.ToRow, move.ToCol),
+		Promotion: move.Promotion,
+		SAN:       moveToSAN(pos, move),
+	})
+}
+
+// maxSANNormalizeBatch caps how many moves one normalize request may send
+const maxSANNormalizeBatch = 500
+
+// NormalizedSAN is one move of a normalize request: the text sent, the form answers are compared
+// in, and whether the text reads as SAN at all. Error says why it doesn't.
+type NormalizedSAN struct {
+	Input      string `json:"input"`
+	Normalized string `json:"normalized"`
+	Valid      bool   `json:"valid"`
+	Error      string `json:"error,omitempty"`
+}
+
+// stripMoveNumber removes a leading move number such as "12." or "12..." from a move. Castling
+// written with zeros ("0-0") has no dot after the digit and is left alone.
+func stripMoveNumber(s string) string {
+	s = strings.TrimSpace(s)
+	digits := 0
+	for digits < len(s) && s[digits] >= '0' && s[digits] <= '9' {
+		digits++
+	}
+	if digits == 0 || digits == len(s) || s[digits] != '.' {
+		return s
+	}
+	return strings.TrimSpace(strings.TrimLeft(s[digits:], "."))
+}
+
+// handleNormalizeSAN shows how each move in a list is normalized before it is compared with a
+// puzzle solution, so clients can see why an answer didn't match. Moves are only checked as SAN,
+// not against a position.
+func handleNormalizeSAN(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Moves []string `json:"moves"`
+	}
+	if !decodeJSON(w, r, &req, "Invalid request body") {
+		return
+	}
+	if len(req.Moves) == 0 {
+		http.Error(w, "moves must not be empty", http.StatusBadRequest)
+		return
+	}
+	if len(req.Moves) > maxSANNormalizeBatch {
+		http.Error(w, fmt.Sprintf("moves must not contain more than %d entries", maxSANNormalizeBatch), http.StatusBadRequest)
+		return
+	}
+
+	results := make([]NormalizedSAN, 0, len(req.Moves))
+	for _, move := range req.Moves {
+		result := NormalizedSAN{Input: move, Normalized: normalizeSAN(move), Valid: true}
+		if _, err := parseSAN(stripMoveNumber(move)); err != nil {
+			result.Valid = false
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"moves": results})
+}
+
+func handleMove(w http.ResponseWriter, r *http.Request) {
+	var move Move
+	if !decodeJSON(w, r, &move, "Invalid move data") {
+		return
+	}
+	if err := move.Validate(); err != nil {
+		http.Error(w, "Invalid move: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	gameLock.Lock()
+	defer gameLock.Unlock()
+
+	if game.GameOver {
+		http.Error(w, "Game is over", http.StatusBadRequest)
+		return
+	}
+
+	// Validate move
+	if !isValidMove(move) {
+		http.Error(w, "Invalid move", http.StatusBadRequest)
+		return
+	}
+
+	// Make the move, noting it in SAN first since that depends on the position before it
+	san := moveToSAN(gamePosition(), move)
+	makeMove(move)
+	game.SANHistory = append(game.SANHistory, san)
+
+	// Moving instead of answering declines the opponent's draw offer
+	if game.DrawOfferedBy != "" && game.DrawOfferedBy != game.CurrentPlayer {
+		game.DrawOfferedBy = ""
+	}
+
+	// Check for game over
+	if isCheckmate() {
+		endGame("checkmate", game.CurrentPlayer)
+	}
+
+	// Switch players
+	if game.CurrentPlayer == "white" {
+		game.CurrentPlayer = "black"
+	} else {
+		game.CurrentPlayer = "white"
+	}
+	game.PositionHistory = append(game.PositionHistory, positionKey(&game.Board, game.CurrentPlayer))
+
+	// Checkmate or stalemate the player now to move
+	if !game.GameOver {
+		checkGameEnd(gamePosition())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(game)
+}
+
+// DrawClaims lists the draw claims the player to move could make now
+type DrawClaims struct {
+	Threefold     bool `json:"threefold"`
+	FiftyMove     bool `json:"fiftyMove"`
+	Repetitions   int  `json:"repetitions"` // times the current position has occurred
+	HalfmoveClock int  `json:"halfmoveClock"`
+}
+
+// handleDrawClaims reports whether threefold repetition or the fifty-move rule can be claimed
+func handleDrawClaims(w http.ResponseWriter, r *http.Request) {
+	gameLock.RLock()
+	defer gameLock.RUnlock()
+
+	claims := DrawClaims{HalfmoveClock: game.HalfmoveClock}
+	current := positionKey(&game.Board, game.CurrentPlayer)
+	for _, key := range game.PositionHistory {
+		if key == current {
+			claims.Repetitions++
+		}
+	}
+	if !game.GameOver {
+		claims.Threefold = claims.Repetitions >= 3
+		claims.FiftyMove = game.HalfmoveClock >= 100
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(claims)
+}
+
+// handleResign ends the game with the current player resigning
+func handleResign(w http.ResponseWriter, r *http.Request) {
+	gameLock.Lock()
+	defer gameLock.Unlock()
+
+	if game.GameOver {
+		http.Error(w, "Game is over", http.StatusBadRequest)
+		return
+	}
+
+	endGame("resignation", opponent(game.CurrentPlayer))
+	game.DrawOfferedBy = ""
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(game)
+}
+
+// handleDraw handles draw offers. The current player may offer a draw; the other player may
+// accept or decline it, and declines implicitly by making a move.
+func handleDraw(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Action string `json:"action"` // offer|accept|decline
+	}
+	if !decodeJSON(w, r, &req, "Invalid request body") {
+		return
+	}
+
+	gameLock.Lock()
+	defer gameLock.Unlock()
+
+	if game.GameOver {
+		http.Error(w, "Game is over", http.StatusBadRequest)
+		return
+	}
+
+	switch req.Action {
+	case "offer":
+		if game.DrawOfferedBy != "" {
+			http.Error(w, "A draw offer is already pending", http.StatusConflict)
+			return
+		}
+		game.DrawOfferedBy = game.CurrentPlayer
+
+	case "accept", "decline":
+		if game.DrawOfferedBy == "" {
+			http.Error(w, "No draw offer is pending", http.StatusConflict)
+			return
+		}
+		if game.CurrentPlayer == game.DrawOfferedBy {
+			http.Error(w, "Only the opponent can answer a draw offer", http.StatusConflict)
+			return
+		}
+		if req.Action == "accept" {
+			endGame("agreed-draw", "")
+		}
+		game.DrawOfferedBy = ""
+
+	default:
+		http.Error(w, "action must be offer, accept or decline", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(game)
+}
+
+func handleNewGame(w http.ResponseWriter, r *http.Request) {
+	gameLock.Lock()
+	defer gameLock.Unlock()
+
+	setupPieces()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(game)
 }
 
 func handleReset(w http.ResponseWriter, r *http.Request) {
@@ -591,6 +1571,51 @@ func handleReset(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(game)
 }
 
+// handleLoadFEN starts the game from a FEN position and remembers it for replay
+func handleLoadFEN(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		FEN string `json:"fen"`
+	}
+	if !decodeJSON(w, r, &req, "Invalid request body") {
+		return
+	}
+
+	pos, err := ParseFEN(req.FEN)
+	if err != nil {
+		http.Error(w, "Invalid FEN: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	gameLock.Lock()
+	defer gameLock.Unlock()
+
+	loadPosition(pos)
+	game.LoadedFEN = req.FEN
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(game)
+}
+
+// handleReplay restarts the game from the most recently loaded FEN
+func handleReplay(w http.ResponseWriter, r *http.Request) {
+	gameLock.Lock()
+	defer gameLock.Unlock()
+
+	if game.LoadedFEN == "" {
+		http.Error(w, "No FEN has been loaded to replay", http.StatusConflict)
+		return
+	}
+
+	pos, err := ParseFEN(game.LoadedFEN)
+	if err != nil {
+		http.Error(w, "Loaded FEN is no longer valid", http.StatusInternalServerError)
+		return
+	}
+
+	loadPosition(pos)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(game)
+}
+
 func isValidMove(move Move) bool {
 	// Check bounds
 	if move.FromRow < 0 || move.FromRow > 7 || move.FromCol < 0 || move.FromCol > 7 ||
@@ -755,6 +1780,13 @@ func isValidKingMove(move Move) bool {
 }
 
 func makeMove(move Move) {
+	// The halfmove clock restarts on captures and pawn moves
+	if game.Board[move.ToRow][move.ToCol] != nil || game.Board[move.FromRow][move.FromCol].Type == Pawn {
+		game.HalfmoveClock = 0
+	} else {
+		game.HalfmoveClock++
+	}
+
 	// Capture piece if present
 	if game.Board[move.ToRow][move.ToCol] != nil {
 		capturedPiece := game.Board[move.ToRow][move.ToCol]
@@ -808,40 +1840,40 @@ func max(a, b int) int {
 
 // Puzzle API handlers
 func handleNextPuzzle(w http.ResponseWriter, r *http.Request) {
-	difficulty := r.URL.Query().Get("difficulty")
-	if difficulty == "" {
+	if r.URL.Query().Get("difficulty") == "" {
 		http.Error(w, "difficulty parameter required", http.StatusBadRequest)
 		return
 	}
 
 	// Validate difficulty
-	validDifficulties := map[string]bool{"easy": true, "intermediate": true, "advanced": true}
-	if !validDifficulties[difficulty] {
-		http.Error(w, "invalid difficulty: must be easy, intermediate, or advanced", http.StatusBadRequest)
+	difficulty, err := model.NormalizeDifficulty(r.URL.Query().Get("difficulty"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	userID := currentUserID(r)
+
 	// Check if a specific puzzle ID was requested
 	requestedPuzzleID := r.URL.Query().Get("puzzleId")
 	if requestedPuzzleID != "" {
 		// Get the specific puzzle
-		var puzzle model.PuzzleDB
-		err := db.Get(&puzzle, `
-			SELECT id, fen, side_to_move, difficulty 
-			FROM puzzles 
-			WHERE id = ? AND difficulty = ?
-		`, requestedPuzzleID, difficulty)
-
-		if err != nil {
+		puzzle, err := getPuzzleByID(requestedPuzzleID)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "failed to get puzzle", http.StatusInternalServerError)
+			return
+		}
+		if err != nil || puzzle.Difficulty != difficulty {
 			http.Error(w, "puzzle not found: "+requestedPuzzleID, http.StatusNotFound)
 			return
 		}
 
 		response := map[string]interface{}{
-			"id":         puzzle.ID,
-			"fen":        puzzle.FEN,
-			"sideToMove": extractSideToMove(puzzle.FEN),
-			"difficulty": puzzle.Difficulty,
+			"id":          puzzle.ID,
+			"fen":         puzzle.FEN,
+			"sideToMove":  model.SideToMove(puzzle.FEN),
+			"difficulty":  puzzle.Difficulty,
+			"orientation": boardOrientationFor(userID, puzzle.FEN),
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -849,8 +1881,12 @@ func handleNextPuzzle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// TODO: Get user ID from session/auth
-	userID := "default_user"
+	// A user mid-way through a trainer set continues at the next puzzle by position
+	if response, ok := nextSetPuzzle(userID, difficulty); ok {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+		return
+	}
 
 	// Initialize woodpecker service
 	woodpeckerService := woodpecker.NewService(db)
@@ -858,15 +1894,16 @@ func handleNextPuzzle(w http.ResponseWriter, r *http.Request) {
 	// Get next puzzle from daily plan
 	puzzleID, err := woodpeckerService.GetNextPuzzle(userID, difficulty)
 	if err != nil {
-		// Fallback to ordered puzzle if daily plan fails
+		// Fallback to ordered puzzle if daily plan fails, leaving puzzles skipped today until last
 		var puzzle model.PuzzleDB
 		err := db.Get(&puzzle, `
-			SELECT id, fen, side_to_move, difficulty 
-			FROM puzzles 
-			WHERE difficulty = ? 
-			ORDER BY id 
+			SELECT p.id, p.fen, p.side_to_move, p.difficulty
+			FROM puzzles p
+			LEFT JOIN progress pr ON pr.puzzle_id = p.id AND pr.user_id = ? AND date(pr.skipped_at) = date('now')
+			WHERE p.difficulty = ?
+			ORDER BY pr.id IS NOT NULL, p.id
 			LIMIT 1
-		`, difficulty)
+		`, userID, difficulty)
 
 		if err != nil {
 			http.Error(w, "no puzzles found for difficulty: "+difficulty, http.StatusNotFound)
@@ -874,10 +1911,11 @@ func handleNextPuzzle(w http.ResponseWriter, r *http.Request) {
 		}
 
 		response := map[string]interface{}{
-			"id":         puzzle.ID,
-			"fen":        puzzle.FEN,
-			"sideToMove": extractSideToMove(puzzle.FEN),
-			"difficulty": puzzle.Difficulty,
+			"id":          puzzle.ID,
+			"fen":         puzzle.FEN,
+			"sideToMove":  model.SideToMove(puzzle.FEN),
+			"difficulty":  puzzle.Difficulty,
+			"orientation": boardOrientationFor(userID, puzzle.FEN),
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -886,775 +1924,3574 @@ func handleNextPuzzle(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get puzzle details
-	var puzzle model.PuzzleDB
-	err = db.Get(&puzzle, `
-		SELECT id, fen, side_to_move, difficulty 
-		FROM puzzles 
-		WHERE id = ?
-	`, puzzleID)
-
+	puzzle, err := getPuzzleByID(resurfaceSkipped(userID, puzzleID))
 	if err != nil {
-		http.Error(w, "puzzle not found", http.StatusNotFound)
+		repoError(w, err, "puzzle not found", "failed to get puzzle")
 		return
 	}
 
 	response := map[string]interface{}{
-		"id":         puzzle.ID,
-		"fen":        puzzle.FEN,
-		"sideToMove": extractSideToMove(puzzle.FEN),
-		"difficulty": puzzle.Difficulty,
+		"id":          puzzle.ID,
+		"fen":         puzzle.FEN,
+		"sideToMove":  model.SideToMove(puzzle.FEN),
+		"difficulty":  puzzle.Difficulty,
+		"orientation": boardOrientationFor(userID, puzzle.FEN),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
-type GradeRequest struct {
-	PuzzleID  string   `json:"puzzleId"`
-	PlayedSAN []string `json:"playedSans"`
-}
+// nextSetPuzzle finds the next unattempted puzzle of the difficulty, by position, in the cycle of
+// the user's open session. It reports false when the user has no open session, the cycle's puzzles
+// of that difficulty have all been attempted, or the lookup fails, so the caller falls back to the
+// daily plan.
+func nextSetPuzzle(userID, difficulty string) (map[string]interface{}, bool) {
+	repo := repository.NewSQLiteRepository(db)
+	session, err := repo.GetOpenSessionByUserID(userID)
+	if err != nil {
+		if !errors.Is(err, repository.ErrNotFound) {
+			slog.Error("Error finding open session", "user", userID, "error", err)
+		}
+		return nil, false
+	}
 
-type GradeResponse struct {
-	Correct     bool     `json:"correct"`
-	Score       int      `json:"score"`
-	MatchedLine []string `json:"matchedLine"`
+	setPuzzle, err := repo.GetNextUnattemptedSetPuzzle(session.CycleID, difficulty)
+	if err != nil {
+		if !errors.Is(err, repository.ErrNotFound) {
+			slog.Error("Error finding next set puzzle", "cycle", session.CycleID, "error", err)
+		}
+		return nil, false
+	}
+
+	puzzle, err := getPuzzleByID(setPuzzle.PuzzleID)
+	if err != nil {
+		slog.Error("Error loading set puzzle", "puzzle", setPuzzle.PuzzleID, "error", err)
+		return nil, false
+	}
+
+	return map[string]interface{}{
+		"id":          puzzle.ID,
+		"fen":         puzzle.FEN,
+		"sideToMove":  model.SideToMove(puzzle.FEN),
+		"difficulty":  puzzle.Difficulty,
+		"orientation": boardOrientationFor(userID, puzzle.FEN),
+		"setId":       setPuzzle.SetID,
+		"cycleId":     session.CycleID,
+		"sessionId":   session.ID,
+		"position":    setPuzzle.Position,
+	}, true
 }
 
-func handleGradePuzzle(w http.ResponseWriter, r *http.Request) {
-	var req GradeRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid JSON", http.StatusBadRequest)
-		return
+// currentUserID returns the authenticated user for routes that don't require auth,
+// falling back to the shared default user for anonymous requests and invalid credentials
+func currentUserID(r *http.Request) string {
+	if userID, ok := r.Context().Value("user_id").(string); ok && userID != "" {
+		return userID
 	}
 
-	if req.PuzzleID == "" {
-		http.Error(w, "puzzleId required", http.StatusBadRequest)
-		return
+	// API keys take precedence over cookies, as in AuthMiddleware
+	if authHeader := r.Header.Get("Authorization"); strings.HasPrefix(authHeader, "Bearer ") {
+		if userID, _, err := authenticateAPIKey(strings.TrimPrefix(authHeader, "Bearer ")); err == nil {
+			return userID
+		}
+		return "default_user"
+	}
+
+	if cookie, err := r.Cookie("auth_token"); err == nil {
+		if claims, err := tokenValidator.ValidateToken(cookie.Value); err == nil {
+			return claims.UserID
+		}
+	}
+
+	return "default_user"
+}
+
+// boardOrientationFor resolves the user's board orientation preference for a puzzle,
+// mapping "auto" to the side to move
+func boardOrientationFor(userID, fen string) string {
+	repo := repository.NewSQLiteRepository(db)
+	settings, err := repo.GetUserSettingsByUserID(userID)
+	if err == nil && (settings.BoardOrientation == "white" || settings.BoardOrientation == "black") {
+		return settings.BoardOrientation
+	}
+
+	if model.SideToMove(fen) == "b" {
+		return "black"
+	}
+	return "white"
+}
+
+// requireSolution writes a 422 and returns false when the puzzle has no solution to grade
+// against, so clients can skip it rather than report every answer as wrong
+func requireSolution(w http.ResponseWriter, puzzle *model.Puzzle) bool {
+	if puzzle.Solution.IsEmpty() {
+		http.Error(w, "puzzle has no solution", http.StatusUnprocessableEntity)
+		return false
 	}
+	return true
+}
+
+// loadPuzzle loads a puzzle with its solution for grading, writing a 404 if it doesn't exist
+// or a 500 if it can't be read or its stored solution is corrupt
+func loadPuzzle(w http.ResponseWriter, puzzleID string) (*model.Puzzle, bool) {
+	puzzleDB, err := getPuzzleByID(puzzleID)
+	if err != nil {
+		repoError(w, err, "puzzle not found", "failed to get puzzle")
+		return nil, false
+	}
+
+	if err := puzzleDB.CheckSolution(); err != nil {
+		slog.Error("Puzzle solution corrupt", "puzzle", puzzleID, "error", err)
+		http.Error(w, "puzzle solution corrupt", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return puzzleDB.ToPuzzle(), true
+}
 
-	// Load puzzle from database
-	var puzzleDB model.PuzzleDB
-	err := db.Get(&puzzleDB, `
-		SELECT id, fen, side_to_move, difficulty, solution_json, ticks_json 
-		FROM puzzles 
-		WHERE id = ?
-	`, req.PuzzleID)
+// handlePuzzleNeighbors returns the previous and next puzzle IDs within the puzzle's difficulty,
+// ordered by ID, with null at either end
+func handlePuzzleNeighbors(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	puzzleID := vars["puzzleId"]
 
+	var difficulty string
+	err := db.Get(&difficulty, `SELECT difficulty FROM puzzles WHERE id = ?`, puzzleID)
 	if err != nil {
 		http.Error(w, "puzzle not found", http.StatusNotFound)
 		return
 	}
 
-	// Convert to model.Puzzle
-	puzzle := puzzleDB.ToPuzzle()
-
-	// Grade the solution
-	correct, score, matchedLine := gradeSolution(puzzle, req.PlayedSAN)
-
-	// TODO: Save/merge progress row for user
-	// For now, just return the grade
+	var prevID, nextID *string
+	var prev string
+	err = db.Get(&prev, `SELECT id FROM puzzles WHERE difficulty = ? AND id < ? ORDER BY id DESC LIMIT 1`, difficulty, puzzleID)
+	if err == nil {
+		prevID = &prev
+	} else if err != sql.ErrNoRows {
+		http.Error(w, "Failed to get neighbors", http.StatusInternalServerError)
+		return
+	}
 
-	response := GradeResponse{
-		Correct:     correct,
-		Score:       score,
-		MatchedLine: matchedLine,
+	var next string
+	err = db.Get(&next, `SELECT id FROM puzzles WHERE difficulty = ? AND id > ? ORDER BY id LIMIT 1`, difficulty, puzzleID)
+	if err == nil {
+		nextID = &next
+	} else if err != sql.ErrNoRows {
+		http.Error(w, "Failed to get neighbors", http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"puzzleId":   puzzleID,
+		"difficulty": difficulty,
+		"prev":       prevID,
+		"next":       nextID,
+	})
 }
 
-func gradeSolution(puzzle *model.Puzzle, playedSAN []string) (bool, int, []string) {
-	if len(playedSAN) == 0 {
-		return false, 0, nil
+// handlePuzzleLength returns how many moves the user must find and how many of them are ticks,
+// without revealing the moves themselves
+func handlePuzzleLength(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	puzzle, ok := loadPuzzle(w, vars["puzzleId"])
+	if !ok {
+		return
 	}
 
-	// Check if first move matches any solution line
-	correct := false
-	score := 0
-	var matchedLine []string
-
-	// Depth-first search through solution lines
-	var dfs func(lines []model.Line, depth int) bool
-	dfs = func(lines []model.Line, depth int) bool {
-		for _, line := range lines {
-			if line.SAN == "" {
-				continue
-			}
+	// The user plays every other ply of the main line, starting with the first
+	mainLine := puzzle.Solution.MainLine()
+	userMoves := (len(mainLine) + 1) / 2
 
-			// Check if this move matches what was played
-			if depth < len(playedSAN) && line.SAN == playedSAN[depth] {
-				// This move matches, check if it's a tick
-				if line.IsTick {
-					score++
-				}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"puzzleId":      puzzle.ID,
+		"userMoves":     userMoves,
+		"requiredTicks": len(puzzle.Ticks),
+	})
+}
 
-				// If this is the first move and it matches, mark as correct
-				if depth == 0 {
-					correct = true
-				}
+// OnlyMoveResponse reports whether a puzzle's first solution move is forced
+type OnlyMoveResponse struct {
+	PuzzleID   string `json:"puzzleId"`
+	Move       string `json:"move"`
+	LegalMoves int    `json:"legalMoves"`
+	OnlyMove   bool   `json:"onlyMove"`
+}
 
-				// Add to matched line
-				if depth < len(matchedLine) {
-					matchedLine[depth] = line.SAN
-				} else {
-					matchedLine = append(matchedLine, line.SAN)
-				}
+// handlePuzzleOnlyMove reports whether the first solution move is the only legal move in the
+// puzzle position. Such puzzles test seeing the idea rather than choosing between moves.
+func handlePuzzleOnlyMove(w http.ResponseWriter, r *http.Request) {
+	puzzle, ok := loadPuzzle(w, mux.Vars(r)["puzzleId"])
+	if !ok || !requireSolution(w, puzzle) {
+		return
+	}
 
-				// Continue with children if we have more moves to check
-				if depth+1 < len(playedSAN) && len(line.Children) > 0 {
-					if dfs(line.Children, depth+1) {
-						return true
-					}
-				} else if depth+1 >= len(playedSAN) {
-					// We've matched all played moves
-					return true
-				}
-			}
-		}
-		return false
+	pos, err := ParseFEN(puzzle.FEN)
+	if err != nil {
+		slog.Warn("Puzzle has invalid FEN", "puzzle", puzzle.ID, "error", err)
+		http.Error(w, "puzzle position invalid", http.StatusInternalServerError)
+		return
 	}
 
-	dfs(puzzle.Solution.Lines, 0)
+	first := puzzle.Solution.MainLine()[0].SAN
+	if _, err := resolveSAN(pos, first); err != nil {
+		slog.Warn("Puzzle solution move is unplayable", "puzzle", puzzle.ID, "move", 1, "error", err)
+		http.Error(w, "puzzle solution cannot be played from its position", http.StatusUnprocessableEntity)
+		return
+	}
 
-	return correct, score, matchedLine
+	legal := len(pos.LegalMoves())
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(OnlyMoveResponse{
+		PuzzleID:   puzzle.ID,
+		Move:       first,
+		LegalMoves: legal,
+		OnlyMove:   legal == 1,
+	})
 }
 
-// GradeLineRequest represents the request body for grading a line of moves
-type GradeLineRequest struct {
-	PuzzleID string   `json:"puzzleId"`
-	TypedSAN []string `json:"typedSans"`
+// HintRequest represents the request body for a progressive hint
+type HintRequest struct {
+	PlayedSAN []string `json:"playedSans"`
 }
 
-// GradeLineResponse represents the response for grading a line of moves
-type GradeLineResponse struct {
-	Correct         bool     `json:"correct"`
-	Score           int      `json:"score"`
-	TicksMatched    []int    `json:"ticksMatched"`
-	DepthMatched    int      `json:"depthMatched"`
-	EarliestMistake *int     `json:"earliestMistake"`
-	BestLine        []string `json:"bestLine"`
-	RequiredTicks   []string `json:"requiredTicks"`
+// HintResponse reveals more of the next solution move at each level:
+// 1 the piece type, 2 the from-square, 3 the full move
+type HintResponse struct {
+	PuzzleID   string    `json:"puzzleId"`
+	Ply        int       `json:"ply"`
+	Level      int       `json:"level"`
+	PieceType  PieceType `json:"pieceType"`
+	FromSquare string    `json:"fromSquare,omitempty"`
+	ToSquare   string    `json:"toSquare,omitempty"`
+	Move       string    `json:"move,omitempty"`
 }
 
-func handleGradeLine(w http.ResponseWriter, r *http.Request) {
-	var req GradeLineRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid JSON", http.StatusBadRequest)
+const maxHintLevel = 3
+
+// handlePuzzleHint gives a progressive hint for the next main line move after the played moves.
+// Repeated calls for the same ply reveal more, until the puzzle is graded again.
+func handlePuzzleHint(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	puzzle, ok := loadPuzzle(w, vars["puzzleId"])
+	if !ok {
 		return
 	}
 
-	if req.PuzzleID == "" {
-		http.Error(w, "puzzleId required", http.StatusBadRequest)
+	var req HintRequest
+	if !decodeJSON(w, r, &req, "invalid JSON") {
 		return
 	}
 
-	// Load puzzle from database
-	var puzzleDB model.PuzzleDB
-	err := db.Get(&puzzleDB, `
-		SELECT id, fen, side_to_move, difficulty, solution_json, ticks_json 
-		FROM puzzles 
-		WHERE id = ?
-	`, req.PuzzleID)
+	// The hint is for the first played move that leaves the main line, or the move after them
+	mainLine := puzzle.Solution.MainLine()
+	ply := 0
+	for ply < len(req.PlayedSAN) && ply < len(mainLine) && normalizeSAN(req.PlayedSAN[ply]) == normalizeSAN(mainLine[ply].SAN) {
+		ply++
+	}
+	if ply >= len(mainLine) {
+		http.Error(w, "puzzle already solved", http.StatusBadRequest)
+		return
+	}
 
+	pos, err := ParseFEN(puzzle.FEN)
 	if err != nil {
-		http.Error(w, "puzzle not found", http.StatusNotFound)
+		slog.Warn("Puzzle has invalid FEN", "puzzle", puzzle.ID, "error", err)
+		http.Error(w, "puzzle position invalid", http.StatusInternalServerError)
 		return
 	}
 
-	// Convert to model.Puzzle
-	puzzle := puzzleDB.ToPuzzle()
+	var next Move
+	for i := 0; i <= ply; i++ {
+		next, err = resolveSAN(pos, mainLine[i].SAN)
+		if err != nil {
+			slog.Warn("Puzzle solution move is unplayable", "puzzle", puzzle.ID, "move", i+1, "error", err)
+			http.Error(w, "puzzle solution cannot be played from its position", http.StatusUnprocessableEntity)
+			return
+		}
+		if i < ply {
+			pos = pos.applyMove(next)
+		}
+	}
+
+	userID := currentUserID(r)
 
-	// Grade the line
-	response := gradeLine(puzzle, req.TypedSAN)
+	// Count earlier hints for this ply since the user last graded the puzzle
+	var previous int
+	err = db.Get(&previous, `
+		SELECT COUNT(*) FROM hints
+		WHERE user_id = ? AND puzzle_id = ? AND ply = ?
+		AND created_at > COALESCE((SELECT updated_at FROM progress WHERE user_id = ? AND puzzle_id = ?), '')
+	`, userID, puzzle.ID, ply, userID, puzzle.ID)
+	if err != nil {
+		http.Error(w, "Failed to load hints", http.StatusInternalServerError)
+		return
+	}
+
+	level := previous + 1
+	if level > maxHintLevel {
+		level = maxHintLevel
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO hints (user_id, puzzle_id, ply, level)
+		VALUES (?, ?, ?, ?)
+	`, userID, puzzle.ID, ply, level)
+	if err != nil {
+		http.Error(w, "Failed to record hint", http.StatusInternalServerError)
+		return
+	}
 
-	// Save progress (for now using a default user_id)
-	userID := "default_user" // TODO: Get from session/auth
-	saveProgress(userID, req.PuzzleID, req.TypedSAN, response.Score, response.DepthMatched)
+	response := HintResponse{
+		PuzzleID:  puzzle.ID,
+		Ply:       ply,
+		Level:     level,
+		PieceType: pos.Board[next.FromRow][next.FromCol].Type,
+	}
+	if level >= 2 {
+		response.FromSquare = squareName(next.FromRow, next.FromCol)
+	}
+	if level >= 3 {
+		response.ToSquare = squareName(next.ToRow, next.ToCol)
+		response.Move = mainLine[ply].SAN
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
-func gradeLine(puzzle *model.Puzzle, typedSAN []string) GradeLineResponse {
-	response := GradeLineResponse{
-		Correct:         false,
-		Score:           0,
-		TicksMatched:    []int{},
-		DepthMatched:    0,
-		EarliestMistake: nil,
-		BestLine:        []string{},
-		RequiredTicks:   puzzle.Ticks,
+// hintLevelsUsed totals the hint levels the user revealed for a puzzle since last grading it,
+// counting the highest level reached at each ply
+func hintLevelsUsed(userID, puzzleID string) (int, error) {
+	var levels int
+	err := db.Get(&levels, `
+		SELECT COALESCE(SUM(level), 0) FROM (
+			SELECT MAX(level) AS level FROM hints
+			WHERE user_id = ? AND puzzle_id = ?
+			AND created_at > COALESCE((SELECT updated_at FROM progress WHERE user_id = ? AND puzzle_id = ?), '')
+			GROUP BY ply
+		)
+	`, userID, puzzleID, userID, puzzleID)
+	return levels, err
+}
+
+// TraceResponse lists the position after each legal typed move. FirstIllegal is the index of the
+// first move that couldn't be played, after which tracing stops.
+type TraceResponse struct {
+	PuzzleID      string   `json:"puzzleId"`
+	StartFEN      string   `json:"startFen"`
+	FENs          []string `json:"fens"`
+	FirstIllegal  *int     `json:"firstIllegal"`
+	IllegalReason string   `json:"illegalReason,omitempty"`
+}
+
+// handlePuzzleTrace plays a typed line from the puzzle's starting position for review
+func handlePuzzleTrace(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	puzzle, ok := loadPuzzle(w, vars["puzzleId"])
+	if !ok {
+		return
 	}
 
-	if len(typedSAN) == 0 {
-		return response
+	var req struct {
+		TypedSAN []string `json:"typedSans"`
+	}
+	if !decodeJSON(w, r, &req, "invalid JSON") {
+		return
 	}
 
-	// For flat solution structure, just check moves in order
-	var ticksMatched []int
-	var depthMatched int
-	var earliestMistake *int
-	var bestLine []string
+	pos, err := ParseFEN(puzzle.FEN)
+	if err != nil {
+		slog.Warn("Puzzle has invalid FEN", "puzzle", puzzle.ID, "error", err)
+		http.Error(w, "puzzle position invalid", http.StatusInternalServerError)
+		return
+	}
 
-	// Check each typed move against the solution
-	for i, typedMove := range typedSAN {
-		if i >= len(puzzle.Solution.Lines) {
-			// More moves typed than in solution
-			if earliestMistake == nil {
-				earliestMistake = &i
-			}
+	response := TraceResponse{
+		PuzzleID: puzzle.ID,
+		StartFEN: pos.FEN(),
+		FENs:     []string{},
+	}
+	for i, san := range req.TypedSAN {
+		move, err := resolveSAN(pos, san)
+		if err != nil {
+			response.FirstIllegal = &i
+			response.IllegalReason = err.Error()
 			break
 		}
+		pos = pos.applyMove(move)
+		response.FENs = append(response.FENs, pos.FEN())
+	}
 
-		solutionMove := puzzle.Solution.Lines[i]
-		normalizedTyped := normalizeSAN(typedMove)
-		normalizedSolution := normalizeSAN(solutionMove.SAN)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
 
-		if normalizedTyped == normalizedSolution {
-			// Move matches
-			bestLine = append(bestLine, solutionMove.SAN)
-			depthMatched = i + 1
+// IsTickResponse says whether the last played move is a tick. OnSolution is false once the line
+// leaves the solution, in which case the move can't be a tick.
+type IsTickResponse struct {
+	PuzzleID   string `json:"puzzleId"`
+	Ply        int    `json:"ply"`
+	Move       string `json:"move"`
+	OnSolution bool   `json:"onSolution"`
+	IsTick     bool   `json:"isTick"`
+}
 
-			// If this is the first move and it matches, mark as correct
-			if i == 0 {
-				response.Correct = true
-			}
+// handlePuzzleIsTick tells the client, as the user plays, whether the move just played is a key
+// move of the solution
+func handlePuzzleIsTick(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	puzzle, ok := loadPuzzle(w, vars["puzzleId"])
+	if !ok {
+		return
+	}
 
-			// Check if this is a tick move
-			if solutionMove.IsTick {
-				ticksMatched = append(ticksMatched, i)
-			}
-		} else {
-			// Move doesn't match - this is a mistake
-			if earliestMistake == nil {
-				earliestMistake = &i
-			}
-			break
-		}
+	var req struct {
+		PlayedSAN []string `json:"playedSans"`
+		Notation  string   `json:"notation"`
+	}
+	if !decodeJSON(w, r, &req, "invalid JSON") {
+		return
+	}
+	if len(req.PlayedSAN) == 0 {
+		http.Error(w, "playedSans must contain at least one move", http.StatusBadRequest)
+		return
 	}
 
-	// Update response with results
-	response.BestLine = bestLine
-	response.TicksMatched = ticksMatched
-	response.DepthMatched = depthMatched
-	response.EarliestMistake = earliestMistake
+	played, ok := playedMovesAsSAN(w, puzzle, req.Notation, req.PlayedSAN)
+	if !ok {
+		return
+	}
 
-	// Calculate score: 1 if first move correct, plus 1 for each tick matched
-	if response.Correct {
-		response.Score = 1 + len(ticksMatched)
+	response := IsTickResponse{
+		PuzzleID: puzzle.ID,
+		Ply:      len(played) - 1,
+		Move:     played[len(played)-1],
+	}
+	if node := solutionNodeAt(puzzle.Solution, played); node != nil {
+		response.OnSolution = true
+		response.IsTick = node.IsTick
 	}
 
-	return response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
 }
 
-// normalizeSAN normalizes SAN notation for comparison
-// Accepts various SAN formats and returns a canonical form for comparison
-func normalizeSAN(s string) string {
-	// Convert to lowercase and trim whitespace
-	s = strings.ToLower(strings.TrimSpace(s))
+// solutionNodeAt follows the played moves through the solution and returns the node for the last
+// one, or nil if the line leaves the solution. Flat solutions are matched ply by ply; in tree
+// solutions any child of the previous move matches.
+func solutionNodeAt(solution model.Solution, played []string) *model.Line {
+	if !solution.IsTree() {
+		lines := solution.Lines
+		if len(played) > len(lines) {
+			return nil
+		}
+		for i, san := range played {
+			if normalizeSAN(san) != normalizeSAN(lines[i].SAN) {
+				return nil
+			}
+		}
+		return &lines[len(played)-1]
+	}
 
-	// Accept 0-0 = O-O, 0-0-0 = O-O-O
-	s = strings.ReplaceAll(s, "0-0-0", "o-o-o")
-	s = strings.ReplaceAll(s, "0-0", "o-o")
+	var node *model.Line
+	candidates := solution.Lines
+	for _, san := range played {
+		node = nil
+		for i := range candidates {
+			if normalizeSAN(san) == normalizeSAN(candidates[i].SAN) {
+				node = &candidates[i]
+				break
+			}
+		}
+		if node == nil {
+			return nil
+		}
+		candidates = node.Children
+	}
+	return node
+}
 
-	// Strip +, #, !?, move numbers, and ellipses
-	s = strings.ReplaceAll(s, "+", "")
+type GradeRequest struct {
+	PuzzleID  string   `json:"puzzleId"`
+	PlayedSAN []string `json:"playedSans"`
+	Notation  string   `json:"notation"` // "san" (default) or "uci"; see playedMovesAsSAN
+}
+
+type GradeResponse struct {
+	Correct     bool     `json:"correct"`
+	Score       int      `json:"score"`
+	MatchedLine []string `json:"matchedLine"`
+}
+
+// handlePuzzleSkip skips a puzzle without scoring it. The skip is noted on the user's progress so
+// the daily queue brings the puzzle back later, and with a sessionId it is also recorded as a
+// skipped attempt in that session.
+func handlePuzzleSkip(w http.ResponseWriter, r *http.Request) {
+	puzzleID := mux.Vars(r)["puzzleId"]
+
+	var req struct {
+		SessionID *int `json:"sessionId"`
+	}
+	if r.ContentLength != 0 && !decodeJSON(w, r, &req, "invalid JSON") {
+		return
+	}
+
+	var exists int
+	if err := db.Get(&exists, `SELECT COUNT(*) FROM puzzles WHERE id = ?`, puzzleID); err != nil || exists == 0 {
+		http.Error(w, "puzzle not found", http.StatusNotFound)
+		return
+	}
+
+	userID := currentUserID(r)
+	if req.SessionID != nil {
+		if !checkSessionOpen(w, *req.SessionID, userID) {
+			return
+		}
+
+		now := model.Now()
+		attempt := &model.Attempt{
+			SessionID: *req.SessionID,
+			PuzzleID:  puzzleID,
+			StartedAt: &now,
+			EndedAt:   &now,
+			Skipped:   true,
+		}
+		repo := repository.NewSQLiteRepository(db)
+		if err := repo.CreateAttempt(attempt); err != nil {
+			http.Error(w, "failed to record skip", http.StatusInternalServerError)
+			return
+		}
+		completeCycleIfFinished(repo, userID, *req.SessionID)
+	}
+
+	// A skip-only progress row has zero attempts, so it doesn't count as a failed attempt
+	_, err := db.Exec(`
+		INSERT INTO progress (user_id, puzzle_id, attempts, score, skipped_at)
+		VALUES (?, ?, 0, 0, CURRENT_TIMESTAMP)
+		ON CONFLICT(user_id, puzzle_id) DO UPDATE SET skipped_at = CURRENT_TIMESTAMP
+	`, userID, puzzleID)
+	if err != nil {
+		slog.Error("Error saving skip", "user", userID, "puzzle", puzzleID, "error", err)
+		http.Error(w, "failed to record skip", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"puzzleId": puzzleID,
+		"skipped":  true,
+	})
+}
+
+// TimeStats summarizes how fast a puzzle is solved, in milliseconds
+type TimeStats struct {
+	PuzzleID string `json:"puzzleId"`
+	Solves   int    `json:"solves"`
+	MedianMs *int   `json:"medianMs"`
+	P90Ms    *int   `json:"p90Ms"`
+	BestMs   *int   `json:"bestMs"` // the caller's fastest correct time
+}
+
+// percentile returns the nearest-rank percentile p (0-100] of an ascending slice
+func percentile(sorted []int, p float64) int {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// handlePuzzleTimeStats returns the median and p90 solve time over all correct attempts, and the caller's best
+func handlePuzzleTimeStats(w http.ResponseWriter, r *http.Request) {
+	puzzleID := mux.Vars(r)["puzzleId"]
+
+	var exists int
+	if err := db.Get(&exists, `SELECT COUNT(*) FROM puzzles WHERE id = ?`, puzzleID); err != nil || exists == 0 {
+		http.Error(w, "puzzle not found", http.StatusNotFound)
+		return
+	}
+
+	repo := repository.NewSQLiteRepository(db)
+	times, err := repo.GetSolveTimesByPuzzleID(puzzleID)
+	if err != nil {
+		http.Error(w, "failed to get solve times", http.StatusInternalServerError)
+		return
+	}
+
+	stats := TimeStats{PuzzleID: puzzleID, Solves: len(times)}
+	if len(times) > 0 {
+		median, p90 := percentile(times, 50), percentile(times, 90)
+		stats.MedianMs, stats.P90Ms = &median, &p90
+	}
+
+	stats.BestMs, err = repo.GetBestSolveTime(currentUserID(r), puzzleID)
+	if err != nil {
+		http.Error(w, "failed to get solve times", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// ScoreBucket counts the attempts that scored a given number of points
+type ScoreBucket struct {
+	Points int `json:"points"`
+	Count  int `json:"count"`
+}
+
+// ScoreDistribution is a histogram of the points scored on a puzzle
+type ScoreDistribution struct {
+	PuzzleID string        `json:"puzzleId"`
+	Attempts int           `json:"attempts"`
+	Buckets  []ScoreBucket `json:"buckets"`
+	Best     *int          `json:"best"` // the caller's highest score
+}
+
+// scoreHistogram counts scores into one bucket per point total from 0 up to the highest score,
+// including empty buckets so the histogram can be drawn as is
+func scoreHistogram(scores []int) []ScoreBucket {
+	buckets := []ScoreBucket{}
+	for _, score := range scores {
+		if score < 0 {
+			score = 0
+		}
+		for len(buckets) <= score {
+			buckets = append(buckets, ScoreBucket{Points: len(buckets)})
+		}
+		buckets[score].Count++
+	}
+	return buckets
+}
+
+// handlePuzzleScoreDistribution returns how the points scored on a puzzle are spread over all
+// attempts, and the caller's best score
+func handlePuzzleScoreDistribution(w http.ResponseWriter, r *http.Request) {
+	puzzleID := mux.Vars(r)["puzzleId"]
+
+	var exists int
+	if err := db.Get(&exists, `SELECT COUNT(*) FROM puzzles WHERE id = ?`, puzzleID); err != nil || exists == 0 {
+		http.Error(w, "puzzle not found", http.StatusNotFound)
+		return
+	}
+
+	repo := repository.NewSQLiteRepository(db)
+	scores, err := repo.GetScoresByPuzzleID(puzzleID)
+	if err != nil {
+		http.Error(w, "failed to get scores", http.StatusInternalServerError)
+		return
+	}
+
+	distribution := ScoreDistribution{
+		PuzzleID: puzzleID,
+		Attempts: len(scores),
+		Buckets:  scoreHistogram(scores),
+	}
+	distribution.Best, err = repo.GetBestScore(currentUserID(r), puzzleID)
+	if err != nil {
+		http.Error(w, "failed to get scores", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(distribution)
+}
+
+func handleGradePuzzle(w http.ResponseWriter, r *http.Request) {
+	var req GradeRequest
+	if !decodeJSON(w, r, &req, "invalid JSON") {
+		return
+	}
+
+	if req.PuzzleID == "" {
+		http.Error(w, "puzzleId required", http.StatusBadRequest)
+		return
+	}
+
+	puzzle, ok := loadPuzzle(w, req.PuzzleID)
+	if !ok || !requireSolution(w, puzzle) {
+		return
+	}
+
+	playedSAN, ok := playedMovesAsSAN(w, puzzle, req.Notation, req.PlayedSAN)
+	if !ok {
+		return
+	}
+
+	// Grade the solution
+	correct, score, matchedLine := gradeSolution(puzzle, playedSAN)
+
+	// TODO: Save/merge progress row for user
+	// For now, just return the grade
+
+	response := GradeResponse{
+		Correct:     correct,
+		Score:       score,
+		MatchedLine: matchedLine,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// playedMovesAsSAN returns the moves as SAN for grading. With notation "uci" each move is
+// resolved against the puzzle FEN and rewritten in SAN; an illegal or malformed move is a 400.
+// SAN (the default) is returned unchanged.
+func playedMovesAsSAN(w http.ResponseWriter, puzzle *model.Puzzle, notation string, moves []string) ([]string, bool) {
+	switch strings.ToLower(notation) {
+	case "", "san":
+		return moves, true
+	case "uci":
+		sans, err := uciLineToSAN(puzzle.FEN, moves)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return nil, false
+		}
+		return sans, true
+	default:
+		http.Error(w, `notation must be "san" or "uci"`, http.StatusBadRequest)
+		return nil, false
+	}
+}
+
+func gradeSolution(puzzle *model.Puzzle, playedSAN []string) (bool, int, []string) {
+	if len(playedSAN) == 0 {
+		return false, 0, nil
+	}
+
+	// Check if first move matches any solution line
+	correct := false
+	score := 0
+	var matchedLine []string
+
+	// Depth-first search through solution lines
+	var dfs func(lines []model.Line, depth int) bool
+	dfs = func(lines []model.Line, depth int) bool {
+		for _, line := range lines {
+			if line.SAN == "" {
+				continue
+			}
+
+			// Check if this move matches what was played, ignoring check marks and notation variants
+			if depth < len(playedSAN) && normalizeSAN(line.SAN) == normalizeSAN(playedSAN[depth]) {
+				// This move matches, check if it's a tick
+				if line.IsTick {
+					score++
+				}
+
+				// If this is the first move and it matches, mark as correct
+				if depth == 0 {
+					correct = true
+				}
+
+				// Add to matched line
+				if depth < len(matchedLine) {
+					matchedLine[depth] = line.SAN
+				} else {
+					matchedLine = append(matchedLine, line.SAN)
+				}
+
+				// Continue with children if we have more moves to check
+				if depth+1 < len(playedSAN) && len(line.Children) > 0 {
+					if dfs(line.Children, depth+1) {
+						return true
+					}
+				} else if depth+1 >= len(playedSAN) {
+					// We've matched all played moves
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	dfs(puzzle.Solution.Lines, 0)
+
+	return correct, score, matchedLine
+}
+
+// GradeLineRequest represents the request body for grading a line of moves
+type GradeLineRequest struct {
+	PuzzleID  string   `json:"puzzleId"`
+	TypedSAN  []string `json:"typedSans"`
+	Notation  string   `json:"notation"`  // "san" (default) or "uci"; see playedMovesAsSAN
+	SessionID *int     `json:"sessionId"` // optional; graded lines are recorded as attempts in the session
+	TimeMs    int      `json:"timeMs"`    // time spent on the puzzle, stored on the session attempt
+}
+
+// GradeLineResponse represents the response for grading a line of moves
+type GradeLineResponse struct {
+	Correct         bool     `json:"correct"`
+	Score           int      `json:"score"`
+	TicksMatched    []int    `json:"ticksMatched"`
+	DepthMatched    int      `json:"depthMatched"`
+	EarliestMistake *int     `json:"earliestMistake"`
+	BestLine        []string `json:"bestLine"`
+	RequiredTicks   []string `json:"requiredTicks"`
+	TicksMatchedSAN []string `json:"ticksMatchedSan"`
+	TicksMissedSAN  []string `json:"ticksMissedSan"`
+	// ReachedMate is true when the matched moves end in checkmate. PliesToMate is set only when
+	// the solution ends in checkmate, and counts the plies left after the matched moves.
+	ReachedMate bool `json:"reachedMate"`
+	PliesToMate *int `json:"pliesToMate,omitempty"`
+}
+
+func handleGradeLine(w http.ResponseWriter, r *http.Request) {
+	var req GradeLineRequest
+	if !decodeJSON(w, r, &req, "invalid JSON") {
+		return
+	}
+
+	if req.PuzzleID == "" {
+		http.Error(w, "puzzleId required", http.StatusBadRequest)
+		return
+	}
+
+	if req.TimeMs < 0 {
+		http.Error(w, "timeMs must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	userID := currentUserID(r)
+	if req.SessionID != nil && !checkSessionOpen(w, *req.SessionID, userID) {
+		return
+	}
+
+	puzzle, ok := loadPuzzle(w, req.PuzzleID)
+	if !ok || !requireSolution(w, puzzle) {
+		return
+	}
+
+	typedSAN, ok := playedMovesAsSAN(w, puzzle, req.Notation, req.TypedSAN)
+	if !ok {
+		return
+	}
+
+	// Hints are read from what the user actually revealed, not from the client
+	hintsUsed, err := hintLevelsUsed(userID, req.PuzzleID)
+	if err != nil {
+		http.Error(w, "Failed to load hints", http.StatusInternalServerError)
+		return
+	}
+
+	// Grade the line
+	response := gradeLine(puzzle, typedSAN, hintsUsed)
+
+	if req.SessionID != nil && !recordGradedAttempt(w, userID, *req.SessionID, req, response, hintsUsed) {
+		return
+	}
+
+	saveProgress(userID, req.PuzzleID, typedSAN, response.Score, response.DepthMatched, response.Correct)
+	recordDailyAttempt(userID, req.PuzzleID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// recordGradedAttempt stores a graded line as an attempt in the session, writing an error if it fails
+func recordGradedAttempt(w http.ResponseWriter, userID string, sessionID int, req GradeLineRequest, graded GradeLineResponse, hintsUsed int) bool {
+	now := time.Now()
+	startedAt := model.NewTimestamp(now.Add(-time.Duration(req.TimeMs) * time.Millisecond))
+	endedAt := model.NewTimestamp(now)
+	scoreFirstMove := 0
+	if graded.Correct {
+		scoreFirstMove = 1
+	}
+
+	attempt := &model.Attempt{
+		SessionID:        sessionID,
+		PuzzleID:         req.PuzzleID,
+		StartedAt:        &startedAt,
+		EndedAt:          &endedAt,
+		ScoreFirstMove:   scoreFirstMove,
+		ScoreTicks:       len(graded.TicksMatched),
+		TotalPoints:      graded.Score,
+		TimeMs:           req.TimeMs,
+		CorrectFirstMove: graded.Correct,
+		HintsUsed:        hintsUsed,
+	}
+	repo := repository.NewSQLiteRepository(db)
+	if err := repo.CreateAttempt(attempt); err != nil {
+		slog.Error("Error saving attempt", "session", sessionID, "puzzle", req.PuzzleID, "error", err)
+		http.Error(w, "failed to record attempt", http.StatusInternalServerError)
+		return false
+	}
+	completeCycleIfFinished(repo, userID, sessionID)
+	return true
+}
+
+func gradeLine(puzzle *model.Puzzle, typedSAN []string, hintsUsed int) GradeLineResponse {
+	response := GradeLineResponse{
+		Correct:         false,
+		Score:           0,
+		TicksMatched:    []int{},
+		DepthMatched:    0,
+		EarliestMistake: nil,
+		BestLine:        []string{},
+		RequiredTicks:   puzzle.Ticks,
+		TicksMatchedSAN: []string{},
+		TicksMissedSAN:  []string{},
+	}
+
+	if len(typedSAN) == 0 {
+		response.TicksMatchedSAN, response.TicksMissedSAN = splitTicks(puzzle.Solution.Lines, 0)
+		response.ReachedMate, response.PliesToMate = mateProgress(puzzle, 0)
+		return response
+	}
+
+	// For flat solution structure, just check moves in order
+	var ticksMatched []int
+	var depthMatched int
+	var earliestMistake *int
+	var bestLine []string
+
+	// Check each typed move against the solution
+	for i, typedMove := range typedSAN {
+		if i >= len(puzzle.Solution.Lines) {
+			// More moves typed than in solution
+			if earliestMistake == nil {
+				earliestMistake = &i
+			}
+			break
+		}
+
+		solutionMove := puzzle.Solution.Lines[i]
+		normalizedTyped := normalizeSAN(typedMove)
+		normalizedSolution := normalizeSAN(solutionMove.SAN)
+
+		if normalizedTyped == normalizedSolution {
+			// Move matches
+			bestLine = append(bestLine, solutionMove.SAN)
+			depthMatched = i + 1
+
+			// If this is the first move and it matches, mark as correct
+			if i == 0 {
+				response.Correct = true
+			}
+
+			// Check if this is a tick move
+			if solutionMove.IsTick {
+				ticksMatched = append(ticksMatched, i)
+			}
+		} else {
+			// Move doesn't match - this is a mistake
+			if earliestMistake == nil {
+				earliestMistake = &i
+			}
+			break
+		}
+	}
+
+	response.TicksMatchedSAN, response.TicksMissedSAN = splitTicks(puzzle.Solution.Lines, depthMatched)
+
+	// Update response with results
+	response.BestLine = bestLine
+	response.TicksMatched = ticksMatched
+	response.DepthMatched = depthMatched
+	response.EarliestMistake = earliestMistake
+
+	response.Score = ScorePuzzle(response.Correct, len(ticksMatched), hintsUsed)
+	response.ReachedMate, response.PliesToMate = mateProgress(puzzle, depthMatched)
+
+	return response
+}
+
+// mateProgress reports whether the first depth moves of the solution end in checkmate and, if
+// the solution ends in checkmate, how many plies remain after them
+func mateProgress(puzzle *model.Puzzle, depth int) (bool, *int) {
+	lines := puzzle.Solution.Lines
+	if len(lines) == 0 || !solutionEndsInMate(puzzle) {
+		return false, nil
+	}
+	remaining := len(lines) - depth
+	if remaining < 0 {
+		remaining = 0
+	}
+	return remaining == 0, &remaining
+}
+
+// solutionEndsInMate reports whether the solution's last move is checkmate, from its "#" suffix
+// or, failing that, by playing the line out from the puzzle FEN
+func solutionEndsInMate(puzzle *model.Puzzle) bool {
+	lines := puzzle.Solution.Lines
+	if len(lines) == 0 {
+		return false
+	}
+	if strings.HasSuffix(strings.TrimRight(lines[len(lines)-1].SAN, "!?"), "#") {
+		return true
+	}
+
+	pos, err := ParseFEN(puzzle.FEN)
+	if err != nil {
+		return false
+	}
+	for _, line := range lines {
+		move, err := resolveSAN(pos, line.SAN)
+		if err != nil {
+			return false
+		}
+		pos = pos.applyMove(move)
+	}
+	return inCheck(&pos.Board, pos.SideToMove) && len(pos.LegalMoves()) == 0
+}
+
+// hintPenalty is the number of points deducted per hint level used (HINT_PENALTY, default 1)
+var hintPenalty = 1
+
+// ScorePuzzle scores a graded line: 1 if the first move is correct, plus 1 for each tick matched,
+// minus hintPenalty per hint level used, floored at zero
+func ScorePuzzle(correct bool, ticksMatched, hintsUsed int) int {
+	if !correct {
+		return 0
+	}
+
+	score := 1 + ticksMatched - hintsUsed*hintPenalty
+	if score < 0 {
+		return 0
+	}
+	return score
+}
+
+// splitTicks separates the tick moves of a flat solution into those within the first
+// depthMatched moves and those the user didn't reach
+func splitTicks(lines []model.Line, depthMatched int) ([]string, []string) {
+	matched := []string{}
+	missed := []string{}
+	for i, line := range lines {
+		if !line.IsTick {
+			continue
+		}
+		if i < depthMatched {
+			matched = append(matched, line.SAN)
+		} else {
+			missed = append(missed, line.SAN)
+		}
+	}
+	return matched, missed
+}
+
+// normalizeSAN normalizes SAN notation for comparison
+// Accepts various SAN formats and returns a canonical form for comparison
+func normalizeSAN(s string) string {
+	// Convert to lowercase and trim whitespace
+	s = strings.ToLower(strings.TrimSpace(s))
+
+	// Accept 0-0 = O-O, 0-0-0 = O-O-O
+	s = strings.ReplaceAll(s, "0-0-0", "o-o-o")
+	s = strings.ReplaceAll(s, "0-0", "o-o")
+
+	// Strip +, #, !?, move numbers, and ellipses
+	s = strings.ReplaceAll(s, "+", "")
 	s = strings.ReplaceAll(s, "#", "")
 	s = strings.ReplaceAll(s, "!", "")
 	s = strings.ReplaceAll(s, "?", "")
 	s = strings.ReplaceAll(s, "!?", "")
 	s = strings.ReplaceAll(s, "?!", "")
 
-	// Remove move numbers and ellipses (e.g., "1.", "1...", "12.")
-	// Handle patterns like "1.", "12.", "1...", "12..." at the start
-	s = strings.ReplaceAll(s, "...", "")
-	s = strings.ReplaceAll(s, "..", "")
-	s = strings.ReplaceAll(s, ".", "")
+	// Remove move numbers and ellipses (e.g., "1.", "1...", "12.")
+	// Handle patterns like "1.", "12.", "1...", "12..." at the start
+	s = strings.ReplaceAll(s, "...", "")
+	s = strings.ReplaceAll(s, "..", "")
+	s = strings.ReplaceAll(s, ".", "")
+
+	// Remove any remaining digits at the start
+	for len(s) > 0 && s[0] >= '0' && s[0] <= '9' {
+		s = s[1:]
+	}
+
+	// Handle promotions: accept e8=Q and e8Q
+	if strings.Contains(s, "=") {
+		parts := strings.Split(s, "=")
+		if len(parts) == 2 {
+			s = parts[0] + parts[1]
+		}
+	}
+
+	// Remove any remaining whitespace
+	s = strings.ReplaceAll(s, " ", "")
+
+	return s
+}
+
+// saveProgress saves or updates progress for a user on a puzzle, and reschedules its next
+// review from whether this attempt was correct
+func saveProgress(userID, puzzleID string, typedSAN []string, score, depthMatched int, correct bool) {
+	typedJSON, _ := json.Marshal(typedSAN)
+
+	// Check if progress already exists
+	var existing struct {
+		ID           int     `db:"id"`
+		IntervalDays int     `db:"interval_days"`
+		Ease         float64 `db:"ease"`
+	}
+	err := db.Get(&existing, `
+		SELECT id, COALESCE(interval_days, 0) AS interval_days, COALESCE(ease, 0) AS ease FROM progress 
+		WHERE user_id = ? AND puzzle_id = ?
+	`, userID, puzzleID)
+
+	if err != nil {
+		// No existing progress, insert new
+		intervalDays, ease := woodpecker.NextReview(0, 0, correct)
+		_, err = db.Exec(`
+			INSERT INTO progress (user_id, puzzle_id, attempts, score, typed_json, interval_days, ease, next_review_at, updated_at)
+			VALUES (?, ?, 1, ?, ?, ?, ?, datetime('now', '+' || ? || ' days'), CURRENT_TIMESTAMP)
+		`, userID, puzzleID, score, string(typedJSON), intervalDays, ease, intervalDays)
+	} else {
+		// Update existing progress
+		intervalDays, ease := woodpecker.NextReview(existing.IntervalDays, existing.Ease, correct)
+		_, err = db.Exec(`
+			UPDATE progress 
+			SET attempts = attempts + 1, 
+				score = ?, 
+				typed_json = ?,
+				solved_at = CASE WHEN ? >= 3 THEN CURRENT_TIMESTAMP ELSE solved_at END,
+				interval_days = ?,
+				ease = ?,
+				next_review_at = datetime('now', '+' || ? || ' days'),
+				updated_at = CURRENT_TIMESTAMP
+			WHERE user_id = ? AND puzzle_id = ?
+		`, score, string(typedJSON), depthMatched, intervalDays, ease, intervalDays, userID, puzzleID)
+	}
+
+	if err != nil {
+		slog.Error("Error saving progress", "user", userID, "puzzle", puzzleID, "error", err)
+	}
+}
+
+// handleTodayProgress returns today's progress summary
+func handleTodayProgress(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+
+	// For now, return a simple response
+	result := struct {
+		TotalAttempted int     `json:"totalAttempted"`
+		TotalSolved    int     `json:"totalSolved"`
+		AverageScore   float64 `json:"averageScore"`
+	}{
+		TotalAttempted: 0,
+		TotalSolved:    0,
+		AverageScore:   0.0,
+	}
+
+	// Try to get actual data if possible
+	var count int
+	err := db.Get(&count, `SELECT COUNT(*) FROM progress WHERE user_id = ? AND attempts > 0`, userID)
+	if err == nil && count > 0 {
+		// We have data, try to get stats
+		var totalAttempted, totalSolved int
+		var avgScore float64
+
+		err1 := db.Get(&totalAttempted, `SELECT COUNT(*) FROM progress WHERE user_id = ? AND attempts > 0`, userID)
+		err2 := db.Get(&totalSolved, `SELECT COUNT(*) FROM progress WHERE user_id = ? AND solved_at IS NOT NULL`, userID)
+		err3 := db.Get(&avgScore, `SELECT AVG(score) FROM progress WHERE user_id = ? AND attempts > 0`, userID)
+
+		if err1 == nil && err2 == nil && err3 == nil {
+			result.TotalAttempted = totalAttempted
+			result.TotalSolved = totalSolved
+			result.AverageScore = avgScore
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// handleStats serves the stats page
+func handleStats(w http.ResponseWriter, r *http.Request) {
+	http.ServeFile(w, r, "web/templates/stats.html")
+}
+
+// handleCompletionStats returns the caller's attempted and solved counts for every difficulty,
+// easiest first
+func handleCompletionStats(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+	repo := repository.NewSQLiteRepository(db)
+
+	rows, err := repo.GetCompletionByUserID(userID)
+	if err != nil {
+		http.Error(w, "Failed to get completion stats", http.StatusInternalServerError)
+		return
+	}
+
+	byDifficulty := make(map[string]*model.DifficultyCompletion, len(rows))
+	for _, row := range rows {
+		byDifficulty[row.Difficulty] = row
+	}
+	completion := make([]*model.DifficultyCompletion, 0, len(model.Difficulties))
+	for _, difficulty := range model.Difficulties {
+		row, ok := byDifficulty[difficulty]
+		if !ok {
+			row = &model.DifficultyCompletion{Difficulty: difficulty}
+		}
+		completion = append(completion, row)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(completion)
+}
+
+// handleActiveDays counts the days in the last `window` days (default 90, today included) on which
+// the caller made at least one attempt, as dates in their settings timezone
+func handleActiveDays(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+
+	window := 90
+	if windowStr := r.URL.Query().Get("window"); windowStr != "" {
+		n, err := strconv.Atoi(windowStr)
+		if err != nil || n <= 0 || n > 366 {
+			http.Error(w, "window must be between 1 and 366", http.StatusBadRequest)
+			return
+		}
+		window = n
+	}
+
+	repo := repository.NewSQLiteRepository(db)
+	loc, err := userLocation(repo, userID)
+	if err != nil {
+		http.Error(w, "Failed to get settings", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now().In(loc)
+	firstDay := time.Date(now.Year(), now.Month(), now.Day()-(window-1), 0, 0, 0, 0, loc)
+
+	times, err := repo.GetAttemptTimesSince(userID, firstDay)
+	if err != nil {
+		http.Error(w, "Failed to get attempts", http.StatusInternalServerError)
+		return
+	}
+
+	// Attempts come oldest first, so each new day is appended once in date order
+	dates := []string{}
+	for _, t := range times {
+		day := t.In(loc).Format("2006-01-02")
+		if len(dates) == 0 || dates[len(dates)-1] != day {
+			dates = append(dates, day)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"window":     window,
+		"activeDays": len(dates),
+		"dates":      dates,
+	})
+}
+
+// userLocation returns the timezone from the user's settings, or UTC if it isn't a valid zone
+func userLocation(repo repository.Repository, userID string) (*time.Location, error) {
+	settings, err := repo.GetUserSettingsByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	return settingsLocation(settings), nil
+}
+
+// settingsLocation returns the timezone of the settings, or UTC if it isn't a valid zone
+func settingsLocation(settings *model.UserSettings) *time.Location {
+	loc, err := time.LoadLocation(settings.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// handleHeatmap counts the caller's attempts per day of a year (default the current one), keyed
+// by date in their settings timezone. Days without attempts are left out.
+func handleHeatmap(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+
+	repo := repository.NewSQLiteRepository(db)
+	loc, err := userLocation(repo, userID)
+	if err != nil {
+		http.Error(w, "Failed to get settings", http.StatusInternalServerError)
+		return
+	}
+
+	year := time.Now().In(loc).Year()
+	if yearStr := r.URL.Query().Get("year"); yearStr != "" {
+		n, err := strconv.Atoi(yearStr)
+		if err != nil || n < 1 || n > 9999 {
+			http.Error(w, "year must be a year", http.StatusBadRequest)
+			return
+		}
+		year = n
+	}
+
+	start := time.Date(year, time.January, 1, 0, 0, 0, 0, loc)
+	end := start.AddDate(1, 0, 0)
+
+	times, err := repo.GetAttemptTimesSince(userID, start)
+	if err != nil {
+		http.Error(w, "Failed to get attempts", http.StatusInternalServerError)
+		return
+	}
+
+	days := map[string]int{}
+	for _, t := range times {
+		if !t.Before(end) {
+			break
+		}
+		days[t.In(loc).Format("2006-01-02")]++
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"year": year,
+		"days": days,
+	})
+}
+
+// DifficultyGoalProgress is the time spent today on one difficulty against its daily goal
+type DifficultyGoalProgress struct {
+	Difficulty  string `json:"difficulty"`
+	GoalMinutes int    `json:"goal_minutes"`
+	Minutes     int    `json:"minutes"`
+	Met         bool   `json:"met"`
+}
+
+// handleDailyGoal reports the caller's progress towards today's goal for every difficulty, using
+// each difficulty's own goal where one is set and the global daily goal otherwise. Today starts
+// at midnight in the caller's settings timezone.
+func handleDailyGoal(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+
+	repo := repository.NewSQLiteRepository(db)
+	settings, err := repo.GetUserSettingsByUserID(userID)
+	if err != nil {
+		http.Error(w, "Failed to get settings", http.StatusInternalServerError)
+		return
+	}
+	loc := settingsLocation(settings)
+
+	now := time.Now().In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	spent, err := repo.GetSolveTimeByDifficultySince(userID, today)
+	if err != nil {
+		http.Error(w, "Failed to get attempts", http.StatusInternalServerError)
+		return
+	}
+
+	progress := make([]DifficultyGoalProgress, 0, len(model.Difficulties))
+	for _, difficulty := range model.Difficulties {
+		goal := settings.GoalMinutesFor(difficulty)
+		minutes := spent[difficulty] / 60000
+		progress = append(progress, DifficultyGoalProgress{
+			Difficulty:  difficulty,
+			GoalMinutes: goal,
+			Minutes:     minutes,
+			Met:         minutes >= goal,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"date":               today.Format("2006-01-02"),
+		"daily_goal_minutes": settings.DailyGoalMinutes,
+		"difficulties":       progress,
+	})
+}
+
+// handleMotifStats returns the caller's accuracy per puzzle tag, weakest motif first
+func handleMotifStats(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+	repo := repository.NewSQLiteRepository(db)
+
+	stats, err := repo.GetMotifStatsByUserID(userID)
+	if err != nil {
+		http.Error(w, "Failed to get motif stats", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// handleRecords returns the caller's personal bests: fastest and longest correct solves and the
+// most points scored on one attempt
+func handleRecords(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+	repo := repository.NewSQLiteRepository(db)
+
+	records, err := repo.GetPersonalRecords(userID)
+	if err != nil {
+		http.Error(w, "Failed to get records", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(records)
+}
+
+// handleCycleProgression returns points and average solve time per completed cycle of one of the caller's sets
+func handleCycleProgression(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+
+	setID, err := strconv.Atoi(r.URL.Query().Get("setId"))
+	if err != nil {
+		http.Error(w, "setId must be a set ID", http.StatusBadRequest)
+		return
+	}
+
+	repo := repository.NewSQLiteRepository(db)
+	if _, ok := getOwnedSet(w, repo, setID, userID); !ok {
+		return
+	}
+
+	progression, err := repo.GetCycleProgressionBySetID(setID)
+	if err != nil {
+		http.Error(w, "Failed to get cycle progression", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(progression)
+}
+
+// CycleResult is one completed cycle's first-move accuracy and average solve time
+type CycleResult struct {
+	CycleID         int     `json:"cycleId"`
+	Index           int     `json:"index"`
+	Attempts        int     `json:"attempts"`
+	AccuracyPercent float64 `json:"accuracyPercent"`
+	AvgTimeMs       int     `json:"avgTimeMs"`
+}
+
+// WoodpeckerGain compares a set's first completed cycle with its latest one
+type WoodpeckerGain struct {
+	SetID  int         `json:"setId"`
+	First  CycleResult `json:"first"`
+	Latest CycleResult `json:"latest"`
+	// AccuracyGain is the rise in accuracy, in percentage points
+	AccuracyGain float64 `json:"accuracyGain"`
+	// TimeGainPercent is how much faster the average solve got, as a percentage of the first cycle's
+	TimeGainPercent float64 `json:"timeGainPercent"`
+}
+
+// cycleAccuracy is the percentage of a cycle's attempts with a correct first move
+func cycleAccuracy(progress *model.CycleProgress) float64 {
+	if progress.Attempts == 0 {
+		return 0
+	}
+	return float64(progress.Correct) * 100 / float64(progress.Attempts)
+}
+
+func newCycleResult(progress *model.CycleProgress) CycleResult {
+	return CycleResult{
+		CycleID:         progress.CycleID,
+		Index:           progress.Index,
+		Attempts:        progress.Attempts,
+		AccuracyPercent: roundTenth(cycleAccuracy(progress)),
+		AvgTimeMs:       progress.AvgTimeMs,
+	}
+}
+
+// roundTenth rounds to one decimal place
+func roundTenth(x float64) float64 {
+	return math.Round(x*10) / 10
+}
+
+// handleWoodpeckerGain compares accuracy and solve time between the first and latest completed
+// cycles of one of the caller's sets, which is where the method's payoff shows
+func handleWoodpeckerGain(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+
+	setID, err := strconv.Atoi(r.URL.Query().Get("setId"))
+	if err != nil {
+		http.Error(w, "setId must be a set ID", http.StatusBadRequest)
+		return
+	}
+
+	repo := repository.NewSQLiteRepository(db)
+	if _, ok := getOwnedSet(w, repo, setID, userID); !ok {
+		return
+	}
+
+	progression, err := repo.GetCycleProgressionBySetID(setID)
+	if err != nil {
+		http.Error(w, "Failed to get cycle progression", http.StatusInternalServerError)
+		return
+	}
+	if len(progression) < 2 {
+		http.Error(w, "The set needs at least two completed cycles", http.StatusConflict)
+		return
+	}
+
+	first, latest := progression[0], progression[len(progression)-1]
+	gain := WoodpeckerGain{
+		SetID:        setID,
+		First:        newCycleResult(first),
+		Latest:       newCycleResult(latest),
+		AccuracyGain: roundTenth(cycleAccuracy(latest) - cycleAccuracy(first)),
+	}
+	if gain.First.AvgTimeMs > 0 {
+		gain.TimeGainPercent = roundTenth(float64(gain.First.AvgTimeMs-gain.Latest.AvgTimeMs) * 100 / float64(gain.First.AvgTimeMs))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(gain)
+}
+
+// handleDailyStatus returns the current daily plan status
+func handleDailyStatus(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+
+	woodpeckerService := woodpecker.NewService(db)
+	status, err := woodpeckerService.GetDailyStatus(userID)
+	if err != nil {
+		slog.Error("Error getting daily status", "error", err)
+		http.Error(w, "failed to get daily status", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// DailyPlanSummary is the shape of a user's daily plan and how far through today's batch they are
+type DailyPlanSummary struct {
+	Difficulty string `json:"difficulty"`
+	TargetSize int    `json:"targetSize"` // puzzles per day the plan aims for
+	BatchSize  int    `json:"batchSize"`  // puzzles in today's batch
+	Remaining  int    `json:"remaining"`  // puzzles in today's batch not yet solved today
+}
+
+// handleDailyPlan returns the daily plan's difficulty and size and how much of today's batch is left
+func handleDailyPlan(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+
+	woodpeckerService := woodpecker.NewService(db)
+	plan, err := woodpeckerService.GetOrCreateDailyPlan(userID)
+	if err != nil {
+		slog.Error("Error getting daily plan", "user", userID, "error", err)
+		http.Error(w, "failed to get daily plan", http.StatusInternalServerError)
+		return
+	}
+	status, err := woodpeckerService.GetDailyStatus(userID)
+	if err != nil {
+		slog.Error("Error getting daily status", "user", userID, "error", err)
+		http.Error(w, "failed to get daily plan", http.StatusInternalServerError)
+		return
+	}
+	solved, err := solvedTodayIDs(userID)
+	if err != nil {
+		slog.Error("Error loading today's progress", "user", userID, "error", err)
+		http.Error(w, "failed to get daily plan", http.StatusInternalServerError)
+		return
+	}
+
+	summary := DailyPlanSummary{
+		Difficulty: plan.Difficulty,
+		TargetSize: status.PerDay,
+		BatchSize:  len(plan.TodayBatch),
+	}
+	for _, puzzleID := range plan.TodayBatch {
+		if !solved[puzzleID] {
+			summary.Remaining++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
+
+// solvedTodayIDs returns the IDs of the puzzles the user solved today
+func solvedTodayIDs(userID string) (map[string]bool, error) {
+	var solvedIDs []string
+	err := db.Select(&solvedIDs, `
+		SELECT puzzle_id FROM progress
+		WHERE user_id = ? AND score > 0 AND date(updated_at) = date('now')
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	solved := make(map[string]bool, len(solvedIDs))
+	for _, id := range solvedIDs {
+		solved[id] = true
+	}
+	return solved, nil
+}
+
+// skippedTodayIDs returns the IDs of the puzzles the user skipped today
+func skippedTodayIDs(userID string) (map[string]bool, error) {
+	var skippedIDs []string
+	err := db.Select(&skippedIDs, `
+		SELECT puzzle_id FROM progress
+		WHERE user_id = ? AND date(skipped_at) = date('now')
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	skipped := make(map[string]bool, len(skippedIDs))
+	for _, id := range skippedIDs {
+		skipped[id] = true
+	}
+	return skipped, nil
+}
+
+// loadActiveDailyPlan loads the user's stored daily plan, returning repository.ErrNotFound if they
+// have none
+func loadActiveDailyPlan(userID string) (*woodpecker.DailyPlan, error) {
+	var planJSON string
+	err := db.Get(&planJSON, `SELECT daily_plan_json FROM daily_plans WHERE user_id = ? AND active = 1`, userID)
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var plan woodpecker.DailyPlan
+	if err := json.Unmarshal([]byte(planJSON), &plan); err != nil {
+		return nil, fmt.Errorf("parsing daily plan: %w", err)
+	}
+	return &plan, nil
+}
+
+// recordDailyAttempt notes the attempt if puzzleID is in the user's daily batch, so the puzzles of
+// the day can later be trained as a set
+func recordDailyAttempt(userID, puzzleID string) {
+	plan, err := loadActiveDailyPlan(userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return
+	}
+	if err != nil {
+		slog.Error("Error loading daily plan", "user", userID, "error", err)
+		return
+	}
+
+	for _, id := range plan.TodayBatch {
+		if id != puzzleID {
+			continue
+		}
+		repo := repository.NewSQLiteRepository(db)
+		if err := repo.RecordDailyAttempt(userID, puzzleID); err != nil {
+			slog.Error("Error recording daily attempt", "user", userID, "puzzle", puzzleID, "error", err)
+		}
+		return
+	}
+}
+
+// resurfaceSkipped returns puzzleID unless the user skipped it today, in which case it returns the
+// first puzzle of today's batch that is neither solved nor skipped today. Skipped puzzles come back
+// once nothing else is left, matching the order of handleDailyRemaining.
+func resurfaceSkipped(userID, puzzleID string) string {
+	skipped, err := skippedTodayIDs(userID)
+	if err != nil {
+		slog.Error("Error loading today's skips", "user", userID, "error", err)
+		return puzzleID
+	}
+	if !skipped[puzzleID] {
+		return puzzleID
+	}
+
+	plan, err := loadActiveDailyPlan(userID)
+	if err != nil {
+		if !errors.Is(err, repository.ErrNotFound) {
+			slog.Error("Error loading daily plan", "user", userID, "error", err)
+		}
+		return puzzleID
+	}
+	solved, err := solvedTodayIDs(userID)
+	if err != nil {
+		slog.Error("Error loading today's progress", "user", userID, "error", err)
+		return puzzleID
+	}
+
+	for _, id := range plan.TodayBatch {
+		if !solved[id] && !skipped[id] {
+			return id
+		}
+	}
+	return puzzleID
+}
+
+// RemainingPuzzle is a puzzle still to be solved in today's batch
+type RemainingPuzzle struct {
+	ID         string `json:"id"`
+	FEN        string `json:"fen"`
+	SideToMove string `json:"sideToMove"`
+}
+
+// handleDailyRemaining returns today's batch minus the puzzles already solved today, in batch order
+// with puzzles skipped today moved to the end
+func handleDailyRemaining(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+
+	plan, err := loadActiveDailyPlan(userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "no active daily plan", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.Error("Error loading daily plan", "user", userID, "error", err)
+		http.Error(w, "failed to get daily plan", http.StatusInternalServerError)
+		return
+	}
+
+	solved, err := solvedTodayIDs(userID)
+	if err != nil {
+		slog.Error("Error loading today's progress", "user", userID, "error", err)
+		http.Error(w, "failed to get daily plan", http.StatusInternalServerError)
+		return
+	}
+
+	skipped, err := skippedTodayIDs(userID)
+	if err != nil {
+		slog.Error("Error loading today's skips", "user", userID, "error", err)
+		http.Error(w, "failed to get daily plan", http.StatusInternalServerError)
+		return
+	}
+
+	// Puzzles skipped today come back after the rest of the batch
+	remaining := []RemainingPuzzle{}
+	var resurfaced []RemainingPuzzle
+	for _, puzzleID := range plan.TodayBatch {
+		if solved[puzzleID] {
+			continue
+		}
+		var fen string
+		if err := db.Get(&fen, `SELECT fen FROM puzzles WHERE id = ?`, puzzleID); err != nil {
+			slog.Warn("Skipping daily puzzle", "puzzle", puzzleID, "error", err)
+			continue
+		}
+		puzzle := RemainingPuzzle{ID: puzzleID, FEN: fen, SideToMove: model.SideToMove(fen)}
+		if skipped[puzzleID] {
+			resurfaced = append(resurfaced, puzzle)
+		} else {
+			remaining = append(remaining, puzzle)
+		}
+	}
+	remaining = append(remaining, resurfaced...)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"total":     len(plan.TodayBatch),
+		"remaining": remaining,
+	})
+}
+
+// dailyPlanWorkers is how many daily plans the nightly cron job rebuilds at once (DAILY_PLAN_WORKERS)
+var dailyPlanWorkers = 4
+
+// planQueue rebuilds daily plans for the nightly cron job
+var planQueue *planRebuildQueue
+
+// updateDailyPlans queues a daily plan rebuild for every user with an active plan
+func updateDailyPlans() {
+	// Get all active users
+	var userIDs []string
+	err := db.Select(&userIDs, `SELECT DISTINCT user_id FROM daily_plans WHERE active = 1`)
+	if err != nil {
+		slog.Error("Error getting users for daily plan update", "error", err)
+		return
+	}
+
+	// Add default user if no users exist
+	if len(userIDs) == 0 {
+		userIDs = []string{"default_user"}
+	}
+
+	planQueue.Enqueue(userIDs)
+}
+
+// rebuildDailyPlan gets or creates the user's daily plan and rebuilds today's batch
+func rebuildDailyPlan(service *woodpecker.Service, userID string) error {
+	plan, err := service.GetOrCreateDailyPlan(userID)
+	if err != nil {
+		return fmt.Errorf("getting daily plan: %w", err)
+	}
+
+	if err := rebuildTodayBatch(service, userID, plan); err != nil {
+		return err
+	}
+	slog.Info("Updated daily plan", "user", userID, "puzzles", len(plan.TodayBatch))
+	return nil
+}
+
+// rebuildTodayBatch builds today's batch for the plan and stores the updated plan
+func rebuildTodayBatch(service *woodpecker.Service, userID string, plan *woodpecker.DailyPlan) error {
+	todayBatch, err := service.PlanTodayBatch(userID, plan)
+	if err != nil {
+		return fmt.Errorf("building today's batch: %w", err)
+	}
+	plan.TodayBatch = todayBatch
+
+	planJSON, err := json.Marshal(plan)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		UPDATE daily_plans
+		SET daily_plan_json = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = ? AND active = 1
+	`, string(planJSON), userID)
+	return err
+}
+
+// handleDailyDifficulty switches the difficulty of the daily plan and rebuilds today's batch
+func handleDailyDifficulty(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+
+	var req struct {
+		Difficulty string `json:"difficulty"`
+	}
+	if !decodeJSON(w, r, &req, "Invalid request body") {
+		return
+	}
+	difficulty, err := model.NormalizeDifficulty(req.Difficulty)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	woodpeckerService := woodpecker.NewService(db)
+	plan, err := woodpeckerService.GetOrCreateDailyPlan(userID)
+	if err != nil {
+		slog.Error("Error getting daily plan", "user", userID, "error", err)
+		http.Error(w, "failed to get daily plan", http.StatusInternalServerError)
+		return
+	}
+
+	plan.Difficulty = difficulty
+	if err := rebuildTodayBatch(woodpeckerService, userID, plan); err != nil {
+		slog.Error("Error updating daily plan", "user", userID, "error", err)
+		http.Error(w, "failed to update daily plan", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(plan)
+}
+
+// handleSolutionText returns the solution text for a given puzzle ID
+func handleSolutionText(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	puzzleId := vars["puzzleId"]
+
+	if puzzleId == "" {
+		http.Error(w, "puzzle ID is required", http.StatusBadRequest)
+		return
+	}
+
+	// Get solution text from the mapping
+	solutionsText := SolutionsTextEasy()
+	if solutionTextLoadErr != nil {
+		http.Error(w, "solution text unavailable", http.StatusInternalServerError)
+		return
+	}
+	solutionText, exists := solutionsText[puzzleId]
+
+	if !exists {
+		http.Error(w, "solution text not found for puzzle ID", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"puzzleId":     puzzleId,
+		"solutionText": solutionText,
+	})
+}
+
+// maxSolutionTextBatch caps how many puzzle IDs one solution text batch may ask for
+const maxSolutionTextBatch = 100
+
+// handleSolutionTextBatch returns the solution text of several puzzles at once as a map from
+// puzzle ID to text. IDs without solution text are left out.
+func handleSolutionTextBatch(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		IDs []string `json:"ids"`
+	}
+	if !decodeJSON(w, r, &req, "Invalid request body") {
+		return
+	}
+	if len(req.IDs) == 0 {
+		http.Error(w, "ids must not be empty", http.StatusBadRequest)
+		return
+	}
+	if len(req.IDs) > maxSolutionTextBatch {
+		http.Error(w, fmt.Sprintf("ids must not contain more than %d entries", maxSolutionTextBatch), http.StatusBadRequest)
+		return
+	}
+
+	solutionsText := SolutionsTextEasy()
+	if solutionTextLoadErr != nil {
+		http.Error(w, "solution text unavailable", http.StatusInternalServerError)
+		return
+	}
+
+	texts := make(map[string]string, len(req.IDs))
+	for _, id := range req.IDs {
+		if text, ok := solutionsText[id]; ok {
+			texts[id] = text
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(texts)
+}
+
+// PuzzleFull is a puzzle with everything the review screen shows: the move tree and the prose solution
+type PuzzleFull struct {
+	ID           string         `json:"id"`
+	FEN          string         `json:"fen"`
+	SideToMove   string         `json:"sideToMove"`
+	Difficulty   string         `json:"difficulty"`
+	Solution     model.Solution `json:"solution"`
+	Ticks        []string       `json:"ticks"`
+	SolutionText string         `json:"solutionText,omitempty"`
+}
+
+// handlePuzzleFull returns a puzzle together with its structured solution and solution text.
+// The solution is only revealed once the signed-in caller has attempted the puzzle; anonymous
+// attempts are shared by everyone, so they never unlock it.
+func handlePuzzleFull(w http.ResponseWriter, r *http.Request) {
+	puzzleID := mux.Vars(r)["puzzleId"]
+	userID := r.Context().Value("user_id").(string)
+
+	puzzle, ok := loadPuzzle(w, puzzleID)
+	if !ok {
+		return
+	}
+
+	repo := repository.NewSQLiteRepository(db)
+	attempted, err := repo.HasAttemptedPuzzle(userID, puzzleID)
+	if err != nil {
+		http.Error(w, "failed to check attempts", http.StatusInternalServerError)
+		return
+	}
+	if !attempted {
+		http.Error(w, "attempt the puzzle before viewing its solution", http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(PuzzleFull{
+		ID:           puzzle.ID,
+		FEN:          puzzle.FEN,
+		SideToMove:   model.SideToMove(puzzle.FEN),
+		Difficulty:   puzzle.Difficulty,
+		Solution:     puzzle.Solution,
+		Ticks:        puzzle.Ticks,
+		SolutionText: SolutionsTextEasy()[puzzleID],
+	})
+}
+
+// Auth handlers
+func handleSignUp(w http.ResponseWriter, r *http.Request) {
+	var req auth.SignUpRequest
+	if !decodeJSON(w, r, &req, "Invalid JSON") {
+		return
+	}
+
+	// Validate input
+	if req.Email == "" || req.Password == "" {
+		http.Error(w, "Email and password are required", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Password) < 6 {
+		http.Error(w, "Password must be at least 6 characters", http.StatusBadRequest)
+		return
+	}
+
+	// Create user
+	userService := user.NewService(db)
+	user, err := userService.CreateUserWithSettings(req.Email, req.Password, model.DefaultUserSettings(""))
+	if err != nil {
+		if err == auth.ErrUserExists {
+			http.Error(w, "User already exists", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to create user", http.StatusInternalServerError)
+		return
+	}
+
+	// Generate JWT token
+	token, err := auth.GenerateJWT(user.ID, user.Email)
+	if err != nil {
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	// Set HTTP-only cookie
+	http.SetCookie(w, newAuthCookie(r, token, 86400)) // 24 hours
+
+	slog.Info("Set auth cookie for new user", "user", user.Email)
+
+	response := auth.AuthResponse{
+		User: *user,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func handleSignIn(w http.ResponseWriter, r *http.Request) {
+	var req auth.SignInRequest
+	if !decodeJSON(w, r, &req, "Invalid JSON") {
+		return
+	}
+
+	// Validate input
+	if req.Email == "" || req.Password == "" {
+		http.Error(w, "Email and password are required", http.StatusBadRequest)
+		return
+	}
+
+	// Validate credentials
+	userService := user.NewService(db)
+	user, err := userService.ValidateCredentials(req.Email, req.Password)
+	if err != nil {
+		slog.Info("Sign-in failed", "email", req.Email, "ip", clientIP(r), "error", err)
+		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+
+	slog.Info("Sign-in successful", "user", user.Email)
+
+	// Generate JWT token
+	token, err := auth.GenerateJWT(user.ID, user.Email)
+	if err != nil {
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	// Set HTTP-only cookie
+	http.SetCookie(w, newAuthCookie(r, token, 86400)) // 24 hours
+
+	slog.Debug("Set auth cookie", "user", user.Email)
+
+	response := auth.AuthResponse{
+		User: *user,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+
+	slog.Debug("Sign-in response sent", "user", user.Email)
+}
+
+func handleLogout(w http.ResponseWriter, r *http.Request) {
+	// Clear the auth cookie; the domain must match the one it was set with
+	http.SetCookie(w, newAuthCookie(r, "", -1))
+
+	response := map[string]interface{}{
+		"success": true,
+		"message": "Logged out successfully",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func handleGetMe(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by AuthMiddleware)
+	userID := r.Context().Value("user_id").(string)
+
+	userService := user.NewService(db)
+	user, err := userService.GetUserByID(userID)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	// Don't include password hash in response
+	user.PasswordHash = ""
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+func handleUserSettings(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+	repo := repository.NewSQLiteRepository(db)
+
+	settings, err := repo.GetUserSettingsByUserID(userID)
+	if err != nil {
+		http.Error(w, "Failed to get settings", http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == "PUT" {
+		var updateData struct {
+			DailyGoalMinutes *int    `json:"daily_goal_minutes"`
+			RemindersEnabled *bool   `json:"reminders_enabled"`
+			Timezone         *string `json:"timezone"`
+			BoardOrientation *string `json:"board_orientation"`
+			// A null goal removes the difficulty's own goal, so the global one applies again
+			DifficultyGoalMinutes map[string]*int `json:"difficulty_goal_minutes"`
+		}
+
+		if !decodeJSON(w, r, &updateData, "Invalid request body") {
+			return
+		}
+
+		if updateData.DailyGoalMinutes != nil {
+			if *updateData.DailyGoalMinutes < 0 {
+				http.Error(w, "daily_goal_minutes must not be negative", http.StatusBadRequest)
+				return
+			}
+			settings.DailyGoalMinutes = *updateData.DailyGoalMinutes
+		}
+		for key, minutes := range updateData.DifficultyGoalMinutes {
+			difficulty, err := model.NormalizeDifficulty(key)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if minutes == nil {
+				delete(settings.DifficultyGoalMinutes, difficulty)
+				continue
+			}
+			if *minutes < 0 {
+				http.Error(w, "difficulty_goal_minutes must not be negative", http.StatusBadRequest)
+				return
+			}
+			settings.DifficultyGoalMinutes[difficulty] = *minutes
+		}
+		if updateData.RemindersEnabled != nil {
+			settings.RemindersEnabled = *updateData.RemindersEnabled
+		}
+		if updateData.Timezone != nil {
+			if _, err := time.LoadLocation(*updateData.Timezone); err != nil {
+				http.Error(w, "invalid timezone", http.StatusBadRequest)
+				return
+			}
+			settings.Timezone = *updateData.Timezone
+		}
+		if updateData.BoardOrientation != nil {
+			switch *updateData.BoardOrientation {
+			case "white", "black", "auto":
+				settings.BoardOrientation = *updateData.BoardOrientation
+			default:
+				http.Error(w, "board_orientation must be white, black, or auto", http.StatusBadRequest)
+				return
+			}
+		}
+
+		if err := repo.UpsertUserSettings(settings); err != nil {
+			http.Error(w, "Failed to update settings", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+func handleAPIKeys(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+	repo := repository.NewSQLiteRepository(db)
+
+	switch r.Method {
+	case "GET":
+		keys, err := repo.GetAPIKeysByUserID(userID)
+		if err != nil {
+			http.Error(w, "Failed to get API keys", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(keys)
+
+	case "POST":
+		key, prefix, hash, err := auth.GenerateAPIKey()
+		if err != nil {
+			http.Error(w, "Failed to generate API key", http.StatusInternalServerError)
+			return
+		}
+
+		apiKey := &model.APIKey{
+			UserID:    userID,
+			Prefix:    prefix,
+			KeyHash:   hash,
+			CreatedAt: model.Now(),
+		}
+		if err := repo.CreateAPIKey(apiKey); err != nil {
+			http.Error(w, "Failed to create API key", http.StatusInternalServerError)
+			return
+		}
+
+		// The full key is only ever returned here
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":         apiKey.ID,
+			"prefix":     apiKey.Prefix,
+			"key":        key,
+			"created_at": apiKey.CreatedAt,
+		})
+	}
+}
+
+func handleDeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+
+	vars := mux.Vars(r)
+	keyID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid API key ID", http.StatusBadRequest)
+		return
+	}
+
+	repo := repository.NewSQLiteRepository(db)
+	deleted, err := repo.DeleteAPIKey(keyID, userID)
+	if err != nil {
+		http.Error(w, "Failed to revoke API key", http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleDeleteOldAttempts deletes the caller's attempts started before ?before=, given as a
+// date (YYYY-MM-DD, midnight UTC) or an RFC 3339 timestamp
+func handleDeleteOldAttempts(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+
+	beforeStr := r.URL.Query().Get("before")
+	if beforeStr == "" {
+		http.Error(w, "before required", http.StatusBadRequest)
+		return
+	}
+
+	before, err := time.Parse("2006-01-02", beforeStr)
+	if err != nil {
+		before, err = time.Parse(time.RFC3339, beforeStr)
+	}
+	if err != nil {
+		http.Error(w, "before must be a date (YYYY-MM-DD) or RFC 3339 timestamp", http.StatusBadRequest)
+		return
+	}
+
+	repo := repository.NewSQLiteRepository(db)
+	deleted, err := repo.DeleteAttemptsBefore(userID, before)
+	if err != nil {
+		http.Error(w, "Failed to delete attempts", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"deleted": deleted})
+}
+
+// handleActivity returns the caller's recent activity feed, newest first
+func handleActivity(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+
+	limit := 20
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		n, err := strconv.Atoi(limitStr)
+		if err != nil || n <= 0 || n > 100 {
+			http.Error(w, "limit must be between 1 and 100", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	repo := repository.NewSQLiteRepository(db)
+	events, err := repo.GetActivityByUserID(userID, limit)
+	if err != nil {
+		http.Error(w, "Failed to get activity", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+// handleReviewSchedule returns when each puzzle the caller has attempted is next due for review
+func handleReviewSchedule(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+
+	repo := repository.NewSQLiteRepository(db)
+	reviews, err := repo.GetReviewScheduleByUserID(userID)
+	if err != nil {
+		http.Error(w, "Failed to get review schedule", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reviews)
+}
+
+// handleUnattempted lists the IDs of puzzles the caller has never attempted, optionally limited to
+// one difficulty
+func handleUnattempted(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+
+	var difficulty string
+	if d := r.URL.Query().Get("difficulty"); d != "" {
+		normalized, err := model.NormalizeDifficulty(d)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		difficulty = normalized
+	}
+
+	limit := 50
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		n, err := strconv.Atoi(limitStr)
+		if err != nil || n <= 0 || n > 500 {
+			http.Error(w, "limit must be between 1 and 500", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	repo := repository.NewSQLiteRepository(db)
+	ids, err := repo.GetUnattemptedPuzzleIDs(userID, difficulty, limit)
+	if err != nil {
+		http.Error(w, "Failed to get puzzles", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"puzzleIds": ids,
+	})
+}
+
+// Admin API handlers
+
+// handleAdminRecomputeTicks rewrites a puzzle's ticks from its solution tree
+func handleAdminRecomputeTicks(w http.ResponseWriter, r *http.Request) {
+	puzzleID := mux.Vars(r)["id"]
+
+	woodpeckerService := woodpecker.NewService(db)
+	ticks, err := woodpeckerService.RecomputeTicks(puzzleID)
+	cachedPuzzles.Invalidate(puzzleID)
+	if err != nil {
+		switch {
+		case err == sql.ErrNoRows:
+			http.Error(w, "puzzle not found", http.StatusNotFound)
+		case errors.Is(err, model.ErrSolutionCorrupt):
+			http.Error(w, "puzzle solution corrupt", http.StatusUnprocessableEntity)
+		default:
+			http.Error(w, "Failed to recompute ticks", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"puzzleId": puzzleID,
+		"ticks":    ticks,
+	})
+}
+
+// handleAdminPuzzleStats reports catalog coverage: puzzles per difficulty and how many have solutions and ticks
+func handleAdminPuzzleStats(w http.ResponseWriter, r *http.Request) {
+	repo := repository.NewSQLiteRepository(db)
+	stats, err := repo.GetPuzzleCatalogStats()
+	if err != nil {
+		http.Error(w, "Failed to get puzzle stats", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// handleAdminImportLichess imports puzzles from a Lichess puzzle CSV sent as the request body.
+// Puzzles whose ID already exists are skipped; themes are stored as puzzle tags.
+func handleAdminImportLichess(w http.ResponseWriter, r *http.Request) {
+	puzzles, err := ParseLichessCSV(r.Body)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Invalid Lichess CSV: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		http.Error(w, "Failed to import puzzles", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	imported := 0
+	for _, lp := range puzzles {
+		puzzleDB := model.FromPuzzle(lp.Puzzle)
+		result, err := tx.Exec(`
+			INSERT OR IGNORE INTO puzzles (id, difficulty, fen, side_to_move, solution_json, ticks_json)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, puzzleDB.ID, puzzleDB.Difficulty, puzzleDB.FEN,
+			puzzleDB.SideToMove, puzzleDB.SolutionJSON, puzzleDB.TicksJSON)
+		if err != nil {
+			http.Error(w, "Failed to import puzzles", http.StatusInternalServerError)
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			continue
+		}
+		imported++
+
+		for _, theme := range lp.Themes {
+			if _, err := tx.Exec(`INSERT OR IGNORE INTO puzzle_tags (puzzle_id, tag) VALUES (?, ?)`, puzzleDB.ID, theme); err != nil {
+				http.Error(w, "Failed to import puzzles", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to import puzzles", http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("Imported Lichess puzzles", "imported", imported, "skipped", len(puzzles)-imported)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{
+		"imported": imported,
+		"skipped":  len(puzzles) - imported,
+	})
+}
+
+// validateSolutionTree checks an edited solution: it must have at least one line, every move
+// must be SAN, and ticks must name exactly the moves flagged IsTick
+func validateSolutionTree(solution model.Solution, ticks []string) error {
+	if len(solution.Lines) == 0 {
+		return errors.New("solution must have at least one line")
+	}
+
+	var check func(lines []model.Line, depth int) error
+	check = func(lines []model.Line, depth int) error {
+		for _, line := range lines {
+			if strings.TrimSpace(line.SAN) == "" {
+				return fmt.Errorf("empty move at ply %d", depth+1)
+			}
+			if _, err := parseSAN(line.SAN); err != nil {
+				return fmt.Errorf("ply %d: %w", depth+1, err)
+			}
+			if err := check(line.Children, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := check(solution.Lines, 0); err != nil {
+		return err
+	}
+
+	want := solution.TickSANs()
+	got := append([]string{}, ticks...)
+	sort.Strings(want)
+	sort.Strings(got)
+	if strings.Join(want, " ") != strings.Join(got, " ") {
+		return fmt.Errorf("ticks %v don't match the moves flagged isTick %v", ticks, solution.TickSANs())
+	}
+	return nil
+}
+
+// handleAdminUpdatePuzzle replaces a puzzle's solution and ticks. Ticks may be omitted, in which
+// case they are taken from the moves flagged IsTick.
+func handleAdminUpdatePuzzle(w http.ResponseWriter, r *http.Request) {
+	puzzleID := mux.Vars(r)["id"]
+
+	var req struct {
+		Solution model.Solution `json:"solution"`
+		Ticks    []string       `json:"ticks"`
+	}
+	if !decodeJSON(w, r, &req, "Invalid request body") {
+		return
+	}
+	if req.Ticks == nil {
+		req.Ticks = req.Solution.TickSANs()
+	}
+
+	if err := validateSolutionTree(req.Solution, req.Ticks); err != nil {
+		http.Error(w, "invalid solution: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// edited_at keeps seeding from replacing the solution on the next start
+	result, err := db.Exec(`UPDATE puzzles SET solution_json = ?, ticks_json = ?, edited_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		model.SolutionJSON{Solution: req.Solution}, model.TicksJSON{Ticks: req.Ticks}, puzzleID)
+	if err != nil {
+		http.Error(w, "Failed to update puzzle", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		http.Error(w, "puzzle not found", http.StatusNotFound)
+		return
+	}
+	cachedPuzzles.Invalidate(puzzleID)
+
+	slog.Info("Updated puzzle solution", "puzzle", puzzleID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"puzzleId": puzzleID,
+		"solution": req.Solution,
+		"ticks":    req.Ticks,
+	})
+}
+
+// SetPuzzleProblem is a puzzle in a set that can't be graded, and why
+type SetPuzzleProblem struct {
+	PuzzleID string `json:"puzzleId"`
+	Position int    `json:"position"`
+	Reason   string `json:"reason"`
+}
+
+// puzzleProblem returns why a puzzle can't be graded, or "" if its FEN is legal and its first
+// solution move is a legal move from it
+func puzzleProblem(puzzleID string) string {
+	puzzleDB, err := getPuzzleByID(puzzleID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return "puzzle not found"
+	}
+	if err != nil {
+		return "failed to load puzzle: " + err.Error()
+	}
+
+	pos, err := ParseFEN(puzzleDB.FEN)
+	if err != nil {
+		return "invalid FEN: " + err.Error()
+	}
+	if err := puzzleDB.CheckSolution(); err != nil {
+		return err.Error()
+	}
+
+	lines := puzzleDB.SolutionJSON.Solution.Lines
+	if len(lines) == 0 {
+		return "no solution"
+	}
+	if _, err := resolveSAN(pos, lines[0].SAN); err != nil {
+		return "first move: " + err.Error()
+	}
+	return ""
+}
+
+// handleAdminAdoptSessions moves the sessions of another, usually deleted, cycle onto this one.
+// It repairs sessions orphaned when a cycle was deleted and recreated.
+func handleAdminAdoptSessions(w http.ResponseWriter, r *http.Request) {
+	cycleID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid cycle ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		FromCycleID int `json:"fromCycleId"`
+	}
+	if !decodeJSON(w, r, &req, "Invalid request body") {
+		return
+	}
+	if req.FromCycleID <= 0 || req.FromCycleID == cycleID {
+		http.Error(w, "fromCycleId must be another cycle's ID", http.StatusBadRequest)
+		return
+	}
+
+	repo := repository.NewSQLiteRepository(db)
+	moved, err := repo.MoveSessionsToCycle(req.FromCycleID, cycleID)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			http.Error(w, "Cycle not found", http.StatusNotFound)
+		case errors.Is(err, repository.ErrCycleSetMismatch):
+			http.Error(w, "fromCycleId must be a cycle of the same set", http.StatusConflict)
+		default:
+			http.Error(w, "Failed to move sessions", http.StatusInternalServerError)
+		}
+		return
+	}
+	slog.Info("Moved sessions between cycles", "from", req.FromCycleID, "to", cycleID, "sessions", moved)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{
+		"cycleId": cycleID,
+		"moved":   moved,
+	})
+}
+
+// handleAdminMergeUser moves one user's sets, collections, progress, hints, daily plan, settings
+// and API keys to another user, e.g. so an account can claim data recorded as default_user
+func handleAdminMergeUser(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		FromUserID string `json:"fromUserId"`
+		ToUserID   string `json:"toUserId"`
+	}
+	if !decodeJSON(w, r, &req, "Invalid request body") {
+		return
+	}
+	if req.FromUserID == "" || req.ToUserID == "" {
+		http.Error(w, "fromUserId and toUserId are required", http.StatusBadRequest)
+		return
+	}
+	if req.FromUserID == req.ToUserID {
+		http.Error(w, "fromUserId and toUserId must differ", http.StatusBadRequest)
+		return
+	}
+
+	repo := repository.NewSQLiteRepository(db)
+	if _, err := repo.GetUserByID(req.ToUserID); err != nil {
+		repoError(w, err, "User not found", "Failed to get user")
+		return
+	}
+
+	moved, err := repo.MergeUserData(req.FromUserID, req.ToUserID)
+	if err != nil {
+		slog.Error("Failed to merge user data", "from", req.FromUserID, "to", req.ToUserID, "error", err)
+		http.Error(w, "Failed to merge user data", http.StatusInternalServerError)
+		return
+	}
+	slog.Info("Merged user data", "from", req.FromUserID, "to", req.ToUserID, "moved", moved)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"fromUserId": req.FromUserID,
+		"toUserId":   req.ToUserID,
+		"moved":      moved,
+	})
+}
+
+// handleAdminValidateSet checks every puzzle in a set can be graded, listing those that can't
+func handleAdminValidateSet(w http.ResponseWriter, r *http.Request) {
+	setID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid set ID", http.StatusBadRequest)
+		return
+	}
+
+	repo := repository.NewSQLiteRepository(db)
+	if _, err := repo.GetSetByID(setID); err != nil {
+		repoError(w, err, "Set not found", "Failed to get set")
+		return
+	}
+
+	setPuzzles, err := repo.GetPuzzlesInSet(setID)
+	if err != nil {
+		http.Error(w, "Failed to get set puzzles", http.StatusInternalServerError)
+		return
+	}
+
+	problems := []SetPuzzleProblem{}
+	for _, sp := range setPuzzles {
+		if reason := puzzleProblem(sp.PuzzleID); reason != "" {
+			problems = append(problems, SetPuzzleProblem{PuzzleID: sp.PuzzleID, Position: sp.Position, Reason: reason})
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"setId":    setID,
+		"puzzles":  len(setPuzzles),
+		"valid":    len(problems) == 0,
+		"problems": problems,
+	})
+}
+
+// Trainer API handlers
+
+func handleTrainerSets(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+	repo := repository.NewSQLiteRepository(db)
+
+	switch r.Method {
+	case "GET":
+		// Get all sets for the user; soft-deleted sets only when asked for
+		includeDeleted := r.URL.Query().Get("includeDeleted") == "true"
+		sets, err := repo.GetSetsByUserID(userID, includeDeleted)
+		if err != nil {
+			http.Error(w, "Failed to get sets", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sets)
+
+	case "POST":
+		// Create a new set
+		var setData struct {
+			Name          string `json:"name"`
+			Description   string `json:"description"`
+			DifficultyMin string `json:"difficulty_min"`
+			DifficultyMax string `json:"difficulty_max"`
+			Size          int    `json:"size"`
+		}
+
+		if !decodeJSON(w, r, &setData, "Invalid request body") {
+			return
+		}
+
+		if err := validateSetSize(setData.Size); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		difficulties, err := normalizeDifficultyRange(&setData.DifficultyMin, &setData.DifficultyMax)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Create the set
+		set := &model.Set{
+			UserID:        userID,
+			Name:          setData.Name,
+			Description:   setData.Description,
+			DifficultyMin: setData.DifficultyMin,
+			DifficultyMax: setData.DifficultyMax,
+			CreatedAt:     model.Now(),
+		}
+
+		puzzleIDs, err := selectSetPuzzleIDs(difficulties, setData.Size)
+		if err != nil {
+			http.Error(w, "Failed to get puzzles", http.StatusInternalServerError)
+			return
+		}
+
+		// Create the set with its puzzles together, so a failure leaves no partly filled set
+		if err := repo.CreateSetWithPuzzles(set, puzzleIDs); err != nil {
+			http.Error(w, "Failed to create set", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(set)
+	}
+}
+
+// handleTrainerSetFromDaily creates a set from the daily batch puzzles the user attempted over the
+// last ?days= days (default 30), in the order they were attempted. Past maxSetSize only the most
+// recent puzzles are kept.
+func handleTrainerSetFromDaily(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+
+	days := 30
+	if raw := r.URL.Query().Get("days"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > 365 {
+			http.Error(w, "days must be an integer between 1 and 365", http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+
+	repo := repository.NewSQLiteRepository(db)
+	puzzleIDs, err := repo.GetDailyAttemptedPuzzleIDs(userID, days)
+	if err != nil {
+		http.Error(w, "Failed to get daily puzzles", http.StatusInternalServerError)
+		return
+	}
+	if len(puzzleIDs) == 0 {
+		http.Error(w, "No daily puzzles attempted in that period", http.StatusNotFound)
+		return
+	}
+	if len(puzzleIDs) > maxSetSize {
+		puzzleIDs = puzzleIDs[len(puzzleIDs)-maxSetSize:]
+	}
+
+	set := &model.Set{
+		UserID:      userID,
+		Name:        "Daily puzzles",
+		Description: fmt.Sprintf("Puzzles of the day from the last %d days", days),
+		CreatedAt:   model.Now(),
+	}
+	for _, puzzleID := range puzzleIDs {
+		puzzle, err := getPuzzleByID(puzzleID)
+		if err != nil {
+			http.Error(w, "Failed to get daily puzzles", http.StatusInternalServerError)
+			return
+		}
+		rank := slices.Index(model.Difficulties, puzzle.Difficulty)
+		if set.DifficultyMin == "" || rank < slices.Index(model.Difficulties, set.DifficultyMin) {
+			set.DifficultyMin = puzzle.Difficulty
+		}
+		if set.DifficultyMax == "" || rank > slices.Index(model.Difficulties, set.DifficultyMax) {
+			set.DifficultyMax = puzzle.Difficulty
+		}
+	}
+
+	if err := repo.CreateSetWithPuzzles(set, puzzleIDs); err != nil {
+		http.Error(w, "Failed to create set", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(set)
+}
+
+// handleTrainerSetDelete soft-deletes a set; its cycles and attempts are kept for stats
+func handleTrainerSetDelete(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+
+	setID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid set ID", http.StatusBadRequest)
+		return
+	}
+
+	repo := repository.NewSQLiteRepository(db)
+	if _, ok := getOwnedSet(w, repo, setID, userID); !ok {
+		return
+	}
+
+	if err := repo.DeleteSet(setID); err != nil {
+		http.Error(w, "Failed to delete set", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleTrainerSetRestore brings back a soft-deleted set
+func handleTrainerSetRestore(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+
+	setID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid set ID", http.StatusBadRequest)
+		return
+	}
+
+	repo := repository.NewSQLiteRepository(db)
+	set, ok := getOwnedSet(w, repo, setID, userID)
+	if !ok {
+		return
+	}
+
+	if err := repo.RestoreSet(setID); err != nil {
+		http.Error(w, "Failed to restore set", http.StatusInternalServerError)
+		return
+	}
+	set.DeletedAt = nil
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(set)
+}
+
+// maxSetSize caps how many puzzles a set can be created with or extended by (MAX_SET_SIZE, default 500)
+var maxSetSize = 500
+
+// validateSetSize checks a requested set size is positive and within maxSetSize
+func validateSetSize(size int) error {
+	if size <= 0 {
+		return fmt.Errorf("size must be a positive integer")
+	}
+	if size > maxSetSize {
+		return fmt.Errorf("size must not exceed %d", maxSetSize)
+	}
+	return nil
+}
+
+// normalizeDifficultyRange normalizes optional difficulty bounds in place and returns the
+// difficulties between them inclusive. An empty bound is treated as open-ended.
+func normalizeDifficultyRange(difficultyMin, difficultyMax *string) ([]string, error) {
+	lo, hi := 0, len(model.Difficulties)-1
+	for _, bound := range []struct {
+		name  string
+		value *string
+		index *int
+	}{{"difficulty_min", difficultyMin, &lo}, {"difficulty_max", difficultyMax, &hi}} {
+		if *bound.value == "" {
+			continue
+		}
+		normalized, err := model.NormalizeDifficulty(*bound.value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", bound.name, err)
+		}
+		*bound.value = normalized
+		*bound.index = slices.Index(model.Difficulties, normalized)
+	}
+	if lo > hi {
+		return nil, fmt.Errorf("difficulty_min must not be harder than difficulty_max")
+	}
+	return model.Difficulties[lo : hi+1], nil
+}
+
+// selectSetPuzzleIDs returns the puzzle IDs a new set of the given difficulties and size would
+// contain. The difficulties come from normalizeDifficultyRange.
+func selectSetPuzzleIDs(difficulties []string, size int) ([]string, error) {
+	query, args, err := sqlx.In(`
+		SELECT id FROM puzzles
+		WHERE difficulty IN (?)
+		ORDER BY id LIMIT ?
+	`, difficulties, size)
+	if err != nil {
+		return nil, err
+	}
+
+	puzzleIDs := []string{}
+	if err := db.Select(&puzzleIDs, db.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+	return puzzleIDs, nil
+}
+
+// handleTrainerSetPreview returns the puzzle IDs a set would be created with, without creating it
+func handleTrainerSetPreview(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	difficultyMin := query.Get("difficultyMin")
+	difficultyMax := query.Get("difficultyMax")
+
+	size, err := strconv.Atoi(query.Get("size"))
+	if err != nil {
+		http.Error(w, "size must be a positive integer", http.StatusBadRequest)
+		return
+	}
+	if err := validateSetSize(size); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	difficulties, err := normalizeDifficultyRange(&difficultyMin, &difficultyMax)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	puzzleIDs, err := selectSetPuzzleIDs(difficulties, size)
+	if err != nil {
+		http.Error(w, "Failed to get puzzles", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"difficultyMin": difficultyMin,
+		"difficultyMax": difficultyMax,
+		"size":          size,
+		"puzzleIds":     puzzleIDs,
+	})
+}
+
+func handleTrainerSetPuzzles(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	setIDStr := vars["id"]
+	setID, err := strconv.Atoi(setIDStr)
+	if err != nil {
+		http.Error(w, "Invalid set ID", http.StatusBadRequest)
+		return
+	}
+
+	repo := repository.NewSQLiteRepository(db)
+	puzzles, err := repo.GetPuzzlesInSet(setID)
+	if err != nil {
+		http.Error(w, "Failed to get puzzles", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(puzzles)
+}
 
-	// Remove any remaining digits at the start
-	for len(s) > 0 && s[0] >= '0' && s[0] <= '9' {
-		s = s[1:]
+// repoError writes 404 with notFoundMsg when err is repository.ErrNotFound, and 500 with failedMsg otherwise
+func repoError(w http.ResponseWriter, err error, notFoundMsg, failedMsg string) {
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, notFoundMsg, http.StatusNotFound)
+		return
 	}
+	http.Error(w, failedMsg, http.StatusInternalServerError)
+}
 
-	// Handle promotions: accept e8=Q and e8Q
-	if strings.Contains(s, "=") {
-		parts := strings.Split(s, "=")
-		if len(parts) == 2 {
-			s = parts[0] + parts[1]
-		}
+// getOwnedSet loads a set and checks it belongs to userID, writing a 404 or 403 response when it doesn't
+func getOwnedSet(w http.ResponseWriter, repo repository.Repository, setID int, userID string) (*model.Set, bool) {
+	set, err := repo.GetSetByID(setID)
+	if err != nil {
+		repoError(w, err, "Set not found", "Failed to get set")
+		return nil, false
 	}
 
-	// Remove any remaining whitespace
-	s = strings.ReplaceAll(s, " ", "")
+	if set.UserID != userID {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil, false
+	}
 
-	return s
+	return set, true
 }
 
-// extractSideToMove extracts the side to move from a FEN string
-func extractSideToMove(fen string) string {
-	if fen == "" {
-		return "w" // Default to white if FEN is empty
+// getOwnedCollection loads a collection and checks it belongs to the user, writing 404/403 otherwise
+func getOwnedCollection(w http.ResponseWriter, repo repository.Repository, collectionID int, userID string) (*model.Collection, bool) {
+	collection, err := repo.GetCollectionByID(collectionID)
+	if err != nil {
+		repoError(w, err, "Collection not found", "Failed to get collection")
+		return nil, false
 	}
 
-	parts := strings.Fields(fen)
-	if len(parts) >= 2 {
-		return parts[1] // The second part of FEN is the side to move
+	if collection.UserID != userID {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil, false
 	}
 
-	return "w" // Default to white if FEN is malformed
+	return collection, true
 }
 
-// saveProgress saves or updates progress for a user on a puzzle
-func saveProgress(userID, puzzleID string, typedSAN []string, score, depthMatched int) {
-	typedJSON, _ := json.Marshal(typedSAN)
+func handleTrainerCollections(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+	repo := repository.NewSQLiteRepository(db)
 
-	// Check if progress already exists
-	var existingID int
-	err := db.Get(&existingID, `
-		SELECT id FROM progress 
-		WHERE user_id = ? AND puzzle_id = ?
-	`, userID, puzzleID)
+	switch r.Method {
+	case "GET":
+		collections, err := repo.GetCollectionsByUserID(userID)
+		if err != nil {
+			http.Error(w, "Failed to get collections", http.StatusInternalServerError)
+			return
+		}
 
-	if err != nil {
-		// No existing progress, insert new
-		_, err = db.Exec(`
-			INSERT INTO progress (user_id, puzzle_id, attempts, score, typed_json, updated_at)
-			VALUES (?, ?, 1, ?, ?, CURRENT_TIMESTAMP)
-		`, userID, puzzleID, score, string(typedJSON))
-	} else {
-		// Update existing progress
-		_, err = db.Exec(`
-			UPDATE progress 
-			SET attempts = attempts + 1, 
-				score = ?, 
-				typed_json = ?,
-				solved_at = CASE WHEN ? >= 3 THEN CURRENT_TIMESTAMP ELSE solved_at END,
-				updated_at = CURRENT_TIMESTAMP
-			WHERE user_id = ? AND puzzle_id = ?
-		`, score, string(typedJSON), depthMatched, userID, puzzleID)
-	}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(collections)
 
-	if err != nil {
-		log.Printf("Error saving progress: %v", err)
+	case "POST":
+		var collectionData struct {
+			Name string `json:"name"`
+		}
+		if !decodeJSON(w, r, &collectionData, "Invalid request body") {
+			return
+		}
+
+		name := strings.TrimSpace(collectionData.Name)
+		if name == "" {
+			http.Error(w, "name required", http.StatusBadRequest)
+			return
+		}
+
+		collection := &model.Collection{
+			UserID:    userID,
+			Name:      name,
+			CreatedAt: model.Now(),
+		}
+		if err := repo.CreateCollection(collection); err != nil {
+			http.Error(w, "Failed to create collection", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(collection)
 	}
 }
 
-// handleTodayProgress returns today's progress summary
-func handleTodayProgress(w http.ResponseWriter, r *http.Request) {
-	userID := "default_user" // TODO: Get from session/auth
+// handleTrainerCollectionSets lists the sets in a collection (GET) or adds one of the user's sets to it (POST)
+func handleTrainerCollectionSets(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
 
-	// For now, return a simple response
-	result := struct {
-		TotalAttempted int     `json:"totalAttempted"`
-		TotalSolved    int     `json:"totalSolved"`
-		AverageScore   float64 `json:"averageScore"`
-	}{
-		TotalAttempted: 0,
-		TotalSolved:    0,
-		AverageScore:   0.0,
+	vars := mux.Vars(r)
+	collectionID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid collection ID", http.StatusBadRequest)
+		return
 	}
 
-	// Try to get actual data if possible
-	var count int
-	err := db.Get(&count, `SELECT COUNT(*) FROM progress WHERE user_id = ?`, userID)
-	if err == nil && count > 0 {
-		// We have data, try to get stats
-		var totalAttempted, totalSolved int
-		var avgScore float64
+	repo := repository.NewSQLiteRepository(db)
+	if _, ok := getOwnedCollection(w, repo, collectionID, userID); !ok {
+		return
+	}
 
-		err1 := db.Get(&totalAttempted, `SELECT COUNT(*) FROM progress WHERE user_id = ?`, userID)
-		err2 := db.Get(&totalSolved, `SELECT COUNT(*) FROM progress WHERE user_id = ? AND solved_at IS NOT NULL`, userID)
-		err3 := db.Get(&avgScore, `SELECT AVG(score) FROM progress WHERE user_id = ?`, userID)
+	switch r.Method {
+	case "GET":
+		sets, err := repo.GetSetsByCollectionID(collectionID)
+		if err != nil {
+			http.Error(w, "Failed to get sets", http.StatusInternalServerError)
+			return
+		}
 
-		if err1 == nil && err2 == nil && err3 == nil {
-			result.TotalAttempted = totalAttempted
-			result.TotalSolved = totalSolved
-			result.AverageScore = avgScore
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sets)
+
+	case "POST":
+		var req struct {
+			SetID int `json:"set_id"`
+		}
+		if !decodeJSON(w, r, &req, "Invalid request body") {
+			return
 		}
-	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(result)
-}
+		if _, ok := getOwnedSet(w, repo, req.SetID, userID); !ok {
+			return
+		}
 
-// handleStats serves the stats page
-func handleStats(w http.ResponseWriter, r *http.Request) {
-	http.ServeFile(w, r, "web/templates/stats.html")
+		if err := repo.AddSetToCollection(collectionID, req.SetID); err != nil {
+			http.Error(w, "Failed to add set to collection", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
 }
 
-// handleDailyStatus returns the current daily plan status
-func handleDailyStatus(w http.ResponseWriter, r *http.Request) {
-	userID := "default_user" // TODO: Get from session/auth
+func handleTrainerCollectionRemoveSet(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
 
-	woodpeckerService := woodpecker.NewService(db)
-	status, err := woodpeckerService.GetDailyStatus(userID)
+	vars := mux.Vars(r)
+	collectionID, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		log.Printf("Error getting daily status: %v", err)
-		http.Error(w, "failed to get daily status", http.StatusInternalServerError)
+		http.Error(w, "Invalid collection ID", http.StatusBadRequest)
+		return
+	}
+	setID, err := strconv.Atoi(vars["setId"])
+	if err != nil {
+		http.Error(w, "Invalid set ID", http.StatusBadRequest)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(status)
-}
+	repo := repository.NewSQLiteRepository(db)
+	if _, ok := getOwnedCollection(w, repo, collectionID, userID); !ok {
+		return
+	}
 
-// updateDailyPlans updates daily plans for all users
-func updateDailyPlans(service *woodpecker.Service) {
-	// Get all active users
-	var userIDs []string
-	err := db.Select(&userIDs, `SELECT DISTINCT user_id FROM daily_plans WHERE active = 1`)
+	removed, err := repo.RemoveSetFromCollection(collectionID, setID)
 	if err != nil {
-		log.Printf("Error getting users for daily plan update: %v", err)
+		http.Error(w, "Failed to remove set from collection", http.StatusInternalServerError)
+		return
+	}
+	if !removed {
+		http.Error(w, "Set not in collection", http.StatusNotFound)
 		return
 	}
 
-	// Add default user if no users exist
-	if len(userIDs) == 0 {
-		userIDs = []string{"default_user"}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleTrainerSetAddPuzzles(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+
+	vars := mux.Vars(r)
+	setIDStr := vars["id"]
+	setID, err := strconv.Atoi(setIDStr)
+	if err != nil {
+		http.Error(w, "Invalid set ID", http.StatusBadRequest)
+		return
 	}
 
-	for _, userID := range userIDs {
-		// Get or create daily plan
-		plan, err := service.GetOrCreateDailyPlan(userID)
-		if err != nil {
-			log.Printf("Error getting daily plan for user %s: %v", userID, err)
-			continue
-		}
+	var req struct {
+		PuzzleIDs []string `json:"puzzleIds"`
+	}
+	if !decodeJSON(w, r, &req, "Invalid request body") {
+		return
+	}
 
-		// Build today's batch
-		todayBatch, err := service.BuildTodayBatch(userID, plan)
-		if err != nil {
-			log.Printf("Error building today's batch for user %s: %v", userID, err)
-			continue
-		}
+	if len(req.PuzzleIDs) == 0 {
+		http.Error(w, "puzzleIds required", http.StatusBadRequest)
+		return
+	}
+	if len(req.PuzzleIDs) > maxSetSize {
+		http.Error(w, fmt.Sprintf("puzzleIds must not contain more than %d entries", maxSetSize), http.StatusBadRequest)
+		return
+	}
 
-		// Update plan with today's batch
-		plan.TodayBatch = todayBatch
-		planJSON, _ := json.Marshal(plan)
+	repo := repository.NewSQLiteRepository(db)
+	if _, ok := getOwnedSet(w, repo, setID, userID); !ok {
+		return
+	}
 
-		_, err = db.Exec(`
-			UPDATE daily_plans 
-			SET daily_plan_json = ?, updated_at = CURRENT_TIMESTAMP
-			WHERE user_id = ? AND active = 1
-		`, string(planJSON), userID)
+	// Repeated IDs in the request count once towards the cap
+	existing, err := repo.GetPuzzlesInSet(setID)
+	if err != nil {
+		http.Error(w, "Failed to get puzzles", http.StatusInternalServerError)
+		return
+	}
+	added := make(map[string]bool, len(existing)+len(req.PuzzleIDs))
+	for _, puzzle := range existing {
+		added[puzzle.PuzzleID] = true
+	}
+	for _, puzzleID := range req.PuzzleIDs {
+		added[puzzleID] = true
+	}
+	if len(added) > maxSetSize {
+		http.Error(w, fmt.Sprintf("set must not contain more than %d puzzles", maxSetSize), http.StatusBadRequest)
+		return
+	}
 
-		if err != nil {
-			log.Printf("Error updating daily plan for user %s: %v", userID, err)
-		} else {
-			log.Printf("Updated daily plan for user %s: %d puzzles for today", userID, len(todayBatch))
+	if err := repo.AppendPuzzlesToSet(setID, req.PuzzleIDs); err != nil {
+		if errors.Is(err, repository.ErrPuzzleAlreadyInSet) {
+			http.Error(w, "One or more puzzles are already in the set", http.StatusConflict)
+			return
 		}
+		http.Error(w, "Failed to add puzzles to set", http.StatusInternalServerError)
+		return
 	}
+
+	puzzles, err := repo.GetPuzzlesInSet(setID)
+	if err != nil {
+		http.Error(w, "Failed to get puzzles", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(puzzles)
 }
 
-// handleSolutionText returns the solution text for a given puzzle ID
-func handleSolutionText(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	puzzleId := vars["puzzleId"]
+// CycleSummary is a cycle with its completion progress
+type CycleSummary struct {
+	*model.Cycle
+	PuzzlesTotal      int     `json:"puzzles_total"`
+	PuzzlesAttempted  int     `json:"puzzles_attempted"`
+	CompletionPercent float64 `json:"completion_percent"`
+}
 
-	if puzzleId == "" {
-		http.Error(w, "puzzle ID is required", http.StatusBadRequest)
-		return
+// summarizeCycle computes a cycle's completion from its attempts against the set size
+func summarizeCycle(repo repository.Repository, cycle *model.Cycle, setSize int) (*CycleSummary, error) {
+	attempted, err := repo.CountAttemptedPuzzlesInCycle(cycle.ID)
+	if err != nil {
+		return nil, err
 	}
+	return newCycleSummary(cycle, setSize, attempted), nil
+}
 
-	// Get solution text from the mapping
-	solutionsText := SolutionsTextEasy()
-	solutionText, exists := solutionsText[puzzleId]
+func newCycleSummary(cycle *model.Cycle, setSize, attempted int) *CycleSummary {
+	summary := &CycleSummary{
+		Cycle:            cycle,
+		PuzzlesTotal:     setSize,
+		PuzzlesAttempted: attempted,
+	}
+	if setSize > 0 {
+		summary.CompletionPercent = float64(attempted) * 100 / float64(setSize)
+	}
+	return summary
+}
 
-	if !exists {
-		http.Error(w, "solution text not found for puzzle ID", http.StatusNotFound)
+// DashboardSet is a set with its active cycle progress, or a null cycle if none is active
+type DashboardSet struct {
+	*model.Set
+	PuzzlesTotal int           `json:"puzzles_total"`
+	ActiveCycle  *CycleSummary `json:"active_cycle"`
+}
+
+// handleTrainerDashboard returns every set of the user with its active cycle in one response,
+// so the dashboard doesn't need a request per set
+func handleTrainerDashboard(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+	repo := repository.NewSQLiteRepository(db)
+
+	overviews, err := repo.GetSetOverviewsByUserID(userID)
+	if err != nil {
+		http.Error(w, "Failed to get dashboard", http.StatusInternalServerError)
 		return
 	}
 
+	dashboard := []*DashboardSet{}
+	for _, overview := range overviews {
+		entry := &DashboardSet{
+			Set:          &overview.Set,
+			PuzzlesTotal: overview.PuzzlesTotal,
+		}
+		if overview.ActiveCycle != nil {
+			entry.ActiveCycle = newCycleSummary(overview.ActiveCycle, overview.PuzzlesTotal, overview.PuzzlesAttempted)
+		}
+		dashboard = append(dashboard, entry)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"puzzleId":     puzzleId,
-		"solutionText": solutionText,
-	})
+	json.NewEncoder(w).Encode(dashboard)
 }
 
-// Auth handlers
-func handleSignUp(w http.ResponseWriter, r *http.Request) {
-	var req auth.SignUpRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+// handleTrainerCycleRemaining reports how many of a set's puzzles haven't been attempted yet in one of its cycles
+func handleTrainerCycleRemaining(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+
+	vars := mux.Vars(r)
+	setID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid set ID", http.StatusBadRequest)
 		return
 	}
-
-	// Validate input
-	if req.Email == "" || req.Password == "" {
-		http.Error(w, "Email and password are required", http.StatusBadRequest)
+	cycleID, err := strconv.Atoi(vars["cycleId"])
+	if err != nil {
+		http.Error(w, "Invalid cycle ID", http.StatusBadRequest)
 		return
 	}
 
-	if len(req.Password) < 6 {
-		http.Error(w, "Password must be at least 6 characters", http.StatusBadRequest)
+	repo := repository.NewSQLiteRepository(db)
+	if _, ok := getOwnedSet(w, repo, setID, userID); !ok {
 		return
 	}
 
-	// Create user
-	userService := user.NewService(db)
-	user, err := userService.CreateUser(req.Email, req.Password)
-	if err != nil {
-		if err == auth.ErrUserExists {
-			http.Error(w, "User already exists", http.StatusConflict)
-			return
-		}
-		http.Error(w, "Failed to create user", http.StatusInternalServerError)
+	cycle, err := repo.GetCycleByID(cycleID)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Failed to get cycle", http.StatusInternalServerError)
+		return
+	}
+	if err != nil || cycle.SetID != setID {
+		http.Error(w, "Cycle not found", http.StatusNotFound)
 		return
 	}
 
-	// Generate JWT token
-	token, err := auth.GenerateJWT(user.ID, user.Email)
+	total, err := repo.CountPuzzlesInSet(setID)
 	if err != nil {
-		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		http.Error(w, "Failed to get puzzles", http.StatusInternalServerError)
 		return
 	}
-
-	// Set HTTP-only cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:     "auth_token",
-		Value:    token,
-		Path:     "/",
-		MaxAge:   86400, // 24 hours
-		HttpOnly: true,
-		Secure:   false,                // Set to true in production with HTTPS
-		SameSite: http.SameSiteLaxMode, // Changed from StrictMode to LaxMode for better compatibility
-	})
-
-	log.Printf("Set auth cookie for new user %s", user.Email)
-
-	response := auth.AuthResponse{
-		User: *user,
+	attempted, err := repo.CountAttemptedPuzzlesInCycle(cycleID)
+	if err != nil {
+		http.Error(w, "Failed to get cycle progress", http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	json.NewEncoder(w).Encode(map[string]int{
+		"setId":     setID,
+		"cycleId":   cycleID,
+		"total":     total,
+		"attempted": attempted,
+		"remaining": total - attempted,
+	})
 }
 
-func handleSignIn(w http.ResponseWriter, r *http.Request) {
-	var req auth.SignInRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+func handleTrainerSetCycles(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+
+	vars := mux.Vars(r)
+	setID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid set ID", http.StatusBadRequest)
 		return
 	}
 
-	// Validate input
-	if req.Email == "" || req.Password == "" {
-		http.Error(w, "Email and password are required", http.StatusBadRequest)
+	repo := repository.NewSQLiteRepository(db)
+	if _, ok := getOwnedSet(w, repo, setID, userID); !ok {
 		return
 	}
 
-	// Validate credentials
-	userService := user.NewService(db)
-	user, err := userService.ValidateCredentials(req.Email, req.Password)
+	cycles, err := repo.GetCyclesBySetID(setID)
 	if err != nil {
-		log.Printf("Sign-in failed for email %s: %v", req.Email, err)
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		http.Error(w, "Failed to get cycles", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Sign-in successful for user %s", user.Email)
-
-	// Generate JWT token
-	token, err := auth.GenerateJWT(user.ID, user.Email)
+	setSize, err := repo.CountPuzzlesInSet(setID)
 	if err != nil {
-		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		http.Error(w, "Failed to get puzzles", http.StatusInternalServerError)
 		return
 	}
 
-	// Set HTTP-only cookie
-	cookie := &http.Cookie{
-		Name:     "auth_token",
-		Value:    token,
-		Path:     "/",
-		MaxAge:   86400, // 24 hours
-		HttpOnly: true,
-		Secure:   false,                // Set to true in production with HTTPS
-		SameSite: http.SameSiteLaxMode, // Changed from StrictMode to LaxMode for better compatibility
+	summaries := []*CycleSummary{}
+	for _, cycle := range cycles {
+		summary, err := summarizeCycle(repo, cycle, setSize)
+		if err != nil {
+			http.Error(w, "Failed to get cycle progress", http.StatusInternalServerError)
+			return
+		}
+		summaries = append(summaries, summary)
 	}
-	http.SetCookie(w, cookie)
 
-	log.Printf("Set auth cookie for user %s: %s", user.Email, cookie.String())
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summaries)
+}
 
-	response := auth.AuthResponse{
-		User: *user,
+func handleTrainerCycles(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+
+	var cycleData struct {
+		SetID      int    `json:"set_id"`
+		Index      int    `json:"index"`
+		TargetDays int    `json:"target_days"`
+		Status     string `json:"status"`
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	if !decodeJSON(w, r, &cycleData, "Invalid request body") {
+		return
+	}
 
-	log.Printf("Sign-in response sent for user %s", user.Email)
-}
+	repo := repository.NewSQLiteRepository(db)
+	if _, ok := getOwnedSet(w, repo, cycleData.SetID, userID); !ok {
+		return
+	}
 
-func handleLogout(w http.ResponseWriter, r *http.Request) {
-	// Clear the auth cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:     "auth_token",
-		Value:    "",
-		Path:     "/",
-		MaxAge:   -1,
-		HttpOnly: true,
-	})
+	cycle := &model.Cycle{
+		SetID:      cycleData.SetID,
+		Index:      cycleData.Index,
+		TargetDays: cycleData.TargetDays,
+		Status:     cycleData.Status,
+	}
 
-	response := map[string]interface{}{
-		"success": true,
-		"message": "Logged out successfully",
+	if err := repo.CreateCycle(cycle); err != nil {
+		http.Error(w, "Failed to create cycle", http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	json.NewEncoder(w).Encode(cycle)
 }
 
-func handleGetMe(w http.ResponseWriter, r *http.Request) {
-	// Get user ID from context (set by AuthMiddleware)
+// handleTrainerCycleEnd marks a cycle done and ends any session still open under it. Ending a
+// cycle that is already done changes nothing.
+func handleTrainerCycleEnd(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("user_id").(string)
 
-	userService := user.NewService(db)
-	user, err := userService.GetUserByID(userID)
+	cycleID, err := strconv.Atoi(mux.Vars(r)["id"])
 	if err != nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+		http.Error(w, "Invalid cycle ID", http.StatusBadRequest)
 		return
 	}
 
-	// Don't include password hash in response
-	user.PasswordHash = ""
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(user)
-}
-
-// Trainer API handlers
-
-func handleTrainerSets(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value("user_id").(string)
 	repo := repository.NewSQLiteRepository(db)
+	cycle, err := repo.GetCycleByID(cycleID)
+	if err != nil {
+		repoError(w, err, "Cycle not found", "Failed to get cycle")
+		return
+	}
 
-	switch r.Method {
-	case "GET":
-		// Get all sets for the user
-		sets, err := repo.GetSetsByUserID(userID)
+	if _, ok := getOwnedSet(w, repo, cycle.SetID, userID); !ok {
+		return
+	}
+
+	if cycle.Status != "done" {
+		sessions, err := repo.GetSessionsByCycleID(cycle.ID)
 		if err != nil {
-			http.Error(w, "Failed to get sets", http.StatusInternalServerError)
+			http.Error(w, "Failed to get sessions", http.StatusInternalServerError)
 			return
 		}
-
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(sets)
-
-	case "POST":
-		// Create a new set
-		var setData struct {
-			Name          string `json:"name"`
-			Description   string `json:"description"`
-			DifficultyMin string `json:"difficulty_min"`
-			DifficultyMax string `json:"difficulty_max"`
-			Size          int    `json:"size"`
+		now := model.Now()
+		for _, session := range sessions {
+			if session.EndedAt != nil {
+				continue
+			}
+			session.EndedAt = &now
+			if err := repo.UpdateSession(session); err != nil {
+				http.Error(w, "Failed to end session", http.StatusInternalServerError)
+				return
+			}
 		}
 
-		if err := json.NewDecoder(r.Body).Decode(&setData); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+		if err := finishCycle(repo, userID, cycle); err != nil {
+			http.Error(w, "Failed to end cycle", http.StatusInternalServerError)
 			return
 		}
+	}
 
-		// Create the set
-		set := &model.Set{
-			UserID:        userID,
-			Name:          setData.Name,
-			Description:   setData.Description,
-			DifficultyMin: setData.DifficultyMin,
-			DifficultyMax: setData.DifficultyMax,
-			CreatedAt:     time.Now().Format(time.RFC3339),
-		}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cycle)
+}
 
-		if err := repo.CreateSet(set); err != nil {
-			http.Error(w, "Failed to create set", http.StatusInternalServerError)
-			return
-		}
+// handleTrainerCycleUpdate sets a cycle's name and notes. Fields left out of the body are kept.
+func handleTrainerCycleUpdate(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
 
-		// Add puzzles to the set
-		var puzzleIDs []string
-		rows, err := db.Query(`
-			SELECT id FROM puzzles 
-			WHERE difficulty >= ? AND difficulty <= ? 
-			ORDER BY id LIMIT ?
-		`, setData.DifficultyMin, setData.DifficultyMax, setData.Size)
-		if err != nil {
-			http.Error(w, "Failed to get puzzles", http.StatusInternalServerError)
-			return
-		}
-		defer rows.Close()
+	cycleID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid cycle ID", http.StatusBadRequest)
+		return
+	}
 
-		for rows.Next() {
-			var puzzleID string
-			if err := rows.Scan(&puzzleID); err != nil {
-				http.Error(w, "Failed to scan puzzle ID", http.StatusInternalServerError)
-				return
-			}
-			puzzleIDs = append(puzzleIDs, puzzleID)
-		}
+	var req struct {
+		Name  *string `json:"name"`
+		Notes *string `json:"notes"`
+	}
+	if !decodeJSON(w, r, &req, "Invalid request body") {
+		return
+	}
 
-		// Add puzzles to set
-		for i, puzzleID := range puzzleIDs {
-			if err := repo.AddPuzzleToSet(set.ID, puzzleID, i+1); err != nil {
-				http.Error(w, "Failed to add puzzle to set", http.StatusInternalServerError)
-				return
-			}
-		}
+	repo := repository.NewSQLiteRepository(db)
+	cycle, err := repo.GetCycleByID(cycleID)
+	if err != nil {
+		repoError(w, err, "Cycle not found", "Failed to get cycle")
+		return
+	}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(set)
+	if _, ok := getOwnedSet(w, repo, cycle.SetID, userID); !ok {
+		return
+	}
+
+	if req.Name != nil {
+		cycle.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Notes != nil {
+		cycle.Notes = *req.Notes
+	}
+	if err := repo.UpdateCycle(cycle); err != nil {
+		http.Error(w, "Failed to update cycle", http.StatusInternalServerError)
+		return
 	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cycle)
 }
 
-func handleTrainerSetPuzzles(w http.ResponseWriter, r *http.Request) {
+// handleTrainerCycleNextPuzzle serves the first puzzle in the cycle's shuffled order
+// that hasn't been attempted in any of the cycle's sessions
+func handleTrainerCycleNextPuzzle(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+
 	vars := mux.Vars(r)
-	setIDStr := vars["id"]
-	setID, err := strconv.Atoi(setIDStr)
+	cycleID, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "Invalid set ID", http.StatusBadRequest)
+		http.Error(w, "Invalid cycle ID", http.StatusBadRequest)
 		return
 	}
 
 	repo := repository.NewSQLiteRepository(db)
-	puzzles, err := repo.GetPuzzlesInSet(setID)
+	cycle, err := repo.GetCycleByID(cycleID)
 	if err != nil {
-		http.Error(w, "Failed to get puzzles", http.StatusInternalServerError)
+		repoError(w, err, "Cycle not found", "Failed to get cycle")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(puzzles)
-}
-
-func handleTrainerCycles(w http.ResponseWriter, r *http.Request) {
-	var cycleData struct {
-		SetID      int    `json:"set_id"`
-		Index      int    `json:"index"`
-		TargetDays int    `json:"target_days"`
-		Status     string `json:"status"`
+	if _, ok := getOwnedSet(w, repo, cycle.SetID, userID); !ok {
+		return
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&cycleData); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	var attempted []string
+	err = db.Select(&attempted, `
+		SELECT DISTINCT a.puzzle_id
+		FROM attempts a
+		JOIN sessions s ON s.id = a.session_id
+		WHERE s.cycle_id = ?
+	`, cycle.ID)
+	if err != nil {
+		http.Error(w, "Failed to get attempts", http.StatusInternalServerError)
 		return
 	}
-
-	repo := repository.NewSQLiteRepository(db)
-	cycle := &model.Cycle{
-		SetID:      cycleData.SetID,
-		Index:      cycleData.Index,
-		TargetDays: cycleData.TargetDays,
-		Status:     cycleData.Status,
+	done := make(map[string]bool, len(attempted))
+	for _, puzzleID := range attempted {
+		done[puzzleID] = true
 	}
 
-	if err := repo.CreateCycle(cycle); err != nil {
-		http.Error(w, "Failed to create cycle", http.StatusInternalServerError)
+	woodpeckerService := woodpecker.NewService(db)
+	order := woodpeckerService.ShuffleForCycle(cycle.SetID, cycle.Index)
+
+	for _, puzzleID := range order {
+		if done[puzzleID] {
+			continue
+		}
+
+		var puzzle model.PuzzleDB
+		err := db.Get(&puzzle, `
+			SELECT id, fen, side_to_move, difficulty 
+			FROM puzzles 
+			WHERE id = ?
+		`, puzzleID)
+		if err != nil {
+			http.Error(w, "puzzle not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":          puzzle.ID,
+			"fen":         puzzle.FEN,
+			"sideToMove":  model.SideToMove(puzzle.FEN),
+			"difficulty":  puzzle.Difficulty,
+			"orientation": boardOrientationFor(userID, puzzle.FEN),
+			"done":        false,
+		})
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(cycle)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"done": true,
+	})
 }
 
 func handleTrainerActiveCycle(w http.ResponseWriter, r *http.Request) {
@@ -1668,7 +5505,7 @@ func handleTrainerActiveCycle(w http.ResponseWriter, r *http.Request) {
 	repo := repository.NewSQLiteRepository(db)
 	cycle, err := repo.GetActiveCycleBySetID(setID)
 	if err != nil {
-		http.Error(w, "Failed to get active cycle", http.StatusInternalServerError)
+		repoError(w, err, "No active cycle", "Failed to get active cycle")
 		return
 	}
 
@@ -1676,26 +5513,80 @@ func handleTrainerActiveCycle(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(cycle)
 }
 
+// idempotencyWindow is how long a replayed Idempotency-Key returns the original session
+const idempotencyWindow = 24 * time.Hour
+
+// requestFingerprint hashes a decoded request body, so a replayed Idempotency-Key can be checked
+// against the request it was first used for
+func requestFingerprint(body interface{}) string {
+	data, _ := json.Marshal(body)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
 func handleTrainerSessions(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+
 	var sessionData struct {
-		CycleID     int `json:"cycle_id"`
-		TargetCount int `json:"target_count"`
+		CycleID          int  `json:"cycle_id"`
+		TargetCount      int  `json:"target_count"`
+		TimeLimitSeconds *int `json:"time_limit_seconds"`
+	}
+
+	if !decodeJSON(w, r, &sessionData, "Invalid request body") {
+		return
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&sessionData); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if sessionData.TimeLimitSeconds != nil && *sessionData.TimeLimitSeconds <= 0 {
+		http.Error(w, "time_limit_seconds must be positive", http.StatusBadRequest)
+		return
+	}
+
+	if sessionData.TargetCount <= 0 {
+		http.Error(w, "target_count must be positive", http.StatusBadRequest)
 		return
 	}
 
 	repo := repository.NewSQLiteRepository(db)
-	now := time.Now().Format(time.RFC3339)
+
+	// The target can't exceed the puzzles in the cycle's set
+	cycle, err := repo.GetCycleByID(sessionData.CycleID)
+	if err != nil {
+		repoError(w, err, "Cycle not found", "Failed to get cycle")
+		return
+	}
+	if _, ok := getOwnedSet(w, repo, cycle.SetID, userID); !ok {
+		return
+	}
+	setSize, err := repo.CountPuzzlesInSet(cycle.SetID)
+	if err != nil {
+		http.Error(w, "Failed to get puzzles", http.StatusInternalServerError)
+		return
+	}
+	if sessionData.TargetCount > setSize {
+		http.Error(w, fmt.Sprintf("target_count must not exceed the set's %d puzzles", setSize), http.StatusBadRequest)
+		return
+	}
+
+	now := model.Now()
 	session := &model.Session{
-		CycleID:     sessionData.CycleID,
-		StartedAt:   &now,
-		TargetCount: sessionData.TargetCount,
+		CycleID:          sessionData.CycleID,
+		StartedAt:        &now,
+		TargetCount:      sessionData.TargetCount,
+		TimeLimitSeconds: sessionData.TimeLimitSeconds,
 	}
 
-	if err := repo.CreateSession(session); err != nil {
+	if key := r.Header.Get("Idempotency-Key"); key != "" {
+		_, err := repo.CreateSessionWithIdempotencyKey(session, userID, key, requestFingerprint(sessionData), idempotencyWindow)
+		if errors.Is(err, repository.ErrIdempotencyKeyReused) {
+			http.Error(w, "Idempotency-Key was already used for a different request", http.StatusUnprocessableEntity)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to create session", http.StatusInternalServerError)
+			return
+		}
+	} else if err := repo.CreateSession(session); err != nil {
 		http.Error(w, "Failed to create session", http.StatusInternalServerError)
 		return
 	}
@@ -1704,6 +5595,48 @@ func handleTrainerSessions(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(session)
 }
 
+// checkSessionOpen checks the session exists, belongs to the user, hasn't ended and is within its
+// time limit, writing an error if not. A timed session past its limit is ended at the moment it
+// expired and reported as 410 "session expired".
+func checkSessionOpen(w http.ResponseWriter, sessionID int, userID string) bool {
+	repo := repository.NewSQLiteRepository(db)
+	session, err := repo.GetSessionByID(sessionID)
+	if err != nil {
+		repoError(w, err, "Session not found", "Failed to get session")
+		return false
+	}
+
+	cycle, err := repo.GetCycleByID(session.CycleID)
+	if err != nil {
+		http.Error(w, "Failed to get session", http.StatusInternalServerError)
+		return false
+	}
+	if _, ok := getOwnedSet(w, repo, cycle.SetID, userID); !ok {
+		return false
+	}
+
+	if session.TimeLimitSeconds != nil && session.StartedAt != nil {
+		expiresAt := session.StartedAt.Add(time.Duration(*session.TimeLimitSeconds) * time.Second)
+		if !time.Now().Before(expiresAt) {
+			if session.EndedAt == nil {
+				endedAt := model.NewTimestamp(expiresAt)
+				session.EndedAt = &endedAt
+				if err := repo.UpdateSession(session); err != nil {
+					slog.Error("Failed to end expired session", "session", session.ID, "error", err)
+				}
+			}
+			http.Error(w, "session expired", http.StatusGone)
+			return false
+		}
+	}
+
+	if session.EndedAt != nil {
+		http.Error(w, "session has ended", http.StatusConflict)
+		return false
+	}
+	return true
+}
+
 func handleTrainerSessionUpdate(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	sessionIDStr := vars["id"]
@@ -1714,19 +5647,18 @@ func handleTrainerSessionUpdate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var updateData struct {
-		EndedAt         *string `json:"ended_at"`
-		DurationSeconds int     `json:"duration_seconds"`
+		EndedAt         *model.Timestamp `json:"ended_at"`
+		DurationSeconds int              `json:"duration_seconds"`
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&updateData); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !decodeJSON(w, r, &updateData, "Invalid request body") {
 		return
 	}
 
 	repo := repository.NewSQLiteRepository(db)
 	session, err := repo.GetSessionByID(sessionID)
 	if err != nil {
-		http.Error(w, "Session not found", http.StatusNotFound)
+		repoError(w, err, "Session not found", "Failed to get session")
 		return
 	}
 
@@ -0,0 +1,271 @@
+package main
+
+import "strings"
+
+var (
+	knightOffsets    = [][2]int{{-2, -1}, {-2, 1}, {-1, -2}, {-1, 2}, {1, -2}, {1, 2}, {2, -1}, {2, 1}}
+	kingOffsets      = [][2]int{{-1, -1}, {-1, 0}, {-1, 1}, {0, -1}, {0, 1}, {1, -1}, {1, 0}, {1, 1}}
+	rookDirections   = [][2]int{{-1, 0}, {1, 0}, {0, -1}, {0, 1}}
+	bishopDirections = [][2]int{{-1, -1}, {-1, 1}, {1, -1}, {1, 1}}
+	promotionPieces  = []PieceType{Queen, Rook, Bishop, Knight}
+)
+
+func onBoard(row, col int) bool {
+	return row >= 0 && row < 8 && col >= 0 && col < 8
+}
+
+// pawnDirection is the row delta of a forward pawn step for the given color
+func pawnDirection(color string) int {
+	if color == "white" {
+		return -1
+	}
+	return 1
+}
+
+// isSquareAttacked reports whether any piece of color byColor attacks the square
+func isSquareAttacked(board *[8][8]*Piece, row, col int, byColor string) bool {
+	return countAttackers(board, row, col, byColor) > 0
+}
+
+// countAttackers returns how many pieces of color byColor attack the square. Sliding pieces
+// are counted only when their line is clear, so batteries count as one attacker.
+func countAttackers(board *[8][8]*Piece, row, col int, byColor string) int {
+	isPiece := func(r, c int, types ...PieceType) bool {
+		if !onBoard(r, c) || board[r][c] == nil || board[r][c].Color != byColor {
+			return false
+		}
+		for _, t := range types {
+			if board[r][c].Type == t {
+				return true
+			}
+		}
+		return false
+	}
+
+	count := 0
+
+	// Pawns attack diagonally forward, so look one row behind the square from the attacker's view
+	pawnRow := row - pawnDirection(byColor)
+	if isPiece(pawnRow, col-1, Pawn) {
+		count++
+	}
+	if isPiece(pawnRow, col+1, Pawn) {
+		count++
+	}
+
+	for _, o := range knightOffsets {
+		if isPiece(row+o[0], col+o[1], Knight) {
+			count++
+		}
+	}
+
+	for _, o := range kingOffsets {
+		if isPiece(row+o[0], col+o[1], King) {
+			count++
+		}
+	}
+
+	slides := func(directions [][2]int, types ...PieceType) {
+		for _, d := range directions {
+			r, c := row+d[0], col+d[1]
+			for onBoard(r, c) {
+				if board[r][c] != nil {
+					if isPiece(r, c, types...) {
+						count++
+					}
+					break
+				}
+				r, c = r+d[0], c+d[1]
+			}
+		}
+	}
+	slides(rookDirections, Rook, Queen)
+	slides(bishopDirections, Bishop, Queen)
+
+	return count
+}
+
+// inCheck reports whether the king of the given color is attacked
+func inCheck(board *[8][8]*Piece, color string) bool {
+	for row := 0; row < 8; row++ {
+		for col := 0; col < 8; col++ {
+			piece := board[row][col]
+			if piece != nil && piece.Type == King && piece.Color == color {
+				return isSquareAttacked(board, row, col, opponent(color))
+			}
+		}
+	}
+	return false
+}
+
+// LegalMoves returns every legal move for the side to move
+func (p *Position) LegalMoves() []Move {
+	var legal []Move
+	for _, move := range p.pseudoLegalMoves() {
+		next := p.applyMove(move)
+		if !inCheck(&next.Board, p.SideToMove) {
+			legal = append(legal, move)
+		}
+	}
+	return legal
+}
+
+// CountLegalMoves returns how many legal moves the given color has on the board, as if it were
+// that side's turn. As with ResolveSAN, castling rights are inferred from the home squares and no
+// en passant capture is assumed. Zero means the side is checkmated or stalemated.
+func CountLegalMoves(board [8][8]*Piece, color string) int {
+	pos := &Position{
+		Board:          board,
+		SideToMove:     color,
+		Castling:       inferCastlingRights(&board),
+		EnPassant:      "-",
+		FullmoveNumber: 1,
+	}
+	return len(pos.LegalMoves())
+}
+
+// pseudoLegalMoves generates moves for the side to move without checking whether they leave the king in check
+func (p *Position) pseudoLegalMoves() []Move {
+	var moves []Move
+	color := p.SideToMove
+
+	for row := 0; row < 8; row++ {
+		for col := 0; col < 8; col++ {
+			piece := p.Board[row][col]
+			if piece == nil || piece.Color != color {
+				continue
+			}
+
+			switch piece.Type {
+			case Pawn:
+				moves = append(moves, p.pawnMoves(row, col)...)
+			case Knight:
+				moves = append(moves, p.stepMoves(row, col, knightOffsets)...)
+			case King:
+				moves = append(moves, p.stepMoves(row, col, kingOffsets)...)
+				moves = append(moves, p.castlingMoves(row, col)...)
+			case Bishop:
+				moves = append(moves, p.slideMoves(row, col, bishopDirections)...)
+			case Rook:
+				moves = append(moves, p.slideMoves(row, col, rookDirections)...)
+			case Queen:
+				moves = append(moves, p.slideMoves(row, col, rookDirections)...)
+				moves = append(moves, p.slideMoves(row, col, bishopDirections)...)
+			}
+		}
+	}
+
+	return moves
+}
+
+func (p *Position) pawnMoves(row, col int) []Move {
+	var moves []Move
+	color := p.Board[row][col].Color
+	dir := pawnDirection(color)
+	startRow, lastRow := 6, 0
+	if color == "black" {
+		startRow, lastRow = 1, 7
+	}
+
+	add := func(toRow, toCol int) {
+		if toRow == lastRow {
+			for _, promotion := range promotionPieces {
+				moves = append(moves, Move{FromRow: row, FromCol: col, ToRow: toRow, ToCol: toCol, Promotion: promotion})
+			}
+			return
+		}
+		moves = append(moves, Move{FromRow: row, FromCol: col, ToRow: toRow, ToCol: toCol})
+	}
+
+	if onBoard(row+dir, col) && p.Board[row+dir][col] == nil {
+		add(row+dir, col)
+		if row == startRow && p.Board[row+2*dir][col] == nil {
+			add(row+2*dir, col)
+		}
+	}
+
+	epRow, epCol, hasEnPassant := parseSquare(p.EnPassant)
+	for _, dc := range []int{-1, 1} {
+		toRow, toCol := row+dir, col+dc
+		if !onBoard(toRow, toCol) {
+			continue
+		}
+		target := p.Board[toRow][toCol]
+		if (target != nil && target.Color != color) || (hasEnPassant && toRow == epRow && toCol == epCol) {
+			add(toRow, toCol)
+		}
+	}
+
+	return moves
+}
+
+func (p *Position) stepMoves(row, col int, offsets [][2]int) []Move {
+	var moves []Move
+	color := p.Board[row][col].Color
+	for _, o := range offsets {
+		toRow, toCol := row+o[0], col+o[1]
+		if !onBoard(toRow, toCol) {
+			continue
+		}
+		if target := p.Board[toRow][toCol]; target == nil || target.Color != color {
+			moves = append(moves, Move{FromRow: row, FromCol: col, ToRow: toRow, ToCol: toCol})
+		}
+	}
+	return moves
+}
+
+func (p *Position) slideMoves(row, col int, directions [][2]int) []Move {
+	var moves []Move
+	color := p.Board[row][col].Color
+	for _, d := range directions {
+		toRow, toCol := row+d[0], col+d[1]
+		for onBoard(toRow, toCol) {
+			target := p.Board[toRow][toCol]
+			if target != nil && target.Color == color {
+				break
+			}
+			moves = append(moves, Move{FromRow: row, FromCol: col, ToRow: toRow, ToCol: toCol})
+			if target != nil {
+				break
+			}
+			toRow, toCol = toRow+d[0], toCol+d[1]
+		}
+	}
+	return moves
+}
+
+// castlingMoves generates castling moves allowed by the castling rights; the king may not
+// start in, pass through, or land on an attacked square
+func (p *Position) castlingMoves(row, col int) []Move {
+	color := p.Board[row][col].Color
+	homeRow, kingSide, queenSide := 7, "K", "Q"
+	if color == "black" {
+		homeRow, kingSide, queenSide = 0, "k", "q"
+	}
+	if row != homeRow || col != 4 || p.Castling == "-" {
+		return nil
+	}
+
+	enemy := opponent(color)
+	if isSquareAttacked(&p.Board, row, col, enemy) {
+		return nil
+	}
+
+	hasRook := func(c int) bool {
+		piece := p.Board[row][c]
+		return piece != nil && piece.Type == Rook && piece.Color == color
+	}
+
+	var moves []Move
+	if strings.Contains(p.Castling, kingSide) && hasRook(7) &&
+		p.Board[row][5] == nil && p.Board[row][6] == nil &&
+		!isSquareAttacked(&p.Board, row, 5, enemy) && !isSquareAttacked(&p.Board, row, 6, enemy) {
+		moves = append(moves, Move{FromRow: row, FromCol: col, ToRow: row, ToCol: 6})
+	}
+	if strings.Contains(p.Castling, queenSide) && hasRook(0) &&
+		p.Board[row][1] == nil && p.Board[row][2] == nil && p.Board[row][3] == nil &&
+		!isSquareAttacked(&p.Board, row, 3, enemy) && !isSquareAttacked(&p.Board, row, 2, enemy) {
+		moves = append(moves, Move{FromRow: row, FromCol: col, ToRow: row, ToCol: 2})
+	}
+	return moves
+}
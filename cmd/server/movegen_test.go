@@ -0,0 +1,87 @@
+package main
+
+import "testing"
+
+func TestCountLegalMoves(t *testing.T) {
+	tests := []struct {
+		name         string
+		fen          string
+		white, black int // -1 skips the check
+	}{
+		{"start position", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", 20, 20},
+		{"castling inferred from home squares", "r3k2r/8/8/8/8/8/8/R3K2R w - - 0 1", 26, 26},
+		{"cramped king", "k7/8/1K6/8/8/8/8/8 b - - 0 1", 6, 1},
+		{"stalemate", "k7/2Q5/1K6/8/8/8/8/8 b - - 0 1", 26, 0},
+		{"checkmate", "rnb1kbnr/pppp1ppp/8/4p3/6Pq/5P2/PPPPP2P/RNBQKBNR w KQkq - 1 3", 0, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pos := mustParseFEN(t, tt.fen)
+			if got := CountLegalMoves(pos.Board, "white"); tt.white >= 0 && got != tt.white {
+				t.Errorf("white has %d legal moves, want %d", got, tt.white)
+			}
+			if got := CountLegalMoves(pos.Board, "black"); tt.black >= 0 && got != tt.black {
+				t.Errorf("black has %d legal moves, want %d", got, tt.black)
+			}
+		})
+	}
+}
+
+func TestCountAttackers(t *testing.T) {
+	tests := []struct {
+		name   string
+		fen    string
+		square string
+		color  string
+		want   int
+	}{
+		{"pawns from both sides", "4k3/8/8/8/8/2P1P3/8/4K3 w - - 0 1", "d4", "white", 2},
+		{"knight and king", "4k3/8/8/8/8/8/3K4/1N6 w - - 0 1", "c3", "white", 2},
+		{"open file", "4k3/8/8/3q4/8/8/8/3RK3 w - - 0 1", "d5", "white", 1},
+		{"blocked line", "4k3/8/8/3q4/8/3P4/8/3RK3 w - - 0 1", "d5", "white", 0},
+		{"battery counts once", "4k3/8/8/3q4/8/8/3R4/3QK3 w - - 0 1", "d5", "white", 1},
+		{"diagonal and line", "4k3/8/8/3q4/8/1B6/8/3RK3 w - - 0 1", "d5", "white", 2},
+		{"no attackers", testPuzzleFEN, "h4", "black", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pos := mustParseFEN(t, tt.fen)
+			row, col, _ := parseSquare(tt.square)
+			if got := countAttackers(&pos.Board, row, col, tt.color); got != tt.want {
+				t.Errorf("%s attackers of %s = %d, want %d", tt.color, tt.square, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePartialFEN(t *testing.T) {
+	pos, err := ParseFEN("r3k3/8/8/8/8/8/5PPP/6K1 b")
+	if err != nil {
+		t.Fatalf("two-field FEN: %v", err)
+	}
+	if pos.SideToMove != "black" || pos.Castling != "-" || pos.EnPassant != "-" || pos.HalfmoveClock != 0 || pos.FullmoveNumber != 1 {
+		t.Errorf("defaults = %s %q %q %d %d, want black - - 0 1", pos.SideToMove, pos.Castling, pos.EnPassant, pos.HalfmoveClock, pos.FullmoveNumber)
+	}
+	if got := pos.FEN(); got != "r3k3/8/8/8/8/8/5PPP/6K1 b - - 0 1" {
+		t.Errorf("FEN() = %q", got)
+	}
+
+	for _, fen := range []string{"r3k3/8/8/8/8/8/5PPP/6K1", "r3k3/8/8/8/8/8/5PPP/6K1 b - - 0 1 extra"} {
+		if _, err := ParseFEN(fen); err == nil {
+			t.Errorf("ParseFEN(%q) accepted it", fen)
+		}
+	}
+
+	previous := strictFEN
+	t.Cleanup(func() { strictFEN = previous })
+	t.Setenv("STRICT_FEN", "true")
+	loadConfig()
+	if _, err := ParseFEN("r3k3/8/8/8/8/8/5PPP/6K1 b"); err == nil {
+		t.Error("STRICT_FEN accepted a two-field FEN")
+	}
+	if _, err := ParseFEN("r3k3/8/8/8/8/8/5PPP/6K1 b q - 0 1"); err != nil {
+		t.Errorf("STRICT_FEN rejected a full FEN: %v", err)
+	}
+}
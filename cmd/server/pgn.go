@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// standardStartFEN is the usual initial position; games from any other position get SetUp and FEN tags
+const standardStartFEN = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+
+// pgnLineWidth is the longest movetext line written, as the PGN export format recommends
+const pgnLineWidth = 79
+
+// gamePosition returns the legacy game's current position. The game doesn't track castling or en
+// passant rights, so castling is inferred from the board and no en passant capture is assumed.
+func gamePosition() *Position {
+	return &Position{
+		Board:          game.Board,
+		SideToMove:     game.CurrentPlayer,
+		Castling:       inferCastlingRights(&game.Board),
+		EnPassant:      "-",
+		HalfmoveClock:  game.HalfmoveClock,
+		FullmoveNumber: 1,
+	}
+}
+
+// pgnResult maps the game state to a PGN result: "1-0", "0-1", "1/2-1/2", or "*" while it is in progress
+func pgnResult() string {
+	switch {
+	case !game.GameOver:
+		return "*"
+	case game.Winner == "white":
+		return "1-0"
+	case game.Winner == "black":
+		return "0-1"
+	default:
+		return "1/2-1/2"
+	}
+}
+
+// buildPGN writes the game as PGN with the seven-tag roster. Tags the game doesn't know are "?".
+func buildPGN() string {
+	result := pgnResult()
+
+	var b strings.Builder
+	tags := [][2]string{
+		{"Event", "?"},
+		{"Site", "?"},
+		{"Date", "????.??.??"},
+		{"Round", "?"},
+		{"White", "?"},
+		{"Black", "?"},
+		{"Result", result},
+	}
+	if game.StartFEN != "" && game.StartFEN != standardStartFEN {
+		tags = append(tags, [2]string{"SetUp", "1"}, [2]string{"FEN", game.StartFEN})
+	}
+	for _, tag := range tags {
+		fmt.Fprintf(&b, "[%s %q]\n", tag[0], tag[1])
+	}
+	b.WriteString("\n")
+
+	// Number moves from the start position's side to move and fullmove number
+	moveNumber, white := 1, true
+	if pos, err := ParseFEN(game.StartFEN); err == nil {
+		moveNumber, white = pos.FullmoveNumber, pos.SideToMove == "white"
+	}
+
+	var tokens []string
+	for i, san := range game.SANHistory {
+		switch {
+		case white:
+			tokens = append(tokens, fmt.Sprintf("%d.", moveNumber))
+		case i == 0:
+			tokens = append(tokens, fmt.Sprintf("%d...", moveNumber))
+		}
+		tokens = append(tokens, san)
+		if !white {
+			moveNumber++
+		}
+		white = !white
+	}
+	tokens = append(tokens, result)
+
+	lineLength := 0
+	for i, token := range tokens {
+		if i > 0 {
+			if lineLength+1+len(token) > pgnLineWidth {
+				b.WriteString("\n")
+				lineLength = 0
+			} else {
+				b.WriteString(" ")
+				lineLength++
+			}
+		}
+		b.WriteString(token)
+		lineLength += len(token)
+	}
+	b.WriteString("\n")
+
+	return b.String()
+}
+
+// handleGamePGN exports the legacy game's moves as PGN
+func handleGamePGN(w http.ResponseWriter, r *http.Request) {
+	gameLock.RLock()
+	defer gameLock.RUnlock()
+
+	w.Header().Set("Content-Type", "application/x-chess-pgn")
+	w.Write([]byte(buildPGN()))
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"woodpecker-online/internal/model"
+)
+
+// planQueueSize is how many rebuild jobs can wait for a worker before enqueuing has to wait
+const planQueueSize = 100
+
+// planRebuildQueue rebuilds users' daily plans on a fixed pool of workers, so the nightly cron
+// tick only hands out the work instead of doing it
+type planRebuildQueue struct {
+	jobs    chan planRebuildJob
+	rebuild func(userID string) error
+}
+
+type planRebuildJob struct {
+	userID string
+	run    *planRebuildRun
+}
+
+// planRebuildRun collects the outcome of one batch of rebuilds. Done is closed once every job
+// has finished and the run has been recorded in cron_runs.
+type planRebuildRun struct {
+	StartedAt model.Timestamp
+	Total     int
+	Done      chan struct{}
+
+	mu       sync.Mutex
+	failures map[string]string // user ID to error
+	pending  sync.WaitGroup
+}
+
+// newPlanRebuildQueue starts workers goroutines that call rebuild for each queued user
+func newPlanRebuildQueue(workers int, rebuild func(userID string) error) *planRebuildQueue {
+	q := &planRebuildQueue{
+		jobs:    make(chan planRebuildJob, planQueueSize),
+		rebuild: rebuild,
+	}
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+	return q
+}
+
+func (q *planRebuildQueue) work() {
+	for job := range q.jobs {
+		err := q.rebuild(job.userID)
+		if err != nil {
+			slog.Error("Error updating daily plan", "user", job.userID, "error", err)
+		}
+		job.run.finish(job.userID, err)
+	}
+}
+
+// Enqueue queues a rebuild for each user and returns without waiting for them, even when the
+// queue is full. The run is recorded in cron_runs once every job has finished.
+func (q *planRebuildQueue) Enqueue(userIDs []string) *planRebuildRun {
+	run := &planRebuildRun{
+		StartedAt: model.Now(),
+		Total:     len(userIDs),
+		Done:      make(chan struct{}),
+		failures:  map[string]string{},
+	}
+	run.pending.Add(len(userIDs))
+
+	go func() {
+		for _, userID := range userIDs {
+			q.jobs <- planRebuildJob{userID: userID, run: run}
+		}
+	}()
+
+	go func() {
+		run.pending.Wait()
+		if err := recordCronRun("daily_plans", run); err != nil {
+			slog.Error("Failed to record cron run", "job", "daily_plans", "error", err)
+		}
+		slog.Info("Updated daily plans", "users", run.Total, "failed", len(run.Failures()))
+		close(run.Done)
+	}()
+
+	return run
+}
+
+func (run *planRebuildRun) finish(userID string, err error) {
+	if err != nil {
+		run.mu.Lock()
+		run.failures[userID] = err.Error()
+		run.mu.Unlock()
+	}
+	run.pending.Done()
+}
+
+// Failures returns the error of each rebuild that failed, by user ID
+func (run *planRebuildRun) Failures() map[string]string {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+
+	failures := make(map[string]string, len(run.failures))
+	for userID, msg := range run.failures {
+		failures[userID] = msg
+	}
+	return failures
+}
+
+// recordCronRun stores a summary of a finished run, with the errors of the jobs that failed
+func recordCronRun(job string, run *planRebuildRun) error {
+	failures := run.Failures()
+	errorsJSON, err := json.Marshal(failures)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO cron_runs (job, started_at, finished_at, jobs, failed, errors_json)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, job, run.StartedAt, model.NewTimestamp(time.Now()), run.Total, len(failures), string(errorsJSON))
+	return err
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPlanRebuildQueueRecordsRun(t *testing.T) {
+	tests := []struct {
+		name    string
+		jobs    int
+		failing map[string]bool
+	}{
+		{"no failures", 5, nil},
+		{"some failures", 5, map[string]bool{"user1": true, "user3": true}},
+		{"more jobs than the queue holds", planQueueSize * 2, map[string]bool{"user150": true}},
+		{"no users", 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestDB(t)
+
+			// Workers wait for release, so Enqueue has to return while the jobs are still queued
+			release := make(chan struct{})
+			var processed atomic.Int32
+			q := newPlanRebuildQueue(2, func(userID string) error {
+				<-release
+				processed.Add(1)
+				if tt.failing[userID] {
+					return fmt.Errorf("rebuild %s failed", userID)
+				}
+				return nil
+			})
+			defer close(q.jobs)
+
+			userIDs := make([]string, tt.jobs)
+			for i := range userIDs {
+				userIDs[i] = fmt.Sprintf("user%d", i)
+			}
+
+			enqueued := make(chan *planRebuildRun)
+			go func() { enqueued <- q.Enqueue(userIDs) }()
+			var run *planRebuildRun
+			select {
+			case run = <-enqueued:
+			case <-time.After(time.Second):
+				t.Fatal("Enqueue blocked on the workers")
+			}
+
+			close(release)
+			select {
+			case <-run.Done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("run did not finish")
+			}
+			if int(processed.Load()) != tt.jobs {
+				t.Errorf("processed %d jobs, want %d", processed.Load(), tt.jobs)
+			}
+
+			var row struct {
+				Job        string `db:"job"`
+				Jobs       int    `db:"jobs"`
+				Failed     int    `db:"failed"`
+				ErrorsJSON string `db:"errors_json"`
+			}
+			if err := db.Get(&row, `SELECT job, jobs, failed, errors_json FROM cron_runs`); err != nil {
+				t.Fatal(err)
+			}
+			var errs map[string]string
+			if err := json.Unmarshal([]byte(row.ErrorsJSON), &errs); err != nil {
+				t.Fatal(err)
+			}
+			if row.Job != "daily_plans" || row.Jobs != tt.jobs || row.Failed != len(tt.failing) {
+				t.Errorf("cron run = %+v, want daily_plans with %d jobs, %d failed", row, tt.jobs, len(tt.failing))
+			}
+			for userID := range tt.failing {
+				if errs[userID] != "rebuild "+userID+" failed" {
+					t.Errorf("error for %s = %q", userID, errs[userID])
+				}
+			}
+			if len(errs) != len(tt.failing) {
+				t.Errorf("errors = %v, want %d", errs, len(tt.failing))
+			}
+		})
+	}
+}
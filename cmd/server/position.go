@@ -0,0 +1,274 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"woodpecker-online/internal/model"
+)
+
+// Position is a board together with the FEN state needed to generate fully legal moves
+type Position struct {
+	Board          [8][8]*Piece
+	SideToMove     string // "white" or "black"
+	Castling       string // subset of "KQkq", or "-"
+	EnPassant      string // target square such as "e3", or "-"
+	HalfmoveClock  int
+	FullmoveNumber int
+}
+
+var fenPieceTypes = map[rune]PieceType{
+	'k': King,
+	'q': Queen,
+	'r': Rook,
+	'b': Bishop,
+	'n': Knight,
+	'p': Pawn,
+}
+
+// strictFEN makes ParseFEN require all six FEN fields (STRICT_FEN, default false)
+var strictFEN = false
+
+// ParseFEN builds a Position from a FEN string. Unless strictFEN is set, the placement and side
+// to move are enough: missing castling, en passant and clock fields default to "- - 0 1".
+func ParseFEN(fen string) (*Position, error) {
+	return parseFEN(fen, strictFEN)
+}
+
+// parseFEN builds a Position from a FEN string, requiring all six fields when strict is set
+func parseFEN(fen string, strict bool) (*Position, error) {
+	n := len(strings.Fields(fen))
+	if strict && n != 6 {
+		return nil, fmt.Errorf("FEN has %d fields, expected 6", n)
+	}
+	if n < 2 || n > 6 {
+		return nil, fmt.Errorf("FEN has %d fields, expected the placement, side to move and up to 4 more", n)
+	}
+
+	fields, err := model.ParseFENFields(fen)
+	if err != nil {
+		return nil, err
+	}
+
+	pos := &Position{
+		SideToMove:     "white",
+		Castling:       fields.Castling,
+		EnPassant:      fields.EnPassant,
+		HalfmoveClock:  fields.HalfmoveClock,
+		FullmoveNumber: fields.FullmoveNumber,
+	}
+	if fields.ActiveColor == "b" {
+		pos.SideToMove = "black"
+	}
+
+	ranks := strings.Split(fields.Placement, "/")
+	if len(ranks) != 8 {
+		return nil, fmt.Errorf("FEN placement has %d ranks, expected 8", len(ranks))
+	}
+
+	kings := map[string]int{}
+	for row, rank := range ranks {
+		col := 0
+		for _, c := range rank {
+			if c >= '1' && c <= '8' {
+				col += int(c - '0')
+				continue
+			}
+
+			pieceType, ok := fenPieceTypes[unicode.ToLower(c)]
+			if !ok {
+				return nil, fmt.Errorf("invalid piece %q in FEN", c)
+			}
+			if col > 7 {
+				return nil, fmt.Errorf("rank %d has more than 8 squares", 8-row)
+			}
+
+			color := "black"
+			if unicode.IsUpper(c) {
+				color = "white"
+			}
+			if pieceType == King {
+				kings[color]++
+			}
+			pos.Board[row][col] = &Piece{Type: pieceType, Color: color}
+			col++
+		}
+		if col != 8 {
+			return nil, fmt.Errorf("rank %d has %d squares, expected 8", 8-row, col)
+		}
+	}
+
+	if kings["white"] != 1 || kings["black"] != 1 {
+		return nil, fmt.Errorf("FEN must have exactly one king per side")
+	}
+
+	if pos.Castling != "-" && strings.Trim(pos.Castling, "KQkq") != "" {
+		return nil, fmt.Errorf("invalid castling field %q", pos.Castling)
+	}
+
+	if pos.EnPassant != "-" {
+		row, _, ok := parseSquare(pos.EnPassant)
+		if !ok || (row != 2 && row != 5) {
+			return nil, fmt.Errorf("invalid en passant field %q", pos.EnPassant)
+		}
+	}
+
+	return pos, nil
+}
+
+// FEN serializes the position as a six-field FEN string
+func (p *Position) FEN() string {
+	var placement strings.Builder
+	for row := 0; row < 8; row++ {
+		empty := 0
+		for col := 0; col < 8; col++ {
+			piece := p.Board[row][col]
+			if piece == nil {
+				empty++
+				continue
+			}
+			if empty > 0 {
+				placement.WriteString(strconv.Itoa(empty))
+				empty = 0
+			}
+			placement.WriteRune(fenPieceLetter(piece))
+		}
+		if empty > 0 {
+			placement.WriteString(strconv.Itoa(empty))
+		}
+		if row < 7 {
+			placement.WriteByte('/')
+		}
+	}
+
+	side := "w"
+	if p.SideToMove == "black" {
+		side = "b"
+	}
+
+	return fmt.Sprintf("%s %s %s %s %d %d", placement.String(), side, p.Castling, p.EnPassant, p.HalfmoveClock, p.FullmoveNumber)
+}
+
+// fenPieceLetter is the FEN letter for a piece: uppercase for white, lowercase for black
+func fenPieceLetter(piece *Piece) rune {
+	for letter, pieceType := range fenPieceTypes {
+		if pieceType == piece.Type {
+			if piece.Color == "white" {
+				return unicode.ToUpper(letter)
+			}
+			return letter
+		}
+	}
+	return '?'
+}
+
+// squareName converts board coordinates to algebraic notation, e.g. (7, 4) -> "e1"
+func squareName(row, col int) string {
+	return string(rune('a'+col)) + string(rune('8'-row))
+}
+
+// parseSquare converts algebraic notation to board coordinates
+func parseSquare(s string) (int, int, bool) {
+	if len(s) != 2 || s[0] < 'a' || s[0] > 'h' || s[1] < '1' || s[1] > '8' {
+		return 0, 0, false
+	}
+	return int('8' - s[1]), int(s[0] - 'a'), true
+}
+
+// opponent returns the other color
+func opponent(color string) string {
+	if color == "white" {
+		return "black"
+	}
+	return "white"
+}
+
+// applyMove returns the position after playing a move, which must be legal in p
+func (p *Position) applyMove(move Move) *Position {
+	next := *p
+	board := &next.Board
+
+	piece := board[move.FromRow][move.FromCol]
+	captured := board[move.ToRow][move.ToCol]
+
+	// En passant captures the pawn beside the destination square
+	if piece.Type == Pawn && move.FromCol != move.ToCol && captured == nil {
+		captured = board[move.FromRow][move.ToCol]
+		board[move.FromRow][move.ToCol] = nil
+	}
+
+	// Castling also moves the rook
+	if piece.Type == King && abs(move.ToCol-move.FromCol) == 2 {
+		if move.ToCol > move.FromCol {
+			board[move.FromRow][5] = board[move.FromRow][7]
+			board[move.FromRow][7] = nil
+		} else {
+			board[move.FromRow][3] = board[move.FromRow][0]
+			board[move.FromRow][0] = nil
+		}
+	}
+
+	board[move.ToRow][move.ToCol] = piece
+	board[move.FromRow][move.FromCol] = nil
+	if move.Promotion != "" {
+		board[move.ToRow][move.ToCol] = &Piece{Type: move.Promotion, Color: piece.Color}
+	}
+
+	next.Castling = updateCastlingRights(p.Castling, piece, move)
+
+	next.EnPassant = "-"
+	if piece.Type == Pawn && abs(move.ToRow-move.FromRow) == 2 {
+		next.EnPassant = squareName((move.FromRow+move.ToRow)/2, move.FromCol)
+	}
+
+	if piece.Type == Pawn || captured != nil {
+		next.HalfmoveClock = 0
+	} else {
+		next.HalfmoveClock++
+	}
+
+	if p.SideToMove == "black" {
+		next.FullmoveNumber++
+	}
+	next.SideToMove = opponent(p.SideToMove)
+
+	return &next
+}
+
+// updateCastlingRights drops rights lost by moving a king or rook, or by capturing a rook on its home square
+func updateCastlingRights(castling string, piece *Piece, move Move) string {
+	if castling == "-" {
+		return castling
+	}
+
+	lost := ""
+	if piece.Type == King {
+		if piece.Color == "white" {
+			lost += "KQ"
+		} else {
+			lost += "kq"
+		}
+	}
+
+	corners := map[[2]int]string{{7, 7}: "K", {7, 0}: "Q", {0, 7}: "k", {0, 0}: "q"}
+	if right, ok := corners[[2]int{move.FromRow, move.FromCol}]; ok {
+		lost += right
+	}
+	if right, ok := corners[[2]int{move.ToRow, move.ToCol}]; ok {
+		lost += right
+	}
+
+	remaining := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(lost, r) {
+			return -1
+		}
+		return r
+	}, castling)
+
+	if remaining == "" {
+		return "-"
+	}
+	return remaining
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"woodpecker-online/internal/model"
+	"woodpecker-online/internal/woodpecker"
+)
+
+func TestTodayProgressIsForTheCaller(t *testing.T) {
+	tests := []struct {
+		name     string
+		userID   string
+		attempts int
+	}{
+		{"signed in", "alice", 2},
+		{"anonymous", "", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRouter(t)
+			mustExec(t, `INSERT INTO progress (user_id, puzzle_id, attempts, score) VALUES
+				('alice', 'p1', 1, 10), ('alice', 'p2', 1, 20), ('default_user', 'p3', 1, 30)`)
+
+			var today struct {
+				TotalAttempted int `json:"totalAttempted"`
+			}
+			decodeBody(t, serve(t, r, "GET", "/api/progress/today", nil, tt.userID), &today)
+			if today.TotalAttempted != tt.attempts {
+				t.Errorf("today's attempted = %d, want %d", today.TotalAttempted, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestGradeLineProgressIsForTheCaller(t *testing.T) {
+	tests := []struct {
+		name       string
+		userID     string
+		progressAs string
+	}{
+		{"signed in", "alice", "alice"},
+		{"anonymous", "", "default_user"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRouter(t)
+			seedPuzzle(t, "p1", "easy")
+
+			var graded GradeLineResponse
+			decodeBody(t, serve(t, r, "POST", "/api/puzzles/grade-line", map[string]interface{}{
+				"puzzleId":  "p1",
+				"typedSans": []string{"Ra8#"},
+			}, tt.userID), &graded)
+			if !graded.Correct {
+				t.Fatalf("grade = %+v, want correct", graded)
+			}
+
+			var owner string
+			if err := db.Get(&owner, `SELECT user_id FROM progress WHERE puzzle_id = 'p1'`); err != nil {
+				t.Fatal(err)
+			}
+			if owner != tt.progressAs {
+				t.Errorf("progress saved for %q, want %q", owner, tt.progressAs)
+			}
+		})
+	}
+}
+
+func TestSkipIsRecordedForTheCaller(t *testing.T) {
+	r := newTestRouter(t)
+	seedPuzzle(t, "p1", "easy")
+
+	rec := serve(t, r, "POST", "/api/puzzles/p1/skip", map[string]interface{}{}, "alice")
+	if rec.Code != 200 {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var owner string
+	if err := db.Get(&owner, `SELECT user_id FROM progress WHERE puzzle_id = 'p1' AND skipped_at IS NOT NULL`); err != nil {
+		t.Fatal(err)
+	}
+	if owner != "alice" {
+		t.Errorf("skip saved for %q, want alice", owner)
+	}
+}
+
+func TestSkipChecksSession(t *testing.T) {
+	tests := []struct {
+		name       string
+		userID     string
+		wantStatus int
+	}{
+		{"owner", "alice", 200},
+		{"another user", "bob", 403},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRouter(t)
+			seedSession(t, 1, "alice")
+			seedPuzzle(t, "p1", "easy")
+
+			rec := serve(t, r, "POST", "/api/puzzles/p1/skip", map[string]int{"sessionId": 1}, tt.userID)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestNextPuzzleLeavesSkipsUntilLast(t *testing.T) {
+	tests := []struct {
+		name    string
+		skipped []string
+		want    string
+	}{
+		{"nothing skipped", nil, "p1"},
+		{"first skipped", []string{"p1"}, "p2"},
+		{"all skipped", []string{"p1", "p2"}, "p1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRouter(t)
+			seedPuzzle(t, "p1", "easy")
+			seedPuzzle(t, "p2", "easy")
+			for _, id := range tt.skipped {
+				serve(t, r, "POST", "/api/puzzles/"+id+"/skip", nil, "alice")
+			}
+
+			var next struct {
+				ID string `json:"id"`
+			}
+			decodeBody(t, serve(t, r, "GET", "/api/puzzles/next?difficulty=easy", nil, "alice"), &next)
+			if next.ID != tt.want {
+				t.Errorf("next puzzle = %q, want %q", next.ID, tt.want)
+			}
+		})
+	}
+}
+
+func TestResurfaceSkipped(t *testing.T) {
+	tests := []struct {
+		name    string
+		next    string
+		skipped []string
+		solved  []string
+		want    string
+	}{
+		{"not skipped", "p1", nil, nil, "p1"},
+		{"skipped", "p1", []string{"p1"}, nil, "p2"},
+		{"skipped with the rest solved", "p1", []string{"p1"}, []string{"p2", "p3"}, "p1"},
+		{"skipped with another skipped", "p1", []string{"p1", "p2"}, nil, "p3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestDB(t)
+			plan, err := json.Marshal(woodpecker.DailyPlan{TodayBatch: []string{"p1", "p2", "p3"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			mustExec(t, `INSERT INTO daily_plans (user_id, daily_plan_json) VALUES ('alice', ?)`, string(plan))
+			for _, id := range tt.skipped {
+				mustExec(t, `INSERT INTO progress (user_id, puzzle_id, attempts, score, skipped_at) VALUES ('alice', ?, 0, 0, CURRENT_TIMESTAMP)`, id)
+			}
+			for _, id := range tt.solved {
+				mustExec(t, `INSERT INTO progress (user_id, puzzle_id, attempts, score) VALUES ('alice', ?, 1, 1)`, id)
+			}
+
+			if got := resurfaceSkipped("alice", tt.next); got != tt.want {
+				t.Errorf("resurfaceSkipped = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSkipDoesNotLowerAccuracy(t *testing.T) {
+	r := newTestRouter(t)
+	seedSession(t, 1, "alice")
+	seedPuzzle(t, "p1", "easy")
+	seedPuzzle(t, "p2", "easy")
+	mustExec(t, `INSERT INTO puzzle_tags (puzzle_id, tag) VALUES ('p1', 'mate'), ('p2', 'mate')`)
+
+	serve(t, r, "POST", "/api/puzzles/grade-line", map[string]interface{}{
+		"puzzleId":  "p1",
+		"typedSans": []string{"Ra8#"},
+		"sessionId": 1,
+	}, "alice")
+	if rec := serve(t, r, "POST", "/api/puzzles/p2/skip", map[string]int{"sessionId": 1}, "alice"); rec.Code != 200 {
+		t.Fatalf("skip: status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var attempt model.Attempt
+	if err := db.Get(&attempt, `SELECT * FROM attempts WHERE puzzle_id = 'p2'`); err != nil {
+		t.Fatal(err)
+	}
+	if !attempt.Skipped || attempt.TotalPoints != 0 {
+		t.Errorf("skip recorded as %+v, want a skipped attempt with no points", attempt)
+	}
+
+	var stats []model.MotifStat
+	decodeBody(t, serve(t, r, "GET", "/api/stats/motifs", nil, "alice"), &stats)
+	if len(stats) != 1 || stats[0].Attempts != 1 || stats[0].AccuracyPercent != 100 {
+		t.Errorf("motif stats = %+v, want mate at 1 of 1", stats)
+	}
+
+	var today struct {
+		TotalAttempted int `json:"totalAttempted"`
+	}
+	decodeBody(t, serve(t, r, "GET", "/api/progress/today", nil, "alice"), &today)
+	if today.TotalAttempted != 1 {
+		t.Errorf("today's attempted = %d, want only the graded puzzle", today.TotalAttempted)
+	}
+
+	if rec := serve(t, r, "POST", "/api/puzzles/missing/skip", nil, "alice"); rec.Code != 404 {
+		t.Errorf("missing puzzle: status %d, want 404", rec.Code)
+	}
+}
+
+func TestPuzzleFullRequiresOwnAttempt(t *testing.T) {
+	tests := []struct {
+		name       string
+		gradedBy   string // "" for no attempt, "anonymous" for a signed-out one
+		userID     string
+		wantStatus int
+	}{
+		{"after own attempt", "alice", "alice", 200},
+		{"without an attempt", "", "alice", 403},
+		{"after another user's attempt", "bob", "alice", 403},
+		{"anonymous after an anonymous attempt", "anonymous", "", 401},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRouter(t)
+			seedPuzzle(t, "p1", "easy")
+			if tt.gradedBy != "" {
+				gradedBy := tt.gradedBy
+				if gradedBy == "anonymous" {
+					gradedBy = ""
+				}
+				decodeBody(t, serve(t, r, "POST", "/api/puzzles/grade-line", map[string]interface{}{
+					"puzzleId":  "p1",
+					"typedSans": []string{"Ra8#"},
+				}, gradedBy), &GradeLineResponse{})
+			}
+
+			rec := serve(t, r, "GET", "/api/puzzles/p1/full", nil, tt.userID)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestPuzzleFullResponse(t *testing.T) {
+	r := newTestRouter(t)
+	seedPuzzle(t, "wpm_easy_001", "easy")
+	mustExec(t, `UPDATE puzzles SET ticks_json = '["Ra8#"]' WHERE id = 'wpm_easy_001'`)
+	serve(t, r, "POST", "/api/puzzles/grade-line", map[string]interface{}{
+		"puzzleId":  "wpm_easy_001",
+		"typedSans": []string{"Ra7"},
+	}, "alice")
+
+	var full PuzzleFull
+	decodeBody(t, serve(t, r, "GET", "/api/puzzles/wpm_easy_001/full", nil, "alice"), &full)
+	if full.ID != "wpm_easy_001" || full.FEN != testPuzzleFEN || full.SideToMove != "w" || full.Difficulty != "easy" {
+		t.Errorf("puzzle = %+v, want wpm_easy_001 with white to move", full)
+	}
+	if len(full.Solution.Lines) != 1 || full.Solution.Lines[0].SAN != "Ra8#" || len(full.Ticks) != 1 || full.Ticks[0] != "Ra8#" {
+		t.Errorf("solution = %+v, ticks %v; want Ra8#", full.Solution, full.Ticks)
+	}
+	if want := SolutionsTextEasy()["wpm_easy_001"]; want == "" || full.SolutionText != want {
+		t.Errorf("solution text = %q, want %q", full.SolutionText, want)
+	}
+
+	if rec := serve(t, r, "GET", "/api/puzzles/missing/full", nil, "alice"); rec.Code != 404 {
+		t.Errorf("missing puzzle: status %d, want 404", rec.Code)
+	}
+}
+
+func TestUnattemptedPuzzles(t *testing.T) {
+	r := newTestRouter(t)
+	for _, id := range []string{"e3", "e1", "e2", "e4"} {
+		seedPuzzle(t, id, "easy")
+	}
+	seedPuzzle(t, "i1", "intermediate")
+	// Only alice's own progress counts
+	mustExec(t, `INSERT INTO progress (user_id, puzzle_id, attempts, score) VALUES
+		('alice', 'e2', 1, 10), ('alice', 'i1', 1, 10), ('bob', 'e1', 1, 10)`)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"?difficulty=easy", []string{"e1", "e3", "e4"}},
+		{"?difficulty=Easy&limit=2", []string{"e1", "e3"}},
+		{"?difficulty=intermediate", []string{}},
+		{"", []string{"e1", "e3", "e4"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			var result struct {
+				PuzzleIDs []string `json:"puzzleIds"`
+			}
+			decodeBody(t, serve(t, r, "GET", "/api/me/unattempted"+tt.query, nil, "alice"), &result)
+			if !reflect.DeepEqual(result.PuzzleIDs, tt.want) {
+				t.Errorf("unattempted = %v, want %v", result.PuzzleIDs, tt.want)
+			}
+		})
+	}
+
+	for _, query := range []string{"?difficulty=impossible", "?limit=0", "?limit=many"} {
+		if rec := serve(t, r, "GET", "/api/me/unattempted"+query, nil, "alice"); rec.Code != 400 {
+			t.Errorf("%s: status %d, want 400", query, rec.Code)
+		}
+	}
+	if rec := serve(t, r, "GET", "/api/me/unattempted", nil, ""); rec.Code != 401 {
+		t.Errorf("anonymous: status %d, want 401", rec.Code)
+	}
+}
+
+func TestReviewSchedule(t *testing.T) {
+	r := newTestRouter(t)
+	seedPuzzle(t, "solved", "easy")
+	seedPuzzle(t, "failed", "easy")
+	// Graded before scheduling existed, so it has no review date
+	mustExec(t, `INSERT INTO progress (user_id, puzzle_id, attempts, score) VALUES ('alice', 'legacy', 1, 10)`)
+
+	for i := 0; i < 3; i++ {
+		for id, san := range map[string]string{"solved": "Ra8#", "failed": "Ra7"} {
+			serve(t, r, "POST", "/api/puzzles/grade-line", map[string]interface{}{
+				"puzzleId":  id,
+				"typedSans": []string{san},
+			}, "alice")
+		}
+	}
+
+	var schedule []model.PuzzleReview
+	decodeBody(t, serve(t, r, "GET", "/api/me/schedule", nil, "alice"), &schedule)
+	if len(schedule) != 3 {
+		t.Fatalf("got %d reviews, want 3: %+v", len(schedule), schedule)
+	}
+	reviews := map[string]model.PuzzleReview{}
+	for _, review := range schedule {
+		reviews[review.PuzzleID] = review
+	}
+
+	solved, failed := reviews["solved"], reviews["failed"]
+	if solved.IntervalDays != 17 || failed.IntervalDays != 1 {
+		t.Errorf("intervals = %d solved, %d failed; want 17 and 1", solved.IntervalDays, failed.IntervalDays)
+	}
+	if solved.Ease <= failed.Ease {
+		t.Errorf("ease = %v solved, %v failed; want solved higher", solved.Ease, failed.Ease)
+	}
+	if solved.NextReviewAt == nil || failed.NextReviewAt == nil || !solved.NextReviewAt.After(failed.NextReviewAt.Time) {
+		t.Errorf("next reviews = %v solved, %v failed; want solved later", solved.NextReviewAt, failed.NextReviewAt)
+	}
+	if solved.Due || failed.Due {
+		t.Error("puzzles reviewed just now are already due")
+	}
+
+	// Unscheduled puzzles are due and listed first
+	if schedule[0].PuzzleID != "legacy" || !schedule[0].Due || schedule[0].NextReviewAt != nil {
+		t.Errorf("first review = %+v, want legacy due now", schedule[0])
+	}
+	if schedule[1].PuzzleID != "failed" {
+		t.Errorf("second review = %s, want the failed puzzle due sooner", schedule[1].PuzzleID)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// trustProxy makes the app believe X-Forwarded-For and X-Forwarded-Proto (TRUST_PROXY, default false).
+// Only enable it when every request arrives through a proxy that sets those headers, or clients
+// can claim any IP and scheme.
+var trustProxy = false
+
+// ResolveClientAddr records the effective client IP and scheme in the request context. With
+// trustProxy set they come from the last X-Forwarded-For entry, which is the address the proxy
+// saw, and the first X-Forwarded-Proto value; otherwise from the connection itself.
+func ResolveClientAddr(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := remoteIP(r.RemoteAddr)
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+
+		if trustProxy {
+			if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+				hops := strings.Split(forwarded, ",")
+				if last := strings.TrimSpace(hops[len(hops)-1]); net.ParseIP(last) != nil {
+					ip = last
+				}
+			}
+			if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+				proto = strings.ToLower(strings.TrimSpace(strings.Split(proto, ",")[0]))
+				if proto == "http" || proto == "https" {
+					scheme = proto
+				}
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), "client_ip", ip)
+		ctx = context.WithValue(ctx, "scheme", scheme)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// remoteIP strips the port from a RemoteAddr
+func remoteIP(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// clientIP returns the effective client IP resolved by ResolveClientAddr
+func clientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value("client_ip").(string); ok {
+		return ip
+	}
+	return remoteIP(r.RemoteAddr)
+}
+
+// requestScheme returns "https" or "http" as resolved by ResolveClientAddr
+func requestScheme(r *http.Request) string {
+	if scheme, ok := r.Context().Value("scheme").(string); ok {
+		return scheme
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResolveClientAddr(t *testing.T) {
+	tests := []struct {
+		name       string
+		trust      bool
+		forwarded  string
+		proto      string
+		tls        bool
+		wantIP     string
+		wantScheme string
+	}{
+		{"no proxy", false, "", "", false, "10.0.0.1", "http"},
+		{"untrusted headers ignored", false, "203.0.113.7", "https", false, "10.0.0.1", "http"},
+		{"untrusted over TLS", false, "", "", true, "10.0.0.1", "https"},
+		{"trusted", true, "203.0.113.7", "https", false, "203.0.113.7", "https"},
+		{"trusted uses the last hop", true, "198.51.100.1, 203.0.113.7", "", false, "203.0.113.7", "http"},
+		{"trusted ignores a forged first hop", true, "1.2.3.4,203.0.113.7", "", false, "203.0.113.7", "http"},
+		{"trusted with an invalid last hop", true, "203.0.113.7, unknown", "", false, "10.0.0.1", "http"},
+		{"trusted with several protos", true, "", "HTTPS, http", false, "10.0.0.1", "https"},
+		{"trusted with an invalid proto", true, "", "gopher", true, "10.0.0.1", "https"},
+		{"trusted without headers", true, "", "", false, "10.0.0.1", "http"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := trustProxy
+			trustProxy = tt.trust
+			t.Cleanup(func() { trustProxy = previous })
+
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = "10.0.0.1:54321"
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if tt.proto != "" {
+				req.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+
+			var ip, scheme string
+			ResolveClientAddr(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ip, scheme = clientIP(r), requestScheme(r)
+			})).ServeHTTP(httptest.NewRecorder(), req)
+			if ip != tt.wantIP || scheme != tt.wantScheme {
+				t.Errorf("resolved %s over %s, want %s over %s", ip, scheme, tt.wantIP, tt.wantScheme)
+			}
+		})
+	}
+}
+
+func TestAuthCookieSecureOverForwardedHTTPS(t *testing.T) {
+	tests := []struct {
+		name       string
+		trust      bool
+		wantSecure bool
+	}{
+		{"trusted proxy", true, true},
+		{"untrusted proxy", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := trustProxy
+			trustProxy = tt.trust
+			t.Cleanup(func() { trustProxy = previous })
+
+			r := newTestRouter(t)
+			req := newRequest(t, "POST", "/api/auth/sign-up", map[string]string{
+				"email": "carol@example.com", "password": "secret-password",
+			}, "")
+			req.Header.Set("X-Forwarded-Proto", "https")
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+
+			cookies := rec.Result().Cookies()
+			if len(cookies) != 1 {
+				t.Fatalf("got %d cookies (status %d), want the auth cookie", len(cookies), rec.Code)
+			}
+			if cookies[0].Secure != tt.wantSecure {
+				t.Errorf("Secure = %v, want %v", cookies[0].Secure, tt.wantSecure)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"container/list"
+	"database/sql"
+	"sync"
+
+	"woodpecker-online/internal/model"
+	"woodpecker-online/internal/repository"
+)
+
+// puzzleCache is a fixed-size LRU cache of puzzle rows keyed by ID. A nil cache is disabled:
+// lookups miss and updates are ignored.
+type puzzleCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // front is most recently used; values are *model.PuzzleDB
+	entries map[string]*list.Element
+	// version counts invalidations, so a read that started before one doesn't cache a stale row
+	version uint64
+}
+
+// cachedPuzzles caches puzzle reads (PUZZLE_CACHE_SIZE entries; unset disables it)
+var cachedPuzzles *puzzleCache
+
+func newPuzzleCache(size int) *puzzleCache {
+	return &puzzleCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// Get returns a copy of the cached puzzle and marks it recently used
+func (c *puzzleCache) Get(id string) (*model.PuzzleDB, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[id]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return clonePuzzle(elem.Value.(*model.PuzzleDB)), true
+}
+
+// Version returns the current invalidation count, to pass to Put after reading a puzzle
+func (c *puzzleCache) Version() uint64 {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.version
+}
+
+// Put stores a copy of the puzzle read at the given Version, evicting the least recently used
+// entry when full. It does nothing if anything was invalidated since, as the row may be stale.
+func (c *puzzleCache) Put(puzzle *model.PuzzleDB, version uint64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if version != c.version {
+		return
+	}
+
+	stored := clonePuzzle(puzzle)
+	if elem, ok := c.entries[puzzle.ID]; ok {
+		elem.Value = stored
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[puzzle.ID] = c.order.PushFront(stored)
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*model.PuzzleDB).ID)
+	}
+}
+
+// Invalidate drops a puzzle so the next read goes to the database
+func (c *puzzleCache) Invalidate(id string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.version++
+	if elem, ok := c.entries[id]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, id)
+	}
+}
+
+// Clear drops every cached puzzle
+func (c *puzzleCache) Clear() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.version++
+	c.order.Init()
+	c.entries = make(map[string]*list.Element)
+}
+
+// clonePuzzle copies a puzzle along with its solution and ticks, so callers can't modify a cached row
+func clonePuzzle(puzzle *model.PuzzleDB) *model.PuzzleDB {
+	cloned := *puzzle
+	cloned.SolutionJSON.Lines = cloneLines(puzzle.SolutionJSON.Lines)
+	if alternatives := puzzle.SolutionJSON.AcceptedAlternatives; alternatives != nil {
+		cloned.SolutionJSON.AcceptedAlternatives = make([][]string, len(alternatives))
+		for i, alternative := range alternatives {
+			cloned.SolutionJSON.AcceptedAlternatives[i] = append([]string{}, alternative...)
+		}
+	}
+	if puzzle.TicksJSON.Ticks != nil {
+		cloned.TicksJSON.Ticks = append([]string{}, puzzle.TicksJSON.Ticks...)
+	}
+	return &cloned
+}
+
+// cloneLines deep-copies a solution's lines and their children
+func cloneLines(lines []model.Line) []model.Line {
+	if lines == nil {
+		return nil
+	}
+	cloned := make([]model.Line, len(lines))
+	for i, line := range lines {
+		cloned[i] = line
+		cloned[i].Children = cloneLines(line.Children)
+	}
+	return cloned
+}
+
+// getPuzzleByID reads a puzzle through the cache, returning repository.ErrNotFound for a missing
+// puzzle.
+func getPuzzleByID(id string) (*model.PuzzleDB, error) {
+	if puzzle, ok := cachedPuzzles.Get(id); ok {
+		return puzzle, nil
+	}
+
+	version := cachedPuzzles.Version()
+	var puzzle model.PuzzleDB
+	err := db.Get(&puzzle, `
+		SELECT id, fen, side_to_move, difficulty, solution_json, ticks_json
+		FROM puzzles
+		WHERE id = ?
+	`, id)
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cachedPuzzles.Put(&puzzle, version)
+	return &puzzle, nil
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"woodpecker-online/internal/model"
+)
+
+func testPuzzleRow(id, san string) *model.PuzzleDB {
+	return &model.PuzzleDB{
+		ID:           id,
+		Difficulty:   "easy",
+		FEN:          testPuzzleFEN,
+		SolutionJSON: model.SolutionJSON{Solution: model.Solution{Lines: []model.Line{{SAN: san, Children: []model.Line{{SAN: "Kh8"}}}}}},
+		TicksJSON:    model.TicksJSON{Ticks: []string{san}},
+	}
+}
+
+func TestPuzzleCachePut(t *testing.T) {
+	tests := []struct {
+		name    string
+		between func(c *puzzleCache) // runs after the read's Version and before its Put
+		wantHit bool
+	}{
+		{"nothing changed", func(c *puzzleCache) {}, true},
+		{"puzzle invalidated during the read", func(c *puzzleCache) { c.Invalidate("p1") }, false},
+		{"another puzzle invalidated during the read", func(c *puzzleCache) { c.Invalidate("p2") }, false},
+		{"cache cleared during the read", func(c *puzzleCache) { c.Clear() }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newPuzzleCache(10)
+			version := c.Version()
+			tt.between(c)
+			c.Put(testPuzzleRow("p1", "Ra8#"), version)
+
+			if _, hit := c.Get("p1"); hit != tt.wantHit {
+				t.Errorf("hit = %v, want %v", hit, tt.wantHit)
+			}
+		})
+	}
+}
+
+func TestPuzzleCacheCopies(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(p *model.PuzzleDB)
+	}{
+		{"line", func(p *model.PuzzleDB) { p.SolutionJSON.Lines[0].SAN = "Rb8" }},
+		{"child line", func(p *model.PuzzleDB) { p.SolutionJSON.Lines[0].Children[0].SAN = "Kf8" }},
+		{"tick", func(p *model.PuzzleDB) { p.TicksJSON.Ticks[0] = "Rb8" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newPuzzleCache(10)
+			stored := testPuzzleRow("p1", "Ra8#")
+			c.Put(stored, c.Version())
+			tt.modify(stored)
+
+			got, _ := c.Get("p1")
+			tt.modify(got)
+
+			again, _ := c.Get("p1")
+			if again.SolutionJSON.Lines[0].SAN != "Ra8#" || again.SolutionJSON.Lines[0].Children[0].SAN != "Kh8" || again.TicksJSON.Ticks[0] != "Ra8#" {
+				t.Errorf("cached puzzle was modified: %+v", again)
+			}
+		})
+	}
+}
+
+// TestGetPuzzleByIDConcurrentUpdates reads a puzzle while it is updated and invalidated, then
+// checks the cache ends up with the last update. Run with -race.
+func TestGetPuzzleByIDConcurrentUpdates(t *testing.T) {
+	newTestDB(t)
+	cachedPuzzles = newPuzzleCache(10)
+	t.Cleanup(func() { cachedPuzzles = nil })
+	seedPuzzle(t, "p1", "easy")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				puzzle, err := getPuzzleByID("p1")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				puzzle.SolutionJSON.Lines[0].SAN = "changed by the reader"
+			}
+		}()
+	}
+	for i := 0; i < 50; i++ {
+		mustExec(t, `UPDATE puzzles SET difficulty = ? WHERE id = 'p1'`, fmt.Sprintf("v%d", i))
+		cachedPuzzles.Invalidate("p1")
+	}
+	wg.Wait()
+
+	puzzle, err := getPuzzleByID("p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if puzzle.Difficulty != "v49" {
+		t.Errorf("difficulty = %q, want the last update v49", puzzle.Difficulty)
+	}
+	if puzzle.SolutionJSON.Lines[0].SAN != "Ra8#" {
+		t.Errorf("solution = %q, want Ra8#", puzzle.SolutionJSON.Lines[0].SAN)
+	}
+}
+
+func BenchmarkGetPuzzleByID(b *testing.B) {
+	tests := []struct {
+		name  string
+		cache *puzzleCache
+	}{
+		{"uncached", nil},
+		{"cached", newPuzzleCache(10)},
+	}
+	for _, tt := range tests {
+		b.Run(tt.name, func(b *testing.B) {
+			b.Setenv("DATABASE_PATH", ":memory:")
+			b.Setenv("DB_MAX_OPEN_CONNS", "1")
+			testDB, err := initDatabase()
+			if err != nil {
+				b.Fatal(err)
+			}
+			previous := db
+			db = testDB
+			cachedPuzzles = tt.cache
+			b.Cleanup(func() {
+				testDB.Close()
+				db = previous
+				cachedPuzzles = nil
+			})
+			db.MustExec(`INSERT INTO puzzles (id, difficulty, fen, side_to_move, solution_json, ticks_json)
+				VALUES ('p1', 'easy', ?, 'w', '{"lines":[{"san":"Ra8#"}]}', '[]')`, testPuzzleFEN)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := getPuzzleByID("p1"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestAdminUpdateInvalidatesCachedPuzzle(t *testing.T) {
+	previous := adminEmails
+	adminEmails = parseAdminEmails("admin@example.com")
+	t.Cleanup(func() { adminEmails = previous })
+
+	r := newTestRouter(t)
+	cachedPuzzles = newPuzzleCache(10)
+	t.Cleanup(func() { cachedPuzzles = nil })
+	seedPuzzle(t, "p1", "easy")
+
+	grade := func(san string) bool {
+		var graded GradeLineResponse
+		decodeBody(t, serve(t, r, "POST", "/api/puzzles/grade-line", map[string]interface{}{
+			"puzzleId":  "p1",
+			"typedSans": []string{san},
+		}, "alice"), &graded)
+		return graded.Correct
+	}
+	if !grade("Ra8#") {
+		t.Fatal("seeded solution Ra8# graded wrong")
+	}
+	if _, ok := cachedPuzzles.Get("p1"); !ok {
+		t.Fatal("graded puzzle wasn't cached")
+	}
+
+	// A write behind the cache's back isn't seen until the puzzle is invalidated
+	mustExec(t, `UPDATE puzzles SET difficulty = 'advanced' WHERE id = 'p1'`)
+	if puzzle, _ := getPuzzleByID("p1"); puzzle.Difficulty != "easy" {
+		t.Errorf("cached read re-queried: difficulty %q", puzzle.Difficulty)
+	}
+
+	rec := serve(t, r, "PUT", "/api/admin/puzzles/p1", map[string]interface{}{
+		"solution": map[string]interface{}{"lines": []map[string]interface{}{{"san": "Ra7", "isTick": true}}},
+	}, "admin")
+	if rec.Code != 200 {
+		t.Fatalf("update: status %d: %s", rec.Code, rec.Body.String())
+	}
+	if grade("Ra8#") || !grade("Ra7") {
+		t.Error("grading after the update still used the cached solution")
+	}
+	if puzzle, _ := getPuzzleByID("p1"); puzzle.Difficulty != "advanced" {
+		t.Errorf("difficulty after invalidation = %q, want advanced", puzzle.Difficulty)
+	}
+}
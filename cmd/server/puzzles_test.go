@@ -0,0 +1,517 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"woodpecker-online/internal/model"
+)
+
+func TestGradeStoredSolution(t *testing.T) {
+	tests := []struct {
+		name       string
+		solution   interface{}
+		wantStatus int
+		wantBody   string
+	}{
+		{"valid solution", `{"lines":[{"san":"Ra8#"}]}`, 200, `"correct":true`},
+		{"null solution", nil, 422, "puzzle has no solution"},
+		{"solution without lines", `{"lines":[]}`, 422, "puzzle has no solution"},
+		{"broken solution", `{"lines":[{"san":`, 500, "puzzle solution corrupt"},
+	}
+
+	for _, tt := range tests {
+		for _, path := range []string{"/api/puzzles/grade", "/api/puzzles/grade-line"} {
+			t.Run(tt.name+" "+path, func(t *testing.T) {
+				r := newTestRouter(t)
+				mustExec(t, `INSERT INTO puzzles (id, difficulty, fen, side_to_move, solution_json, ticks_json)
+					VALUES ('p1', 'easy', ?, 'w', ?, '[]')`, testPuzzleFEN, tt.solution)
+
+				rec := serve(t, r, "POST", path, map[string]interface{}{
+					"puzzleId":   "p1",
+					"playedSans": []string{"Ra8#"},
+					"typedSans":  []string{"Ra8#"},
+				}, "")
+				if rec.Code != tt.wantStatus {
+					t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+				}
+				if !strings.Contains(rec.Body.String(), tt.wantBody) {
+					t.Errorf("body %q does not contain %q", rec.Body.String(), tt.wantBody)
+				}
+			})
+		}
+	}
+}
+
+func TestPuzzleNeighbors(t *testing.T) {
+	r := newTestRouter(t)
+	for _, id := range []string{"e3", "e1", "e2"} {
+		seedPuzzle(t, id, "easy")
+	}
+	// Puzzles of another difficulty sit between and around the easy ones by ID
+	seedPuzzle(t, "e0", "advanced")
+	seedPuzzle(t, "e15", "advanced")
+	seedPuzzle(t, "e9", "advanced")
+
+	str := func(s string) *string { return &s }
+	tests := []struct {
+		name       string
+		puzzleID   string
+		prev, next *string
+	}{
+		{"middle", "e2", str("e1"), str("e3")},
+		{"first", "e1", nil, str("e2")},
+		{"last", "e3", str("e2"), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got struct {
+				Prev *string `json:"prev"`
+				Next *string `json:"next"`
+			}
+			decodeBody(t, serve(t, r, "GET", "/api/puzzles/"+tt.puzzleID+"/neighbors", nil, ""), &got)
+			if !sameID(got.Prev, tt.prev) || !sameID(got.Next, tt.next) {
+				t.Errorf("prev %v next %v, want %v and %v", deref(got.Prev), deref(got.Next), deref(tt.prev), deref(tt.next))
+			}
+		})
+	}
+
+	if rec := serve(t, r, "GET", "/api/puzzles/nope/neighbors", nil, ""); rec.Code != 404 {
+		t.Errorf("missing puzzle: status %d, want 404", rec.Code)
+	}
+}
+
+func sameID(a, b *string) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return "null"
+	}
+	return *s
+}
+
+func TestGradeLineTickSANs(t *testing.T) {
+	puzzle := &model.Puzzle{
+		Solution: model.Solution{Lines: []model.Line{
+			{SAN: "Nf7+", IsTick: true},
+			{SAN: "Kg8"},
+			{SAN: "Nh6+", IsTick: true},
+			{SAN: "Kh8"},
+			{SAN: "Qg8+", IsTick: true},
+			{SAN: "Rxg8"},
+			{SAN: "Nf7#", IsTick: true},
+		}},
+	}
+
+	tests := []struct {
+		name        string
+		typed       []string
+		wantMatched []string
+		wantMissed  []string
+	}{
+		{"nothing typed", nil, []string{}, []string{"Nf7+", "Nh6+", "Qg8+", "Nf7#"}},
+		{"some ticks", []string{"Nf7+", "Kg8", "Nh6+", "Kh8", "Qh5"}, []string{"Nf7+", "Nh6+"}, []string{"Qg8+", "Nf7#"}},
+		{"wrong first move", []string{"Qg8+"}, []string{}, []string{"Nf7+", "Nh6+", "Qg8+", "Nf7#"}},
+		{"whole line", []string{"Nf7+", "Kg8", "Nh6+", "Kh8", "Qg8+", "Rxg8", "Nf7#"}, []string{"Nf7+", "Nh6+", "Qg8+", "Nf7#"}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := gradeLine(puzzle, tt.typed, 0)
+			if !reflect.DeepEqual(got.TicksMatchedSAN, tt.wantMatched) || !reflect.DeepEqual(got.TicksMissedSAN, tt.wantMissed) {
+				t.Errorf("matched %v missed %v, want %v and %v", got.TicksMatchedSAN, got.TicksMissedSAN, tt.wantMatched, tt.wantMissed)
+			}
+		})
+	}
+}
+
+func TestPuzzleLength(t *testing.T) {
+	tests := []struct {
+		name          string
+		solution      string
+		ticks         string
+		wantUserMoves int
+		wantTicks     int
+	}{
+		{"single move", `{"lines":[{"san":"Ra8#"}]}`, `[]`, 1, 0},
+		{"flat line with ticks",
+			`{"lines":[{"san":"Nf7+","isTick":true},{"san":"Kg8"},{"san":"Nh6+","isTick":true},{"san":"Kh8"},{"san":"Qg8+"},{"san":"Rxg8"},{"san":"Nf7#","isTick":true}]}`,
+			`["Nf7+","Nh6+","Nf7#"]`, 4, 3},
+		{"tree follows the first child",
+			`{"lines":[{"san":"Qxh7+","isTick":true,"children":[{"san":"Kxh7","children":[{"san":"Rh3#"}]},{"san":"Kf8"}]}]}`,
+			`["Qxh7+"]`, 2, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRouter(t)
+			mustExec(t, `INSERT INTO puzzles (id, difficulty, fen, side_to_move, solution_json, ticks_json)
+				VALUES ('p1', 'easy', ?, 'w', ?, ?)`, testPuzzleFEN, tt.solution, tt.ticks)
+
+			rec := serve(t, r, "GET", "/api/puzzles/p1/length", nil, "")
+			if strings.Contains(rec.Body.String(), "#") {
+				t.Errorf("response reveals the solution: %s", rec.Body.String())
+			}
+			var got struct {
+				UserMoves     int `json:"userMoves"`
+				RequiredTicks int `json:"requiredTicks"`
+			}
+			decodeBody(t, rec, &got)
+			if got.UserMoves != tt.wantUserMoves || got.RequiredTicks != tt.wantTicks {
+				t.Errorf("got %+v, want %d user moves and %d ticks", got, tt.wantUserMoves, tt.wantTicks)
+			}
+		})
+	}
+
+	r := newTestRouter(t)
+	if rec := serve(t, r, "GET", "/api/puzzles/nope/length", nil, ""); rec.Code != 404 {
+		t.Errorf("missing puzzle: status %d, want 404", rec.Code)
+	}
+}
+
+func TestPuzzleTrace(t *testing.T) {
+	tests := []struct {
+		name         string
+		typed        []string
+		wantFENs     []string
+		firstIllegal *int
+	}{
+		{
+			"legal line",
+			[]string{"Ra7", "h6", "Ra8+"},
+			[]string{
+				"6k1/R4ppp/8/8/8/8/8/4K3 b - - 1 1",
+				"6k1/R4pp1/7p/8/8/8/8/4K3 w - - 0 2",
+				"R5k1/5pp1/7p/8/8/8/8/4K3 b - - 1 2",
+			},
+			nil,
+		},
+		{
+			"illegal midway",
+			[]string{"Ra7", "h6", "Rb9", "Ra8+"},
+			[]string{
+				"6k1/R4ppp/8/8/8/8/8/4K3 b - - 1 1",
+				"6k1/R4pp1/7p/8/8/8/8/4K3 w - - 0 2",
+			},
+			intPtr(2),
+		},
+		{"illegal first move", []string{"Kg2"}, []string{}, intPtr(0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRouter(t)
+			seedPuzzle(t, "p1", "easy")
+
+			var trace TraceResponse
+			decodeBody(t, serve(t, r, "POST", "/api/puzzles/p1/trace", map[string][]string{"typedSans": tt.typed}, ""), &trace)
+			if trace.StartFEN != testPuzzleFEN {
+				t.Errorf("start = %q, want %q", trace.StartFEN, testPuzzleFEN)
+			}
+			if !reflect.DeepEqual(trace.FENs, tt.wantFENs) {
+				t.Errorf("fens = %q, want %q", trace.FENs, tt.wantFENs)
+			}
+			if !reflect.DeepEqual(trace.FirstIllegal, tt.firstIllegal) {
+				t.Errorf("first illegal = %v, want %v", trace.FirstIllegal, tt.firstIllegal)
+			}
+			if (trace.IllegalReason != "") != (tt.firstIllegal != nil) {
+				t.Errorf("illegal reason = %q", trace.IllegalReason)
+			}
+		})
+	}
+
+	r := newTestRouter(t)
+	if rec := serve(t, r, "POST", "/api/puzzles/missing/trace", map[string][]string{"typedSans": {"e4"}}, ""); rec.Code != 404 {
+		t.Errorf("missing puzzle: status %d, want 404", rec.Code)
+	}
+}
+
+func TestNextPuzzleDifficultyCasing(t *testing.T) {
+	r := newTestRouter(t)
+	seedPuzzle(t, "p1", "easy")
+
+	if rec := serve(t, r, "GET", "/api/puzzles/next?difficulty=EASY&puzzleId=p1", nil, "alice"); rec.Code != 200 {
+		t.Errorf("upper case difficulty: status %d: %s", rec.Code, rec.Body.String())
+	}
+	rec := serve(t, r, "GET", "/api/puzzles/next?difficulty=Expert&puzzleId=p1", nil, "alice")
+	if rec.Code != 400 || !strings.Contains(rec.Body.String(), "invalid difficulty") {
+		t.Errorf("unknown difficulty: status %d %q, want 400 invalid difficulty", rec.Code, rec.Body.String())
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := []int{10, 20, 30, 40, 50, 60, 70, 80, 90, 100}
+	for _, tt := range []struct {
+		p    float64
+		want int
+	}{{50, 50}, {90, 90}, {100, 100}, {1, 10}, {55, 60}} {
+		if got := percentile(sorted, tt.p); got != tt.want {
+			t.Errorf("percentile(%v) = %d, want %d", tt.p, got, tt.want)
+		}
+	}
+	if got := percentile([]int{7}, 90); got != 7 {
+		t.Errorf("percentile of one time = %d, want 7", got)
+	}
+}
+
+func TestPuzzleTimeStats(t *testing.T) {
+	r := newTestRouter(t)
+	seedSession(t, 1, "alice")
+	seedSession(t, 2, "bob")
+	seedPuzzle(t, "p1", "easy")
+	seedPuzzle(t, "p2", "easy")
+	// Correct solves of 1s to 10s, alice's best being 3s; the wrong and skipped attempts don't count
+	mustExec(t, `INSERT INTO attempts (session_id, puzzle_id, time_ms, correct_first_move, skipped) VALUES
+		(2, 'p1', 1000, 1, 0), (2, 'p1', 2000, 1, 0), (1, 'p1', 3000, 1, 0), (2, 'p1', 4000, 1, 0),
+		(1, 'p1', 5000, 1, 0), (2, 'p1', 6000, 1, 0), (1, 'p1', 7000, 1, 0), (2, 'p1', 8000, 1, 0),
+		(2, 'p1', 9000, 1, 0), (1, 'p1', 10000, 1, 0),
+		(1, 'p1', 500, 0, 0), (1, 'p1', 600, 0, 1)`)
+
+	var stats TimeStats
+	decodeBody(t, serve(t, r, "GET", "/api/puzzles/p1/time-stats", nil, "alice"), &stats)
+	if stats.Solves != 10 || stats.MedianMs == nil || *stats.MedianMs != 5000 ||
+		stats.P90Ms == nil || *stats.P90Ms != 9000 || stats.BestMs == nil || *stats.BestMs != 3000 {
+		t.Errorf("stats = %+v, want 10 solves, median 5000, p90 9000, best 3000", stats)
+	}
+
+	var unsolved TimeStats
+	decodeBody(t, serve(t, r, "GET", "/api/puzzles/p2/time-stats", nil, "alice"), &unsolved)
+	if unsolved.Solves != 0 || unsolved.MedianMs != nil || unsolved.P90Ms != nil || unsolved.BestMs != nil {
+		t.Errorf("unsolved puzzle stats = %+v, want no times", unsolved)
+	}
+
+	if rec := serve(t, r, "GET", "/api/puzzles/missing/time-stats", nil, "alice"); rec.Code != 404 {
+		t.Errorf("missing puzzle: status %d, want 404", rec.Code)
+	}
+}
+
+func TestGradeUCILine(t *testing.T) {
+	// Stored without check marks, which the SAN converted from UCI always carries
+	const solution = `{"lines":[{"san":"Ra7","isTick":true},{"san":"h6"},{"san":"Ra8","isTick":true}]}`
+	sanLine := []string{"Ra7", "h6", "Ra8+"}
+	uciLine := []string{"a1a7", "h7h6", "a7a8"}
+
+	gradeLineAs := func(t *testing.T, r http.Handler, notation string, moves []string) GradeLineResponse {
+		t.Helper()
+		var graded GradeLineResponse
+		decodeBody(t, serve(t, r, "POST", "/api/puzzles/grade-line", map[string]interface{}{
+			"puzzleId":  "p1",
+			"typedSans": moves,
+			"notation":  notation,
+		}, "alice"), &graded)
+		return graded
+	}
+	gradeAs := func(t *testing.T, r http.Handler, notation string, moves []string) GradeResponse {
+		t.Helper()
+		var graded GradeResponse
+		decodeBody(t, serve(t, r, "POST", "/api/puzzles/grade", map[string]interface{}{
+			"puzzleId":   "p1",
+			"playedSans": moves,
+			"notation":   notation,
+		}, "alice"), &graded)
+		return graded
+	}
+
+	r := newTestRouter(t)
+	mustExec(t, `INSERT INTO puzzles (id, difficulty, fen, side_to_move, solution_json, ticks_json)
+		VALUES ('p1', 'easy', ?, 'w', ?, '["Ra7","Ra8"]')`, testPuzzleFEN, solution)
+
+	san, uci := gradeLineAs(t, r, "san", sanLine), gradeLineAs(t, r, "uci", uciLine)
+	if !san.Correct || san.DepthMatched != 3 || !reflect.DeepEqual(san.TicksMatched, []int{0, 2}) {
+		t.Errorf("SAN line graded %+v, want correct with both ticks", san)
+	}
+	if !reflect.DeepEqual(uci, san) {
+		t.Errorf("UCI line graded %+v, SAN line %+v", uci, san)
+	}
+
+	// A wrong UCI move grades like the same wrong SAN move
+	if got, want := gradeLineAs(t, r, "UCI", []string{"a1a7", "h7h6", "a7b7"}), gradeLineAs(t, r, "", []string{"Ra7", "h6", "Rb7"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong UCI line graded %+v, SAN %+v", got, want)
+	}
+
+	if got, want := gradeAs(t, r, "uci", uciLine[:1]), gradeAs(t, r, "san", sanLine[:1]); !got.Correct || !reflect.DeepEqual(got, want) {
+		t.Errorf("/grade with UCI = %+v, SAN %+v; want both correct", got, want)
+	}
+
+	for _, tt := range []struct {
+		name     string
+		notation string
+		moves    []string
+	}{
+		{"illegal UCI move", "uci", []string{"a1b2"}},
+		{"malformed UCI move", "uci", []string{"Ra7"}},
+		{"unknown notation", "lan", sanLine},
+	} {
+		rec := serve(t, r, "POST", "/api/puzzles/grade-line", map[string]interface{}{
+			"puzzleId": "p1", "typedSans": tt.moves, "notation": tt.notation,
+		}, "alice")
+		if rec.Code != 400 {
+			t.Errorf("%s: status %d, want 400", tt.name, rec.Code)
+		}
+	}
+}
+
+func TestGradeLineMateProgress(t *testing.T) {
+	const mateInTwoFEN = "q5nr/1ppknQpp/3p4/1P2p3/4P3/B1PP1b2/B5PP/5K2 w - - 1 18"
+	tests := []struct {
+		name        string
+		fen         string
+		solution    string
+		typed       []string
+		reachedMate bool
+		pliesToMate *int
+	}{
+		{"mate in one reached", testPuzzleFEN, `{"lines":[{"san":"Ra8#","isTick":true}]}`, []string{"Ra8#"}, true, intPtr(0)},
+		{"mate in one missed", testPuzzleFEN, `{"lines":[{"san":"Ra8#","isTick":true}]}`, []string{"Ra7"}, false, intPtr(1)},
+		{"stopped short of mate", mateInTwoFEN, `{"lines":[{"san":"Be6+","isTick":true},{"san":"Kd8"},{"san":"Qf8#","isTick":true}]}`,
+			[]string{"Be6+"}, false, intPtr(2)},
+		{"mate without a # mark", mateInTwoFEN, `{"lines":[{"san":"Be6+","isTick":true},{"san":"Kd8"},{"san":"Qf8","isTick":true}]}`,
+			[]string{"Be6+", "Kd8", "Qf8"}, true, intPtr(0)},
+		{"solution without mate", testPuzzleFEN, `{"lines":[{"san":"Ra7","isTick":true}]}`, []string{"Ra7"}, false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRouter(t)
+			mustExec(t, `INSERT INTO puzzles (id, difficulty, fen, side_to_move, solution_json, ticks_json)
+				VALUES ('p1', 'easy', ?, 'w', ?, '[]')`, tt.fen, tt.solution)
+
+			var graded GradeLineResponse
+			decodeBody(t, serve(t, r, "POST", "/api/puzzles/grade-line", map[string]interface{}{
+				"puzzleId":  "p1",
+				"typedSans": tt.typed,
+			}, "alice"), &graded)
+			if graded.ReachedMate != tt.reachedMate || !reflect.DeepEqual(graded.PliesToMate, tt.pliesToMate) {
+				t.Errorf("reachedMate %v, pliesToMate %v; want %v, %v",
+					graded.ReachedMate, graded.PliesToMate, tt.reachedMate, tt.pliesToMate)
+			}
+		})
+	}
+}
+
+func TestPuzzleIsTick(t *testing.T) {
+	flat := `{"lines":[{"san":"Ra7","isTick":true},{"san":"h6"},{"san":"Ra8+"}]}`
+	tree := `{"lines":[{"san":"Ra7","children":[{"san":"h6","children":[{"san":"Ra8+","isTick":true}]},{"san":"h5","children":[{"san":"Ra8+"}]}]}]}`
+	tests := []struct {
+		name       string
+		solution   string
+		played     []string
+		onSolution bool
+		isTick     bool
+	}{
+		{"flat tick", flat, []string{"Ra7"}, true, true},
+		{"flat move that isn't a tick", flat, []string{"Ra7", "h6", "Ra8+"}, true, false},
+		{"flat line left the solution", flat, []string{"Ra7", "h5"}, false, false},
+		{"tree tick", tree, []string{"Ra7", "h6", "Ra8+"}, true, true},
+		{"tree side line without a tick", tree, []string{"Ra7", "h5", "Ra8+"}, true, false},
+		{"tree line left the solution", tree, []string{"Ra6"}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRouter(t)
+			mustExec(t, `INSERT INTO puzzles (id, difficulty, fen, side_to_move, solution_json, ticks_json)
+				VALUES ('p1', 'easy', ?, 'w', ?, '[]')`, testPuzzleFEN, tt.solution)
+
+			var resp IsTickResponse
+			decodeBody(t, serve(t, r, "POST", "/api/puzzles/p1/is-tick", map[string]interface{}{"playedSans": tt.played}, ""), &resp)
+			if resp.OnSolution != tt.onSolution || resp.IsTick != tt.isTick || resp.Ply != len(tt.played)-1 || resp.Move != tt.played[len(tt.played)-1] {
+				t.Errorf("response = %+v, want on solution %v, tick %v", resp, tt.onSolution, tt.isTick)
+			}
+		})
+	}
+
+	r := newTestRouter(t)
+	seedPuzzle(t, "p1", "easy")
+	if rec := serve(t, r, "POST", "/api/puzzles/p1/is-tick", map[string]interface{}{"playedSans": []string{}}, ""); rec.Code != 400 {
+		t.Errorf("no moves: status %d, want 400", rec.Code)
+	}
+	if rec := serve(t, r, "POST", "/api/puzzles/missing/is-tick", map[string]interface{}{"playedSans": []string{"Ra8#"}}, ""); rec.Code != 404 {
+		t.Errorf("missing puzzle: status %d, want 404", rec.Code)
+	}
+}
+
+func TestPuzzleScoreDistribution(t *testing.T) {
+	r := newTestRouter(t)
+	seedSession(t, 1, "alice")
+	seedSession(t, 2, "bob")
+	seedPuzzle(t, "p1", "easy")
+	seedPuzzle(t, "p2", "easy")
+	// alice scored 5 and 8, bob 0, 10 and 10; the skip and the attempt at p2 don't count
+	mustExec(t, `INSERT INTO attempts (session_id, puzzle_id, total_points, skipped) VALUES
+		(1, 'p1', 5, 0), (1, 'p1', 8, 0), (2, 'p1', 0, 0), (2, 'p1', 10, 0), (2, 'p1', 10, 0),
+		(1, 'p1', 10, 1), (1, 'p2', 3, 0)`)
+
+	var distribution ScoreDistribution
+	decodeBody(t, serve(t, r, "GET", "/api/puzzles/p1/score-distribution", nil, "alice"), &distribution)
+	counts := []int{1, 0, 0, 0, 0, 1, 0, 0, 1, 0, 2}
+	wantBuckets := make([]ScoreBucket, len(counts))
+	for points, count := range counts {
+		wantBuckets[points] = ScoreBucket{Points: points, Count: count}
+	}
+	if distribution.Attempts != 5 || !reflect.DeepEqual(distribution.Buckets, wantBuckets) {
+		t.Errorf("distribution = %d attempts %v, want 5 attempts %v", distribution.Attempts, distribution.Buckets, wantBuckets)
+	}
+	if !reflect.DeepEqual(distribution.Best, intPtr(8)) {
+		t.Errorf("best = %v, want 8", distribution.Best)
+	}
+
+	var anonymous ScoreDistribution
+	decodeBody(t, serve(t, r, "GET", "/api/puzzles/p1/score-distribution", nil, ""), &anonymous)
+	if anonymous.Best != nil {
+		t.Errorf("anonymous best = %d, want none", *anonymous.Best)
+	}
+
+	var unplayed ScoreDistribution
+	decodeBody(t, serve(t, r, "GET", "/api/puzzles/p2/score-distribution", nil, "bob"), &unplayed)
+	if unplayed.Attempts != 1 || unplayed.Best != nil {
+		t.Errorf("p2 for bob = %+v, want alice's 1 attempt and no best", unplayed)
+	}
+
+	if rec := serve(t, r, "GET", "/api/puzzles/missing/score-distribution", nil, "alice"); rec.Code != 404 {
+		t.Errorf("missing puzzle: status %d, want 404", rec.Code)
+	}
+}
+
+func TestPuzzleOnlyMove(t *testing.T) {
+	tests := []struct {
+		name       string
+		fen        string
+		solution   string
+		wantStatus int
+		wantLegal  int
+		wantOnly   bool
+	}{
+		// The king on h1 can only step to h2: g1 and g2 are covered by the rook on g8
+		{"single legal move", "k5r1/8/8/8/8/8/8/7K w - - 0 1", "Kh2", 200, 1, true},
+		{"many legal moves", testPuzzleFEN, "Ra8#", 200, 16, false},
+		{"unplayable solution", testPuzzleFEN, "Qd8", 422, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRouter(t)
+			mustExec(t, `INSERT INTO puzzles (id, difficulty, fen, side_to_move, solution_json, ticks_json)
+				VALUES ('p1', 'easy', ?, 'w', ?, '[]')`, tt.fen, `{"lines":[{"san":"`+tt.solution+`"}]}`)
+
+			rec := serve(t, r, "GET", "/api/puzzles/p1/only-move", nil, "")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus != 200 {
+				return
+			}
+
+			var got OnlyMoveResponse
+			decodeBody(t, rec, &got)
+			if got.Move != tt.solution || got.LegalMoves != tt.wantLegal || got.OnlyMove != tt.wantOnly {
+				t.Errorf("got %+v, want move %s with %d legal moves (only: %v)", got, tt.solution, tt.wantLegal, tt.wantOnly)
+			}
+		})
+	}
+
+	t.Run("missing puzzle", func(t *testing.T) {
+		r := newTestRouter(t)
+		if rec := serve(t, r, "GET", "/api/puzzles/nope/only-move", nil, ""); rec.Code != 404 {
+			t.Errorf("status = %d, want 404", rec.Code)
+		}
+	})
+}
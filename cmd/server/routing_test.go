@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestRouting(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       interface{}
+		wantStatus int
+		wantAllow  string
+	}{
+		{"GET", "GET", "/api/progress/today", nil, 200, ""},
+		{"GET with trailing slash", "GET", "/api/progress/today/", nil, 200, ""},
+		{"POST with trailing slash keeps its body", "POST", "/api/puzzles/grade-line/",
+			map[string]interface{}{"puzzleId": "p1", "typedSans": []string{"Ra8#"}}, 200, ""},
+		{"wrong method", "DELETE", "/api/puzzles/grade-line", nil, 405, "POST"},
+		{"unknown path", "GET", "/api/nope/", nil, 404, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRouter(t)
+			seedPuzzle(t, "p1", "easy")
+
+			rec := serve(t, r, tt.method, tt.path, tt.body, "")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if got := rec.Header().Get("Allow"); got != tt.wantAllow {
+				t.Errorf("Allow = %q, want %q", got, tt.wantAllow)
+			}
+		})
+	}
+}
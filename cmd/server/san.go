@@ -0,0 +1,323 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrInvalidSAN means the move text isn't SAN at all
+	ErrInvalidSAN = errors.New("invalid move")
+	// ErrIllegalSAN means no legal move in the position matches the SAN
+	ErrIllegalSAN = errors.New("illegal move")
+	// ErrAmbiguousSAN means several legal moves match, so the SAN needs a file or rank to disambiguate
+	ErrAmbiguousSAN = errors.New("ambiguous move")
+)
+
+var sanPieceTypes = map[byte]PieceType{
+	'K': King,
+	'Q': Queen,
+	'R': Rook,
+	'B': Bishop,
+	'N': Knight,
+}
+
+// sanMove is a parsed SAN token before it is matched against a position
+type sanMove struct {
+	Piece     PieceType
+	FromRow   int // -1 when not given
+	FromCol   int // -1 when not given
+	ToRow     int
+	ToCol     int
+	Promotion PieceType
+	Castle    string // "O-O", "O-O-O" or empty
+}
+
+// parseSAN splits a SAN token into its parts, ignoring check, mate and annotation suffixes
+func parseSAN(san string) (*sanMove, error) {
+	s := strings.TrimRight(strings.TrimSpace(san), "+#!?")
+	if s == "" {
+		return nil, fmt.Errorf("%w: empty", ErrInvalidSAN)
+	}
+
+	castle := strings.ToUpper(strings.ReplaceAll(s, "0", "O"))
+	if castle == "O-O" || castle == "O-O-O" {
+		return &sanMove{Piece: King, FromRow: -1, FromCol: -1, Castle: castle}, nil
+	}
+
+	move := &sanMove{Piece: Pawn, FromRow: -1, FromCol: -1}
+	if pieceType, ok := sanPieceTypes[s[0]]; ok {
+		move.Piece = pieceType
+		s = s[1:]
+	}
+
+	s = strings.ReplaceAll(s, "x", "")
+	s = strings.ReplaceAll(s, "=", "")
+
+	if n := len(s); n > 0 {
+		if pieceType, ok := sanPieceTypes[s[n-1]]; ok && pieceType != King && move.Piece == Pawn {
+			move.Promotion = pieceType
+			s = s[:n-1]
+		}
+	}
+
+	if len(s) < 2 {
+		return nil, fmt.Errorf("%w %q", ErrInvalidSAN, san)
+	}
+	toRow, toCol, ok := parseSquare(s[len(s)-2:])
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrInvalidSAN, san)
+	}
+	move.ToRow, move.ToCol = toRow, toCol
+
+	for _, c := range s[:len(s)-2] {
+		switch {
+		case c >= 'a' && c <= 'h':
+			move.FromCol = int(c - 'a')
+		case c >= '1' && c <= '8':
+			move.FromRow = int('8' - c)
+		default:
+			return nil, fmt.Errorf("%w %q", ErrInvalidSAN, san)
+		}
+	}
+
+	return move, nil
+}
+
+// ResolveSAN maps a SAN string to the legal move it describes on the board. Castling rights
+// are assumed wherever king and rook stand on their home squares, and no en passant capture is
+// available, since a bare board doesn't record either; use resolveSAN with a full Position when
+// the FEN is known. Errors wrap ErrInvalidSAN, ErrIllegalSAN or ErrAmbiguousSAN.
+func ResolveSAN(board [8][8]*Piece, sideToMove string, san string) (Move, error) {
+	pos := &Position{
+		Board:          board,
+		SideToMove:     sideToMove,
+		Castling:       inferCastlingRights(&board),
+		EnPassant:      "-",
+		FullmoveNumber: 1,
+	}
+	return resolveSAN(pos, san)
+}
+
+// inferCastlingRights grants each castling right whose king and rook are still on their home squares
+func inferCastlingRights(board *[8][8]*Piece) string {
+	has := func(row, col int, pieceType PieceType, color string) bool {
+		piece := board[row][col]
+		return piece != nil && piece.Type == pieceType && piece.Color == color
+	}
+
+	rights := ""
+	if has(7, 4, King, "white") {
+		if has(7, 7, Rook, "white") {
+			rights += "K"
+		}
+		if has(7, 0, Rook, "white") {
+			rights += "Q"
+		}
+	}
+	if has(0, 4, King, "black") {
+		if has(0, 7, Rook, "black") {
+			rights += "k"
+		}
+		if has(0, 0, Rook, "black") {
+			rights += "q"
+		}
+	}
+
+	if rights == "" {
+		return "-"
+	}
+	return rights
+}
+
+// resolveSAN finds the legal move in the position that a SAN token describes
+func resolveSAN(pos *Position, san string) (Move, error) {
+	parsed, err := parseSAN(san)
+	if err != nil {
+		return Move{}, err
+	}
+
+	var matches []Move
+	for _, move := range pos.LegalMoves() {
+		if parsed.matches(pos, move) {
+			matches = append(matches, move)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return Move{}, fmt.Errorf("%w %q", ErrIllegalSAN, san)
+	case 1:
+		return matches[0], nil
+	default:
+		return Move{}, fmt.Errorf("%w %q", ErrAmbiguousSAN, san)
+	}
+}
+
+func (s *sanMove) matches(pos *Position, move Move) bool {
+	piece := pos.Board[move.FromRow][move.FromCol]
+	if piece.Type != s.Piece {
+		return false
+	}
+
+	isCastle := piece.Type == King && abs(move.ToCol-move.FromCol) == 2
+	if s.Castle != "" {
+		return isCastle && (s.Castle == "O-O") == (move.ToCol == 6)
+	}
+	if isCastle {
+		return false
+	}
+
+	if move.ToRow != s.ToRow || move.ToCol != s.ToCol {
+		return false
+	}
+	if s.FromRow >= 0 && move.FromRow != s.FromRow {
+		return false
+	}
+	if s.FromCol >= 0 && move.FromCol != s.FromCol {
+		return false
+	}
+
+	if piece.Type == Pawn {
+		// A pawn move without a file is a push, never a capture
+		if s.FromCol < 0 && move.FromCol != move.ToCol {
+			return false
+		}
+		if move.Promotion != "" {
+			promotion := s.Promotion
+			if promotion == "" {
+				promotion = Queen
+			}
+			return move.Promotion == promotion
+		}
+	}
+
+	return s.Promotion == ""
+}
+
+// sanLetter returns the SAN letter for a piece type; pawns have none
+func sanLetter(pieceType PieceType) string {
+	for letter, t := range sanPieceTypes {
+		if t == pieceType {
+			return string(letter)
+		}
+	}
+	return ""
+}
+
+// moveToSAN writes a legal move in the position as SAN, disambiguating by file, then rank,
+// then both, and marking check or mate
+func moveToSAN(pos *Position, move Move) string {
+	piece := pos.Board[move.FromRow][move.FromCol]
+
+	var san string
+	switch {
+	case piece.Type == King && move.ToCol-move.FromCol == 2:
+		san = "O-O"
+	case piece.Type == King && move.FromCol-move.ToCol == 2:
+		san = "O-O-O"
+	default:
+		capture := pos.Board[move.ToRow][move.ToCol] != nil ||
+			(piece.Type == Pawn && move.FromCol != move.ToCol)
+
+		if piece.Type == Pawn {
+			if capture {
+				san = squareName(move.FromRow, move.FromCol)[:1]
+			}
+		} else {
+			san = sanLetter(piece.Type)
+
+			sameFile, sameRank, ambiguous := false, false, false
+			for _, other := range pos.LegalMoves() {
+				if other == move || other.ToRow != move.ToRow || other.ToCol != move.ToCol {
+					continue
+				}
+				if pos.Board[other.FromRow][other.FromCol].Type != piece.Type {
+					continue
+				}
+				ambiguous = true
+				sameFile = sameFile || other.FromCol == move.FromCol
+				sameRank = sameRank || other.FromRow == move.FromRow
+			}
+			from := squareName(move.FromRow, move.FromCol)
+			switch {
+			case !ambiguous:
+			case !sameFile:
+				san += from[:1]
+			case !sameRank:
+				san += from[1:]
+			default:
+				san += from
+			}
+		}
+
+		if capture {
+			san += "x"
+		}
+		san += squareName(move.ToRow, move.ToCol)
+		if move.Promotion != "" {
+			san += "=" + sanLetter(move.Promotion)
+		}
+	}
+
+	next := pos.applyMove(move)
+	if inCheck(&next.Board, next.SideToMove) {
+		if len(next.LegalMoves()) == 0 {
+			return san + "#"
+		}
+		return san + "+"
+	}
+	return san
+}
+
+// resolveUCI finds the legal move in the position written in UCI long algebraic notation, e.g. "e2e4" or "e7e8q"
+func resolveUCI(pos *Position, uci string) (Move, error) {
+	if len(uci) != 4 && len(uci) != 5 {
+		return Move{}, fmt.Errorf("%w %q", ErrInvalidSAN, uci)
+	}
+	fromRow, fromCol, ok := parseSquare(uci[0:2])
+	if !ok {
+		return Move{}, fmt.Errorf("%w %q", ErrInvalidSAN, uci)
+	}
+	toRow, toCol, ok := parseSquare(uci[2:4])
+	if !ok {
+		return Move{}, fmt.Errorf("%w %q", ErrInvalidSAN, uci)
+	}
+
+	var promotion PieceType
+	if len(uci) == 5 {
+		promotion, ok = sanPieceTypes[strings.ToUpper(uci[4:])[0]]
+		if !ok || promotion == King {
+			return Move{}, fmt.Errorf("%w %q", ErrInvalidSAN, uci)
+		}
+	}
+
+	for _, move := range pos.LegalMoves() {
+		if move.FromRow == fromRow && move.FromCol == fromCol && move.ToRow == toRow && move.ToCol == toCol &&
+			move.Promotion == promotion {
+			return move, nil
+		}
+	}
+	return Move{}, fmt.Errorf("%w %q", ErrIllegalSAN, uci)
+}
+
+// uciLineToSAN converts a line of UCI moves played from the FEN into SAN, stopping at the first
+// move that isn't legal in the position reached
+func uciLineToSAN(fen string, uciMoves []string) ([]string, error) {
+	pos, err := ParseFEN(fen)
+	if err != nil {
+		return nil, err
+	}
+
+	sans := make([]string, 0, len(uciMoves))
+	for _, uci := range uciMoves {
+		move, err := resolveUCI(pos, strings.TrimSpace(uci))
+		if err != nil {
+			return nil, err
+		}
+		sans = append(sans, moveToSAN(pos, move))
+		pos = pos.applyMove(move)
+	}
+	return sans, nil
+}
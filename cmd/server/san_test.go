@@ -0,0 +1,281 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// mustParseFEN parses a test position, failing the test on error
+func mustParseFEN(t *testing.T, fen string) *Position {
+	t.Helper()
+	pos, err := ParseFEN(fen)
+	if err != nil {
+		t.Fatalf("ParseFEN(%q): %v", fen, err)
+	}
+	return pos
+}
+
+// moveName formats a move as from-to squares plus any promotion, e.g. "a7a8queen"
+func moveName(move Move) string {
+	return squareName(move.FromRow, move.FromCol) + squareName(move.ToRow, move.ToCol) + string(move.Promotion)
+}
+
+func TestResolveSAN(t *testing.T) {
+	const (
+		knights   = "4k3/8/8/6N1/8/8/8/1N2K1N1 w - - 0 1"
+		castling  = "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1"
+		promotion = "1r5k/P7/8/8/8/8/8/4K3 w - - 0 1"
+	)
+
+	tests := []struct {
+		name    string
+		fen     string
+		san     string
+		want    string
+		wantErr error
+	}{
+		{"file disambiguation", knights, "Nbd2", "b1d2", nil},
+		{"second knight by file", knights, "Ngf3", "", ErrAmbiguousSAN},
+		{"rank disambiguation", knights, "N1f3", "g1f3", nil},
+		{"other rank", knights, "N5f3", "g5f3", nil},
+		{"full square", knights, "Ng1f3", "g1f3", nil},
+		{"single candidate needs no disambiguation", knights, "Nc3", "b1c3", nil},
+		{"ambiguous", knights, "Nf3", "", ErrAmbiguousSAN},
+		{"ambiguous on a rank", "4k3/8/8/8/8/8/4K3/R6R w - - 0 1", "Rd1", "", ErrAmbiguousSAN},
+
+		{"kingside castling", castling, "O-O", "e1g1", nil},
+		{"queenside castling", castling, "O-O-O", "e1c1", nil},
+		{"castling with zeros", castling, "0-0-0", "e1c1", nil},
+		{"black castling", "r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", "O-O", "e8g8", nil},
+		{"castling without the right", "r3k2r/8/8/8/8/8/8/R3K2R w Qkq - 0 1", "O-O", "", ErrIllegalSAN},
+		{"castling through check", "4kr2/8/8/8/8/8/8/R3K2R w KQ - 0 1", "O-O", "", ErrIllegalSAN},
+		{"king move is not castling", castling, "Kf1", "e1f1", nil},
+
+		{"promotion", promotion, "a8=Q", "a7a8queen", nil},
+		{"underpromotion", promotion, "a8=N", "a7a8knight", nil},
+		{"promotion without a piece is to a queen", promotion, "a8", "a7a8queen", nil},
+		{"capture promotion with check", promotion, "axb8=R+", "a7b8rook", nil},
+		{"promotion on a non-promoting move", "4k3/8/8/8/8/8/P7/4K3 w - - 0 1", "a3=Q", "", ErrIllegalSAN},
+
+		{"en passant", "4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 2", "exd6", "e5d6", nil},
+		{"en passant without the target square", "4k3/8/8/3pP3/8/8/8/4K3 w - - 0 2", "exd6", "", ErrIllegalSAN},
+		{"pawn push is not a capture", "4k3/8/8/8/8/3p4/4P3/4K3 w - - 0 1", "d3", "", ErrIllegalSAN},
+
+		{"pinned piece", "4k3/4r3/8/8/8/8/4N3/4K3 w - - 0 1", "Nf4", "", ErrIllegalSAN},
+		{"no such piece", testPuzzleFEN, "Qh5", "", ErrIllegalSAN},
+		{"wrong side's piece", testPuzzleFEN, "Kh8", "", ErrIllegalSAN},
+		{"off the board", testPuzzleFEN, "Rb9", "", ErrInvalidSAN},
+		{"empty", testPuzzleFEN, " ", "", ErrInvalidSAN},
+		{"garbage", testPuzzleFEN, "hello", "", ErrInvalidSAN},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pos := mustParseFEN(t, tt.fen)
+			move, err := resolveSAN(pos, tt.san)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("resolveSAN(%q) = %v, %v; want %v", tt.san, moveName(move), err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveSAN(%q): %v", tt.san, err)
+			}
+			if got := moveName(move); got != tt.want {
+				t.Errorf("resolveSAN(%q) = %s, want %s", tt.san, got, tt.want)
+			}
+
+			// Whatever resolves must be one of the position's legal moves
+			legal := false
+			for _, m := range pos.LegalMoves() {
+				legal = legal || m == move
+			}
+			if !legal {
+				t.Errorf("resolveSAN(%q) = %s, which LegalMoves doesn't generate", tt.san, moveName(move))
+			}
+		})
+	}
+}
+
+func TestResolveSANOnBareBoard(t *testing.T) {
+	tests := []struct {
+		name    string
+		fen     string
+		san     string
+		want    string
+		wantErr error
+	}{
+		{"castling inferred from home squares", "r3k2r/8/8/8/8/8/8/R3K2R w - - 0 1", "O-O", "e1g1", nil},
+		{"no castling once the rook has left", "r3k2r/8/8/8/8/8/8/R3K1R1 w - - 0 1", "O-O", "", ErrIllegalSAN},
+		{"no en passant without a target square", "4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 2", "exd6", "", ErrIllegalSAN},
+		{"black to move", "r3k2r/8/8/8/8/8/8/R3K2R b - - 0 1", "O-O-O", "e8c8", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pos := mustParseFEN(t, tt.fen)
+			move, err := ResolveSAN(pos.Board, pos.SideToMove, tt.san)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ResolveSAN(%q) = %v, %v; want %v", tt.san, moveName(move), err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveSAN(%q): %v", tt.san, err)
+			}
+			if got := moveName(move); got != tt.want {
+				t.Errorf("ResolveSAN(%q) = %s, want %s", tt.san, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestResolveSANAgreesWithLegalMoves checks every legal move in a few busy positions resolves
+// from its fully disambiguated SAN back to itself
+func TestResolveSANAgreesWithLegalMoves(t *testing.T) {
+	letters := map[PieceType]string{King: "K", Queen: "Q", Rook: "R", Bishop: "B", Knight: "N", Pawn: ""}
+	fens := []string{
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R b KQkq - 0 1",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+		"n1n5/PPPk4/8/8/8/8/4Kppp/5N1N b - - 0 1",
+		"4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 2",
+	}
+
+	for _, fen := range fens {
+		pos := mustParseFEN(t, fen)
+		for _, move := range pos.LegalMoves() {
+			piece := pos.Board[move.FromRow][move.FromCol]
+			var san string
+			switch {
+			case piece.Type == King && move.ToCol-move.FromCol == 2:
+				san = "O-O"
+			case piece.Type == King && move.FromCol-move.ToCol == 2:
+				san = "O-O-O"
+			default:
+				san = letters[piece.Type] + squareName(move.FromRow, move.FromCol) + squareName(move.ToRow, move.ToCol)
+				if move.Promotion != "" {
+					san += "=" + letters[move.Promotion]
+				}
+			}
+
+			got, err := resolveSAN(pos, san)
+			if err != nil || got != move {
+				t.Errorf("%s: resolveSAN(%q) = %s, %v; want %s", fen, san, moveName(got), err, moveName(move))
+			}
+		}
+	}
+}
+
+func TestResolveSANEndpoint(t *testing.T) {
+	r := newTestRouter(t)
+	tests := []struct {
+		name   string
+		fen    string
+		san    string
+		status int
+		want   ResolvedSAN
+	}{
+		{"castling", "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "O-O", 200, ResolvedSAN{From: "e1", To: "g1", SAN: "O-O"}},
+		{"disambiguated", "4k3/8/8/8/8/8/4K3/R6R w - - 0 1", "Rad1", 200, ResolvedSAN{From: "a1", To: "d1", SAN: "Rad1"}},
+		{"promotion", "8/P7/8/8/8/8/8/4K2k w - - 0 1", "a8=N", 200, ResolvedSAN{From: "a7", To: "a8", Promotion: Knight, SAN: "a8=N"}},
+		{"ambiguous", "4k3/8/8/8/8/8/4K3/R6R w - - 0 1", "Rd1", 422, ResolvedSAN{}},
+		{"illegal", "4k3/8/8/8/8/8/4K3/R6R w - - 0 1", "Qd4", 422, ResolvedSAN{}},
+		{"malformed SAN", "4k3/8/8/8/8/8/4K3/R6R w - - 0 1", "zz9", 400, ResolvedSAN{}},
+		{"invalid FEN", "not a fen", "e4", 400, ResolvedSAN{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(t, r, "POST", "/api/san/resolve", map[string]string{"fen": tt.fen, "san": tt.san}, "")
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.status, rec.Body.String())
+			}
+			if tt.status != 200 {
+				return
+			}
+			var got ResolvedSAN
+			decodeBody(t, rec, &got)
+			if got != tt.want {
+				t.Errorf("resolved %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeSANEndpoint(t *testing.T) {
+	tests := []struct {
+		name      string
+		move      string
+		want      string
+		wantValid bool
+	}{
+		{"check", "Nf3+", "nf3", true},
+		{"mate with annotation", "Qxe7#!", "qxe7", true},
+		{"dubious annotation", "e4?!", "e4", true},
+		{"move number", "12. Nf3", "nf3", true},
+		{"black move number", "12...Nf3", "nf3", true},
+		{"move number without space", "1.e4", "e4", true},
+		{"kingside castling", "O-O", "o-o", true},
+		{"kingside castling with zeros", "0-0", "o-o", true},
+		{"queenside castling with zeros", "0-0-0", "o-o-o", true},
+		{"queenside castling with check", "O-O-O+", "o-o-o", true},
+		{"promotion", "e8=Q", "e8q", true},
+		{"promotion without equals", "e8Q", "e8q", true},
+		{"capture promotion with mate", "exd8=N#", "exd8n", true},
+		{"not a move", "xyz", "xyz", false},
+		{"move number only", "12.", "", false},
+	}
+
+	moves := make([]string, len(tests))
+	for i, tt := range tests {
+		moves[i] = tt.move
+	}
+	r := newTestRouter(t)
+	var got struct {
+		Moves []NormalizedSAN `json:"moves"`
+	}
+	decodeBody(t, serve(t, r, "POST", "/api/san/normalize", map[string][]string{"moves": moves}, ""), &got)
+	if len(got.Moves) != len(tests) {
+		t.Fatalf("got %d moves, want %d", len(got.Moves), len(tests))
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := got.Moves[i]
+			if result.Input != tt.move || result.Normalized != tt.want || result.Valid != tt.wantValid {
+				t.Errorf("got %+v, want %q (valid: %v)", result, tt.want, tt.wantValid)
+			}
+			if result.Valid == (result.Error != "") {
+				t.Errorf("error = %q with valid %v", result.Error, result.Valid)
+			}
+		})
+	}
+}
+
+func TestNormalizeSANRequestLimits(t *testing.T) {
+	tests := []struct {
+		name       string
+		moves      int
+		wantStatus int
+	}{
+		{"empty", 0, 400},
+		{"at the limit", maxSANNormalizeBatch, 200},
+		{"over the limit", maxSANNormalizeBatch + 1, 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRouter(t)
+			moves := make([]string, tt.moves)
+			for i := range moves {
+				moves[i] = "e4"
+			}
+			rec := serve(t, r, "POST", "/api/san/normalize", map[string][]string{"moves": moves}, "")
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -1,12 +1,15 @@
 package main
 
 import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/http"
 	"os"
 	"strconv"
 	"strings"
-	"time"
 
 	"woodpecker-online/internal/model"
 	"woodpecker-online/internal/repository"
@@ -15,8 +18,46 @@ import (
 	"github.com/jmoiron/sqlx"
 )
 
-// readPuzzlesFromFile reads puzzles from a FEN list file
-func readPuzzlesFromFile(filename string, maxPuzzles int) ([]*model.Puzzle, error) {
+// Seed source, set from PUZZLE_SEED_FILE, PUZZLE_SEED_MAX and PUZZLE_SEED_DIFFICULTY at startup.
+// A max of 0 seeds every puzzle in the file. The difficulty applies to every puzzle in the file
+// and names their IDs, e.g. wpm_easy_001.
+var (
+	seedFile       = "fen_list_easy.txt"
+	seedMax        = 5
+	seedDifficulty = "easy"
+)
+
+// seedMaxFromEnv reads PUZZLE_SEED_MAX, which unlike most settings may be 0
+func seedMaxFromEnv(def int) int {
+	v := os.Getenv("PUZZLE_SEED_MAX")
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		slog.Warn("Ignoring invalid setting", "name", "PUZZLE_SEED_MAX", "value", v)
+		return def
+	}
+	return n
+}
+
+// seedDifficultyFromEnv reads PUZZLE_SEED_DIFFICULTY, falling back to def when unset or invalid
+func seedDifficultyFromEnv(def string) string {
+	v := os.Getenv("PUZZLE_SEED_DIFFICULTY")
+	if v == "" {
+		return def
+	}
+	difficulty, err := model.NormalizeDifficulty(v)
+	if err != nil {
+		slog.Warn("Ignoring invalid setting", "name", "PUZZLE_SEED_DIFFICULTY", "value", v)
+		return def
+	}
+	return difficulty
+}
+
+// readPuzzlesFromFile reads puzzles of the given difficulty from a FEN list file, stopping after
+// maxPuzzles unless it is 0
+func readPuzzlesFromFile(filename, difficulty string, maxPuzzles int) ([]*model.Puzzle, error) {
 	// Read the entire file content first
 	content, err := os.ReadFile(filename)
 	if err != nil {
@@ -28,7 +69,7 @@ func readPuzzlesFromFile(filename string, maxPuzzles int) ([]*model.Puzzle, erro
 	var puzzles []*model.Puzzle
 
 	for _, line := range lines {
-		if len(puzzles) >= maxPuzzles {
+		if maxPuzzles > 0 && len(puzzles) >= maxPuzzles {
 			break
 		}
 
@@ -54,27 +95,19 @@ func readPuzzlesFromFile(filename string, maxPuzzles int) ([]*model.Puzzle, erro
 			continue
 		}
 
-		// Extract FEN and side to move
+		// Extract FEN fields: board and side to move, optionally followed by the rest of a full FEN
 		fenParts := strings.Fields(parts[1])
 		if len(fenParts) < 2 {
 			continue
 		}
-
-		// Get the side to move (last part)
-		sideToMove := fenParts[len(fenParts)-1]
-
-		// Get the board position (all parts except the last one)
-		boardPosition := strings.Join(fenParts[:len(fenParts)-1], " ")
-
-		// Reconstruct full FEN with proper side to move
-		fen := fmt.Sprintf("%s %s - - 0 1", boardPosition, sideToMove)
+		fen := seedFEN(fenParts)
 
 		// Create puzzle ID
-		puzzleID := fmt.Sprintf("wpm_easy_%03d", puzzleNum)
+		puzzleID := fmt.Sprintf("wpm_%s_%03d", difficulty, puzzleNum)
 
 		puzzle := &model.Puzzle{
 			ID:         puzzleID,
-			Difficulty: "easy",
+			Difficulty: difficulty,
 			FEN:        fen,
 		}
 
@@ -84,63 +117,195 @@ func readPuzzlesFromFile(filename string, maxPuzzles int) ([]*model.Puzzle, erro
 	return puzzles, nil
 }
 
-// seedPuzzles inserts sample puzzles into the database
-func seedPuzzles(db *sqlx.DB) error {
-	log.Println("Seeding puzzles...")
+// seedFEN builds a full FEN from the fields of a seed line. Lines usually give only the board
+// and side to move; castling, en passant and move counters are kept when the line has them and
+// default to "- - 0 1" otherwise.
+func seedFEN(fields []string) string {
+	full := []string{fields[0], fields[1], "-", "-", "0", "1"}
+	copy(full[2:], fields[2:min(len(fields), 6)])
+	return strings.Join(full, " ")
+}
 
-	// Read puzzles from fen_list_easy.txt file
-	puzzles, err := readPuzzlesFromFile("fen_list_easy.txt", 5)
+// loadSeedPuzzles reads the seed puzzles from the seed file, with their solutions and ticks from
+// easy_solutions.go, which only covers the easy list
+func loadSeedPuzzles() ([]*model.Puzzle, error) {
+	puzzles, err := readPuzzlesFromFile(seedFile, seedDifficulty, seedMax)
 	if err != nil {
-		return fmt.Errorf("failed to read puzzles from file: %v", err)
+		return nil, fmt.Errorf("failed to read puzzles from file: %v", err)
 	}
 
-	// Load solutions and ticks from easy_solutions.go
-	easySolutions := SolutionsEasy()
-
-	// Merge solutions and ticks with puzzle data
-	for _, puzzle := range puzzles {
-		if solutionData, exists := easySolutions[puzzle.ID]; exists {
-			puzzle.Solution = solutionData.Solution
-			puzzle.Ticks = solutionData.Ticks
+	if seedDifficulty == "easy" {
+		easySolutions := CachedSolutionsEasy()
+		for _, puzzle := range puzzles {
+			if solutionData, exists := easySolutions[puzzle.ID]; exists {
+				puzzle.Solution = solutionData.Solution
+				puzzle.Ticks = solutionData.Ticks
+			}
 		}
 	}
+	return puzzles, nil
+}
 
-	// Check if puzzles already exist (idempotent)
-	var count int
-	err = db.QueryRow("SELECT COUNT(*) FROM puzzles").Scan(&count)
+// seedPuzzles upserts the seed puzzles by ID: missing puzzles are inserted and puzzles whose
+// FEN, difficulty, solution or ticks differ from the seed are updated, so puzzles added to
+// fen_list_easy.txt or easy_solutions.go take effect on the next start. A seed puzzle without a
+// solution never clears one already stored, and solutions edited through the admin API are kept.
+func seedPuzzles(db *sqlx.DB) error {
+	slog.Info("Seeding puzzles")
+
+	puzzles, err := loadSeedPuzzles()
 	if err != nil {
 		return err
 	}
 
-	if count > 0 {
-		log.Printf("Found %d existing puzzles, skipping seed", count)
-		return nil
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
 	}
+	defer tx.Rollback()
+
+	inserted, updated, err := upsertSeedPuzzles(tx, puzzles)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	slog.Info("Seeded puzzles", "inserted", inserted, "updated", updated, "unchanged", len(puzzles)-inserted-updated)
+	return nil
+}
 
-	// Insert puzzles
+// upsertSeedPuzzles writes the seed puzzles within tx as described on seedPuzzles, returning how
+// many were inserted and updated
+func upsertSeedPuzzles(tx *sqlx.Tx, puzzles []*model.Puzzle) (inserted, updated int, err error) {
 	for _, puzzle := range puzzles {
 		puzzleDB := model.FromPuzzle(puzzle)
 
-		_, err := db.Exec(`
-			INSERT INTO puzzles (id, difficulty, fen, side_to_move, solution_json, ticks_json)
-			VALUES (?, ?, ?, ?, ?, ?)
-		`, puzzleDB.ID, puzzleDB.Difficulty, puzzleDB.FEN,
-			extractSideToMove(puzzleDB.FEN), puzzleDB.SolutionJSON, puzzleDB.TicksJSON)
+		var existing struct {
+			Difficulty string         `db:"difficulty"`
+			FEN        string         `db:"fen"`
+			Solution   sql.NullString `db:"solution_json"`
+			Ticks      sql.NullString `db:"ticks_json"`
+			Edited     bool           `db:"edited"`
+		}
+		err := tx.Get(&existing, `
+			SELECT difficulty, fen, solution_json, ticks_json, edited_at IS NOT NULL AS edited
+			FROM puzzles WHERE id = ?
+		`, puzzleDB.ID)
+		if err == sql.ErrNoRows {
+			_, err = tx.Exec(`
+				INSERT INTO puzzles (id, difficulty, fen, side_to_move, solution_json, ticks_json)
+				VALUES (?, ?, ?, ?, ?, ?)
+			`, puzzleDB.ID, puzzleDB.Difficulty, puzzleDB.FEN,
+				puzzleDB.SideToMove, puzzleDB.SolutionJSON, puzzleDB.TicksJSON)
+			if err != nil {
+				return 0, 0, err
+			}
+			inserted++
+			slog.Debug("Inserted puzzle", "puzzle", puzzle.ID, "difficulty", puzzle.Difficulty)
+			continue
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+
+		solution, ticks := existing.Solution, existing.Ticks
+		if puzzle.Solution.Lines != nil && !existing.Edited {
+			if solution, err = storedJSON(puzzleDB.SolutionJSON); err != nil {
+				return 0, 0, err
+			}
+			if ticks, err = storedJSON(puzzleDB.TicksJSON); err != nil {
+				return 0, 0, err
+			}
+		}
+
+		if existing.Difficulty == puzzleDB.Difficulty && existing.FEN == puzzleDB.FEN &&
+			existing.Solution == solution && existing.Ticks == ticks {
+			continue
+		}
 
+		_, err = tx.Exec(`
+			UPDATE puzzles SET difficulty = ?, fen = ?, side_to_move = ?, solution_json = ?, ticks_json = ?
+			WHERE id = ?
+		`, puzzleDB.Difficulty, puzzleDB.FEN, puzzleDB.SideToMove, solution, ticks, puzzleDB.ID)
 		if err != nil {
-			return err
+			return 0, 0, err
 		}
+		cachedPuzzles.Invalidate(puzzleDB.ID)
+		updated++
+		slog.Debug("Updated puzzle", "puzzle", puzzle.ID, "difficulty", puzzle.Difficulty)
+	}
+	return inserted, updated, nil
+}
 
-		log.Printf("Inserted puzzle: %s (%s)", puzzle.ID, puzzle.Difficulty)
+// devMode enables development-only endpoints such as /api/dev/reseed (ENV=development)
+var devMode = false
+
+// handleDevReseed replaces the seed puzzles (IDs starting wpm_) with those in the seed file, in a
+// single transaction so a failed reseed leaves the puzzles as they were. Puzzles from other
+// sources, such as Lichess imports, are kept. Other tables keep their references by puzzle ID,
+// which point at the reseeded puzzles again when the IDs are still in the file. Outside
+// development it is forbidden.
+func handleDevReseed(w http.ResponseWriter, r *http.Request) {
+	if !devMode {
+		http.Error(w, "Reseeding is only available in development", http.StatusForbidden)
+		return
 	}
 
-	log.Printf("Successfully seeded %d puzzles", len(puzzles))
-	return nil
+	puzzles, err := loadSeedPuzzles()
+	if err != nil {
+		slog.Error("Failed to reseed puzzles", "error", err)
+		http.Error(w, "Failed to reseed puzzles", http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		http.Error(w, "Failed to reseed puzzles", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM puzzles WHERE id LIKE 'wpm\_%' ESCAPE '\'`); err != nil {
+		slog.Error("Failed to clear puzzles", "error", err)
+		http.Error(w, "Failed to clear puzzles", http.StatusInternalServerError)
+		return
+	}
+	if _, _, err := upsertSeedPuzzles(tx, puzzles); err != nil {
+		slog.Error("Failed to reseed puzzles", "error", err)
+		http.Error(w, "Failed to reseed puzzles", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		slog.Error("Failed to reseed puzzles", "error", err)
+		http.Error(w, "Failed to reseed puzzles", http.StatusInternalServerError)
+		return
+	}
+	cachedPuzzles.Clear()
+
+	var count int
+	if err := db.Get(&count, `SELECT COUNT(*) FROM puzzles`); err != nil {
+		http.Error(w, "Failed to count puzzles", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"puzzles": count})
+}
+
+// storedJSON returns a JSON column value as it is stored, so it can be compared with what the database holds
+func storedJSON(v driver.Valuer) (sql.NullString, error) {
+	value, err := v.Value()
+	if err != nil || value == nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(value.([]byte)), Valid: true}, nil
 }
 
 // seedTestUser creates a test user for development
 func seedTestUser(db *sqlx.DB) error {
-	log.Println("Seeding test user...")
+	slog.Info("Seeding test user")
 
 	// Check if test user already exists
 	var count int
@@ -150,7 +315,7 @@ func seedTestUser(db *sqlx.DB) error {
 	}
 
 	if count > 0 {
-		log.Println("Test user already exists, skipping")
+		slog.Info("Test user already exists, skipping")
 		return nil
 	}
 
@@ -161,13 +326,13 @@ func seedTestUser(db *sqlx.DB) error {
 		return fmt.Errorf("failed to create test user: %v", err)
 	}
 
-	log.Printf("Created test user: %s (ID: %s)", testUser.Email, testUser.ID)
+	slog.Info("Created test user", "email", testUser.Email, "id", testUser.ID)
 	return nil
 }
 
 // seedDemoSet creates a demo set with the first 5 easy puzzles for the test user
 func seedDemoSet(db *sqlx.DB) error {
-	log.Println("Seeding demo set...")
+	slog.Info("Seeding demo set")
 
 	// Get the test user
 	var testUserID string
@@ -184,7 +349,7 @@ func seedDemoSet(db *sqlx.DB) error {
 	}
 
 	if count > 0 {
-		log.Println("Demo set already exists, skipping")
+		slog.Info("Demo set already exists, skipping")
 		return nil
 	}
 
@@ -198,7 +363,7 @@ func seedDemoSet(db *sqlx.DB) error {
 		Description:   "A demonstration set containing the first 5 easy puzzles for testing the Woodpecker Method",
 		DifficultyMin: "easy",
 		DifficultyMax: "easy",
-		CreatedAt:     time.Now().Format(time.RFC3339),
+		CreatedAt:     model.Now(),
 	}
 
 	err = repo.CreateSet(demoSet)
@@ -247,19 +412,6 @@ func seedDemoSet(db *sqlx.DB) error {
 		return fmt.Errorf("failed to create demo cycle: %v", err)
 	}
 
-	// Create default user settings for the test user
-	settings := &model.UserSettings{
-		UserID:           testUserID,
-		DailyGoalMinutes: 30,
-		RemindersEnabled: true,
-		Timezone:         "UTC",
-	}
-
-	err = repo.CreateUserSettings(settings)
-	if err != nil {
-		return fmt.Errorf("failed to create user settings: %v", err)
-	}
-
-	log.Printf("Created demo set '%s' with %d puzzles and initial cycle", demoSet.Name, len(puzzleIDs))
+	slog.Info("Created demo set with initial cycle", "name", demoSet.Name, "puzzles", len(puzzleIDs))
 	return nil
 }
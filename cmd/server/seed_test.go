@@ -0,0 +1,330 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"woodpecker-online/internal/model"
+)
+
+func TestSeededUserGetsConfiguredDailyGoal(t *testing.T) {
+	tests := []struct {
+		setting string
+		want    int
+	}{
+		{"", 30},
+		{"45", 45},
+	}
+	for _, tt := range tests {
+		t.Run(tt.setting, func(t *testing.T) {
+			previous := model.DefaultDailyGoalMinutes
+			t.Cleanup(func() { model.DefaultDailyGoalMinutes = previous })
+			t.Setenv("DEFAULT_DAILY_GOAL_MINUTES", tt.setting)
+
+			loadConfig()
+			newTestDB(t)
+			if err := seedTestUser(db); err != nil {
+				t.Fatal(err)
+			}
+
+			var goal int
+			if err := db.Get(&goal, `SELECT s.daily_goal_minutes FROM user_settings s
+				JOIN users u ON u.id = s.user_id WHERE u.email = 'test@example.com'`); err != nil {
+				t.Fatal(err)
+			}
+			if goal != tt.want {
+				t.Errorf("daily goal = %d, want %d", goal, tt.want)
+			}
+		})
+	}
+}
+
+func TestSeedPuzzlesKeepsAdminEdits(t *testing.T) {
+	edited := model.Solution{Lines: []model.Line{{SAN: "Rxh2+", IsTick: true}}}
+
+	tests := []struct {
+		name      string
+		edit      func(t *testing.T, r http.Handler)
+		wantLines int
+	}{
+		{"unchanged", func(t *testing.T, r http.Handler) {}, 3},
+		{"changed outside the admin API", func(t *testing.T, r http.Handler) {
+			mustExec(t, `UPDATE puzzles SET solution_json = '{"lines":[{"san":"Rxh2+"}]}' WHERE id = 'wpm_easy_001'`)
+		}, 3},
+		{"edited through the admin API", func(t *testing.T, r http.Handler) {
+			rec := serve(t, r, "PUT", "/api/admin/puzzles/wpm_easy_001", map[string]interface{}{"solution": edited}, "admin")
+			if rec.Code != 200 {
+				t.Fatalf("admin update: status %d: %s", rec.Code, rec.Body.String())
+			}
+		}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := adminEmails
+			adminEmails = parseAdminEmails("admin@example.com")
+			t.Cleanup(func() { adminEmails = previous })
+
+			r := newTestRouter(t)
+			if err := seedPuzzles(db); err != nil {
+				t.Fatal(err)
+			}
+			tt.edit(t, r)
+			if err := seedPuzzles(db); err != nil {
+				t.Fatal(err)
+			}
+
+			var solution model.SolutionJSON
+			if err := db.Get(&solution, `SELECT solution_json FROM puzzles WHERE id = 'wpm_easy_001'`); err != nil {
+				t.Fatal(err)
+			}
+			if len(solution.Lines) != tt.wantLines {
+				t.Errorf("solution has %d moves, want %d", len(solution.Lines), tt.wantLines)
+			}
+		})
+	}
+}
+
+func TestSeedPuzzlesUpsertsByID(t *testing.T) {
+	newTestDB(t)
+	dir := t.TempDir()
+	t.Chdir(dir)
+	writeSeed := func(lines string) {
+		if err := os.WriteFile(filepath.Join(dir, "fen_list_easy.txt"), []byte(lines), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	first := "1. r6r/1pp3k1/1b6/p2P1p2/2N1pn2/2P2PP1/BP5P/4RR1K w\n"
+
+	writeSeed(first)
+	if err := seedPuzzles(db); err != nil {
+		t.Fatal(err)
+	}
+	// A stray edit is undone by the next seed; the new line is added
+	mustExec(t, `UPDATE puzzles SET solution_json = '{"lines":[{"san":"Rxh2+"}]}' WHERE id = 'wpm_easy_001'`)
+	writeSeed(first + "4. 2kr4/1pp4p/1p1r4/5Pp1/1P2q3/2P1R2P/P3KP2/1Q1R4 b\n")
+	if err := seedPuzzles(db); err != nil {
+		t.Fatal(err)
+	}
+
+	var puzzles []model.PuzzleDB
+	if err := db.Select(&puzzles, `SELECT id, difficulty, fen, side_to_move, solution_json, ticks_json FROM puzzles ORDER BY id`); err != nil {
+		t.Fatal(err)
+	}
+	if len(puzzles) != 2 || puzzles[0].ID != "wpm_easy_001" || puzzles[1].ID != "wpm_easy_004" {
+		t.Fatalf("seeded %d puzzles %+v, want wpm_easy_001 and wpm_easy_004", len(puzzles), puzzles)
+	}
+	want := CachedSolutionsEasy()["wpm_easy_001"].Solution.Lines
+	if got := puzzles[0].SolutionJSON.Lines; len(got) != len(want) || got[0].SAN != want[0].SAN {
+		t.Errorf("wpm_easy_001 solution = %+v, want the seeded %+v", got, want)
+	}
+	if puzzles[1].FEN != "2kr4/1pp4p/1p1r4/5Pp1/1P2q3/2P1R2P/P3KP2/1Q1R4 b - - 0 1" {
+		t.Errorf("new puzzle FEN = %q", puzzles[1].FEN)
+	}
+}
+
+func TestSeedFEN(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"6k1/5ppp/8/8/8/8/8/R3K3 w", "6k1/5ppp/8/8/8/8/8/R3K3 w - - 0 1"},
+		{"6k1/5ppp/8/8/8/8/8/R3K3 w Q", "6k1/5ppp/8/8/8/8/8/R3K3 w Q - 0 1"},
+		{"rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq e6 0 2", "rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq e6 0 2"},
+	}
+	for _, tt := range tests {
+		if got := seedFEN(strings.Fields(tt.line)); got != tt.want {
+			t.Errorf("seedFEN(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestSeedKeepsCastlingAndEnPassant(t *testing.T) {
+	r := newTestRouter(t)
+	dir := t.TempDir()
+	t.Chdir(dir)
+	fen := "rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq e6 0 2"
+	if err := os.WriteFile(filepath.Join(dir, "fen_list_easy.txt"), []byte("7. "+fen+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := seedPuzzles(db); err != nil {
+		t.Fatal(err)
+	}
+
+	var stored string
+	if err := db.Get(&stored, `SELECT fen FROM puzzles WHERE id = 'wpm_easy_007'`); err != nil {
+		t.Fatal(err)
+	}
+	if stored != fen {
+		t.Errorf("stored FEN = %q, want %q", stored, fen)
+	}
+
+	var served struct {
+		FEN string `json:"fen"`
+	}
+	decodeBody(t, serve(t, r, "GET", "/api/puzzles/next?difficulty=easy&puzzleId=wpm_easy_007", nil, "alice"), &served)
+	if served.FEN != fen {
+		t.Errorf("served FEN = %q, want %q", served.FEN, fen)
+	}
+}
+
+func TestSeedPuzzlesDifficulty(t *testing.T) {
+	tests := []struct {
+		setting      string
+		wantID       string
+		wantLevel    string
+		wantSolution bool
+	}{
+		{"", "wpm_easy_001", "easy", true},
+		{"Intermediate", "wpm_intermediate_001", "intermediate", false},
+		{"bogus", "wpm_easy_001", "easy", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.setting, func(t *testing.T) {
+			previousDifficulty, previousMax := seedDifficulty, seedMax
+			t.Cleanup(func() { seedDifficulty, seedMax = previousDifficulty, previousMax })
+			t.Setenv("PUZZLE_SEED_DIFFICULTY", tt.setting)
+			loadConfig()
+			seedMax = 1
+
+			newTestDB(t)
+			if err := seedPuzzles(db); err != nil {
+				t.Fatal(err)
+			}
+
+			var got struct {
+				ID          string `db:"id"`
+				Difficulty  string `db:"difficulty"`
+				HasSolution bool   `db:"has_solution"`
+			}
+			if err := db.Get(&got, `SELECT id, difficulty, solution_json IS NOT NULL AS has_solution FROM puzzles`); err != nil {
+				t.Fatal(err)
+			}
+			if got.ID != tt.wantID || got.Difficulty != tt.wantLevel || got.HasSolution != tt.wantSolution {
+				t.Errorf("seeded %+v, want %s (%s, solution: %v)", got, tt.wantID, tt.wantLevel, tt.wantSolution)
+			}
+		})
+	}
+}
+
+func TestSeedPuzzlesMax(t *testing.T) {
+	all, err := readPuzzlesFromFile(seedFile, "easy", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		setting string
+		want    int
+	}{
+		{"", 5},
+		{"12", 12},
+		{"0", len(all)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.setting, func(t *testing.T) {
+			previous := seedMax
+			t.Cleanup(func() { seedMax = previous })
+			t.Setenv("PUZZLE_SEED_MAX", tt.setting)
+			loadConfig()
+
+			newTestDB(t)
+			if err := seedPuzzles(db); err != nil {
+				t.Fatal(err)
+			}
+			var count int
+			if err := db.Get(&count, `SELECT COUNT(*) FROM puzzles`); err != nil {
+				t.Fatal(err)
+			}
+			if count != tt.want {
+				t.Errorf("seeded %d puzzles, want %d", count, tt.want)
+			}
+		})
+	}
+}
+
+func TestSeedPuzzlesFileOverride(t *testing.T) {
+	previous := seedFile
+	t.Cleanup(func() { seedFile = previous })
+	path := filepath.Join(t.TempDir(), "custom.txt")
+	if err := os.WriteFile(path, []byte("9. 6k1/5ppp/8/8/8/8/8/R3K3 w\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PUZZLE_SEED_FILE", path)
+	loadConfig()
+
+	newTestDB(t)
+	if err := seedPuzzles(db); err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	if err := db.Select(&ids, `SELECT id FROM puzzles`); err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != "wpm_easy_009" {
+		t.Errorf("seeded %v from the override file, want [wpm_easy_009]", ids)
+	}
+}
+
+func TestDevReseed(t *testing.T) {
+	tests := []struct {
+		name       string
+		failOn     string // seed puzzle whose insert fails, or ""
+		wantStatus int
+		want       []string
+	}{
+		{"replaces seed puzzles and keeps imports", "", 200, []string{"lichess_abc", "wpm_easy_001", "wpm_easy_004"}},
+		{"failure keeps the old puzzles", "wpm_easy_004", 500, []string{"lichess_abc", "wpm_easy_001", "wpm_easy_999"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previousDev, previousMax := devMode, seedMax
+			devMode, seedMax = true, 2
+			t.Cleanup(func() { devMode, seedMax = previousDev, previousMax })
+
+			newTestDB(t)
+			seedPuzzle(t, "lichess_abc", "easy")
+			seedPuzzle(t, "wpm_easy_001", "easy")
+			seedPuzzle(t, "wpm_easy_999", "easy")
+			if tt.failOn != "" {
+				mustExec(t, `CREATE TRIGGER fail_seed BEFORE INSERT ON puzzles
+					WHEN NEW.id = '`+tt.failOn+`' BEGIN SELECT RAISE(ABORT, 'injected failure'); END`)
+			}
+
+			rec := serve(t, http.HandlerFunc(handleDevReseed), "POST", "/api/dev/reseed", nil, "")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+
+			var got []string
+			if err := db.Select(&got, `SELECT id FROM puzzles ORDER BY id`); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("puzzles = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDevReseedForbiddenOutsideDevelopment(t *testing.T) {
+	previous := devMode
+	devMode = false
+	t.Cleanup(func() { devMode = previous })
+
+	newTestDB(t)
+	seedPuzzle(t, "lichess_abc", "easy")
+	if rec := serve(t, http.HandlerFunc(handleDevReseed), "POST", "/api/dev/reseed", nil, ""); rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want 403", rec.Code)
+	}
+
+	var count int
+	if err := db.Get(&count, `SELECT COUNT(*) FROM puzzles`); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("%d puzzles after a forbidden reseed, want the 1 left untouched", count)
+	}
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"woodpecker-online/internal/model"
+)
+
+func TestIdempotentSessionCreation(t *testing.T) {
+	r := newTestRouter(t)
+	seedSession(t, 1, "alice")
+	seedSession(t, 2, "alice")
+	seedPuzzle(t, "p1", "easy")
+	mustExec(t, `INSERT INTO set_puzzles (set_id, puzzle_id, position) VALUES (1, 'p1', 1), (2, 'p1', 1)`)
+
+	create := func(key string, cycleID int) *httptest.ResponseRecorder {
+		req := newRequest(t, "POST", "/api/trainer/sessions", map[string]int{"cycle_id": cycleID, "target_count": 1}, "alice")
+		req.Header.Set("Idempotency-Key", key)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	var first struct {
+		ID int `json:"id"`
+	}
+	decodeBody(t, create("k1", 1), &first)
+
+	tests := []struct {
+		name       string
+		key        string
+		cycleID    int
+		wantStatus int
+		wantSameID bool
+	}{
+		{"replay with the same body", "k1", 1, 200, true},
+		{"replay with a different cycle", "k1", 2, 422, false},
+		{"new key", "k2", 2, 200, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := create(tt.key, tt.cycleID)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if rec.Code != 200 {
+				return
+			}
+			var got struct {
+				ID int `json:"id"`
+			}
+			decodeBody(t, rec, &got)
+			if (got.ID == first.ID) != tt.wantSameID {
+				t.Errorf("session %d, first was %d, want same = %v", got.ID, first.ID, tt.wantSameID)
+			}
+		})
+	}
+}
+
+func TestGradeLineRecordsAttempt(t *testing.T) {
+	tests := []struct {
+		name      string
+		typedSANs []string
+		hints     int
+		want      model.Attempt
+	}{
+		{"correct", []string{"Ra8#"}, 0, model.Attempt{TimeMs: 4200, CorrectFirstMove: true, ScoreFirstMove: 1, TotalPoints: 1}},
+		{"correct with hint", []string{"Ra8#"}, 1, model.Attempt{TimeMs: 4200, CorrectFirstMove: true, ScoreFirstMove: 1, HintsUsed: 1}},
+		{"wrong", []string{"Ra7"}, 0, model.Attempt{TimeMs: 4200}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRouter(t)
+			seedSession(t, 1, "alice")
+			seedPuzzle(t, "p1", "easy")
+			for i := 0; i < tt.hints; i++ {
+				requestHint(t, r, nil)
+			}
+
+			rec := serve(t, r, "POST", "/api/puzzles/grade-line", map[string]interface{}{
+				"puzzleId":  "p1",
+				"typedSans": tt.typedSANs,
+				"sessionId": 1,
+				"timeMs":    4200,
+			}, "alice")
+			var graded GradeLineResponse
+			decodeBody(t, rec, &graded)
+
+			var got model.Attempt
+			if err := db.Get(&got, `SELECT session_id, puzzle_id, score_first_move, total_points, time_ms, correct_first_move, hints_used
+				FROM attempts`); err != nil {
+				t.Fatal(err)
+			}
+			tt.want.SessionID, tt.want.PuzzleID = 1, "p1"
+			if got != tt.want {
+				t.Errorf("attempt = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGradeLineSessionChecks(t *testing.T) {
+	tests := []struct {
+		name       string
+		sessionID  int
+		userID     string
+		ended      bool
+		wantStatus int
+	}{
+		{"own open session", 1, "alice", false, 200},
+		{"another user's session", 1, "bob", false, 403},
+		{"ended session", 1, "alice", true, 409},
+		{"missing session", 9, "alice", false, 404},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRouter(t)
+			seedSession(t, 1, "alice")
+			seedPuzzle(t, "p1", "easy")
+			if tt.ended {
+				mustExec(t, `UPDATE sessions SET ended_at = CURRENT_TIMESTAMP WHERE id = 1`)
+			}
+
+			rec := serve(t, r, "POST", "/api/puzzles/grade-line", map[string]interface{}{
+				"puzzleId":  "p1",
+				"typedSans": []string{"Ra8#"},
+				"sessionId": tt.sessionID,
+			}, tt.userID)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+
+			var attempts int
+			if err := db.Get(&attempts, `SELECT COUNT(*) FROM attempts`); err != nil {
+				t.Fatal(err)
+			}
+			if want := boolToInt(tt.wantStatus == 200); attempts != want {
+				t.Errorf("%d attempts recorded, want %d", attempts, want)
+			}
+		})
+	}
+}
+
+func TestTimedSessionExpiry(t *testing.T) {
+	tests := []struct {
+		name       string
+		startedAgo time.Duration
+		wantStatus int
+	}{
+		{"within the limit", 30 * time.Second, 200},
+		{"after expiry", 2 * time.Minute, 410},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRouter(t)
+			seedSession(t, 1, "alice")
+			seedPuzzle(t, "p1", "easy")
+			startedAt := time.Now().Add(-tt.startedAgo)
+			mustExec(t, `UPDATE sessions SET time_limit_seconds = 60, started_at = ? WHERE id = 1`, startedAt.Format(time.RFC3339))
+
+			rec := serve(t, r, "POST", "/api/puzzles/grade-line", map[string]interface{}{
+				"puzzleId":  "p1",
+				"typedSans": []string{"Ra8#"},
+				"sessionId": 1,
+			}, "alice")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+
+			var endedAt *model.Timestamp
+			if err := db.Get(&endedAt, `SELECT ended_at FROM sessions WHERE id = 1`); err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantStatus == 200 {
+				if endedAt != nil {
+					t.Errorf("session within its limit ended at %v", endedAt.Time)
+				}
+				return
+			}
+			if !strings.Contains(rec.Body.String(), "session expired") {
+				t.Errorf("body = %q, want session expired", rec.Body.String())
+			}
+			if want := startedAt.Add(time.Minute).Truncate(time.Second); endedAt == nil || !endedAt.Equal(want) {
+				t.Errorf("ended_at = %v, want %v", endedAt, want)
+			}
+
+			// Once ended the session keeps reporting expiry rather than 409
+			rec = serve(t, r, "POST", "/api/puzzles/grade-line", map[string]interface{}{
+				"puzzleId":  "p1",
+				"typedSans": []string{"Ra8#"},
+				"sessionId": 1,
+			}, "alice")
+			if rec.Code != 410 {
+				t.Errorf("second grade: status %d, want 410", rec.Code)
+			}
+		})
+	}
+}
+
+func TestCreateTimedSession(t *testing.T) {
+	r := newTestRouter(t)
+	seedSession(t, 1, "alice")
+	mustExec(t, `INSERT INTO set_puzzles (set_id, puzzle_id, position) VALUES (1, 'p1', 1)`)
+
+	var session model.Session
+	decodeBody(t, serve(t, r, "POST", "/api/trainer/sessions", map[string]interface{}{
+		"cycle_id":           1,
+		"target_count":       1,
+		"time_limit_seconds": 600,
+	}, "alice"), &session)
+	if session.TimeLimitSeconds == nil || *session.TimeLimitSeconds != 600 {
+		t.Errorf("time limit = %v, want 600", session.TimeLimitSeconds)
+	}
+
+	for _, limit := range []int{0, -5} {
+		rec := serve(t, r, "POST", "/api/trainer/sessions", map[string]interface{}{
+			"cycle_id":           1,
+			"target_count":       1,
+			"time_limit_seconds": limit,
+		}, "alice")
+		if rec.Code != 400 {
+			t.Errorf("time limit %d: status %d, want 400", limit, rec.Code)
+		}
+	}
+}
+
+func TestCreateSessionTargetCount(t *testing.T) {
+	tests := []struct {
+		name   string
+		target int
+		status int
+	}{
+		{"zero", 0, 400},
+		{"negative", -1, 400},
+		{"whole set", 3, 200},
+		{"part of the set", 2, 200},
+		{"more than the set", 4, 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRouter(t)
+			seedSession(t, 1, "alice")
+			mustExec(t, `INSERT INTO set_puzzles (set_id, puzzle_id, position) VALUES (1, 'p1', 1), (1, 'p2', 2), (1, 'p3', 3)`)
+
+			rec := serve(t, r, "POST", "/api/trainer/sessions", map[string]int{"cycle_id": 1, "target_count": tt.target}, "alice")
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.status, rec.Body.String())
+			}
+			var sessions int
+			if err := db.Get(&sessions, `SELECT COUNT(*) FROM sessions WHERE target_count = ?`, tt.target); err != nil {
+				t.Fatal(err)
+			}
+			if created := sessions == 1; created != (tt.status == 200) {
+				t.Errorf("%d sessions stored with target %d", sessions, tt.target)
+			}
+		})
+	}
+
+	r := newTestRouter(t)
+	seedSession(t, 1, "alice")
+	mustExec(t, `INSERT INTO set_puzzles (set_id, puzzle_id, position) VALUES (1, 'p1', 1)`)
+	if rec := serve(t, r, "POST", "/api/trainer/sessions", map[string]int{"cycle_id": 9, "target_count": 1}, "alice"); rec.Code != 404 {
+		t.Errorf("missing cycle: status %d, want 404", rec.Code)
+	}
+	if rec := serve(t, r, "POST", "/api/trainer/sessions", map[string]int{"cycle_id": 1, "target_count": 1}, "bob"); rec.Code != 403 {
+		t.Errorf("another user's cycle: status %d, want 403", rec.Code)
+	}
+}
+
+func TestNextPuzzleContinuesSet(t *testing.T) {
+	tests := []struct {
+		name       string
+		difficulty string
+		graded     []string
+		want       string
+		wantInSet  bool
+	}{
+		{"first of the set", "easy", nil, "p1", true},
+		{"after grading", "easy", []string{"p1"}, "p3", true},
+		{"other difficulty", "intermediate", nil, "p2", true},
+		{"set finished at this difficulty", "easy", []string{"p1", "p3"}, "p0", false},
+		{"no set puzzles at this difficulty", "advanced", nil, "p4", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRouter(t)
+			seedSession(t, 1, "alice")
+			seedPuzzle(t, "p0", "easy")
+			seedPuzzle(t, "p1", "easy")
+			seedPuzzle(t, "p2", "intermediate")
+			seedPuzzle(t, "p3", "easy")
+			seedPuzzle(t, "p4", "advanced")
+			mustExec(t, `INSERT INTO set_puzzles (set_id, puzzle_id, position) VALUES (1, 'p1', 1), (1, 'p2', 2), (1, 'p3', 3)`)
+			for _, id := range tt.graded {
+				decodeBody(t, serve(t, r, "POST", "/api/puzzles/grade-line", map[string]interface{}{
+					"puzzleId":  id,
+					"typedSans": []string{"Ra8#"},
+					"sessionId": 1,
+				}, "alice"), &GradeLineResponse{})
+			}
+
+			var next struct {
+				ID    string `json:"id"`
+				SetID *int   `json:"setId"`
+			}
+			decodeBody(t, serve(t, r, "GET", "/api/puzzles/next?difficulty="+tt.difficulty, nil, "alice"), &next)
+			if next.ID != tt.want || (next.SetID != nil) != tt.wantInSet {
+				t.Errorf("next = %q (in set: %v), want %q (in set: %v)", next.ID, next.SetID != nil, tt.want, tt.wantInSet)
+			}
+		})
+	}
+}
+
+func TestCreateSessionActivatesPlannedCycle(t *testing.T) {
+	r := newTestRouter(t)
+	mustExec(t, `INSERT INTO sets (id, user_id, name, description, difficulty_min, difficulty_max, created_at)
+		VALUES (1, 'alice', 'set', '', 'easy', 'easy', CURRENT_TIMESTAMP)`)
+	mustExec(t, `INSERT INTO set_puzzles (set_id, puzzle_id, position) VALUES (1, 'p1', 1)`)
+	mustExec(t, `INSERT INTO cycles (id, set_id, cycle_index, target_days, status) VALUES (1, 1, 1, 7, 'planned')`)
+	mustExec(t, `INSERT INTO cycles (id, set_id, cycle_index, target_days, status, started_at)
+		VALUES (2, 1, 2, 7, 'active', '2026-01-02 03:04:05')`)
+
+	for _, cycleID := range []int{1, 2} {
+		if rec := serve(t, r, "POST", "/api/trainer/sessions", map[string]int{"cycle_id": cycleID, "target_count": 1}, "alice"); rec.Code != 200 {
+			t.Fatalf("cycle %d: status %d: %s", cycleID, rec.Code, rec.Body.String())
+		}
+	}
+
+	var cycles []struct {
+		Status    string     `db:"status"`
+		StartedAt *time.Time `db:"started_at"`
+	}
+	if err := db.Select(&cycles, `SELECT status, started_at FROM cycles ORDER BY id`); err != nil {
+		t.Fatal(err)
+	}
+	if planned := cycles[0]; planned.Status != "active" || planned.StartedAt == nil {
+		t.Errorf("planned cycle = %s started %v, want active with a start time", planned.Status, planned.StartedAt)
+	}
+	want := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	if active := cycles[1]; active.Status != "active" || active.StartedAt == nil || !active.StartedAt.Equal(want) {
+		t.Errorf("active cycle = %s started %v, want it untouched", active.Status, active.StartedAt)
+	}
+}
@@ -0,0 +1,563 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"woodpecker-online/internal/model"
+	"woodpecker-online/internal/woodpecker"
+)
+
+func TestSetPreviewMatchesCreate(t *testing.T) {
+	tests := []struct {
+		name          string
+		difficultyMin string
+		difficultyMax string
+		size          int
+		want          []string
+	}{
+		{"single difficulty", "intermediate", "intermediate", 10, []string{"i1", "i2"}},
+		{"range", "easy", "intermediate", 10, []string{"e1", "e2", "i1", "i2"}},
+		{"open range", "", "", 10, []string{"a1", "e1", "e2", "i1", "i2"}},
+		{"open upper bound", "intermediate", "", 10, []string{"a1", "i1", "i2"}},
+		{"size limits the set", "easy", "advanced", 2, []string{"a1", "e1"}},
+		{"mixed case", "Easy", "INTERMEDIATE", 10, []string{"e1", "e2", "i1", "i2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRouter(t)
+			for id, difficulty := range map[string]string{
+				"e1": "easy", "e2": "easy", "i1": "intermediate", "i2": "intermediate", "a1": "advanced",
+			} {
+				seedPuzzle(t, id, difficulty)
+			}
+
+			var preview struct {
+				PuzzleIDs []string `json:"puzzleIds"`
+			}
+			path := "/api/trainer/sets/preview?difficultyMin=" + tt.difficultyMin +
+				"&difficultyMax=" + tt.difficultyMax + "&size=" + strconv.Itoa(tt.size)
+			decodeBody(t, serve(t, r, "GET", path, nil, "alice"), &preview)
+			if !reflect.DeepEqual(preview.PuzzleIDs, tt.want) {
+				t.Errorf("preview = %v, want %v", preview.PuzzleIDs, tt.want)
+			}
+
+			var set struct {
+				ID int `json:"id"`
+			}
+			decodeBody(t, serve(t, r, "POST", "/api/trainer/sets", map[string]interface{}{
+				"name":           "set",
+				"difficulty_min": tt.difficultyMin,
+				"difficulty_max": tt.difficultyMax,
+				"size":           tt.size,
+			}, "alice"), &set)
+			var created []string
+			if err := db.Select(&created, `SELECT puzzle_id FROM set_puzzles WHERE set_id = ? ORDER BY position`, set.ID); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(created, preview.PuzzleIDs) {
+				t.Errorf("created set = %v, preview was %v", created, preview.PuzzleIDs)
+			}
+
+			var sets int
+			if err := db.Get(&sets, `SELECT COUNT(*) FROM sets`); err != nil {
+				t.Fatal(err)
+			}
+			if sets != 1 {
+				t.Errorf("%d sets exist, want only the created one", sets)
+			}
+		})
+	}
+}
+
+func TestSetPreviewRejectsInvalidParameters(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"missing size", "difficultyMin=easy&difficultyMax=easy"},
+		{"zero size", "difficultyMin=easy&difficultyMax=easy&size=0"},
+		{"unknown difficulty", "difficultyMin=expert&size=5"},
+		{"inverted range", "difficultyMin=advanced&difficultyMax=easy&size=5"},
+		{"inverted mixed case range", "difficultyMin=Advanced&difficultyMax=EASY&size=5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRouter(t)
+			rec := serve(t, r, "GET", "/api/trainer/sets/preview?"+tt.query, nil, "alice")
+			if rec.Code != 400 {
+				t.Errorf("status = %d, want 400: %s", rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestCreateSetNormalizesDifficulties(t *testing.T) {
+	r := newTestRouter(t)
+	seedPuzzle(t, "p1", "easy")
+
+	rec := serve(t, r, "POST", "/api/trainer/sets", map[string]interface{}{
+		"name":           "set",
+		"difficulty_min": " Easy ",
+		"difficulty_max": "ADVANCED",
+		"size":           1,
+	}, "alice")
+	if rec.Code != 200 && rec.Code != 201 {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+	var set model.Set
+	if err := db.Get(&set, `SELECT * FROM sets`); err != nil {
+		t.Fatal(err)
+	}
+	if set.DifficultyMin != "easy" || set.DifficultyMax != "advanced" {
+		t.Errorf("stored range %q-%q, want easy-advanced", set.DifficultyMin, set.DifficultyMax)
+	}
+
+	rec = serve(t, r, "POST", "/api/trainer/sets", map[string]interface{}{
+		"name":           "set",
+		"difficulty_min": "expert",
+		"size":           1,
+	}, "alice")
+	if rec.Code != 400 || !strings.Contains(rec.Body.String(), "difficulty_min") {
+		t.Errorf("unknown difficulty: status %d %q, want 400 naming difficulty_min", rec.Code, rec.Body.String())
+	}
+}
+
+func TestAppendPuzzlesToSet(t *testing.T) {
+	tests := []struct {
+		name       string
+		userID     string
+		setID      string
+		puzzleIDs  []string
+		wantStatus int
+		want       []string
+	}{
+		{"new puzzles go after the existing ones", "alice", "1", []string{"p4", "p3"}, 200, []string{"p1", "p2", "p4", "p3"}},
+		{"puzzles already in the set are rejected", "alice", "1", []string{"p3", "p2"}, 409, []string{"p1", "p2"}},
+		{"repeated ids are added once", "alice", "1", []string{"p3", "p3"}, 200, []string{"p1", "p2", "p3"}},
+		{"empty list", "alice", "1", []string{}, 400, []string{"p1", "p2"}},
+		{"another user's set", "bob", "1", []string{"p3"}, 403, []string{"p1", "p2"}},
+		{"missing set", "alice", "99", []string{"p3"}, 404, []string{"p1", "p2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRouter(t)
+			seedSession(t, 1, "alice")
+			for _, id := range []string{"p1", "p2", "p3", "p4"} {
+				seedPuzzle(t, id, "easy")
+			}
+			mustExec(t, `INSERT INTO set_puzzles (set_id, puzzle_id, position) VALUES (1, 'p1', 1), (1, 'p2', 2)`)
+
+			rec := serve(t, r, "POST", "/api/trainer/sets/"+tt.setID+"/puzzles", map[string][]string{"puzzleIds": tt.puzzleIDs}, tt.userID)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+
+			var got []string
+			if err := db.Select(&got, `SELECT puzzle_id FROM set_puzzles WHERE set_id = 1 ORDER BY position`); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("set puzzles = %v, want %v", got, tt.want)
+			}
+			if tt.wantStatus != 200 {
+				return
+			}
+
+			var listed []struct {
+				PuzzleID string `json:"puzzle_id"`
+			}
+			decodeBody(t, rec, &listed)
+			if len(listed) != len(tt.want) {
+				t.Errorf("response lists %d puzzles, want %d", len(listed), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestAppendPuzzlesSizeCap(t *testing.T) {
+	previous := maxSetSize
+	maxSetSize = 3
+	t.Cleanup(func() { maxSetSize = previous })
+
+	tests := []struct {
+		name       string
+		puzzleIDs  []string
+		wantStatus int
+		wantSize   int
+	}{
+		{"up to the cap", []string{"p3"}, 200, 3},
+		{"repeated ids count once", []string{"p3", "p3"}, 200, 3},
+		{"new puzzles over the cap", []string{"p3", "p4"}, 400, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRouter(t)
+			seedSession(t, 1, "alice")
+			for _, id := range []string{"p1", "p2", "p3", "p4"} {
+				seedPuzzle(t, id, "easy")
+			}
+			mustExec(t, `INSERT INTO set_puzzles (set_id, puzzle_id, position) VALUES (1, 'p1', 1), (1, 'p2', 2)`)
+
+			rec := serve(t, r, "POST", "/api/trainer/sets/1/puzzles", map[string][]string{"puzzleIds": tt.puzzleIDs}, "alice")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			var size int
+			if err := db.Get(&size, `SELECT COUNT(*) FROM set_puzzles WHERE set_id = 1`); err != nil {
+				t.Fatal(err)
+			}
+			if size != tt.wantSize {
+				t.Errorf("set size = %d, want %d", size, tt.wantSize)
+			}
+		})
+	}
+}
+
+func TestAppendDuplicatePuzzles(t *testing.T) {
+	tests := []struct {
+		name       string
+		puzzleIDs  []string
+		wantStatus int
+		want       []string
+	}{
+		{"new puzzles", []string{"p2", "p3"}, 200, []string{"p1", "p2", "p3"}},
+		{"repeated in the request", []string{"p2", "p2"}, 200, []string{"p1", "p2"}},
+		{"already in the set", []string{"p1"}, 409, []string{"p1"}},
+		{"some already in the set", []string{"p2", "p1", "p3"}, 409, []string{"p1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRouter(t)
+			seedSession(t, 1, "alice")
+			for _, id := range []string{"p1", "p2", "p3"} {
+				seedPuzzle(t, id, "easy")
+			}
+			mustExec(t, `INSERT INTO set_puzzles (set_id, puzzle_id, position) VALUES (1, 'p1', 1)`)
+
+			rec := serve(t, r, "POST", "/api/trainer/sets/1/puzzles", map[string][]string{"puzzleIds": tt.puzzleIDs}, "alice")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			var got []string
+			if err := db.Select(&got, `SELECT puzzle_id FROM set_puzzles WHERE set_id = 1 ORDER BY position`); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("set puzzles = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateSetIsAtomic(t *testing.T) {
+	tests := []struct {
+		name       string
+		failOn     string // puzzle whose insert into the set fails, or ""
+		wantStatus int
+		wantSets   int
+		wantSize   int
+	}{
+		{"success", "", 200, 1, 3},
+		{"failed puzzle insert", "p2", 500, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRouter(t)
+			for _, id := range []string{"p1", "p2", "p3"} {
+				seedPuzzle(t, id, "easy")
+			}
+			if tt.failOn != "" {
+				mustExec(t, `CREATE TRIGGER fail_set_puzzle BEFORE INSERT ON set_puzzles
+					WHEN NEW.puzzle_id = '`+tt.failOn+`' BEGIN SELECT RAISE(ABORT, 'injected failure'); END`)
+			}
+
+			rec := serve(t, r, "POST", "/api/trainer/sets", map[string]interface{}{
+				"name":           "set",
+				"difficulty_min": "easy",
+				"difficulty_max": "easy",
+				"size":           3,
+			}, "alice")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+
+			var sets, size int
+			if err := db.Get(&sets, `SELECT COUNT(*) FROM sets`); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.Get(&size, `SELECT COUNT(*) FROM set_puzzles`); err != nil {
+				t.Fatal(err)
+			}
+			if sets != tt.wantSets || size != tt.wantSize {
+				t.Errorf("sets = %d with %d puzzles, want %d with %d", sets, size, tt.wantSets, tt.wantSize)
+			}
+		})
+	}
+}
+
+func TestSetSizeLimits(t *testing.T) {
+	previous := maxSetSize
+	maxSetSize = 3
+	t.Cleanup(func() { maxSetSize = previous })
+
+	tests := []struct {
+		name       string
+		size       int
+		wantStatus int
+	}{
+		{"zero", 0, 400},
+		{"negative", -1, 400},
+		{"over the cap", 4, 400},
+		{"at the cap", 3, 200},
+		{"valid", 2, 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRouter(t)
+			for _, id := range []string{"p1", "p2", "p3", "p4"} {
+				seedPuzzle(t, id, "easy")
+			}
+
+			preview := serve(t, r, "GET", "/api/trainer/sets/preview?difficultyMin=easy&size="+strconv.Itoa(tt.size), nil, "alice")
+			if preview.Code != tt.wantStatus {
+				t.Errorf("preview status = %d, want %d: %s", preview.Code, tt.wantStatus, preview.Body.String())
+			}
+
+			rec := serve(t, r, "POST", "/api/trainer/sets", map[string]interface{}{
+				"name":           "set",
+				"difficulty_min": "easy",
+				"difficulty_max": "easy",
+				"size":           tt.size,
+			}, "alice")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("create status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+
+			var sets int
+			if err := db.Get(&sets, `SELECT COUNT(*) FROM sets`); err != nil {
+				t.Fatal(err)
+			}
+			if want := boolToInt(tt.wantStatus == 200); sets != want {
+				t.Errorf("%d sets created, want %d", sets, want)
+			}
+		})
+	}
+
+	t.Run("curated list over the cap", func(t *testing.T) {
+		r := newTestRouter(t)
+		seedSession(t, 1, "alice")
+		rec := serve(t, r, "POST", "/api/trainer/sets/1/puzzles", map[string][]string{"puzzleIds": {"a", "b", "c", "d"}}, "alice")
+		if rec.Code != 400 {
+			t.Errorf("status = %d, want 400", rec.Code)
+		}
+	})
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func TestSoftDeleteAndRestoreSet(t *testing.T) {
+	r := newTestRouter(t)
+	seedSession(t, 1, "alice")
+	seedSession(t, 2, "alice")
+	mustExec(t, `INSERT INTO set_puzzles (set_id, puzzle_id, position) VALUES (1, 'p1', 1), (1, 'p2', 2)`)
+	mustExec(t, `INSERT INTO attempts (session_id, puzzle_id) VALUES (1, 'p1')`)
+	mustExec(t, `INSERT INTO collections (id, user_id, name) VALUES (1, 'alice', 'all')`)
+	mustExec(t, `INSERT INTO set_collections (collection_id, set_id) VALUES (1, 1), (1, 2)`)
+
+	listIDs := func(path string) []int {
+		t.Helper()
+		var sets []model.Set
+		decodeBody(t, serve(t, r, "GET", path, nil, "alice"), &sets)
+		ids := []int{}
+		for _, set := range sets {
+			ids = append(ids, set.ID)
+		}
+		sort.Ints(ids)
+		return ids
+	}
+
+	if rec := serve(t, r, "DELETE", "/api/trainer/sets/1", nil, "bob"); rec.Code != 403 {
+		t.Errorf("bob deleting alice's set: status %d, want 403", rec.Code)
+	}
+	if rec := serve(t, r, "DELETE", "/api/trainer/sets/1", nil, "alice"); rec.Code != 204 {
+		t.Fatalf("delete: status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if got := listIDs("/api/trainer/sets"); !reflect.DeepEqual(got, []int{2}) {
+		t.Errorf("default list = %v, want [2]", got)
+	}
+	if got := listIDs("/api/trainer/sets?includeDeleted=true"); !reflect.DeepEqual(got, []int{1, 2}) {
+		t.Errorf("list including deleted = %v, want [1 2]", got)
+	}
+	if got := listIDs("/api/trainer/collections/1/sets"); !reflect.DeepEqual(got, []int{2}) {
+		t.Errorf("collection list = %v, want [2]", got)
+	}
+
+	// The deleted set's history is still there for stats
+	var summaries []CycleSummary
+	decodeBody(t, serve(t, r, "GET", "/api/trainer/sets/1/cycles", nil, "alice"), &summaries)
+	if len(summaries) != 1 || summaries[0].PuzzlesAttempted != 1 || summaries[0].PuzzlesTotal != 2 {
+		t.Errorf("deleted set's cycles = %+v, want one cycle with 1 of 2 attempted", summaries)
+	}
+
+	var restored model.Set
+	decodeBody(t, serve(t, r, "POST", "/api/trainer/sets/1/restore", nil, "alice"), &restored)
+	if restored.ID != 1 || restored.DeletedAt != nil {
+		t.Errorf("restored = %+v, want set 1 without deleted_at", restored)
+	}
+	if got := listIDs("/api/trainer/sets"); !reflect.DeepEqual(got, []int{1, 2}) {
+		t.Errorf("list after restore = %v, want [1 2]", got)
+	}
+	if got := listIDs("/api/trainer/collections/1/sets"); !reflect.DeepEqual(got, []int{1, 2}) {
+		t.Errorf("collection list after restore = %v, want [1 2]", got)
+	}
+}
+
+func TestSetCreatedAtFormat(t *testing.T) {
+	r := newTestRouter(t)
+	seedPuzzle(t, "p1", "easy")
+	// One set gets its created_at from the DB default, the other from the API
+	mustExec(t, `INSERT INTO sets (user_id, name, description, difficulty_min, difficulty_max)
+		VALUES ('alice', 'from the db', '', 'easy', 'easy')`)
+	if rec := serve(t, r, "POST", "/api/trainer/sets", map[string]interface{}{
+		"name":           "from the app",
+		"difficulty_min": "easy",
+		"difficulty_max": "easy",
+		"size":           1,
+	}, "alice"); rec.Code != 200 && rec.Code != 201 {
+		t.Fatalf("create: status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var sets []struct {
+		Name      string `json:"name"`
+		CreatedAt string `json:"created_at"`
+	}
+	decodeBody(t, serve(t, r, "GET", "/api/trainer/sets", nil, "alice"), &sets)
+	if len(sets) != 2 {
+		t.Fatalf("got %d sets, want 2", len(sets))
+	}
+	for _, set := range sets {
+		parsed, err := time.Parse(time.RFC3339, set.CreatedAt)
+		if err != nil || !strings.HasSuffix(set.CreatedAt, "Z") {
+			t.Errorf("%s: created_at %q is not RFC3339 in UTC", set.Name, set.CreatedAt)
+			continue
+		}
+		if age := time.Since(parsed); age < -time.Minute || age > time.Minute {
+			t.Errorf("%s: created_at %q is not now", set.Name, set.CreatedAt)
+		}
+	}
+
+	var stored []string
+	if err := db.Select(&stored, `SELECT CAST(created_at AS TEXT) FROM sets`); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range stored {
+		if _, err := time.Parse("2006-01-02 15:04:05", s); err != nil {
+			t.Errorf("stored created_at %q is not in the CURRENT_TIMESTAMP format", s)
+		}
+	}
+}
+
+func TestSetFromDaily(t *testing.T) {
+	type attempt struct {
+		puzzleID string
+		daysAgo  int
+	}
+	tests := []struct {
+		name       string
+		attempts   []attempt
+		query      string
+		wantStatus int
+		want       []string
+	}{
+		{"date order", []attempt{{"p3", 0}, {"p1", 2}, {"p2", 1}}, "", 200, []string{"p1", "p2", "p3"}},
+		{"same day in attempt order", []attempt{{"p2", 0}, {"p1", 0}}, "", 200, []string{"p2", "p1"}},
+		{"repeated on later days", []attempt{{"p1", 2}, {"p2", 1}, {"p1", 0}}, "", 200, []string{"p1", "p2"}},
+		{"window", []attempt{{"p1", 5}, {"p2", 1}}, "?days=3", 200, []string{"p2"}},
+		{"nothing in window", []attempt{{"p1", 5}}, "?days=3", 404, nil},
+		{"invalid days", nil, "?days=0", 400, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRouter(t)
+			for _, id := range []string{"p1", "p2", "p3"} {
+				seedPuzzle(t, id, "easy")
+			}
+			for _, a := range tt.attempts {
+				mustExec(t, `INSERT INTO daily_attempts (user_id, puzzle_id, day) VALUES ('alice', ?, date('now', '-' || ? || ' days'))`, a.puzzleID, a.daysAgo)
+			}
+			// Another user's attempts stay out of the set
+			mustExec(t, `INSERT INTO daily_attempts (user_id, puzzle_id, day) VALUES ('bob', 'p3', date('now'))`)
+
+			rec := serve(t, r, "POST", "/api/trainer/sets/from-daily"+tt.query, nil, "alice")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus != 200 {
+				return
+			}
+
+			var set struct {
+				ID int `json:"id"`
+			}
+			decodeBody(t, rec, &set)
+			var got []string
+			if err := db.Select(&got, `SELECT puzzle_id FROM set_puzzles WHERE set_id = ? ORDER BY position`, set.ID); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("set puzzles = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGradeRecordsDailyAttempt(t *testing.T) {
+	tests := []struct {
+		name     string
+		puzzleID string
+		want     int
+	}{
+		{"in today's batch", "p1", 1},
+		{"outside today's batch", "p2", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRouter(t)
+			seedPuzzle(t, "p1", "easy")
+			seedPuzzle(t, "p2", "easy")
+			plan, err := json.Marshal(woodpecker.DailyPlan{TodayBatch: []string{"p1"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			mustExec(t, `INSERT INTO daily_plans (user_id, daily_plan_json) VALUES ('alice', ?)`, string(plan))
+
+			// Grading twice on the same day is recorded once
+			for i := 0; i < 2; i++ {
+				decodeBody(t, serve(t, r, "POST", "/api/puzzles/grade-line", map[string]interface{}{
+					"puzzleId":  tt.puzzleID,
+					"typedSans": []string{"Ra8#"},
+				}, "alice"), &GradeLineResponse{})
+			}
+
+			var count int
+			if err := db.Get(&count, `SELECT COUNT(*) FROM daily_attempts WHERE user_id = 'alice'`); err != nil {
+				t.Fatal(err)
+			}
+			if count != tt.want {
+				t.Errorf("daily attempts = %d, want %d", count, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"testing"
+
+	"woodpecker-online/internal/model"
+)
+
+func TestBoardOrientationSetting(t *testing.T) {
+	r := newTestRouter(t)
+
+	var settings model.UserSettings
+	decodeBody(t, serve(t, r, "GET", "/api/me/settings", nil, "alice"), &settings)
+	if settings.BoardOrientation != "auto" {
+		t.Errorf("default orientation = %q, want auto", settings.BoardOrientation)
+	}
+
+	decodeBody(t, serve(t, r, "PUT", "/api/me/settings", map[string]interface{}{
+		"board_orientation": "black",
+	}, "alice"), &settings)
+	if settings.BoardOrientation != "black" {
+		t.Errorf("updated orientation = %q, want black", settings.BoardOrientation)
+	}
+
+	var stored string
+	if err := db.Get(&stored, `SELECT board_orientation FROM user_settings WHERE user_id = 'alice'`); err != nil {
+		t.Fatal(err)
+	}
+	if stored != "black" {
+		t.Errorf("stored orientation = %q, want black", stored)
+	}
+
+	rec := serve(t, r, "PUT", "/api/me/settings", map[string]interface{}{"board_orientation": "sideways"}, "alice")
+	if rec.Code != 400 {
+		t.Errorf("invalid orientation: status %d, want 400", rec.Code)
+	}
+}
+
+func TestNextPuzzleOrientation(t *testing.T) {
+	tests := []struct {
+		name       string
+		preference string
+		fen        string
+		want       string
+	}{
+		{"auto with white to move", "auto", testPuzzleFEN, "white"},
+		{"auto with black to move", "auto", "r3k3/8/8/8/8/8/5PPP/6K1 b q - 0 1", "black"},
+		{"fixed preference overrides side to move", "black", testPuzzleFEN, "black"},
+		{"no settings row", "", "r3k3/8/8/8/8/8/5PPP/6K1 b q - 0 1", "black"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRouter(t)
+			mustExec(t, `INSERT INTO puzzles (id, difficulty, fen, side_to_move, solution_json, ticks_json)
+				VALUES ('p1', 'easy', ?, '', '{"lines":[]}', '[]')`, tt.fen)
+			if tt.preference != "" {
+				mustExec(t, `INSERT INTO user_settings (user_id, board_orientation) VALUES ('alice', ?)`, tt.preference)
+			}
+
+			var puzzle struct {
+				ID          string `json:"id"`
+				Orientation string `json:"orientation"`
+			}
+			decodeBody(t, serve(t, r, "GET", "/api/puzzles/next?difficulty=easy&puzzleId=p1", nil, "alice"), &puzzle)
+			if puzzle.ID != "p1" || puzzle.Orientation != tt.want {
+				t.Errorf("got %+v, want p1 oriented %s", puzzle, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignUpGetsDefaultSettings(t *testing.T) {
+	previous := model.DefaultDailyGoalMinutes
+	t.Cleanup(func() { model.DefaultDailyGoalMinutes = previous })
+	t.Setenv("DEFAULT_DAILY_GOAL_MINUTES", "20")
+	loadConfig()
+
+	r := newTestRouter(t)
+	credentials := map[string]string{"email": "carol@example.com", "password": "secret-password"}
+	if rec := serve(t, r, "POST", "/api/auth/sign-up", credentials, ""); rec.Code != 200 && rec.Code != 201 {
+		t.Fatalf("sign-up: status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var settings model.UserSettings
+	if err := db.Get(&settings, `SELECT s.* FROM user_settings s
+		JOIN users u ON u.id = s.user_id WHERE u.email = 'carol@example.com'`); err != nil {
+		t.Fatalf("no settings stored for the new user: %v", err)
+	}
+	if settings.DailyGoalMinutes != 20 || settings.BoardOrientation != "auto" || settings.Timezone != "UTC" {
+		t.Errorf("new user settings = %+v, want the defaults with a 20 minute goal", settings)
+	}
+}
+
+func TestSignUpSettingsAreUpdatable(t *testing.T) {
+	r := newTestRouter(t)
+	credentials := map[string]string{"email": "dave@example.com", "password": "secret-password"}
+	if rec := serve(t, r, "POST", "/api/auth/sign-up", credentials, ""); rec.Code != 200 && rec.Code != 201 {
+		t.Fatalf("sign-up: status %d: %s", rec.Code, rec.Body.String())
+	}
+	var userID string
+	if err := db.Get(&userID, `SELECT id FROM users WHERE email = 'dave@example.com'`); err != nil {
+		t.Fatal(err)
+	}
+
+	var rows int
+	if err := db.Get(&rows, `SELECT COUNT(*) FROM user_settings WHERE user_id = ?`, userID); err != nil {
+		t.Fatal(err)
+	}
+	if rows != 1 {
+		t.Fatalf("%d settings rows after sign-up, want 1", rows)
+	}
+
+	if rec := serve(t, r, "PUT", "/api/me/settings", map[string]interface{}{"board_orientation": "white"}, userID); rec.Code != 200 {
+		t.Fatalf("update: status %d: %s", rec.Code, rec.Body.String())
+	}
+	var stored string
+	if err := db.Get(&stored, `SELECT board_orientation FROM user_settings WHERE user_id = ?`, userID); err != nil {
+		t.Fatal(err)
+	}
+	if stored != "white" {
+		t.Errorf("stored orientation = %q, want white", stored)
+	}
+}
+
+func TestFailedSettingsInsertRollsBackSignUp(t *testing.T) {
+	r := newTestRouter(t)
+	mustExec(t, `DROP TABLE user_settings`)
+
+	credentials := map[string]string{"email": "erin@example.com", "password": "secret-password"}
+	if rec := serve(t, r, "POST", "/api/auth/sign-up", credentials, ""); rec.Code != 500 {
+		t.Errorf("sign-up without a settings table: status %d, want 500", rec.Code)
+	}
+
+	var users int
+	if err := db.Get(&users, `SELECT COUNT(*) FROM users WHERE email = 'erin@example.com'`); err != nil {
+		t.Fatal(err)
+	}
+	if users != 0 {
+		t.Errorf("%d users left behind by the failed sign-up, want 0", users)
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"woodpecker-online/internal/model"
+)
+
+func TestMotifStats(t *testing.T) {
+	r := newTestRouter(t)
+	seedSession(t, 1, "alice")
+	seedSession(t, 2, "bob")
+	mustExec(t, `INSERT INTO puzzle_tags (puzzle_id, tag) VALUES
+		('p1', 'fork'), ('p2', 'fork'), ('p3', 'back-rank'), ('p4', 'pin'), ('p1', 'pin')`)
+	// fork: 3 of 4 right, back-rank: 0 of 2, pin (p1 and p4): 3 of 3; bob's misses don't count
+	mustExec(t, `INSERT INTO attempts (session_id, puzzle_id, correct_first_move) VALUES
+		(1, 'p1', 1), (1, 'p1', 1), (1, 'p2', 1), (1, 'p2', 0),
+		(1, 'p3', 0), (1, 'p3', 0),
+		(1, 'p4', 1),
+		(1, 'untagged', 0),
+		(2, 'p1', 0), (2, 'p4', 0)`)
+
+	var stats []model.MotifStat
+	decodeBody(t, serve(t, r, "GET", "/api/stats/motifs", nil, "alice"), &stats)
+	want := []model.MotifStat{
+		{Tag: "back-rank", Attempts: 2, Correct: 0, AccuracyPercent: 0},
+		{Tag: "fork", Attempts: 4, Correct: 3, AccuracyPercent: 75},
+		{Tag: "pin", Attempts: 3, Correct: 3, AccuracyPercent: 100},
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("motif stats = %+v, want %+v", stats, want)
+	}
+
+	decodeBody(t, serve(t, r, "GET", "/api/stats/motifs", nil, "carol"), &stats)
+	if len(stats) != 0 {
+		t.Errorf("user without attempts has stats %+v", stats)
+	}
+}
+
+func TestCycleProgression(t *testing.T) {
+	r := newTestRouter(t)
+	mustExec(t, `INSERT INTO sets (id, user_id, name, description, difficulty_min, difficulty_max, created_at)
+		VALUES (1, 'alice', 'set', '', 'easy', 'easy', CURRENT_TIMESTAMP)`)
+	// Cycle 3 is still active so it is left out
+	mustExec(t, `INSERT INTO cycles (id, set_id, cycle_index, target_days, status, ended_at) VALUES
+		(1, 1, 1, 28, 'done', '2026-01-28 00:00:00'),
+		(2, 1, 2, 14, 'done', '2026-02-11 00:00:00'),
+		(3, 1, 3, 7, 'active', NULL)`)
+	mustExec(t, `INSERT INTO sessions (id, cycle_id, target_count) VALUES (1, 1, 2), (2, 1, 2), (3, 2, 2), (4, 3, 2)`)
+	mustExec(t, `INSERT INTO attempts (session_id, puzzle_id, total_points, time_ms) VALUES
+		(1, 'p1', 5, 40000), (2, 'p2', 3, 60000),
+		(3, 'p1', 10, 10000), (3, 'p2', 8, 20000),
+		(4, 'p1', 10, 1000)`)
+
+	var progression []model.CycleProgress
+	decodeBody(t, serve(t, r, "GET", "/api/stats/cycle-progression?setId=1", nil, "alice"), &progression)
+	if len(progression) != 2 {
+		t.Fatalf("got %d cycles, want the 2 done ones", len(progression))
+	}
+	first, second := progression[0], progression[1]
+	if first.Index != 1 || first.Attempts != 2 || first.TotalPoints != 8 || first.AvgTimeMs != 50000 {
+		t.Errorf("cycle 1 = %+v, want 2 attempts, 8 points, 50000ms", first)
+	}
+	if second.Index != 2 || second.Attempts != 2 || second.TotalPoints != 18 || second.AvgTimeMs != 15000 {
+		t.Errorf("cycle 2 = %+v, want 2 attempts, 18 points, 15000ms", second)
+	}
+	if second.AvgTimeMs >= first.AvgTimeMs {
+		t.Errorf("later cycle averaged %dms, not faster than %dms", second.AvgTimeMs, first.AvgTimeMs)
+	}
+
+	for _, tt := range []struct {
+		query  string
+		userID string
+		status int
+	}{
+		{"setId=1", "bob", 403},
+		{"setId=9", "alice", 404},
+		{"setId=x", "alice", 400},
+		{"setId=1", "", 401},
+	} {
+		if rec := serve(t, r, "GET", "/api/stats/cycle-progression?"+tt.query, nil, tt.userID); rec.Code != tt.status {
+			t.Errorf("%s as %q: status %d, want %d", tt.query, tt.userID, rec.Code, tt.status)
+		}
+	}
+}
+
+func TestCompletionStats(t *testing.T) {
+	r := newTestRouter(t)
+	for _, id := range []string{"e1", "e2", "e3"} {
+		seedPuzzle(t, id, "easy")
+	}
+	seedPuzzle(t, "i1", "intermediate")
+	seedPuzzle(t, "i2", "intermediate")
+	// e1 solved, e2 attempted but not solved, i1 solved; bob's progress doesn't count
+	mustExec(t, `INSERT INTO progress (user_id, puzzle_id, attempts, score, solved_at) VALUES
+		('alice', 'e1', 2, 10, CURRENT_TIMESTAMP), ('alice', 'e2', 1, 0, NULL),
+		('alice', 'i1', 1, 10, CURRENT_TIMESTAMP), ('bob', 'e3', 1, 10, CURRENT_TIMESTAMP)`)
+
+	var completion []model.DifficultyCompletion
+	decodeBody(t, serve(t, r, "GET", "/api/stats/completion", nil, "alice"), &completion)
+	want := []model.DifficultyCompletion{
+		{Difficulty: "easy", Total: 3, Attempted: 2, Solved: 1},
+		{Difficulty: "intermediate", Total: 2, Attempted: 1, Solved: 1},
+		{Difficulty: "advanced"},
+	}
+	if !reflect.DeepEqual(completion, want) {
+		t.Errorf("completion = %+v, want %+v", completion, want)
+	}
+
+	if rec := serve(t, r, "GET", "/api/stats/completion", nil, ""); rec.Code != 401 {
+		t.Errorf("anonymous: status %d, want 401", rec.Code)
+	}
+}
+
+func TestActiveDays(t *testing.T) {
+	r := newTestRouter(t)
+	seedSession(t, 1, "alice")
+	seedSession(t, 2, "bob")
+	// Two attempts today, then days 2, 5 and 10 ago; the skip yesterday and bob's attempt don't count
+	mustExec(t, `INSERT INTO attempts (session_id, puzzle_id, started_at, skipped) VALUES
+		(1, 'p1', datetime('now'), 0), (1, 'p2', datetime('now'), 0),
+		(1, 'p3', datetime('now', '-1 days'), 1),
+		(1, 'p4', datetime('now', '-2 days'), 0), (1, 'p5', datetime('now', '-5 days'), 0),
+		(1, 'p6', datetime('now', '-10 days'), 0), (2, 'p7', datetime('now', '-3 days'), 0)`)
+
+	day := func(daysAgo int) string { return time.Now().UTC().AddDate(0, 0, -daysAgo).Format("2006-01-02") }
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"?window=7", []string{day(5), day(2), day(0)}},
+		{"", []string{day(10), day(5), day(2), day(0)}},
+		{"?window=1", []string{day(0)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			var result struct {
+				ActiveDays int      `json:"activeDays"`
+				Dates      []string `json:"dates"`
+			}
+			decodeBody(t, serve(t, r, "GET", "/api/stats/active-days"+tt.query, nil, "alice"), &result)
+			if result.ActiveDays != len(tt.want) || !reflect.DeepEqual(result.Dates, tt.want) {
+				t.Errorf("got %d days %v, want %v", result.ActiveDays, result.Dates, tt.want)
+			}
+		})
+	}
+
+	for _, query := range []string{"?window=0", "?window=367", "?window=week"} {
+		if rec := serve(t, r, "GET", "/api/stats/active-days"+query, nil, "alice"); rec.Code != 400 {
+			t.Errorf("%s: status %d, want 400", query, rec.Code)
+		}
+	}
+}
+
+func TestWoodpeckerGain(t *testing.T) {
+	r := newTestRouter(t)
+	mustExec(t, `INSERT INTO sets (id, user_id, name, description, difficulty_min, difficulty_max, created_at) VALUES
+		(1, 'alice', 'set', '', 'easy', 'easy', CURRENT_TIMESTAMP),
+		(2, 'alice', 'new set', '', 'easy', 'easy', CURRENT_TIMESTAMP)`)
+	// Set 1's active cycle 3 doesn't count; set 2 has only one completed cycle
+	mustExec(t, `INSERT INTO cycles (id, set_id, cycle_index, target_days, status, ended_at) VALUES
+		(1, 1, 1, 28, 'done', '2026-01-28 00:00:00'),
+		(2, 1, 2, 14, 'done', '2026-02-11 00:00:00'),
+		(3, 1, 3, 7, 'active', NULL),
+		(4, 2, 1, 28, 'done', '2026-01-28 00:00:00')`)
+	mustExec(t, `INSERT INTO sessions (id, cycle_id, target_count) VALUES (1, 1, 4), (2, 2, 4), (3, 3, 4), (4, 4, 4)`)
+	// Cycle 1: 2 of 4 right at 40s; cycle 2: 3 of 4 right at 30s
+	mustExec(t, `INSERT INTO attempts (session_id, puzzle_id, correct_first_move, time_ms) VALUES
+		(1, 'p1', 1, 40000), (1, 'p2', 0, 50000), (1, 'p3', 1, 30000), (1, 'p4', 0, 40000),
+		(2, 'p1', 1, 20000), (2, 'p2', 1, 40000), (2, 'p3', 1, 30000), (2, 'p4', 0, 30000),
+		(3, 'p1', 0, 90000),
+		(4, 'p1', 1, 10000)`)
+
+	var gain WoodpeckerGain
+	decodeBody(t, serve(t, r, "GET", "/api/stats/woodpecker-gain?setId=1", nil, "alice"), &gain)
+	want := WoodpeckerGain{
+		SetID:           1,
+		First:           CycleResult{CycleID: 1, Index: 1, Attempts: 4, AccuracyPercent: 50, AvgTimeMs: 40000},
+		Latest:          CycleResult{CycleID: 2, Index: 2, Attempts: 4, AccuracyPercent: 75, AvgTimeMs: 30000},
+		AccuracyGain:    25,
+		TimeGainPercent: 25,
+	}
+	if gain != want {
+		t.Errorf("gain = %+v, want %+v", gain, want)
+	}
+
+	for _, tt := range []struct {
+		query  string
+		userID string
+		status int
+	}{
+		{"setId=2", "alice", 409},
+		{"setId=1", "bob", 403},
+		{"setId=9", "alice", 404},
+		{"setId=x", "alice", 400},
+		{"setId=1", "", 401},
+	} {
+		if rec := serve(t, r, "GET", "/api/stats/woodpecker-gain?"+tt.query, nil, tt.userID); rec.Code != tt.status {
+			t.Errorf("%s as %q: status %d, want %d", tt.query, tt.userID, rec.Code, tt.status)
+		}
+	}
+}
+
+func TestHeatmap(t *testing.T) {
+	r := newTestRouter(t)
+	seedSession(t, 1, "alice")
+	seedSession(t, 2, "bob")
+	// In UTC the late attempts fall on Mar 10 and Dec 31, 2023; in Tokyo (UTC+9) on Mar 11 and
+	// Jan 1, 2024. The skip, the 2025 attempt and bob's attempt never count.
+	mustExec(t, `INSERT INTO attempts (session_id, puzzle_id, started_at, skipped) VALUES
+		(1, 'p1', '2024-03-10 10:00:00', 0), (1, 'p2', '2024-03-10 11:00:00', 0),
+		(1, 'p3', '2024-03-10 23:30:00', 0), (1, 'p4', '2023-12-31 20:00:00', 0),
+		(1, 'p5', '2024-06-01 12:00:00', 1), (1, 'p6', '2025-01-01 12:00:00', 0),
+		(2, 'p7', '2024-03-10 10:00:00', 0)`)
+
+	tests := []struct {
+		timezone string
+		want     map[string]int
+	}{
+		{"UTC", map[string]int{"2024-03-10": 3}},
+		{"Asia/Tokyo", map[string]int{"2024-01-01": 1, "2024-03-10": 2, "2024-03-11": 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.timezone, func(t *testing.T) {
+			mustExec(t, `INSERT INTO user_settings (user_id, timezone) VALUES ('alice', ?)
+				ON CONFLICT(user_id) DO UPDATE SET timezone = excluded.timezone`, tt.timezone)
+
+			var heatmap struct {
+				Year int            `json:"year"`
+				Days map[string]int `json:"days"`
+			}
+			decodeBody(t, serve(t, r, "GET", "/api/stats/heatmap?year=2024", nil, "alice"), &heatmap)
+			if heatmap.Year != 2024 || !reflect.DeepEqual(heatmap.Days, tt.want) {
+				t.Errorf("heatmap = %d %v, want 2024 %v", heatmap.Year, heatmap.Days, tt.want)
+			}
+		})
+	}
+
+	for _, query := range []string{"?year=0", "?year=last"} {
+		if rec := serve(t, r, "GET", "/api/stats/heatmap"+query, nil, "alice"); rec.Code != 400 {
+			t.Errorf("%s: status %d, want 400", query, rec.Code)
+		}
+	}
+	if rec := serve(t, r, "GET", "/api/stats/heatmap", nil, ""); rec.Code != 401 {
+		t.Errorf("anonymous: status %d, want 401", rec.Code)
+	}
+}
+
+func TestRecordsEndpoint(t *testing.T) {
+	tests := []struct {
+		name        string
+		userID      string
+		wantStatus  int
+		wantFastest string
+	}{
+		{"owner", "alice", 200, "p2"},
+		{"another user", "bob", 200, ""},
+		{"anonymous", "", 401, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRouter(t)
+			seedSession(t, 1, "alice")
+			mustExec(t, `INSERT INTO attempts (session_id, puzzle_id, started_at, total_points, time_ms, correct_first_move)
+				VALUES (1, 'p1', CURRENT_TIMESTAMP, 3, 5000, 1), (1, 'p2', CURRENT_TIMESTAMP, 1, 2000, 1)`)
+
+			rec := serve(t, r, "GET", "/api/stats/records", nil, tt.userID)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus != 200 {
+				return
+			}
+
+			var records model.PersonalRecords
+			decodeBody(t, rec, &records)
+			got := ""
+			if records.FastestSolve != nil {
+				got = records.FastestSolve.PuzzleID
+			}
+			if got != tt.wantFastest {
+				t.Errorf("fastest solve = %q, want %q", got, tt.wantFastest)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"woodpecker-online/internal/model"
+	"woodpecker-online/internal/repository"
+)
+
+// Notifier is told about training milestones that integrators may want to react to
+type Notifier interface {
+	CycleCompleted(event CycleCompletedEvent)
+}
+
+// CycleCompletedEvent is sent when one of a user's cycles is marked done
+type CycleCompletedEvent struct {
+	UserID     string               `json:"userId"`
+	SetID      int                  `json:"setId"`
+	CycleIndex int                  `json:"cycleIndex"`
+	Stats      *model.CycleProgress `json:"stats"`
+}
+
+// notifier receives training events. It does nothing unless CYCLE_WEBHOOK_URL is set.
+var notifier Notifier = noopNotifier{}
+
+type noopNotifier struct{}
+
+func (noopNotifier) CycleCompleted(CycleCompletedEvent) {}
+
+// webhookMaxAttempts is how many times a webhook delivery is tried before giving up
+const webhookMaxAttempts = 3
+
+// webhookNotifier POSTs events as JSON to a URL, retrying failed deliveries with a growing delay
+type webhookNotifier struct {
+	url     string
+	client  *http.Client
+	backoff time.Duration
+}
+
+func newWebhookNotifier(url string, timeout time.Duration) *webhookNotifier {
+	return &webhookNotifier{
+		url:     url,
+		client:  &http.Client{Timeout: timeout},
+		backoff: time.Second,
+	}
+}
+
+// CycleCompleted delivers the event in the background so the request that ended the cycle isn't held up
+func (n *webhookNotifier) CycleCompleted(event CycleCompletedEvent) {
+	go func() {
+		if err := n.deliver(event); err != nil {
+			slog.Error("Cycle webhook failed", "user", event.UserID, "set", event.SetID, "cycle", event.CycleIndex, "error", err)
+		}
+	}()
+}
+
+// deliver posts the payload until the receiver answers 2xx or the attempts run out
+func (n *webhookNotifier) deliver(payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = n.post(body)
+		if err == nil || attempt == webhookMaxAttempts {
+			return err
+		}
+		slog.Warn("Retrying webhook", "attempt", attempt, "error", err)
+		time.Sleep(n.backoff * time.Duration(attempt))
+	}
+}
+
+func (n *webhookNotifier) post(body []byte) error {
+	resp, err := n.client.Post(n.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// finishCycle marks a cycle done and tells the notifier, with the cycle's points and solve times.
+// Cycles that are already done are left as they are and not reported again.
+func finishCycle(repo repository.Repository, userID string, cycle *model.Cycle) error {
+	if cycle.Status == "done" {
+		return nil
+	}
+
+	now := model.Now()
+	cycle.Status = "done"
+	cycle.EndedAt = &now
+	if err := repo.UpdateCycle(cycle); err != nil {
+		return err
+	}
+
+	event := CycleCompletedEvent{UserID: userID, SetID: cycle.SetID, CycleIndex: cycle.Index}
+	progression, err := repo.GetCycleProgressionBySetID(cycle.SetID)
+	if err != nil {
+		slog.Warn("Failed to load cycle stats for webhook", "cycle", cycle.ID, "error", err)
+	}
+	for _, stats := range progression {
+		if stats.CycleID == cycle.ID {
+			event.Stats = stats
+		}
+	}
+
+	notifier.CycleCompleted(event)
+	return nil
+}
+
+// completeCycleIfFinished finishes the session's cycle once every puzzle in its set has been
+// attempted. The attempt that got it there is already saved, so failures are only logged.
+func completeCycleIfFinished(repo repository.Repository, userID string, sessionID int) {
+	session, err := repo.GetSessionByID(sessionID)
+	if err != nil {
+		slog.Error("Failed to get session to check cycle completion", "session", sessionID, "error", err)
+		return
+	}
+	cycle, err := repo.GetCycleByID(session.CycleID)
+	if err != nil {
+		slog.Error("Failed to get cycle to check completion", "cycle", session.CycleID, "error", err)
+		return
+	}
+	if cycle.Status == "done" {
+		return
+	}
+
+	total, err := repo.CountPuzzlesInSet(cycle.SetID)
+	if err != nil {
+		slog.Error("Failed to count set puzzles", "set", cycle.SetID, "error", err)
+		return
+	}
+	attempted, err := repo.CountAttemptedPuzzlesInCycle(cycle.ID)
+	if err != nil {
+		slog.Error("Failed to count attempted puzzles", "cycle", cycle.ID, "error", err)
+		return
+	}
+	if total == 0 || attempted < total {
+		return
+	}
+
+	if err := finishCycle(repo, userID, cycle); err != nil {
+		slog.Error("Failed to finish cycle", "cycle", cycle.ID, "error", err)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhookDeliverRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int32
+		wantErr  bool
+		wantHits int32
+	}{
+		{"first try", 0, false, 1},
+		{"after two failures", 2, false, 3},
+		{"gives up", 5, true, webhookMaxAttempts},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var hits atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if hits.Add(1) <= tt.failures {
+					http.Error(w, "unavailable", http.StatusServiceUnavailable)
+				}
+			}))
+			defer srv.Close()
+
+			n := newWebhookNotifier(srv.URL, time.Second)
+			n.backoff = time.Millisecond
+			if err := n.deliver(map[string]int{"setId": 1}); (err != nil) != tt.wantErr {
+				t.Errorf("deliver error = %v, want error %v", err, tt.wantErr)
+			}
+			if got := hits.Load(); got != tt.wantHits {
+				t.Errorf("webhook called %d times, want %d", got, tt.wantHits)
+			}
+		})
+	}
+}
+
+func TestCycleCompletionNotifiesWebhook(t *testing.T) {
+	received := make(chan CycleCompletedEvent, 4)
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first delivery fails, so the event only arrives on the retry
+		if hits.Add(1) == 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q, want application/json", ct)
+		}
+		var event CycleCompletedEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Error(err)
+		}
+		received <- event
+	}))
+	defer srv.Close()
+
+	webhook := newWebhookNotifier(srv.URL, time.Second)
+	webhook.backoff = time.Millisecond
+	previous := notifier
+	notifier = webhook
+	t.Cleanup(func() { notifier = previous })
+
+	r := newTestRouter(t)
+	seedSession(t, 1, "alice")
+	seedPuzzle(t, "p1", "easy")
+	seedPuzzle(t, "p2", "easy")
+	mustExec(t, `INSERT INTO set_puzzles (set_id, puzzle_id, position) VALUES (1, 'p1', 1), (1, 'p2', 2)`)
+
+	grade := func(id string) {
+		rec := serve(t, r, "POST", "/api/puzzles/grade-line", map[string]interface{}{
+			"puzzleId":  id,
+			"typedSans": []string{"Ra8#"},
+			"sessionId": 1,
+			"timeMs":    4000,
+		}, "alice")
+		if rec.Code != 200 {
+			t.Fatalf("grade %s: status %d: %s", id, rec.Code, rec.Body.String())
+		}
+	}
+	status := func() string {
+		var s string
+		if err := db.Get(&s, `SELECT status FROM cycles WHERE id = 1`); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	grade("p1")
+	if s := status(); s != "active" {
+		t.Fatalf("cycle %s after one of two puzzles, want active", s)
+	}
+
+	grade("p2")
+	if s := status(); s != "done" {
+		t.Fatalf("cycle %s after every puzzle, want done", s)
+	}
+	select {
+	case event := <-received:
+		if event.UserID != "alice" || event.SetID != 1 || event.CycleIndex != 1 {
+			t.Errorf("event = %+v, want alice's set 1 cycle 1", event)
+		}
+		if event.Stats == nil || event.Stats.CycleID != 1 || event.Stats.Attempts != 2 || event.Stats.AvgTimeMs != 4000 {
+			t.Errorf("stats = %+v, want 2 attempts averaging 4000ms", event.Stats)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no webhook received for the finished cycle")
+	}
+
+	// Once done, further attempts in the cycle aren't reported again
+	grade("p1")
+	select {
+	case event := <-received:
+		t.Errorf("finished cycle reported again: %+v", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
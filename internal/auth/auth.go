@@ -1,6 +1,9 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"time"
 
@@ -63,6 +66,29 @@ func CheckPasswordHash(password, hash string) bool {
 	return err == nil
 }
 
+// apiKeyPrefix marks API keys so they're recognizable in config files and logs
+const apiKeyPrefix = "wpk_"
+
+// GenerateAPIKey creates a random API key, returning the key, its short display prefix, and its hash.
+// Only the hash and prefix should be stored.
+func GenerateAPIKey() (key, prefix, hash string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", "", err
+	}
+
+	key = apiKeyPrefix + hex.EncodeToString(buf)
+	prefix = key[:len(apiKeyPrefix)+8]
+	return key, prefix, HashAPIKey(key), nil
+}
+
+// HashAPIKey hashes an API key for storage and lookup.
+// Keys are high-entropy random values, so a fast hash is sufficient.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
 // GenerateJWT generates a JWT token for a user
 func GenerateJWT(userID, email string) (string, error) {
 	claims := Claims{
@@ -0,0 +1,16 @@
+package auth
+
+// TokenValidator resolves an auth token to the claims of the user it was issued to. JWTValidator
+// is the only implementation; one backed by stored opaque sessions would allow revoking them.
+type TokenValidator interface {
+	ValidateToken(token string) (*Claims, error)
+}
+
+// JWTValidator accepts the stateless JWTs issued by GenerateJWT. They stay valid until they
+// expire, since nothing is stored that could revoke them.
+type JWTValidator struct{}
+
+// ValidateToken checks the token's signature and expiry
+func (JWTValidator) ValidateToken(token string) (*Claims, error) {
+	return ValidateJWT(token)
+}
@@ -3,7 +3,8 @@ package dev
 import (
 	"encoding/json"
 	"net/http"
-	"strings"
+
+	"woodpecker-online/internal/model"
 
 	"github.com/jmoiron/sqlx"
 )
@@ -44,7 +45,7 @@ func (s *Service) FirstPuzzle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	json.NewEncoder(w).Encode(map[string]any{
-		"id": p.ID, "fen": p.FEN, "sideToMove": extractSideToMove(p.FEN),
+		"id": p.ID, "fen": p.FEN, "sideToMove": model.SideToMove(p.FEN),
 	})
 }
 
@@ -73,7 +74,7 @@ func (s *Service) NextPuzzle(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	json.NewEncoder(w).Encode(map[string]any{
-		"id": p.ID, "fen": p.FEN, "sideToMove": extractSideToMove(p.FEN),
+		"id": p.ID, "fen": p.FEN, "sideToMove": model.SideToMove(p.FEN),
 	})
 }
 
@@ -114,17 +115,3 @@ func (s *Service) GradeFirstMove(w http.ResponseWriter, r *http.Request) {
 		"expectedFirstMoves": want, // for visibility while testing
 	})
 }
-
-// extractSideToMove extracts the side to move from a FEN string
-func extractSideToMove(fen string) string {
-	if fen == "" {
-		return "w" // Default to white if FEN is empty
-	}
-	
-	parts := strings.Fields(fen)
-	if len(parts) >= 2 {
-		return parts[1] // The second part of FEN is the side to move
-	}
-	
-	return "w" // Default to white if FEN is malformed
-}
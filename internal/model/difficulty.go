@@ -0,0 +1,20 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Difficulties lists puzzle difficulties from easiest to hardest
+var Difficulties = []string{"easy", "intermediate", "advanced"}
+
+// NormalizeDifficulty trims and lowercases a difficulty, rejecting values that aren't one of Difficulties
+func NormalizeDifficulty(s string) (string, error) {
+	difficulty := strings.ToLower(strings.TrimSpace(s))
+	for _, d := range Difficulties {
+		if d == difficulty {
+			return difficulty, nil
+		}
+	}
+	return "", fmt.Errorf("invalid difficulty %q: must be easy, intermediate, or advanced", s)
+}
@@ -0,0 +1,25 @@
+package model
+
+import "testing"
+
+func TestNormalizeDifficulty(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"easy", "easy", false},
+		{"Easy", "easy", false},
+		{"  INTERMEDIATE\t", "intermediate", false},
+		{"AdVaNcEd", "advanced", false},
+		{"expert", "", true},
+		{"", "", true},
+		{"easy-ish", "", true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeDifficulty(tt.in)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("NormalizeDifficulty(%q) = %q, %v; want %q, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
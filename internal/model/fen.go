@@ -0,0 +1,81 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FENFields holds the six space-separated fields of a FEN string
+type FENFields struct {
+	Placement      string `json:"placement"`
+	ActiveColor    string `json:"activeColor"`
+	Castling       string `json:"castling"`
+	EnPassant      string `json:"enPassant"`
+	HalfmoveClock  int    `json:"halfmoveClock"`
+	FullmoveNumber int    `json:"fullmoveNumber"`
+}
+
+// ParseFENFields splits a FEN string into its fields.
+// Missing trailing fields fall back to "w - - 0 1", so a placement-only FEN is accepted.
+func ParseFENFields(fen string) (FENFields, error) {
+	fields := FENFields{
+		ActiveColor:    "w",
+		Castling:       "-",
+		EnPassant:      "-",
+		HalfmoveClock:  0,
+		FullmoveNumber: 1,
+	}
+
+	parts := strings.Fields(fen)
+	if len(parts) == 0 {
+		return fields, fmt.Errorf("empty FEN")
+	}
+	if len(parts) > 6 {
+		return fields, fmt.Errorf("FEN has %d fields, expected at most 6", len(parts))
+	}
+
+	fields.Placement = parts[0]
+
+	if len(parts) >= 2 {
+		if parts[1] != "w" && parts[1] != "b" {
+			return fields, fmt.Errorf("invalid active color %q", parts[1])
+		}
+		fields.ActiveColor = parts[1]
+	}
+
+	if len(parts) >= 3 {
+		fields.Castling = parts[2]
+	}
+
+	if len(parts) >= 4 {
+		fields.EnPassant = parts[3]
+	}
+
+	if len(parts) >= 5 {
+		halfmove, err := strconv.Atoi(parts[4])
+		if err != nil || halfmove < 0 {
+			return fields, fmt.Errorf("invalid halfmove clock %q", parts[4])
+		}
+		fields.HalfmoveClock = halfmove
+	}
+
+	if len(parts) == 6 {
+		fullmove, err := strconv.Atoi(parts[5])
+		if err != nil || fullmove < 1 {
+			return fields, fmt.Errorf("invalid fullmove number %q", parts[5])
+		}
+		fields.FullmoveNumber = fullmove
+	}
+
+	return fields, nil
+}
+
+// SideToMove returns the active color ("w" or "b") of a FEN string, defaulting to white if the FEN is malformed
+func SideToMove(fen string) string {
+	fields, err := ParseFENFields(fen)
+	if err != nil {
+		return "w"
+	}
+	return fields.ActiveColor
+}
@@ -0,0 +1,66 @@
+package model
+
+import "testing"
+
+func TestParseFENFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		fen     string
+		want    FENFields
+		wantErr bool
+	}{
+		{"full FEN", "rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq e6 0 2",
+			FENFields{"rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR", "w", "KQkq", "e6", 0, 2}, false},
+		{"move counters", "8/8/8/8/8/8/8/K6k b - - 37 81",
+			FENFields{"8/8/8/8/8/8/8/K6k", "b", "-", "-", 37, 81}, false},
+		{"placement and side only", "6k1/5ppp/8/8/8/8/8/R5K1 b",
+			FENFields{"6k1/5ppp/8/8/8/8/8/R5K1", "b", "-", "-", 0, 1}, false},
+		{"placement only", "6k1/5ppp/8/8/8/8/8/R5K1",
+			FENFields{"6k1/5ppp/8/8/8/8/8/R5K1", "w", "-", "-", 0, 1}, false},
+		{"extra whitespace", "  8/8/8/8/8/8/8/K6k   w  -  - ",
+			FENFields{"8/8/8/8/8/8/8/K6k", "w", "-", "-", 0, 1}, false},
+		{"empty", "", FENFields{}, true},
+		{"invalid side", "8/8/8/8/8/8/8/K6k x", FENFields{}, true},
+		{"invalid halfmove clock", "8/8/8/8/8/8/8/K6k w - - x 1", FENFields{}, true},
+		{"negative halfmove clock", "8/8/8/8/8/8/8/K6k w - - -1 1", FENFields{}, true},
+		{"zero fullmove number", "8/8/8/8/8/8/8/K6k w - - 0 0", FENFields{}, true},
+		{"too many fields", "8/8/8/8/8/8/8/K6k w - - 0 1 extra", FENFields{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFENFields(tt.fen)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseFENFields(%q) = %+v, want an error", tt.fen, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseFENFields(%q): %v", tt.fen, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseFENFields(%q) = %+v, want %+v", tt.fen, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSideToMove(t *testing.T) {
+	tests := []struct {
+		fen  string
+		want string
+	}{
+		{"6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", "w"},
+		{"6k1/5ppp/8/8/8/8/8/R5K1 b", "b"},
+		{"6k1/5ppp/8/8/8/8/8/R5K1", "w"},
+		{"6k1/5ppp/8/8/8/8/8/R5K1 x", "w"},
+		{"", "w"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fen, func(t *testing.T) {
+			if got := SideToMove(tt.fen); got != tt.want {
+				t.Errorf("SideToMove(%q) = %q, want %q", tt.fen, got, tt.want)
+			}
+		})
+	}
+}
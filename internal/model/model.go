@@ -3,8 +3,8 @@ package model
 import (
 	"database/sql/driver"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"strings"
 )
 
 // Line represents a single move line in a chess puzzle solution
@@ -20,6 +20,54 @@ type Solution struct {
 	AcceptedAlternatives [][]string `json:"acceptedAlternatives,omitempty"`
 }
 
+// MainLine returns the moves of the solution's principal line.
+// Seeded solutions store the line flat in Lines; tree-shaped solutions nest replies in
+// Children, in which case the first child is followed at each ply.
+func (s Solution) MainLine() []Line {
+	if !s.IsTree() {
+		return s.Lines
+	}
+
+	var mainLine []Line
+	lines := s.Lines
+	for len(lines) > 0 {
+		mainLine = append(mainLine, lines[0])
+		lines = lines[0].Children
+	}
+	return mainLine
+}
+
+// IsEmpty reports whether the solution has no moves, which leaves a puzzle with nothing to grade against
+func (s Solution) IsEmpty() bool {
+	return len(s.Lines) == 0
+}
+
+// IsTree reports whether the solution nests replies in Children rather than storing a flat line
+func (s Solution) IsTree() bool {
+	for _, line := range s.Lines {
+		if len(line.Children) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// TickSANs collects the SAN of every move flagged IsTick, walking the whole tree depth-first
+func (s Solution) TickSANs() []string {
+	ticks := []string{}
+	var walk func(lines []Line)
+	walk = func(lines []Line) {
+		for _, line := range lines {
+			if line.IsTick {
+				ticks = append(ticks, line.SAN)
+			}
+			walk(line.Children)
+		}
+	}
+	walk(s.Lines)
+	return ticks
+}
+
 // Puzzle represents a chess puzzle with its solution
 type Puzzle struct {
 	ID         string   `json:"id"`
@@ -32,6 +80,10 @@ type Puzzle struct {
 // SolutionJSON is a custom type for database storage of Solution
 type SolutionJSON struct {
 	Solution
+	// Valid is false when the stored value is NULL
+	Valid bool
+	// ParseErr is set when the stored value is not valid solution JSON
+	ParseErr error
 }
 
 // Value implements driver.Valuer for database storage
@@ -42,19 +94,31 @@ func (sj SolutionJSON) Value() (driver.Value, error) {
 	return json.Marshal(sj.Solution)
 }
 
-// Scan implements sql.Scanner for database retrieval
+// Scan implements sql.Scanner for database retrieval.
+// Malformed JSON is recorded in ParseErr rather than failing the whole row scan.
 func (sj *SolutionJSON) Scan(value interface{}) error {
-	if value == nil {
-		sj.Solution = Solution{}
-		return nil
-	}
+	sj.Solution = Solution{}
+	sj.Valid = false
+	sj.ParseErr = nil
 
-	bytes, ok := value.([]byte)
-	if !ok {
+	var bytes []byte
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
 		return fmt.Errorf("expected []byte, got %T", value)
 	}
 
-	return json.Unmarshal(bytes, &sj.Solution)
+	sj.Valid = true
+	if err := json.Unmarshal(bytes, &sj.Solution); err != nil {
+		sj.Solution = Solution{}
+		sj.ParseErr = err
+	}
+	return nil
 }
 
 // TicksJSON is a custom type for database storage of Ticks
@@ -72,17 +136,17 @@ func (tj TicksJSON) Value() (driver.Value, error) {
 
 // Scan implements sql.Scanner for database retrieval
 func (tj *TicksJSON) Scan(value interface{}) error {
-	if value == nil {
+	switch v := value.(type) {
+	case nil:
 		tj.Ticks = []string{}
 		return nil
-	}
-
-	bytes, ok := value.([]byte)
-	if !ok {
+	case []byte:
+		return json.Unmarshal(v, &tj.Ticks)
+	case string:
+		return json.Unmarshal([]byte(v), &tj.Ticks)
+	default:
 		return fmt.Errorf("expected []byte, got %T", value)
 	}
-
-	return json.Unmarshal(bytes, &tj.Ticks)
 }
 
 // PuzzleDB represents the database structure for puzzles
@@ -95,6 +159,17 @@ type PuzzleDB struct {
 	TicksJSON    TicksJSON    `db:"ticks_json"`
 }
 
+// ErrSolutionCorrupt is returned when a puzzle's stored solution JSON can't be parsed
+var ErrSolutionCorrupt = errors.New("puzzle solution corrupt")
+
+// CheckSolution reports ErrSolutionCorrupt if the stored solution failed to parse
+func (pdb *PuzzleDB) CheckSolution() error {
+	if pdb.SolutionJSON.ParseErr != nil {
+		return fmt.Errorf("%w: %v", ErrSolutionCorrupt, pdb.SolutionJSON.ParseErr)
+	}
+	return nil
+}
+
 // ToPuzzle converts PuzzleDB to Puzzle
 func (pdb *PuzzleDB) ToPuzzle() *Puzzle {
 	return &Puzzle{
@@ -112,43 +187,48 @@ func FromPuzzle(puzzle *Puzzle) *PuzzleDB {
 		ID:           puzzle.ID,
 		Difficulty:   puzzle.Difficulty,
 		FEN:          puzzle.FEN,
-		SideToMove:   extractSideToMove(puzzle.FEN),
+		SideToMove:   SideToMove(puzzle.FEN),
 		SolutionJSON: SolutionJSON{Solution: puzzle.Solution},
 		TicksJSON:    TicksJSON{Ticks: puzzle.Ticks},
 	}
 }
 
-// extractSideToMove extracts the side to move from a FEN string
-func extractSideToMove(fen string) string {
-	if fen == "" {
-		return "w" // Default to white if FEN is empty
-	}
-
-	parts := strings.Fields(fen)
-	if len(parts) >= 2 {
-		return parts[1] // The second part of FEN is the side to move
-	}
-
-	return "w" // Default to white if FEN is malformed
+// PuzzleCatalogStats summarizes how complete the puzzle catalog is
+type PuzzleCatalogStats struct {
+	Total           int            `db:"total" json:"total"`
+	WithSolution    int            `db:"with_solution" json:"with_solution"`
+	MissingSolution int            `db:"missing_solution" json:"missing_solution"`
+	WithTicks       int            `db:"with_ticks" json:"with_ticks"`
+	ByDifficulty    map[string]int `db:"-" json:"by_difficulty"`
 }
 
 // User represents a user in the system
 type User struct {
-	ID           string `db:"id" json:"id"`
-	Email        string `db:"email" json:"email"`
-	PasswordHash string `db:"password_hash" json:"-"`
-	CreatedAt    string `db:"created_at" json:"created_at"`
+	ID           string    `db:"id" json:"id"`
+	Email        string    `db:"email" json:"email"`
+	PasswordHash string    `db:"password_hash" json:"-"`
+	CreatedAt    Timestamp `db:"created_at" json:"created_at"`
 }
 
 // Set represents a collection of puzzles for the Woodpecker Method
 type Set struct {
-	ID            int    `db:"id" json:"id"`
-	UserID        string `db:"user_id" json:"user_id"`
-	Name          string `db:"name" json:"name"`
-	Description   string `db:"description" json:"description"`
-	DifficultyMin string `db:"difficulty_min" json:"difficulty_min"`
-	DifficultyMax string `db:"difficulty_max" json:"difficulty_max"`
-	CreatedAt     string `db:"created_at" json:"created_at"`
+	ID            int       `db:"id" json:"id"`
+	UserID        string    `db:"user_id" json:"user_id"`
+	Name          string    `db:"name" json:"name"`
+	Description   string    `db:"description" json:"description"`
+	DifficultyMin string    `db:"difficulty_min" json:"difficulty_min"`
+	DifficultyMax string    `db:"difficulty_max" json:"difficulty_max"`
+	CreatedAt     Timestamp `db:"created_at" json:"created_at"`
+	// DeletedAt is set when the set has been soft-deleted
+	DeletedAt *Timestamp `db:"deleted_at" json:"deleted_at,omitempty"`
+}
+
+// SetOverview is a set joined with its active cycle (nil if none) and progress counts
+type SetOverview struct {
+	Set
+	PuzzlesTotal     int    `json:"puzzles_total"`
+	ActiveCycle      *Cycle `json:"active_cycle"`
+	PuzzlesAttempted int    `json:"puzzles_attempted"` // within the active cycle
 }
 
 // SetPuzzle represents the relationship between a set and a puzzle with position
@@ -160,36 +240,108 @@ type SetPuzzle struct {
 
 // Cycle represents a cycle in the Woodpecker Method
 type Cycle struct {
-	ID         int     `db:"id" json:"id"`
-	SetID      int     `db:"set_id" json:"set_id"`
-	Index      int     `db:"cycle_index" json:"index"`
-	TargetDays int     `db:"target_days" json:"target_days"`
-	StartedAt  *string `db:"started_at" json:"started_at"`
-	EndedAt    *string `db:"ended_at" json:"ended_at"`
-	Status     string  `db:"status" json:"status"` // planned|active|rest|done
+	ID         int        `db:"id" json:"id"`
+	SetID      int        `db:"set_id" json:"set_id"`
+	Index      int        `db:"cycle_index" json:"index"`
+	TargetDays int        `db:"target_days" json:"target_days"`
+	StartedAt  *Timestamp `db:"started_at" json:"started_at"`
+	EndedAt    *Timestamp `db:"ended_at" json:"ended_at"`
+	Status     string     `db:"status" json:"status"` // planned|active|rest|done
+	Name       string     `db:"name" json:"name"`
+	Notes      string     `db:"notes" json:"notes"`
 }
 
 // Session represents a solving session within a cycle
 type Session struct {
-	ID          int     `db:"id" json:"id"`
-	CycleID     int     `db:"cycle_id" json:"cycle_id"`
-	StartedAt   *string `db:"started_at" json:"started_at"`
-	EndedAt     *string `db:"ended_at" json:"ended_at"`
-	TargetCount int     `db:"target_count" json:"target_count"`
+	ID          int        `db:"id" json:"id"`
+	CycleID     int        `db:"cycle_id" json:"cycle_id"`
+	StartedAt   *Timestamp `db:"started_at" json:"started_at"`
+	EndedAt     *Timestamp `db:"ended_at" json:"ended_at"`
+	TargetCount int        `db:"target_count" json:"target_count"`
+	// TimeLimitSeconds is nil for untimed sessions
+	TimeLimitSeconds *int `db:"time_limit_seconds" json:"time_limit_seconds"`
 }
 
 // Attempt represents a single puzzle attempt within a session
 type Attempt struct {
-	ID               int     `db:"id" json:"id"`
-	SessionID        int     `db:"session_id" json:"session_id"`
-	PuzzleID         string  `db:"puzzle_id" json:"puzzle_id"`
-	StartedAt        *string `db:"started_at" json:"started_at"`
-	EndedAt          *string `db:"ended_at" json:"ended_at"`
-	ScoreFirstMove   int     `db:"score_first_move" json:"score_first_move"`
-	ScoreTicks       int     `db:"score_ticks" json:"score_ticks"`
-	TotalPoints      int     `db:"total_points" json:"total_points"`
-	TimeMs           int     `db:"time_ms" json:"time_ms"`
-	CorrectFirstMove bool    `db:"correct_first_move" json:"correct_first_move"`
+	ID               int        `db:"id" json:"id"`
+	SessionID        int        `db:"session_id" json:"session_id"`
+	PuzzleID         string     `db:"puzzle_id" json:"puzzle_id"`
+	StartedAt        *Timestamp `db:"started_at" json:"started_at"`
+	EndedAt          *Timestamp `db:"ended_at" json:"ended_at"`
+	ScoreFirstMove   int        `db:"score_first_move" json:"score_first_move"`
+	ScoreTicks       int        `db:"score_ticks" json:"score_ticks"`
+	TotalPoints      int        `db:"total_points" json:"total_points"`
+	TimeMs           int        `db:"time_ms" json:"time_ms"`
+	CorrectFirstMove bool       `db:"correct_first_move" json:"correct_first_move"`
+	HintsUsed        int        `db:"hints_used" json:"hints_used"`
+	// Skipped attempts score nothing and are left out of accuracy
+	Skipped bool `db:"skipped" json:"skipped"`
+}
+
+// MotifStat is a user's first-move accuracy on puzzles carrying one tag
+type MotifStat struct {
+	Tag             string `db:"tag" json:"tag"`
+	Attempts        int    `db:"attempts" json:"attempts"`
+	Correct         int    `db:"correct" json:"correct"`
+	AccuracyPercent int    `db:"accuracy_percent" json:"accuracy_percent"`
+}
+
+// AttemptRecord is one of a user's personal bests: the attempt's value and the puzzle it was on
+type AttemptRecord struct {
+	PuzzleID  string     `db:"puzzle_id" json:"puzzle_id"`
+	Value     int        `db:"value" json:"value"`
+	StartedAt *Timestamp `db:"started_at" json:"started_at"`
+}
+
+// PersonalRecords holds a user's fastest and slowest correct solves (in milliseconds) and their
+// highest-scoring attempt. Each is nil until the user has a qualifying attempt.
+type PersonalRecords struct {
+	FastestSolve  *AttemptRecord `json:"fastest_solve"`
+	LongestSolve  *AttemptRecord `json:"longest_solve"`
+	HighestPoints *AttemptRecord `json:"highest_points"`
+}
+
+// DifficultyCompletion counts how many puzzles of one difficulty a user has attempted and solved
+type DifficultyCompletion struct {
+	Difficulty string `db:"difficulty" json:"difficulty"`
+	Total      int    `db:"total" json:"total"`
+	Attempted  int    `db:"attempted" json:"attempted"`
+	Solved     int    `db:"solved" json:"solved"`
+}
+
+// CycleProgress sums up one completed cycle of a set, for comparing repetitions
+type CycleProgress struct {
+	CycleID     int        `db:"cycle_id" json:"cycle_id"`
+	Index       int        `db:"cycle_index" json:"index"`
+	EndedAt     *Timestamp `db:"ended_at" json:"ended_at"`
+	Attempts    int        `db:"attempts" json:"attempts"`
+	Correct     int        `db:"correct" json:"correct"` // attempts with a correct first move
+	TotalPoints int        `db:"total_points" json:"total_points"`
+	AvgTimeMs   int        `db:"avg_time_ms" json:"avg_time_ms"`
+}
+
+// ActivityEvent is one entry in a user's activity feed
+type ActivityEvent struct {
+	Type       string    `db:"type" json:"type"` // set_created|cycle_started|cycle_completed|session_finished|puzzle_solved
+	OccurredAt Timestamp `db:"occurred_at" json:"occurred_at"`
+	SetID      int       `db:"set_id" json:"set_id"`
+	SetName    string    `db:"set_name" json:"set_name"`
+	CycleIndex *int      `db:"cycle_index" json:"cycle_index,omitempty"`
+	SessionID  *int      `db:"session_id" json:"session_id,omitempty"`
+	PuzzleID   *string   `db:"puzzle_id" json:"puzzle_id,omitempty"`
+	TimeMs     *int      `db:"time_ms" json:"time_ms,omitempty"` // set for puzzle_solved: the new best time
+}
+
+// PuzzleReview is when an attempted puzzle is next due for review, with the spaced repetition
+// state it was scheduled from. NextReviewAt is nil for puzzles graded before scheduling existed.
+type PuzzleReview struct {
+	PuzzleID     string     `db:"puzzle_id" json:"puzzle_id"`
+	Attempts     int        `db:"attempts" json:"attempts"`
+	IntervalDays int        `db:"interval_days" json:"interval_days"`
+	Ease         float64    `db:"ease" json:"ease"`
+	NextReviewAt *Timestamp `db:"next_review_at" json:"next_review_at"`
+	Due          bool       `db:"due" json:"due"`
 }
 
 // UserSettings represents user preferences and settings
@@ -198,4 +350,73 @@ type UserSettings struct {
 	DailyGoalMinutes int    `db:"daily_goal_minutes" json:"daily_goal_minutes"`
 	RemindersEnabled bool   `db:"reminders_enabled" json:"reminders_enabled"`
 	Timezone         string `db:"timezone" json:"timezone"`
-}
\ No newline at end of file
+	BoardOrientation string `db:"board_orientation" json:"board_orientation"` // white|black|auto
+	// DifficultyGoalMinutes overrides DailyGoalMinutes for the difficulties it lists
+	DifficultyGoalMinutes DifficultyGoalsJSON `db:"difficulty_goal_minutes" json:"difficulty_goal_minutes"`
+}
+
+// GoalMinutesFor returns the user's daily goal for a difficulty, falling back to the global goal
+func (s *UserSettings) GoalMinutesFor(difficulty string) int {
+	if minutes, ok := s.DifficultyGoalMinutes[difficulty]; ok {
+		return minutes
+	}
+	return s.DailyGoalMinutes
+}
+
+// DifficultyGoalsJSON is a custom type for database storage of daily goals in minutes by difficulty
+type DifficultyGoalsJSON map[string]int
+
+// Value implements driver.Valuer for database storage. No goals are stored as NULL.
+func (g DifficultyGoalsJSON) Value() (driver.Value, error) {
+	if len(g) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(map[string]int(g))
+}
+
+// Scan implements sql.Scanner for database retrieval
+func (g *DifficultyGoalsJSON) Scan(value interface{}) error {
+	*g = DifficultyGoalsJSON{}
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(v, g)
+	case string:
+		return json.Unmarshal([]byte(v), g)
+	default:
+		return fmt.Errorf("expected []byte, got %T", value)
+	}
+}
+
+// DefaultDailyGoalMinutes is the daily goal given to new users (DEFAULT_DAILY_GOAL_MINUTES, default 30)
+var DefaultDailyGoalMinutes = 30
+
+// DefaultUserSettings returns the settings a new user starts with
+func DefaultUserSettings(userID string) *UserSettings {
+	return &UserSettings{
+		UserID:                userID,
+		DailyGoalMinutes:      DefaultDailyGoalMinutes,
+		RemindersEnabled:      true,
+		Timezone:              "UTC",
+		BoardOrientation:      "auto",
+		DifficultyGoalMinutes: DifficultyGoalsJSON{},
+	}
+}
+
+// APIKey represents a user's key for programmatic API access; only its hash is stored
+type APIKey struct {
+	ID        int       `db:"id" json:"id"`
+	UserID    string    `db:"user_id" json:"user_id"`
+	Prefix    string    `db:"prefix" json:"prefix"`
+	KeyHash   string    `db:"key_hash" json:"-"`
+	CreatedAt Timestamp `db:"created_at" json:"created_at"`
+}
+
+// Collection groups a user's sets, e.g. "Mating Patterns" or "Endgames"
+type Collection struct {
+	ID        int       `db:"id" json:"id"`
+	UserID    string    `db:"user_id" json:"user_id"`
+	Name      string    `db:"name" json:"name"`
+	CreatedAt Timestamp `db:"created_at" json:"created_at"`
+}
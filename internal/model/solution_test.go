@@ -0,0 +1,46 @@
+package model
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSolutionJSONScan(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     interface{}
+		wantValid bool
+		wantLines int
+		wantErr   bool
+	}{
+		{"null", nil, false, 0, false},
+		{"bytes", []byte(`{"lines":[{"san":"Ra8#"}]}`), true, 1, false},
+		{"string", `{"lines":[{"san":"Ra8#"},{"san":"Rb8"}]}`, true, 2, false},
+		{"broken", `{"lines":[{"san":`, true, 0, true},
+		{"wrong shape", `{"lines":"Ra8#"}`, true, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Start from a populated value to check Scan resets it
+			sj := SolutionJSON{Solution: Solution{Lines: []Line{{SAN: "Qh5"}}}, Valid: true}
+			if err := sj.Scan(tt.value); err != nil {
+				t.Fatalf("Scan: %v", err)
+			}
+			if sj.Valid != tt.wantValid || len(sj.Lines) != tt.wantLines || (sj.ParseErr != nil) != tt.wantErr {
+				t.Errorf("got valid=%v lines=%d err=%v, want valid=%v lines=%d err=%v",
+					sj.Valid, len(sj.Lines), sj.ParseErr, tt.wantValid, tt.wantLines, tt.wantErr)
+			}
+
+			pdb := PuzzleDB{SolutionJSON: sj}
+			if err := pdb.CheckSolution(); errors.Is(err, ErrSolutionCorrupt) != tt.wantErr {
+				t.Errorf("CheckSolution = %v, want corrupt = %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	var sj SolutionJSON
+	if err := sj.Scan(42); err == nil {
+		t.Error("Scan(42) succeeded, want an error")
+	}
+}
@@ -0,0 +1,91 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// dbTimeFormat is SQLite's CURRENT_TIMESTAMP format, always in UTC
+const dbTimeFormat = "2006-01-02 15:04:05"
+
+// timestampLayouts are the formats a stored timestamp may be in: the DB default, and RFC3339
+// from rows written by app code before timestamps were normalized
+var timestampLayouts = []string{
+	dbTimeFormat,
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05.999999999-07:00",
+}
+
+// Timestamp is a point in time stored in SQLite's UTC CURRENT_TIMESTAMP format and serialized
+// to JSON as RFC3339 in UTC, so app-set and DB-default values look the same in the API
+type Timestamp struct {
+	time.Time
+}
+
+// NewTimestamp wraps t, truncated to the second precision the database keeps
+func NewTimestamp(t time.Time) Timestamp {
+	return Timestamp{Time: t.UTC().Truncate(time.Second)}
+}
+
+// Now is the current time as a Timestamp
+func Now() Timestamp {
+	return NewTimestamp(time.Now())
+}
+
+// ParseTimestamp parses any of the stored timestamp formats; values without a zone are UTC
+func ParseTimestamp(s string) (Timestamp, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return NewTimestamp(t), nil
+		}
+	}
+	return Timestamp{}, fmt.Errorf("invalid timestamp %q", s)
+}
+
+// Value implements driver.Valuer for database storage
+func (ts Timestamp) Value() (driver.Value, error) {
+	return ts.UTC().Format(dbTimeFormat), nil
+}
+
+// Scan implements sql.Scanner for database retrieval
+func (ts *Timestamp) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case time.Time:
+		*ts = NewTimestamp(v)
+		return nil
+	case string:
+		parsed, err := ParseTimestamp(v)
+		*ts = parsed
+		return err
+	case []byte:
+		parsed, err := ParseTimestamp(string(v))
+		*ts = parsed
+		return err
+	default:
+		return fmt.Errorf("expected time or string, got %T", value)
+	}
+}
+
+// MarshalJSON formats the timestamp as RFC3339 in UTC
+func (ts Timestamp) MarshalJSON() ([]byte, error) {
+	return json.Marshal(ts.UTC().Format(time.RFC3339))
+}
+
+// UnmarshalJSON accepts RFC3339 or the database format
+func (ts *Timestamp) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := ParseTimestamp(s)
+	if err != nil {
+		return err
+	}
+	*ts = parsed
+	return nil
+}
@@ -0,0 +1,48 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestTimestampFormats(t *testing.T) {
+	want := time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC)
+	for _, stored := range []string{
+		"2024-03-01 10:30:00",
+		"2024-03-01T10:30:00Z",
+		"2024-03-01T12:30:00+02:00",
+		"2024-03-01T10:30:00.75Z",
+		"2024-03-01T10:30:00",
+	} {
+		var ts Timestamp
+		if err := ts.Scan(stored); err != nil {
+			t.Errorf("Scan(%q): %v", stored, err)
+			continue
+		}
+		if !ts.Equal(want) {
+			t.Errorf("Scan(%q) = %v, want %v", stored, ts.Time, want)
+		}
+
+		data, err := json.Marshal(ts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != `"2024-03-01T10:30:00Z"` {
+			t.Errorf("%q marshals to %s, want \"2024-03-01T10:30:00Z\"", stored, data)
+		}
+
+		value, err := ts.Value()
+		if err != nil || value != "2024-03-01 10:30:00" {
+			t.Errorf("%q stores as %v (%v), want the CURRENT_TIMESTAMP format", stored, value, err)
+		}
+	}
+
+	var ts Timestamp
+	if err := ts.Scan("yesterday"); err == nil {
+		t.Error("Scan accepted an invalid timestamp")
+	}
+	if err := json.Unmarshal([]byte(`"2024-03-01T12:30:00+02:00"`), &ts); err != nil || !ts.Equal(want) {
+		t.Errorf("UnmarshalJSON = %v, %v; want %v", ts.Time, err, want)
+	}
+}
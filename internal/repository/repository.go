@@ -1,9 +1,24 @@
 package repository
 
 import (
+	"errors"
+	"time"
+
 	"woodpecker-online/internal/model"
 )
 
+// ErrNotFound is returned by getters when no row matches
+var ErrNotFound = errors.New("not found")
+
+// ErrIdempotencyKeyReused is returned when an idempotency key is replayed with a different request
+var ErrIdempotencyKeyReused = errors.New("idempotency key reused with a different request")
+
+// ErrPuzzleAlreadyInSet is returned by AddPuzzleToSet and AppendPuzzlesToSet when the set already holds a puzzle
+var ErrPuzzleAlreadyInSet = errors.New("puzzle already in set")
+
+// ErrCycleSetMismatch is returned by MoveSessionsToCycle when the sessions belong to another set
+var ErrCycleSetMismatch = errors.New("sessions belong to a different set")
+
 // Repository defines the interface for all repository operations
 type Repository interface {
 	UserRepository
@@ -12,6 +27,9 @@ type Repository interface {
 	SessionRepository
 	AttemptRepository
 	UserSettingsRepository
+	APIKeyRepository
+	CollectionRepository
+	PuzzleRepository
 }
 
 // UserRepository defines operations for user management
@@ -21,18 +39,26 @@ type UserRepository interface {
 	GetUserByEmail(email string) (*model.User, error)
 	UpdateUser(user *model.User) error
 	DeleteUser(id string) error
+	GetActivityByUserID(userID string, limit int) ([]*model.ActivityEvent, error)
+	GetReviewScheduleByUserID(userID string) ([]*model.PuzzleReview, error)
+	MergeUserData(fromUserID, toUserID string) (map[string]int, error)
 }
 
 // SetRepository defines operations for set management
 type SetRepository interface {
 	CreateSet(set *model.Set) error
 	GetSetByID(id int) (*model.Set, error)
-	GetSetsByUserID(userID string) ([]*model.Set, error)
+	GetSetsByUserID(userID string, includeDeleted bool) ([]*model.Set, error)
 	UpdateSet(set *model.Set) error
 	DeleteSet(id int) error
+	RestoreSet(id int) error
 	AddPuzzleToSet(setID int, puzzleID string, position int) error
+	AppendPuzzlesToSet(setID int, puzzleIDs []string) error
+	CreateSetWithPuzzles(set *model.Set, puzzleIDs []string) error
 	GetPuzzlesInSet(setID int) ([]*model.SetPuzzle, error)
 	RemovePuzzleFromSet(setID int, puzzleID string) error
+	CountPuzzlesInSet(setID int) (int, error)
+	GetSetOverviewsByUserID(userID string) ([]*model.SetOverview, error)
 }
 
 // CycleRepository defines operations for cycle management
@@ -43,6 +69,9 @@ type CycleRepository interface {
 	UpdateCycle(cycle *model.Cycle) error
 	DeleteCycle(id int) error
 	GetActiveCycleBySetID(setID int) (*model.Cycle, error)
+	CountAttemptedPuzzlesInCycle(cycleID int) (int, error)
+	GetCycleProgressionBySetID(setID int) ([]*model.CycleProgress, error)
+	GetNextUnattemptedSetPuzzle(cycleID int, difficulty string) (*model.SetPuzzle, error)
 }
 
 // SessionRepository defines operations for session management
@@ -53,6 +82,9 @@ type SessionRepository interface {
 	UpdateSession(session *model.Session) error
 	DeleteSession(id int) error
 	GetActiveSessionByCycleID(cycleID int) (*model.Session, error)
+	GetOpenSessionByUserID(userID string) (*model.Session, error)
+	CreateSessionWithIdempotencyKey(session *model.Session, userID, key, fingerprint string, window time.Duration) (bool, error)
+	MoveSessionsToCycle(fromCycleID, toCycleID int) (int, error)
 }
 
 // AttemptRepository defines operations for attempt management
@@ -63,6 +95,16 @@ type AttemptRepository interface {
 	UpdateAttempt(attempt *model.Attempt) error
 	DeleteAttempt(id int) error
 	GetAttemptsByPuzzleID(puzzleID string) ([]*model.Attempt, error)
+	DeleteAttemptsBefore(userID string, before time.Time) (int, error)
+	GetMotifStatsByUserID(userID string) ([]*model.MotifStat, error)
+	GetSolveTimesByPuzzleID(puzzleID string) ([]int, error)
+	GetBestSolveTime(userID, puzzleID string) (*int, error)
+	GetScoresByPuzzleID(puzzleID string) ([]int, error)
+	GetBestScore(userID, puzzleID string) (*int, error)
+	HasAttemptedPuzzle(userID, puzzleID string) (bool, error)
+	GetAttemptTimesSince(userID string, since time.Time) ([]model.Timestamp, error)
+	GetPersonalRecords(userID string) (*model.PersonalRecords, error)
+	GetSolveTimeByDifficultySince(userID string, since time.Time) (map[string]int, error)
 }
 
 // UserSettingsRepository defines operations for user settings management
@@ -70,5 +112,33 @@ type UserSettingsRepository interface {
 	CreateUserSettings(settings *model.UserSettings) error
 	GetUserSettingsByUserID(userID string) (*model.UserSettings, error)
 	UpdateUserSettings(settings *model.UserSettings) error
+	UpsertUserSettings(settings *model.UserSettings) error
 	DeleteUserSettings(userID string) error
 }
+
+// APIKeyRepository defines operations for API key management
+type APIKeyRepository interface {
+	CreateAPIKey(key *model.APIKey) error
+	GetAPIKeysByUserID(userID string) ([]*model.APIKey, error)
+	GetAPIKeyByHash(keyHash string) (*model.APIKey, error)
+	DeleteAPIKey(id int, userID string) (bool, error)
+}
+
+// CollectionRepository defines operations for grouping sets into collections
+type CollectionRepository interface {
+	CreateCollection(collection *model.Collection) error
+	GetCollectionByID(id int) (*model.Collection, error)
+	GetCollectionsByUserID(userID string) ([]*model.Collection, error)
+	AddSetToCollection(collectionID, setID int) error
+	RemoveSetFromCollection(collectionID, setID int) (bool, error)
+	GetSetsByCollectionID(collectionID int) ([]*model.Set, error)
+}
+
+// PuzzleRepository defines read operations over the puzzle catalog
+type PuzzleRepository interface {
+	GetPuzzleCatalogStats() (*model.PuzzleCatalogStats, error)
+	GetUnattemptedPuzzleIDs(userID, difficulty string, limit int) ([]string, error)
+	GetCompletionByUserID(userID string) ([]*model.DifficultyCompletion, error)
+	RecordDailyAttempt(userID, puzzleID string) error
+	GetDailyAttemptedPuzzleIDs(userID string, days int) ([]string, error)
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"database/sql"
+	"time"
 
 	"woodpecker-online/internal/model"
 
@@ -18,6 +19,14 @@ func NewSQLiteRepository(db *sqlx.DB) Repository {
 	return &SQLiteRepository{db: db}
 }
 
+// notFound maps sql.ErrNoRows to ErrNotFound, passing other errors through
+func notFound(err error) error {
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
+
 // UserRepository implementation
 
 func (r *SQLiteRepository) CreateUser(user *model.User) error {
@@ -34,7 +43,7 @@ func (r *SQLiteRepository) GetUserByID(id string) (*model.User, error) {
 	query := `SELECT id, email, password_hash, created_at FROM users WHERE id = ?`
 	err := r.db.Get(user, query, id)
 	if err != nil {
-		return nil, err
+		return nil, notFound(err)
 	}
 	return user, nil
 }
@@ -44,7 +53,7 @@ func (r *SQLiteRepository) GetUserByEmail(email string) (*model.User, error) {
 	query := `SELECT id, email, password_hash, created_at FROM users WHERE email = ?`
 	err := r.db.Get(user, query, email)
 	if err != nil {
-		return nil, err
+		return nil, notFound(err)
 	}
 	return user, nil
 }
@@ -65,6 +74,135 @@ func (r *SQLiteRepository) DeleteUser(id string) error {
 	return err
 }
 
+// GetActivityByUserID returns the user's most recent events across sets, cycles, sessions and
+// attempts, newest first. Events for deleted sets are left out. A solve is only an event when it
+// is the user's first solve of that puzzle without hints, or beats their earlier best time.
+func (r *SQLiteRepository) GetActivityByUserID(userID string, limit int) ([]*model.ActivityEvent, error) {
+	events := []*model.ActivityEvent{}
+	query := `
+		SELECT * FROM (
+			SELECT 'set_created' AS type, s.created_at AS occurred_at, s.id AS set_id, s.name AS set_name,
+				NULL AS cycle_index, NULL AS session_id, NULL AS puzzle_id, NULL AS time_ms
+			FROM sets s
+			WHERE s.user_id = ? AND s.deleted_at IS NULL
+
+			UNION ALL
+			SELECT 'cycle_started', c.started_at, s.id, s.name, c.cycle_index, NULL, NULL, NULL
+			FROM cycles c
+			JOIN sets s ON s.id = c.set_id
+			WHERE s.user_id = ? AND s.deleted_at IS NULL AND c.started_at IS NOT NULL
+
+			UNION ALL
+			SELECT 'cycle_completed', c.ended_at, s.id, s.name, c.cycle_index, NULL, NULL, NULL
+			FROM cycles c
+			JOIN sets s ON s.id = c.set_id
+			WHERE s.user_id = ? AND s.deleted_at IS NULL AND c.status = 'done' AND c.ended_at IS NOT NULL
+
+			UNION ALL
+			SELECT 'session_finished', se.ended_at, s.id, s.name, c.cycle_index, se.id, NULL, NULL
+			FROM sessions se
+			JOIN cycles c ON c.id = se.cycle_id
+			JOIN sets s ON s.id = c.set_id
+			WHERE s.user_id = ? AND s.deleted_at IS NULL AND se.ended_at IS NOT NULL
+
+			UNION ALL
+			SELECT 'puzzle_solved', a.ended_at, s.id, s.name, c.cycle_index, se.id, a.puzzle_id, a.time_ms
+			FROM attempts a
+			JOIN sessions se ON se.id = a.session_id
+			JOIN cycles c ON c.id = se.cycle_id
+			JOIN sets s ON s.id = c.set_id
+			WHERE s.user_id = ? AND s.deleted_at IS NULL AND a.ended_at IS NOT NULL
+				AND a.correct_first_move = 1 AND a.skipped = 0 AND a.hints_used = 0 AND a.time_ms > 0
+				AND NOT EXISTS (
+					SELECT 1 FROM attempts b
+					JOIN sessions bse ON bse.id = b.session_id
+					JOIN cycles bc ON bc.id = bse.cycle_id
+					JOIN sets bs ON bs.id = bc.set_id
+					WHERE bs.user_id = s.user_id AND b.puzzle_id = a.puzzle_id AND b.id != a.id
+						AND b.correct_first_move = 1 AND b.skipped = 0 AND b.time_ms > 0 AND b.ended_at < a.ended_at
+						AND b.time_ms <= a.time_ms
+				)
+		)
+		ORDER BY occurred_at DESC
+		LIMIT ?
+	`
+	err := r.db.Select(&events, query, userID, userID, userID, userID, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// GetReviewScheduleByUserID lists the user's attempted puzzles by next review date, soonest
+// first. Puzzles without a date are due now and come first.
+func (r *SQLiteRepository) GetReviewScheduleByUserID(userID string) ([]*model.PuzzleReview, error) {
+	reviews := []*model.PuzzleReview{}
+	query := `
+		SELECT puzzle_id, attempts, COALESCE(interval_days, 0) AS interval_days,
+			COALESCE(ease, 2.5) AS ease, next_review_at,
+			next_review_at IS NULL OR next_review_at <= datetime('now') AS due
+		FROM progress
+		WHERE user_id = ? AND attempts > 0
+		ORDER BY next_review_at IS NOT NULL, next_review_at, puzzle_id
+	`
+	if err := r.db.Select(&reviews, query, userID); err != nil {
+		return nil, err
+	}
+	return reviews, nil
+}
+
+// MergeUserData reassigns everything owned by fromUserID to toUserID in one transaction and
+// returns how many rows were reassigned per table. Where both users have a row that must be
+// unique, the target's wins: its daily plan, settings and daily attempts are kept, and progress
+// on the same puzzle is combined into the target's row.
+func (r *SQLiteRepository) MergeUserData(fromUserID, toUserID string) (map[string]int, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE progress SET
+			attempts = progress.attempts + src.attempts,
+			score = MAX(progress.score, src.score),
+			solved_at = COALESCE(progress.solved_at, src.solved_at),
+			updated_at = MAX(progress.updated_at, src.updated_at)
+		FROM (SELECT puzzle_id, attempts, score, solved_at, updated_at FROM progress WHERE user_id = ?) AS src
+		WHERE progress.user_id = ? AND progress.puzzle_id = src.puzzle_id
+	`, fromUserID, toUserID)
+	if err != nil {
+		return nil, err
+	}
+
+	conflicts := []string{
+		`DELETE FROM progress WHERE user_id = ? AND puzzle_id IN (SELECT puzzle_id FROM progress WHERE user_id = ?)`,
+		`DELETE FROM daily_plans WHERE user_id = ? AND EXISTS (SELECT 1 FROM daily_plans WHERE user_id = ?)`,
+		`DELETE FROM user_settings WHERE user_id = ? AND EXISTS (SELECT 1 FROM user_settings WHERE user_id = ?)`,
+		`DELETE FROM daily_attempts WHERE user_id = ? AND (puzzle_id, day) IN (SELECT puzzle_id, day FROM daily_attempts WHERE user_id = ?)`,
+	}
+	for _, query := range conflicts {
+		if _, err := tx.Exec(query, fromUserID, toUserID); err != nil {
+			return nil, err
+		}
+	}
+
+	moved := map[string]int{}
+	for _, table := range []string{"sets", "collections", "progress", "hints", "daily_plans", "daily_attempts", "user_settings", "api_keys"} {
+		result, err := tx.Exec(`UPDATE `+table+` SET user_id = ? WHERE user_id = ?`, toUserID, fromUserID)
+		if err != nil {
+			return nil, err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		moved[table] = int(affected)
+	}
+
+	return moved, tx.Commit()
+}
+
 // SetRepository implementation
 
 func (r *SQLiteRepository) CreateSet(set *model.Set) error {
@@ -87,24 +225,97 @@ func (r *SQLiteRepository) CreateSet(set *model.Set) error {
 
 func (r *SQLiteRepository) GetSetByID(id int) (*model.Set, error) {
 	set := &model.Set{}
-	query := `SELECT id, user_id, name, description, difficulty_min, difficulty_max, created_at FROM sets WHERE id = ?`
+	query := `SELECT id, user_id, name, description, difficulty_min, difficulty_max, created_at, deleted_at FROM sets WHERE id = ?`
 	err := r.db.Get(set, query, id)
 	if err != nil {
-		return nil, err
+		return nil, notFound(err)
 	}
 	return set, nil
 }
 
-func (r *SQLiteRepository) GetSetsByUserID(userID string) ([]*model.Set, error) {
+// GetSetsByUserID lists the user's sets, leaving out soft-deleted ones unless includeDeleted is set
+func (r *SQLiteRepository) GetSetsByUserID(userID string, includeDeleted bool) ([]*model.Set, error) {
 	var sets []*model.Set
-	query := `SELECT id, user_id, name, description, difficulty_min, difficulty_max, created_at FROM sets WHERE user_id = ? ORDER BY created_at DESC`
-	err := r.db.Select(&sets, query, userID)
+	query := `
+		SELECT id, user_id, name, description, difficulty_min, difficulty_max, created_at, deleted_at
+		FROM sets
+		WHERE user_id = ? AND (? OR deleted_at IS NULL)
+		ORDER BY created_at DESC
+	`
+	err := r.db.Select(&sets, query, userID, includeDeleted)
 	if err != nil {
 		return nil, err
 	}
 	return sets, nil
 }
 
+// GetSetOverviewsByUserID loads the user's sets with their latest active cycle and progress in one query
+func (r *SQLiteRepository) GetSetOverviewsByUserID(userID string) ([]*model.SetOverview, error) {
+	var rows []struct {
+		model.Set
+		PuzzlesTotal     int              `db:"puzzles_total"`
+		PuzzlesAttempted int              `db:"puzzles_attempted"`
+		CycleID          sql.NullInt64    `db:"cycle_id"`
+		CycleIndex       sql.NullInt64    `db:"cycle_index"`
+		TargetDays       sql.NullInt64    `db:"target_days"`
+		CycleStartedAt   *model.Timestamp `db:"cycle_started_at"`
+		CycleEndedAt     *model.Timestamp `db:"cycle_ended_at"`
+		CycleStatus      sql.NullString   `db:"cycle_status"`
+		CycleName        sql.NullString   `db:"cycle_name"`
+		CycleNotes       sql.NullString   `db:"cycle_notes"`
+	}
+	query := `
+		SELECT s.id, s.user_id, s.name, s.description, s.difficulty_min, s.difficulty_max, s.created_at,
+			(SELECT COUNT(*) FROM set_puzzles sp WHERE sp.set_id = s.id) AS puzzles_total,
+			c.id AS cycle_id, c.cycle_index, c.target_days,
+			c.started_at AS cycle_started_at, c.ended_at AS cycle_ended_at, c.status AS cycle_status,
+			c.name AS cycle_name, c.notes AS cycle_notes,
+			(
+				SELECT COUNT(DISTINCT a.puzzle_id)
+				FROM attempts a
+				JOIN sessions se ON se.id = a.session_id
+				JOIN set_puzzles sp ON sp.set_id = s.id AND sp.puzzle_id = a.puzzle_id
+				WHERE se.cycle_id = c.id
+			) AS puzzles_attempted
+		FROM sets s
+		LEFT JOIN cycles c ON c.id = (
+			SELECT id FROM cycles
+			WHERE set_id = s.id AND status = 'active'
+			ORDER BY cycle_index DESC
+			LIMIT 1
+		)
+		WHERE s.user_id = ? AND s.deleted_at IS NULL
+		ORDER BY s.created_at DESC
+	`
+	if err := r.db.Select(&rows, query, userID); err != nil {
+		return nil, err
+	}
+
+	overviews := make([]*model.SetOverview, 0, len(rows))
+	for _, row := range rows {
+		overview := &model.SetOverview{
+			Set:              row.Set,
+			PuzzlesTotal:     row.PuzzlesTotal,
+			PuzzlesAttempted: row.PuzzlesAttempted,
+		}
+		if row.CycleID.Valid {
+			overview.ActiveCycle = &model.Cycle{
+				ID:         int(row.CycleID.Int64),
+				SetID:      row.Set.ID,
+				Index:      int(row.CycleIndex.Int64),
+				TargetDays: int(row.TargetDays.Int64),
+				StartedAt:  row.CycleStartedAt,
+				EndedAt:    row.CycleEndedAt,
+				Status:     row.CycleStatus.String,
+				Name:       row.CycleName.String,
+				Notes:      row.CycleNotes.String,
+			}
+		}
+		overviews = append(overviews, overview)
+	}
+	return overviews, nil
+}
+
 func (r *SQLiteRepository) UpdateSet(set *model.Set) error {
 	query := `
 		UPDATE sets 
@@ -115,19 +326,130 @@ func (r *SQLiteRepository) UpdateSet(set *model.Set) error {
 	return err
 }
 
+// DeleteSet soft-deletes a set, keeping its cycles, sessions and attempts for stats
 func (r *SQLiteRepository) DeleteSet(id int) error {
-	query := `DELETE FROM sets WHERE id = ?`
+	query := `UPDATE sets SET deleted_at = CURRENT_TIMESTAMP WHERE id = ? AND deleted_at IS NULL`
+	_, err := r.db.Exec(query, id)
+	return err
+}
+
+// RestoreSet undoes a soft delete
+func (r *SQLiteRepository) RestoreSet(id int) error {
+	query := `UPDATE sets SET deleted_at = NULL WHERE id = ?`
 	_, err := r.db.Exec(query, id)
 	return err
 }
 
+// AddPuzzleToSet puts a puzzle at a position in a set. It returns ErrPuzzleAlreadyInSet, leaving
+// the set unchanged, when the puzzle is already in it.
 func (r *SQLiteRepository) AddPuzzleToSet(setID int, puzzleID string, position int) error {
 	query := `
 		INSERT INTO set_puzzles (set_id, puzzle_id, position)
 		VALUES (?, ?, ?)
+		ON CONFLICT (set_id, puzzle_id) DO NOTHING
 	`
-	_, err := r.db.Exec(query, setID, puzzleID, position)
-	return err
+	result, err := r.db.Exec(query, setID, puzzleID, position)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrPuzzleAlreadyInSet
+	}
+	return nil
+}
+
+// AppendPuzzlesToSet adds puzzles after the set's current last position in a single transaction.
+// It returns ErrPuzzleAlreadyInSet, leaving the set unchanged, when any of the puzzles is already
+// in it. Repeated IDs in puzzleIDs are added once.
+func (r *SQLiteRepository) AppendPuzzlesToSet(setID int, puzzleIDs []string) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var maxPosition int
+	err = tx.Get(&maxPosition, `SELECT COALESCE(MAX(position), 0) FROM set_puzzles WHERE set_id = ?`, setID)
+	if err != nil {
+		return err
+	}
+
+	var existing []string
+	err = tx.Select(&existing, `SELECT puzzle_id FROM set_puzzles WHERE set_id = ?`, setID)
+	if err != nil {
+		return err
+	}
+	inSet := make(map[string]bool, len(existing))
+	for _, puzzleID := range existing {
+		inSet[puzzleID] = true
+	}
+
+	for _, puzzleID := range puzzleIDs {
+		if inSet[puzzleID] {
+			return ErrPuzzleAlreadyInSet
+		}
+	}
+
+	added := make(map[string]bool, len(puzzleIDs))
+	position := maxPosition
+	for _, puzzleID := range puzzleIDs {
+		if added[puzzleID] {
+			continue
+		}
+		position++
+		_, err = tx.Exec(`INSERT INTO set_puzzles (set_id, puzzle_id, position) VALUES (?, ?, ?)`, setID, puzzleID, position)
+		if err != nil {
+			return err
+		}
+		added[puzzleID] = true
+	}
+
+	return tx.Commit()
+}
+
+// CreateSetWithPuzzles creates a set holding the puzzles in the given order, in a single
+// transaction so a failure leaves no partly filled set behind. Repeated IDs are added once.
+func (r *SQLiteRepository) CreateSetWithPuzzles(set *model.Set, puzzleIDs []string) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO sets (user_id, name, description, difficulty_min, difficulty_max, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, set.UserID, set.Name, set.Description, set.DifficultyMin, set.DifficultyMax, set.CreatedAt)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	added := make(map[string]bool, len(puzzleIDs))
+	for _, puzzleID := range puzzleIDs {
+		if added[puzzleID] {
+			continue
+		}
+		added[puzzleID] = true
+		_, err = tx.Exec(`INSERT INTO set_puzzles (set_id, puzzle_id, position) VALUES (?, ?, ?)`, id, puzzleID, len(added))
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	set.ID = int(id)
+	return nil
 }
 
 func (r *SQLiteRepository) GetPuzzlesInSet(setID int) ([]*model.SetPuzzle, error) {
@@ -146,14 +468,21 @@ func (r *SQLiteRepository) RemovePuzzleFromSet(setID int, puzzleID string) error
 	return err
 }
 
+func (r *SQLiteRepository) CountPuzzlesInSet(setID int) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM set_puzzles WHERE set_id = ?`
+	err := r.db.Get(&count, query, setID)
+	return count, err
+}
+
 // CycleRepository implementation
 
 func (r *SQLiteRepository) CreateCycle(cycle *model.Cycle) error {
 	query := `
-		INSERT INTO cycles (set_id, cycle_index, target_days, started_at, ended_at, status)
-		VALUES (?, ?, ?, ?, ?, ?)
+		INSERT INTO cycles (set_id, cycle_index, target_days, started_at, ended_at, status, name, notes)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
 	`
-	result, err := r.db.Exec(query, cycle.SetID, cycle.Index, cycle.TargetDays, cycle.StartedAt, cycle.EndedAt, cycle.Status)
+	result, err := r.db.Exec(query, cycle.SetID, cycle.Index, cycle.TargetDays, cycle.StartedAt, cycle.EndedAt, cycle.Status, cycle.Name, cycle.Notes)
 	if err != nil {
 		return err
 	}
@@ -168,17 +497,17 @@ func (r *SQLiteRepository) CreateCycle(cycle *model.Cycle) error {
 
 func (r *SQLiteRepository) GetCycleByID(id int) (*model.Cycle, error) {
 	cycle := &model.Cycle{}
-	query := `SELECT id, set_id, cycle_index, target_days, started_at, ended_at, status FROM cycles WHERE id = ?`
+	query := `SELECT id, set_id, cycle_index, target_days, started_at, ended_at, status, COALESCE(name, '') AS name, COALESCE(notes, '') AS notes FROM cycles WHERE id = ?`
 	err := r.db.Get(cycle, query, id)
 	if err != nil {
-		return nil, err
+		return nil, notFound(err)
 	}
 	return cycle, nil
 }
 
 func (r *SQLiteRepository) GetCyclesBySetID(setID int) ([]*model.Cycle, error) {
 	var cycles []*model.Cycle
-	query := `SELECT id, set_id, cycle_index, target_days, started_at, ended_at, status FROM cycles WHERE set_id = ? ORDER BY cycle_index`
+	query := `SELECT id, set_id, cycle_index, target_days, started_at, ended_at, status, COALESCE(name, '') AS name, COALESCE(notes, '') AS notes FROM cycles WHERE set_id = ? ORDER BY cycle_index`
 	err := r.db.Select(&cycles, query, setID)
 	if err != nil {
 		return nil, err
@@ -189,40 +518,125 @@ func (r *SQLiteRepository) GetCyclesBySetID(setID int) ([]*model.Cycle, error) {
 func (r *SQLiteRepository) UpdateCycle(cycle *model.Cycle) error {
 	query := `
 		UPDATE cycles 
-		SET set_id = ?, cycle_index = ?, target_days = ?, started_at = ?, ended_at = ?, status = ?
+		SET set_id = ?, cycle_index = ?, target_days = ?, started_at = ?, ended_at = ?, status = ?, name = ?, notes = ?
 		WHERE id = ?
 	`
-	_, err := r.db.Exec(query, cycle.SetID, cycle.Index, cycle.TargetDays, cycle.StartedAt, cycle.EndedAt, cycle.Status, cycle.ID)
+	_, err := r.db.Exec(query, cycle.SetID, cycle.Index, cycle.TargetDays, cycle.StartedAt, cycle.EndedAt, cycle.Status, cycle.Name, cycle.Notes, cycle.ID)
 	return err
 }
 
+// DeleteCycle deletes a cycle along with its sessions and their attempts in one transaction, so
+// no sessions are left pointing at a missing cycle
 func (r *SQLiteRepository) DeleteCycle(id int) error {
-	query := `DELETE FROM cycles WHERE id = ?`
-	_, err := r.db.Exec(query, id)
-	return err
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	queries := []string{
+		`DELETE FROM attempts WHERE session_id IN (SELECT id FROM sessions WHERE cycle_id = ?)`,
+		`DELETE FROM idempotency_keys WHERE session_id IN (SELECT id FROM sessions WHERE cycle_id = ?)`,
+		`DELETE FROM sessions WHERE cycle_id = ?`,
+		`DELETE FROM cycles WHERE id = ?`,
+	}
+	for _, query := range queries {
+		if _, err := tx.Exec(query, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
 func (r *SQLiteRepository) GetActiveCycleBySetID(setID int) (*model.Cycle, error) {
 	cycle := &model.Cycle{}
-	query := `SELECT id, set_id, index, target_days, started_at, ended_at, status FROM cycles WHERE set_id = ? AND status = 'active'`
+	query := `SELECT id, set_id, cycle_index, target_days, started_at, ended_at, status, COALESCE(name, '') AS name, COALESCE(notes, '') AS notes FROM cycles WHERE set_id = ? AND status = 'active'`
 	err := r.db.Get(cycle, query, setID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
-		}
-		return nil, err
+		return nil, notFound(err)
 	}
 	return cycle, nil
 }
 
+// CountAttemptedPuzzlesInCycle counts the distinct set puzzles attempted in any of the cycle's sessions
+func (r *SQLiteRepository) CountAttemptedPuzzlesInCycle(cycleID int) (int, error) {
+	var count int
+	query := `
+		SELECT COUNT(DISTINCT a.puzzle_id)
+		FROM attempts a
+		JOIN sessions s ON s.id = a.session_id
+		JOIN cycles c ON c.id = s.cycle_id
+		JOIN set_puzzles sp ON sp.set_id = c.set_id AND sp.puzzle_id = a.puzzle_id
+		WHERE s.cycle_id = ?
+	`
+	err := r.db.Get(&count, query, cycleID)
+	return count, err
+}
+
+// GetNextUnattemptedSetPuzzle returns the lowest-position puzzle of the given difficulty in the
+// cycle's set that hasn't been attempted in any of the cycle's sessions, or ErrNotFound if every
+// such puzzle has been
+func (r *SQLiteRepository) GetNextUnattemptedSetPuzzle(cycleID int, difficulty string) (*model.SetPuzzle, error) {
+	setPuzzle := &model.SetPuzzle{}
+	query := `
+		SELECT sp.set_id, sp.puzzle_id, sp.position
+		FROM set_puzzles sp
+		JOIN cycles c ON c.set_id = sp.set_id
+		JOIN puzzles p ON p.id = sp.puzzle_id
+		WHERE c.id = ? AND p.difficulty = ? AND NOT EXISTS (
+			SELECT 1 FROM attempts a
+			JOIN sessions s ON s.id = a.session_id
+			WHERE s.cycle_id = c.id AND a.puzzle_id = sp.puzzle_id
+		)
+		ORDER BY sp.position
+		LIMIT 1
+	`
+	err := r.db.Get(setPuzzle, query, cycleID, difficulty)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return setPuzzle, nil
+}
+
+// GetCycleProgressionBySetID returns first-move accuracy, points and average solve time for each
+// completed cycle of a set, in cycle order
+func (r *SQLiteRepository) GetCycleProgressionBySetID(setID int) ([]*model.CycleProgress, error) {
+	progression := []*model.CycleProgress{}
+	query := `
+		SELECT c.id AS cycle_id, c.cycle_index, c.ended_at,
+			COUNT(a.id) AS attempts,
+			COALESCE(SUM(a.correct_first_move), 0) AS correct,
+			COALESCE(SUM(a.total_points), 0) AS total_points,
+			CAST(COALESCE(AVG(a.time_ms), 0) AS INTEGER) AS avg_time_ms
+		FROM cycles c
+		LEFT JOIN sessions s ON s.cycle_id = c.id
+		LEFT JOIN attempts a ON a.session_id = s.id AND a.skipped = 0
+		WHERE c.set_id = ? AND c.status = 'done'
+		GROUP BY c.id
+		ORDER BY c.cycle_index
+	`
+	err := r.db.Select(&progression, query, setID)
+	if err != nil {
+		return nil, err
+	}
+	return progression, nil
+}
+
 // SessionRepository implementation
 
+// CreateSession inserts a session and, if its cycle is still planned, makes the cycle active
 func (r *SQLiteRepository) CreateSession(session *model.Session) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	query := `
-		INSERT INTO sessions (cycle_id, started_at, ended_at, target_count)
-		VALUES (?, ?, ?, ?)
+		INSERT INTO sessions (cycle_id, started_at, ended_at, target_count, time_limit_seconds)
+		VALUES (?, ?, ?, ?, ?)
 	`
-	result, err := r.db.Exec(query, session.CycleID, session.StartedAt, session.EndedAt, session.TargetCount)
+	result, err := tx.Exec(query, session.CycleID, session.StartedAt, session.EndedAt, session.TargetCount, session.TimeLimitSeconds)
 	if err != nil {
 		return err
 	}
@@ -232,22 +646,41 @@ func (r *SQLiteRepository) CreateSession(session *model.Session) error {
 		return err
 	}
 	session.ID = int(id)
-	return nil
+
+	if err := activatePlannedCycle(tx, session); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// activatePlannedCycle flips a planned cycle to active when its first session starts, stamping
+// started_at with the session's start. Cycles in any other status are left alone.
+func activatePlannedCycle(tx *sqlx.Tx, session *model.Session) error {
+	startedAt := session.StartedAt
+	if startedAt == nil {
+		now := model.Now()
+		startedAt = &now
+	}
+	_, err := tx.Exec(`
+		UPDATE cycles SET status = 'active', started_at = COALESCE(started_at, ?)
+		WHERE id = ? AND status = 'planned'
+	`, startedAt, session.CycleID)
+	return err
 }
 
 func (r *SQLiteRepository) GetSessionByID(id int) (*model.Session, error) {
 	session := &model.Session{}
-	query := `SELECT id, cycle_id, started_at, ended_at, target_count FROM sessions WHERE id = ?`
+	query := `SELECT id, cycle_id, started_at, ended_at, target_count, time_limit_seconds FROM sessions WHERE id = ?`
 	err := r.db.Get(session, query, id)
 	if err != nil {
-		return nil, err
+		return nil, notFound(err)
 	}
 	return session, nil
 }
 
 func (r *SQLiteRepository) GetSessionsByCycleID(cycleID int) ([]*model.Session, error) {
 	var sessions []*model.Session
-	query := `SELECT id, cycle_id, started_at, ended_at, target_count FROM sessions WHERE cycle_id = ? ORDER BY started_at`
+	query := `SELECT id, cycle_id, started_at, ended_at, target_count, time_limit_seconds FROM sessions WHERE cycle_id = ? ORDER BY started_at`
 	err := r.db.Select(&sessions, query, cycleID)
 	if err != nil {
 		return nil, err
@@ -258,10 +691,10 @@ func (r *SQLiteRepository) GetSessionsByCycleID(cycleID int) ([]*model.Session,
 func (r *SQLiteRepository) UpdateSession(session *model.Session) error {
 	query := `
 		UPDATE sessions 
-		SET cycle_id = ?, started_at = ?, ended_at = ?, target_count = ?
+		SET cycle_id = ?, started_at = ?, ended_at = ?, target_count = ?, time_limit_seconds = ?
 		WHERE id = ?
 	`
-	_, err := r.db.Exec(query, session.CycleID, session.StartedAt, session.EndedAt, session.TargetCount, session.ID)
+	_, err := r.db.Exec(query, session.CycleID, session.StartedAt, session.EndedAt, session.TargetCount, session.TimeLimitSeconds, session.ID)
 	return err
 }
 
@@ -273,25 +706,165 @@ func (r *SQLiteRepository) DeleteSession(id int) error {
 
 func (r *SQLiteRepository) GetActiveSessionByCycleID(cycleID int) (*model.Session, error) {
 	session := &model.Session{}
-	query := `SELECT id, cycle_id, started_at, ended_at, target_count FROM sessions WHERE cycle_id = ? AND ended_at IS NULL`
+	query := `SELECT id, cycle_id, started_at, ended_at, target_count, time_limit_seconds FROM sessions WHERE cycle_id = ? AND ended_at IS NULL`
 	err := r.db.Get(session, query, cycleID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
-		}
-		return nil, err
+		return nil, notFound(err)
+	}
+	return session, nil
+}
+
+// GetOpenSessionByUserID returns the user's most recently started open session in an active
+// cycle of one of their sets, or ErrNotFound if they have none
+func (r *SQLiteRepository) GetOpenSessionByUserID(userID string) (*model.Session, error) {
+	session := &model.Session{}
+	query := `
+		SELECT se.id, se.cycle_id, se.started_at, se.ended_at, se.target_count, se.time_limit_seconds
+		FROM sessions se
+		JOIN cycles c ON c.id = se.cycle_id
+		JOIN sets s ON s.id = c.set_id
+		WHERE s.user_id = ? AND s.deleted_at IS NULL AND c.status = 'active' AND se.ended_at IS NULL
+		ORDER BY se.started_at DESC, se.id DESC
+		LIMIT 1
+	`
+	err := r.db.Get(session, query, userID)
+	if err != nil {
+		return nil, notFound(err)
 	}
 	return session, nil
 }
 
+// CreateSessionWithIdempotencyKey creates a session unless the user already created one with the same
+// key within the window, in which case session is filled with the original. fingerprint identifies
+// the request; replaying the key with a different fingerprint returns ErrIdempotencyKeyReused. It
+// reports whether a new session was created.
+func (r *SQLiteRepository) CreateSessionWithIdempotencyKey(session *model.Session, userID, key, fingerprint string, window time.Duration) (bool, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	cutoff := time.Now().Add(-window).UTC().Format("2006-01-02 15:04:05")
+
+	var existing struct {
+		SessionID   int    `db:"session_id"`
+		Fingerprint string `db:"fingerprint"`
+	}
+	err = tx.Get(&existing, `
+		SELECT session_id, COALESCE(fingerprint, '') AS fingerprint FROM idempotency_keys
+		WHERE user_id = ? AND idempotency_key = ? AND created_at >= ?
+	`, userID, key, cutoff)
+	if err == nil {
+		if existing.Fingerprint != fingerprint {
+			return false, ErrIdempotencyKeyReused
+		}
+		err = tx.Get(session, `SELECT id, cycle_id, started_at, ended_at, target_count, time_limit_seconds FROM sessions WHERE id = ?`, existing.SessionID)
+		if err != nil {
+			return false, err
+		}
+		return false, tx.Commit()
+	}
+	if err != sql.ErrNoRows {
+		return false, err
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO sessions (cycle_id, started_at, ended_at, target_count, time_limit_seconds)
+		VALUES (?, ?, ?, ?, ?)
+	`, session.CycleID, session.StartedAt, session.EndedAt, session.TargetCount, session.TimeLimitSeconds)
+	if err != nil {
+		return false, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return false, err
+	}
+	session.ID = int(id)
+
+	if err := activatePlannedCycle(tx, session); err != nil {
+		return false, err
+	}
+
+	// Replace any expired entry for the same key
+	_, err = tx.Exec(`
+		INSERT INTO idempotency_keys (user_id, idempotency_key, session_id, fingerprint, created_at)
+		VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(user_id, idempotency_key) DO UPDATE SET
+			session_id = excluded.session_id,
+			fingerprint = excluded.fingerprint,
+			created_at = excluded.created_at
+	`, userID, key, session.ID, fingerprint)
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// MoveSessionsToCycle reassigns every session of one cycle to another, returning how many moved.
+// It is used to reattach sessions orphaned when their cycle was deleted and recreated. Sessions
+// only move within a set: if the source cycle still exists it must belong to the target's set,
+// and otherwise every puzzle attempted in its sessions must be in that set. ErrCycleSetMismatch
+// is returned when they aren't, and ErrNotFound when the target cycle doesn't exist.
+func (r *SQLiteRepository) MoveSessionsToCycle(fromCycleID, toCycleID int) (int, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var setID int
+	if err := tx.Get(&setID, `SELECT set_id FROM cycles WHERE id = ?`, toCycleID); err != nil {
+		return 0, notFound(err)
+	}
+
+	var fromSetID int
+	err = tx.Get(&fromSetID, `SELECT set_id FROM cycles WHERE id = ?`, fromCycleID)
+	switch {
+	case err == nil:
+		if fromSetID != setID {
+			return 0, ErrCycleSetMismatch
+		}
+	case err == sql.ErrNoRows:
+		var foreign bool
+		err := tx.Get(&foreign, `
+			SELECT EXISTS (
+				SELECT 1 FROM attempts a
+				JOIN sessions s ON s.id = a.session_id
+				WHERE s.cycle_id = ? AND a.puzzle_id NOT IN (SELECT puzzle_id FROM set_puzzles WHERE set_id = ?)
+			)
+		`, fromCycleID, setID)
+		if err != nil {
+			return 0, err
+		}
+		if foreign {
+			return 0, ErrCycleSetMismatch
+		}
+	default:
+		return 0, err
+	}
+
+	result, err := tx.Exec(`UPDATE sessions SET cycle_id = ? WHERE cycle_id = ?`, toCycleID, fromCycleID)
+	if err != nil {
+		return 0, err
+	}
+	moved, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(moved), tx.Commit()
+}
+
 // AttemptRepository implementation
 
 func (r *SQLiteRepository) CreateAttempt(attempt *model.Attempt) error {
 	query := `
-		INSERT INTO attempts (session_id, puzzle_id, started_at, ended_at, score_first_move, score_ticks, total_points, time_ms, correct_first_move)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO attempts (session_id, puzzle_id, started_at, ended_at, score_first_move, score_ticks, total_points, time_ms, correct_first_move, hints_used, skipped)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
-	result, err := r.db.Exec(query, attempt.SessionID, attempt.PuzzleID, attempt.StartedAt, attempt.EndedAt, attempt.ScoreFirstMove, attempt.ScoreTicks, attempt.TotalPoints, attempt.TimeMs, attempt.CorrectFirstMove)
+	result, err := r.db.Exec(query, attempt.SessionID, attempt.PuzzleID, attempt.StartedAt, attempt.EndedAt, attempt.ScoreFirstMove, attempt.ScoreTicks, attempt.TotalPoints, attempt.TimeMs, attempt.CorrectFirstMove, attempt.HintsUsed, attempt.Skipped)
 	if err != nil {
 		return err
 	}
@@ -306,17 +879,17 @@ func (r *SQLiteRepository) CreateAttempt(attempt *model.Attempt) error {
 
 func (r *SQLiteRepository) GetAttemptByID(id int) (*model.Attempt, error) {
 	attempt := &model.Attempt{}
-	query := `SELECT id, session_id, puzzle_id, started_at, ended_at, score_first_move, score_ticks, total_points, time_ms, correct_first_move FROM attempts WHERE id = ?`
+	query := `SELECT id, session_id, puzzle_id, started_at, ended_at, score_first_move, score_ticks, total_points, time_ms, correct_first_move, hints_used, skipped FROM attempts WHERE id = ?`
 	err := r.db.Get(attempt, query, id)
 	if err != nil {
-		return nil, err
+		return nil, notFound(err)
 	}
 	return attempt, nil
 }
 
 func (r *SQLiteRepository) GetAttemptsBySessionID(sessionID int) ([]*model.Attempt, error) {
 	var attempts []*model.Attempt
-	query := `SELECT id, session_id, puzzle_id, started_at, ended_at, score_first_move, score_ticks, total_points, time_ms, correct_first_move FROM attempts WHERE session_id = ? ORDER BY started_at`
+	query := `SELECT id, session_id, puzzle_id, started_at, ended_at, score_first_move, score_ticks, total_points, time_ms, correct_first_move, hints_used, skipped FROM attempts WHERE session_id = ? ORDER BY started_at`
 	err := r.db.Select(&attempts, query, sessionID)
 	if err != nil {
 		return nil, err
@@ -327,10 +900,10 @@ func (r *SQLiteRepository) GetAttemptsBySessionID(sessionID int) ([]*model.Attem
 func (r *SQLiteRepository) UpdateAttempt(attempt *model.Attempt) error {
 	query := `
 		UPDATE attempts 
-		SET session_id = ?, puzzle_id = ?, started_at = ?, ended_at = ?, score_first_move = ?, score_ticks = ?, total_points = ?, time_ms = ?, correct_first_move = ?
+		SET session_id = ?, puzzle_id = ?, started_at = ?, ended_at = ?, score_first_move = ?, score_ticks = ?, total_points = ?, time_ms = ?, correct_first_move = ?, hints_used = ?, skipped = ?
 		WHERE id = ?
 	`
-	_, err := r.db.Exec(query, attempt.SessionID, attempt.PuzzleID, attempt.StartedAt, attempt.EndedAt, attempt.ScoreFirstMove, attempt.ScoreTicks, attempt.TotalPoints, attempt.TimeMs, attempt.CorrectFirstMove, attempt.ID)
+	_, err := r.db.Exec(query, attempt.SessionID, attempt.PuzzleID, attempt.StartedAt, attempt.EndedAt, attempt.ScoreFirstMove, attempt.ScoreTicks, attempt.TotalPoints, attempt.TimeMs, attempt.CorrectFirstMove, attempt.HintsUsed, attempt.Skipped, attempt.ID)
 	return err
 }
 
@@ -342,7 +915,7 @@ func (r *SQLiteRepository) DeleteAttempt(id int) error {
 
 func (r *SQLiteRepository) GetAttemptsByPuzzleID(puzzleID string) ([]*model.Attempt, error) {
 	var attempts []*model.Attempt
-	query := `SELECT id, session_id, puzzle_id, started_at, ended_at, score_first_move, score_ticks, total_points, time_ms, correct_first_move FROM attempts WHERE puzzle_id = ? ORDER BY started_at`
+	query := `SELECT id, session_id, puzzle_id, started_at, ended_at, score_first_move, score_ticks, total_points, time_ms, correct_first_move, hints_used, skipped FROM attempts WHERE puzzle_id = ? ORDER BY started_at`
 	err := r.db.Select(&attempts, query, puzzleID)
 	if err != nil {
 		return nil, err
@@ -350,30 +923,268 @@ func (r *SQLiteRepository) GetAttemptsByPuzzleID(puzzleID string) ([]*model.Atte
 	return attempts, nil
 }
 
+// DeleteAttemptsBefore deletes the user's attempts started before the cutoff, returning how many were removed.
+// Ownership is resolved through the attempt's session, cycle and set.
+func (r *SQLiteRepository) DeleteAttemptsBefore(userID string, before time.Time) (int, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		DELETE FROM attempts
+		WHERE id IN (
+			SELECT a.id
+			FROM attempts a
+			JOIN sessions se ON se.id = a.session_id
+			JOIN cycles c ON c.id = se.cycle_id
+			JOIN sets s ON s.id = c.set_id
+			WHERE s.user_id = ? AND datetime(a.started_at) < datetime(?)
+		)
+	`, userID, before.UTC().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return 0, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(affected), tx.Commit()
+}
+
+// GetMotifStatsByUserID returns first-move accuracy per puzzle tag over the user's attempts,
+// weakest motif first
+func (r *SQLiteRepository) GetMotifStatsByUserID(userID string) ([]*model.MotifStat, error) {
+	stats := []*model.MotifStat{}
+	query := `
+		SELECT pt.tag,
+			COUNT(*) AS attempts,
+			SUM(a.correct_first_move) AS correct,
+			SUM(a.correct_first_move) * 100 / COUNT(*) AS accuracy_percent
+		FROM attempts a
+		JOIN sessions se ON se.id = a.session_id
+		JOIN cycles c ON c.id = se.cycle_id
+		JOIN sets s ON s.id = c.set_id
+		JOIN puzzle_tags pt ON pt.puzzle_id = a.puzzle_id
+		WHERE s.user_id = ? AND a.skipped = 0
+		GROUP BY pt.tag
+		ORDER BY CAST(SUM(a.correct_first_move) AS REAL) / COUNT(*), COUNT(*) DESC, pt.tag
+	`
+	err := r.db.Select(&stats, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// GetSolveTimesByPuzzleID returns the times of every correct, unskipped attempt at a puzzle, fastest first
+func (r *SQLiteRepository) GetSolveTimesByPuzzleID(puzzleID string) ([]int, error) {
+	times := []int{}
+	query := `
+		SELECT time_ms FROM attempts
+		WHERE puzzle_id = ? AND correct_first_move = 1 AND skipped = 0 AND time_ms > 0
+		ORDER BY time_ms
+	`
+	err := r.db.Select(&times, query, puzzleID)
+	if err != nil {
+		return nil, err
+	}
+	return times, nil
+}
+
+// GetBestSolveTime returns the user's fastest correct time on a puzzle, or nil if they haven't solved it
+func (r *SQLiteRepository) GetBestSolveTime(userID, puzzleID string) (*int, error) {
+	var best sql.NullInt64
+	query := `
+		SELECT MIN(a.time_ms)
+		FROM attempts a
+		JOIN sessions se ON se.id = a.session_id
+		JOIN cycles c ON c.id = se.cycle_id
+		JOIN sets s ON s.id = c.set_id
+		WHERE s.user_id = ? AND a.puzzle_id = ? AND a.correct_first_move = 1 AND a.skipped = 0 AND a.time_ms > 0
+	`
+	if err := r.db.Get(&best, query, userID, puzzleID); err != nil {
+		return nil, err
+	}
+	if !best.Valid {
+		return nil, nil
+	}
+	ms := int(best.Int64)
+	return &ms, nil
+}
+
+// GetScoresByPuzzleID returns the points of every unskipped attempt at a puzzle, lowest first
+func (r *SQLiteRepository) GetScoresByPuzzleID(puzzleID string) ([]int, error) {
+	scores := []int{}
+	query := `
+		SELECT total_points FROM attempts
+		WHERE puzzle_id = ? AND skipped = 0
+		ORDER BY total_points
+	`
+	err := r.db.Select(&scores, query, puzzleID)
+	if err != nil {
+		return nil, err
+	}
+	return scores, nil
+}
+
+// GetBestScore returns the user's highest points on a puzzle, or nil if they haven't attempted it
+func (r *SQLiteRepository) GetBestScore(userID, puzzleID string) (*int, error) {
+	var best sql.NullInt64
+	query := `
+		SELECT MAX(a.total_points)
+		FROM attempts a
+		JOIN sessions se ON se.id = a.session_id
+		JOIN cycles c ON c.id = se.cycle_id
+		JOIN sets s ON s.id = c.set_id
+		WHERE s.user_id = ? AND a.puzzle_id = ? AND a.skipped = 0
+	`
+	if err := r.db.Get(&best, query, userID, puzzleID); err != nil {
+		return nil, err
+	}
+	if !best.Valid {
+		return nil, nil
+	}
+	points := int(best.Int64)
+	return &points, nil
+}
+
+// HasAttemptedPuzzle reports whether the user has played a puzzle, either in one of their
+// sessions or through the free-play progress table. Skips don't count.
+func (r *SQLiteRepository) HasAttemptedPuzzle(userID, puzzleID string) (bool, error) {
+	var attempted bool
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM attempts a
+			JOIN sessions se ON se.id = a.session_id
+			JOIN cycles c ON c.id = se.cycle_id
+			JOIN sets s ON s.id = c.set_id
+			WHERE s.user_id = ? AND a.puzzle_id = ? AND a.skipped = 0
+		) OR EXISTS (
+			SELECT 1 FROM progress WHERE user_id = ? AND puzzle_id = ? AND attempts > 0
+		)
+	`
+	if err := r.db.Get(&attempted, query, userID, puzzleID, userID, puzzleID); err != nil {
+		return false, err
+	}
+	return attempted, nil
+}
+
+// GetAttemptTimesSince returns when each of the user's unskipped attempts started, for attempts
+// started at or after since, oldest first
+func (r *SQLiteRepository) GetAttemptTimesSince(userID string, since time.Time) ([]model.Timestamp, error) {
+	times := []model.Timestamp{}
+	query := `
+		SELECT a.started_at
+		FROM attempts a
+		JOIN sessions se ON se.id = a.session_id
+		JOIN cycles c ON c.id = se.cycle_id
+		JOIN sets s ON s.id = c.set_id
+		WHERE s.user_id = ? AND a.skipped = 0 AND a.started_at IS NOT NULL
+			AND datetime(a.started_at) >= datetime(?)
+		ORDER BY datetime(a.started_at)
+	`
+	err := r.db.Select(&times, query, userID, since.UTC().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return nil, err
+	}
+	return times, nil
+}
+
+// GetSolveTimeByDifficultySince totals the milliseconds the user spent on unskipped attempts
+// started at or after since, by puzzle difficulty. Difficulties without attempts are left out.
+func (r *SQLiteRepository) GetSolveTimeByDifficultySince(userID string, since time.Time) (map[string]int, error) {
+	var rows []struct {
+		Difficulty string `db:"difficulty"`
+		TimeMs     int    `db:"time_ms"`
+	}
+	query := `
+		SELECT p.difficulty, SUM(a.time_ms) AS time_ms
+		FROM attempts a
+		JOIN sessions se ON se.id = a.session_id
+		JOIN cycles c ON c.id = se.cycle_id
+		JOIN sets s ON s.id = c.set_id
+		JOIN puzzles p ON p.id = a.puzzle_id
+		WHERE s.user_id = ? AND a.skipped = 0 AND a.started_at IS NOT NULL
+			AND datetime(a.started_at) >= datetime(?)
+		GROUP BY p.difficulty
+	`
+	if err := r.db.Select(&rows, query, userID, since.UTC().Format("2006-01-02 15:04:05")); err != nil {
+		return nil, err
+	}
+
+	totals := make(map[string]int, len(rows))
+	for _, row := range rows {
+		totals[row.Difficulty] = row.TimeMs
+	}
+	return totals, nil
+}
+
+// attemptRecordFrom narrows attempts to the user's unskipped ones. Each personal record selects
+// its own value from these, adds its filter and order, and takes the first row.
+const attemptRecordFrom = `
+	FROM attempts a
+	JOIN sessions se ON se.id = a.session_id
+	JOIN cycles c ON c.id = se.cycle_id
+	JOIN sets s ON s.id = c.set_id
+	WHERE s.user_id = ? AND a.skipped = 0`
+
+// GetPersonalRecords finds the user's fastest and longest correct solves and their highest
+// points on a single attempt. Solves without a recorded time are ignored; ties go to the earliest.
+func (r *SQLiteRepository) GetPersonalRecords(userID string) (*model.PersonalRecords, error) {
+	solves := `SELECT a.puzzle_id, a.time_ms AS value, a.started_at` + attemptRecordFrom +
+		` AND a.correct_first_move = 1 AND a.time_ms > 0`
+	points := `SELECT a.puzzle_id, a.total_points AS value, a.started_at` + attemptRecordFrom
+
+	records := &model.PersonalRecords{}
+	var err error
+	if records.FastestSolve, err = r.attemptRecord(solves+` ORDER BY a.time_ms, a.id LIMIT 1`, userID); err != nil {
+		return nil, err
+	}
+	if records.LongestSolve, err = r.attemptRecord(solves+` ORDER BY a.time_ms DESC, a.id LIMIT 1`, userID); err != nil {
+		return nil, err
+	}
+	if records.HighestPoints, err = r.attemptRecord(points+` ORDER BY a.total_points DESC, a.id LIMIT 1`, userID); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// attemptRecord runs a personal record query, returning nil if the user has no qualifying attempt
+func (r *SQLiteRepository) attemptRecord(query, userID string) (*model.AttemptRecord, error) {
+	record := &model.AttemptRecord{}
+	err := r.db.Get(record, query, userID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
 // UserSettingsRepository implementation
 
 func (r *SQLiteRepository) CreateUserSettings(settings *model.UserSettings) error {
 	query := `
-		INSERT INTO user_settings (user_id, daily_goal_minutes, reminders_enabled, timezone)
-		VALUES (?, ?, ?, ?)
+		INSERT INTO user_settings (user_id, daily_goal_minutes, reminders_enabled, timezone, board_orientation, difficulty_goal_minutes)
+		VALUES (?, ?, ?, ?, ?, ?)
 	`
-	_, err := r.db.Exec(query, settings.UserID, settings.DailyGoalMinutes, settings.RemindersEnabled, settings.Timezone)
+	_, err := r.db.Exec(query, settings.UserID, settings.DailyGoalMinutes, settings.RemindersEnabled, settings.Timezone, settings.BoardOrientation, settings.DifficultyGoalMinutes)
 	return err
 }
 
 func (r *SQLiteRepository) GetUserSettingsByUserID(userID string) (*model.UserSettings, error) {
 	settings := &model.UserSettings{}
-	query := `SELECT user_id, daily_goal_minutes, reminders_enabled, timezone FROM user_settings WHERE user_id = ?`
+	query := `SELECT user_id, daily_goal_minutes, reminders_enabled, timezone, board_orientation, difficulty_goal_minutes FROM user_settings WHERE user_id = ?`
 	err := r.db.Get(settings, query, userID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			// Return default settings if none exist
-			return &model.UserSettings{
-				UserID:           userID,
-				DailyGoalMinutes: 30,
-				RemindersEnabled: true,
-				Timezone:         "UTC",
-			}, nil
+			return model.DefaultUserSettings(userID), nil
 		}
 		return nil, err
 	}
@@ -383,10 +1194,26 @@ func (r *SQLiteRepository) GetUserSettingsByUserID(userID string) (*model.UserSe
 func (r *SQLiteRepository) UpdateUserSettings(settings *model.UserSettings) error {
 	query := `
 		UPDATE user_settings 
-		SET daily_goal_minutes = ?, reminders_enabled = ?, timezone = ?
+		SET daily_goal_minutes = ?, reminders_enabled = ?, timezone = ?, board_orientation = ?, difficulty_goal_minutes = ?
 		WHERE user_id = ?
 	`
-	_, err := r.db.Exec(query, settings.DailyGoalMinutes, settings.RemindersEnabled, settings.Timezone, settings.UserID)
+	_, err := r.db.Exec(query, settings.DailyGoalMinutes, settings.RemindersEnabled, settings.Timezone, settings.BoardOrientation, settings.DifficultyGoalMinutes, settings.UserID)
+	return err
+}
+
+// UpsertUserSettings saves settings, creating the row if the user has none yet
+func (r *SQLiteRepository) UpsertUserSettings(settings *model.UserSettings) error {
+	query := `
+		INSERT INTO user_settings (user_id, daily_goal_minutes, reminders_enabled, timezone, board_orientation, difficulty_goal_minutes)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			daily_goal_minutes = excluded.daily_goal_minutes,
+			reminders_enabled = excluded.reminders_enabled,
+			timezone = excluded.timezone,
+			board_orientation = excluded.board_orientation,
+			difficulty_goal_minutes = excluded.difficulty_goal_minutes
+	`
+	_, err := r.db.Exec(query, settings.UserID, settings.DailyGoalMinutes, settings.RemindersEnabled, settings.Timezone, settings.BoardOrientation, settings.DifficultyGoalMinutes)
 	return err
 }
 
@@ -395,3 +1222,240 @@ func (r *SQLiteRepository) DeleteUserSettings(userID string) error {
 	_, err := r.db.Exec(query, userID)
 	return err
 }
+
+// APIKeyRepository implementation
+
+func (r *SQLiteRepository) CreateAPIKey(key *model.APIKey) error {
+	query := `
+		INSERT INTO api_keys (user_id, prefix, key_hash, created_at)
+		VALUES (?, ?, ?, ?)
+	`
+	result, err := r.db.Exec(query, key.UserID, key.Prefix, key.KeyHash, key.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	key.ID = int(id)
+	return nil
+}
+
+func (r *SQLiteRepository) GetAPIKeysByUserID(userID string) ([]*model.APIKey, error) {
+	keys := []*model.APIKey{}
+	query := `SELECT id, user_id, prefix, key_hash, created_at FROM api_keys WHERE user_id = ? ORDER BY id`
+	err := r.db.Select(&keys, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (r *SQLiteRepository) GetAPIKeyByHash(keyHash string) (*model.APIKey, error) {
+	key := &model.APIKey{}
+	query := `SELECT id, user_id, prefix, key_hash, created_at FROM api_keys WHERE key_hash = ?`
+	err := r.db.Get(key, query, keyHash)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return key, nil
+}
+
+// DeleteAPIKey revokes one of the user's keys, reporting whether a key was removed
+func (r *SQLiteRepository) DeleteAPIKey(id int, userID string) (bool, error) {
+	query := `DELETE FROM api_keys WHERE id = ? AND user_id = ?`
+	result, err := r.db.Exec(query, id, userID)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// CollectionRepository implementation
+
+func (r *SQLiteRepository) CreateCollection(collection *model.Collection) error {
+	query := `
+		INSERT INTO collections (user_id, name, created_at)
+		VALUES (?, ?, ?)
+	`
+	result, err := r.db.Exec(query, collection.UserID, collection.Name, collection.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	collection.ID = int(id)
+	return nil
+}
+
+func (r *SQLiteRepository) GetCollectionByID(id int) (*model.Collection, error) {
+	collection := &model.Collection{}
+	query := `SELECT id, user_id, name, created_at FROM collections WHERE id = ?`
+	err := r.db.Get(collection, query, id)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return collection, nil
+}
+
+func (r *SQLiteRepository) GetCollectionsByUserID(userID string) ([]*model.Collection, error) {
+	collections := []*model.Collection{}
+	query := `SELECT id, user_id, name, created_at FROM collections WHERE user_id = ? ORDER BY name`
+	err := r.db.Select(&collections, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	return collections, nil
+}
+
+// AddSetToCollection assigns a set to a collection; assigning it again is a no-op
+func (r *SQLiteRepository) AddSetToCollection(collectionID, setID int) error {
+	query := `INSERT OR IGNORE INTO set_collections (collection_id, set_id) VALUES (?, ?)`
+	_, err := r.db.Exec(query, collectionID, setID)
+	return err
+}
+
+// RemoveSetFromCollection unassigns a set, reporting whether it was in the collection
+func (r *SQLiteRepository) RemoveSetFromCollection(collectionID, setID int) (bool, error) {
+	query := `DELETE FROM set_collections WHERE collection_id = ? AND set_id = ?`
+	result, err := r.db.Exec(query, collectionID, setID)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func (r *SQLiteRepository) GetSetsByCollectionID(collectionID int) ([]*model.Set, error) {
+	sets := []*model.Set{}
+	query := `
+		SELECT s.id, s.user_id, s.name, s.description, s.difficulty_min, s.difficulty_max, s.created_at
+		FROM sets s
+		JOIN set_collections sc ON sc.set_id = s.id
+		WHERE sc.collection_id = ? AND s.deleted_at IS NULL
+		ORDER BY s.created_at DESC
+	`
+	err := r.db.Select(&sets, query, collectionID)
+	if err != nil {
+		return nil, err
+	}
+	return sets, nil
+}
+
+// PuzzleRepository implementation
+
+// GetPuzzleCatalogStats counts puzzles per difficulty and how many have a usable solution and
+// ticks. A solution is missing when it is NULL, unparseable, or has no lines.
+func (r *SQLiteRepository) GetPuzzleCatalogStats() (*model.PuzzleCatalogStats, error) {
+	stats := &model.PuzzleCatalogStats{}
+	query := `
+		SELECT COUNT(*) AS total,
+			COALESCE(SUM(has_solution), 0) AS with_solution,
+			COUNT(*) - COALESCE(SUM(has_solution), 0) AS missing_solution,
+			COALESCE(SUM(has_ticks), 0) AS with_ticks
+		FROM (
+			SELECT
+				CASE WHEN json_valid(solution_json) AND json_array_length(solution_json, '$.lines') > 0
+					THEN 1 ELSE 0 END AS has_solution,
+				CASE WHEN json_valid(ticks_json) AND json_array_length(ticks_json) > 0
+					THEN 1 ELSE 0 END AS has_ticks
+			FROM puzzles
+		)
+	`
+	if err := r.db.Get(stats, query); err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		Difficulty string `db:"difficulty"`
+		Count      int    `db:"count"`
+	}
+	if err := r.db.Select(&rows, `SELECT difficulty, COUNT(*) AS count FROM puzzles GROUP BY difficulty`); err != nil {
+		return nil, err
+	}
+	stats.ByDifficulty = map[string]int{}
+	for _, row := range rows {
+		stats.ByDifficulty[row.Difficulty] = row.Count
+	}
+	return stats, nil
+}
+
+// GetUnattemptedPuzzleIDs lists, by ID, puzzles the user has no progress row for. An empty
+// difficulty matches every difficulty.
+func (r *SQLiteRepository) GetUnattemptedPuzzleIDs(userID, difficulty string, limit int) ([]string, error) {
+	ids := []string{}
+	query := `
+		SELECT p.id
+		FROM puzzles p
+		WHERE (? = '' OR p.difficulty = ?)
+		AND NOT EXISTS (SELECT 1 FROM progress pr WHERE pr.user_id = ? AND pr.puzzle_id = p.id)
+		ORDER BY p.id
+		LIMIT ?
+	`
+	if err := r.db.Select(&ids, query, difficulty, difficulty, userID, limit); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// GetCompletionByUserID counts, per difficulty, all puzzles and those the user has attempted and
+// solved according to their progress rows. Difficulties with no puzzles are left out.
+func (r *SQLiteRepository) GetCompletionByUserID(userID string) ([]*model.DifficultyCompletion, error) {
+	completion := []*model.DifficultyCompletion{}
+	query := `
+		SELECT p.difficulty,
+			COUNT(*) AS total,
+			COUNT(CASE WHEN pr.attempts > 0 THEN 1 END) AS attempted,
+			COUNT(pr.solved_at) AS solved
+		FROM puzzles p
+		LEFT JOIN progress pr ON pr.puzzle_id = p.id AND pr.user_id = ?
+		GROUP BY p.difficulty
+	`
+	if err := r.db.Select(&completion, query, userID); err != nil {
+		return nil, err
+	}
+	return completion, nil
+}
+
+// RecordDailyAttempt notes that the user attempted a puzzle from today's daily batch. Further
+// attempts on the same day are ignored.
+func (r *SQLiteRepository) RecordDailyAttempt(userID, puzzleID string) error {
+	_, err := r.db.Exec(`
+		INSERT INTO daily_attempts (user_id, puzzle_id, day) VALUES (?, ?, date('now'))
+		ON CONFLICT(user_id, puzzle_id, day) DO NOTHING
+	`, userID, puzzleID)
+	return err
+}
+
+// GetDailyAttemptedPuzzleIDs returns the daily puzzles the user attempted today and on the
+// days-1 days before it, in the order they were first attempted. Puzzles since removed from
+// the catalog are left out.
+func (r *SQLiteRepository) GetDailyAttemptedPuzzleIDs(userID string, days int) ([]string, error) {
+	puzzleIDs := []string{}
+	query := `
+		SELECT da.puzzle_id
+		FROM daily_attempts da
+		JOIN puzzles p ON p.id = da.puzzle_id
+		WHERE da.user_id = ? AND da.day > date('now', '-' || ? || ' days')
+		GROUP BY da.puzzle_id
+		ORDER BY MIN(da.day), MIN(da.id)
+	`
+	if err := r.db.Select(&puzzleIDs, query, userID, days); err != nil {
+		return nil, err
+	}
+	return puzzleIDs, nil
+}
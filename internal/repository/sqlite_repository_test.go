@@ -0,0 +1,185 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+
+	"woodpecker-online/internal/model"
+
+	"github.com/jmoiron/sqlx"
+	_ "modernc.org/sqlite"
+)
+
+// newTestRepository returns a repository on an in-memory database with the tables the getters read
+func newTestRepository(t *testing.T) (*SQLiteRepository, *sqlx.DB) {
+	t.Helper()
+	db, err := sqlx.Connect("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	db.MustExec(`CREATE TABLE users (id TEXT PRIMARY KEY, email TEXT, password_hash TEXT, created_at DATETIME)`)
+	db.MustExec(`CREATE TABLE sets (
+		id INTEGER PRIMARY KEY, user_id TEXT, name TEXT, description TEXT,
+		difficulty_min TEXT, difficulty_max TEXT, created_at DATETIME, deleted_at DATETIME
+	)`)
+	db.MustExec(`CREATE TABLE set_puzzles (set_id INTEGER, puzzle_id TEXT, position INTEGER, PRIMARY KEY (set_id, puzzle_id))`)
+	db.MustExec(`CREATE TABLE puzzles (id TEXT PRIMARY KEY, difficulty TEXT)`)
+	db.MustExec(`CREATE TABLE cycles (
+		id INTEGER PRIMARY KEY, set_id INTEGER, cycle_index INTEGER, target_days INTEGER,
+		started_at DATETIME, ended_at DATETIME, status TEXT, name TEXT, notes TEXT
+	)`)
+	db.MustExec(`CREATE TABLE sessions (
+		id INTEGER PRIMARY KEY, cycle_id INTEGER, started_at DATETIME, ended_at DATETIME,
+		target_count INTEGER, time_limit_seconds INTEGER
+	)`)
+	db.MustExec(`CREATE TABLE attempts (
+		id INTEGER PRIMARY KEY, session_id INTEGER, puzzle_id TEXT, started_at DATETIME, ended_at DATETIME,
+		score_first_move INTEGER, score_ticks INTEGER, total_points INTEGER, time_ms INTEGER,
+		correct_first_move BOOLEAN, hints_used INTEGER, skipped BOOLEAN
+	)`)
+	db.MustExec(`CREATE TABLE api_keys (id INTEGER PRIMARY KEY, user_id TEXT, prefix TEXT, key_hash TEXT, created_at DATETIME)`)
+	db.MustExec(`CREATE TABLE collections (id INTEGER PRIMARY KEY, user_id TEXT, name TEXT, created_at DATETIME)`)
+	return &SQLiteRepository{db: db}, db
+}
+
+// getters calls each single-row getter for a row that doesn't exist
+var getters = map[string]func(r *SQLiteRepository) error{
+	"GetUserByID":                 func(r *SQLiteRepository) error { _, err := r.GetUserByID("missing"); return err },
+	"GetUserByEmail":              func(r *SQLiteRepository) error { _, err := r.GetUserByEmail("missing@example.com"); return err },
+	"GetSetByID":                  func(r *SQLiteRepository) error { _, err := r.GetSetByID(9); return err },
+	"GetCycleByID":                func(r *SQLiteRepository) error { _, err := r.GetCycleByID(9); return err },
+	"GetActiveCycleBySetID":       func(r *SQLiteRepository) error { _, err := r.GetActiveCycleBySetID(9); return err },
+	"GetNextUnattemptedSetPuzzle": func(r *SQLiteRepository) error { _, err := r.GetNextUnattemptedSetPuzzle(9, "easy"); return err },
+	"GetSessionByID":              func(r *SQLiteRepository) error { _, err := r.GetSessionByID(9); return err },
+	"GetActiveSessionByCycleID":   func(r *SQLiteRepository) error { _, err := r.GetActiveSessionByCycleID(9); return err },
+	"GetOpenSessionByUserID":      func(r *SQLiteRepository) error { _, err := r.GetOpenSessionByUserID("missing"); return err },
+	"GetAttemptByID":              func(r *SQLiteRepository) error { _, err := r.GetAttemptByID(9); return err },
+	"GetAPIKeyByHash":             func(r *SQLiteRepository) error { _, err := r.GetAPIKeyByHash("missing"); return err },
+	"GetCollectionByID":           func(r *SQLiteRepository) error { _, err := r.GetCollectionByID(9); return err },
+	"MoveSessionsToCycle":         func(r *SQLiteRepository) error { _, err := r.MoveSessionsToCycle(1, 9); return err },
+}
+
+func TestGettersReturnErrNotFound(t *testing.T) {
+	repo, _ := newTestRepository(t)
+	for name, get := range getters {
+		if err := get(repo); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: err = %v, want ErrNotFound", name, err)
+		}
+	}
+}
+
+func TestGettersPassThroughDatabaseErrors(t *testing.T) {
+	repo, db := newTestRepository(t)
+	db.Close()
+	for name, get := range getters {
+		if err := get(repo); err == nil || errors.Is(err, ErrNotFound) {
+			t.Errorf("%s on a closed database: err = %v, want the database error", name, err)
+		}
+	}
+}
+
+func TestAddPuzzleToSetDuplicate(t *testing.T) {
+	repo, db := newTestRepository(t)
+	if err := repo.AddPuzzleToSet(1, "p1", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.AddPuzzleToSet(1, "p1", 2); !errors.Is(err, ErrPuzzleAlreadyInSet) {
+		t.Errorf("adding p1 again: err = %v, want ErrPuzzleAlreadyInSet", err)
+	}
+	if err := repo.AppendPuzzlesToSet(1, []string{"p2", "p1"}); !errors.Is(err, ErrPuzzleAlreadyInSet) {
+		t.Errorf("appending p1 again: err = %v, want ErrPuzzleAlreadyInSet", err)
+	}
+
+	var positions []int
+	if err := db.Select(&positions, `SELECT position FROM set_puzzles ORDER BY position`); err != nil {
+		t.Fatal(err)
+	}
+	if len(positions) != 1 || positions[0] != 1 {
+		t.Errorf("positions = %v, want p1 left alone at 1", positions)
+	}
+}
+
+func TestGetPersonalRecords(t *testing.T) {
+	type attempt struct {
+		session int // 1 is alice's, 2 is bob's
+		puzzle  string
+		points  int
+		timeMs  int
+		correct bool
+		skipped bool
+	}
+	type record struct {
+		puzzle string
+		value  int
+	}
+	tests := []struct {
+		name        string
+		attempts    []attempt
+		wantFastest *record
+		wantLongest *record
+		wantPoints  *record
+	}{
+		{"no attempts", nil, nil, nil, nil},
+		{"correct solves", []attempt{
+			{1, "p1", 3, 5000, true, false},
+			{1, "p2", 5, 2000, true, false},
+			{1, "p3", 1, 9000, true, false},
+		}, &record{"p2", 2000}, &record{"p3", 9000}, &record{"p2", 5}},
+		{"wrong and skipped attempts are not solves", []attempt{
+			{1, "p1", 0, 1000, false, false},
+			{1, "p2", 9, 500, true, true},
+			{1, "p3", 2, 4000, true, false},
+		}, &record{"p3", 4000}, &record{"p3", 4000}, &record{"p3", 2}},
+		{"untimed solves are ignored", []attempt{
+			{1, "p1", 4, 0, true, false},
+		}, nil, nil, &record{"p1", 4}},
+		{"ties go to the earliest", []attempt{
+			{1, "p1", 3, 2000, true, false},
+			{1, "p2", 3, 2000, true, false},
+		}, &record{"p1", 2000}, &record{"p1", 2000}, &record{"p1", 3}},
+		{"other users' attempts", []attempt{
+			{2, "p1", 9, 100, true, false},
+		}, nil, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, db := newTestRepository(t)
+			for i, userID := range []string{"alice", "bob"} {
+				db.MustExec(`INSERT INTO sets (id, user_id) VALUES (?, ?)`, i+1, userID)
+				db.MustExec(`INSERT INTO cycles (id, set_id) VALUES (?, ?)`, i+1, i+1)
+				db.MustExec(`INSERT INTO sessions (id, cycle_id) VALUES (?, ?)`, i+1, i+1)
+			}
+			for _, a := range tt.attempts {
+				db.MustExec(`INSERT INTO attempts (session_id, puzzle_id, started_at, total_points, time_ms, correct_first_move, skipped)
+					VALUES (?, ?, CURRENT_TIMESTAMP, ?, ?, ?, ?)`, a.session, a.puzzle, a.points, a.timeMs, a.correct, a.skipped)
+			}
+
+			records, err := repo.GetPersonalRecords("alice")
+			if err != nil {
+				t.Fatal(err)
+			}
+			checks := []struct {
+				name string
+				got  *model.AttemptRecord
+				want *record
+			}{
+				{"fastest solve", records.FastestSolve, tt.wantFastest},
+				{"longest solve", records.LongestSolve, tt.wantLongest},
+				{"highest points", records.HighestPoints, tt.wantPoints},
+			}
+			for _, c := range checks {
+				switch {
+				case c.want == nil && c.got != nil:
+					t.Errorf("%s = %s (%d), want none", c.name, c.got.PuzzleID, c.got.Value)
+				case c.want != nil && c.got == nil:
+					t.Errorf("%s = none, want %s (%d)", c.name, c.want.puzzle, c.want.value)
+				case c.want != nil && (c.got.PuzzleID != c.want.puzzle || c.got.Value != c.want.value):
+					t.Errorf("%s = %s (%d), want %s (%d)", c.name, c.got.PuzzleID, c.got.Value, c.want.puzzle, c.want.value)
+				}
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"woodpecker-online/internal/auth"
+	"woodpecker-online/internal/model"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
@@ -18,8 +19,14 @@ func NewService(db *sqlx.DB) *Service {
 	return &Service{db: db}
 }
 
-// CreateUser creates a new user
+// CreateUser creates a new user along with their default settings
 func (s *Service) CreateUser(email, password string) (*auth.User, error) {
+	return s.CreateUserWithSettings(email, password, model.DefaultUserSettings(""))
+}
+
+// CreateUserWithSettings creates a new user and their settings in one transaction, so a failed
+// settings insert leaves no user behind. settings.UserID is set to the new user's ID.
+func (s *Service) CreateUserWithSettings(email, password string, settings *model.UserSettings) (*auth.User, error) {
 	// Check if user already exists
 	var existingUser auth.User
 	err := s.db.Get(&existingUser, "SELECT id FROM users WHERE email = ?", email)
@@ -45,7 +52,13 @@ func (s *Service) CreateUser(email, password string) (*auth.User, error) {
 		UpdatedAt:    time.Now(),
 	}
 
-	_, err = s.db.Exec(`
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
 		INSERT INTO users (id, email, password_hash, created_at, updated_at)
 		VALUES (?, ?, ?, ?, ?)
 	`, user.ID, user.Email, user.PasswordHash, user.CreatedAt, user.UpdatedAt)
@@ -54,6 +67,20 @@ func (s *Service) CreateUser(email, password string) (*auth.User, error) {
 		return nil, err
 	}
 
+	// Create settings so the user has a row to update from the start
+	settings.UserID = user.ID
+	_, err = tx.Exec(`
+		INSERT INTO user_settings (user_id, daily_goal_minutes, reminders_enabled, timezone, board_orientation)
+		VALUES (?, ?, ?, ?, ?)
+	`, settings.UserID, settings.DailyGoalMinutes, settings.RemindersEnabled, settings.Timezone, settings.BoardOrientation)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
 	return user, nil
 }
 
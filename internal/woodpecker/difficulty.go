@@ -0,0 +1,122 @@
+package woodpecker
+
+import (
+	"log/slog"
+
+	"woodpecker-online/internal/model"
+)
+
+// AutoDifficultyConfig controls when a daily batch starts mixing in harder puzzles
+type AutoDifficultyConfig struct {
+	// AccuracyPercent is the recent accuracy a user must exceed on their current difficulty
+	AccuracyPercent int
+	// MinSample is how many recent attempts are needed before accuracy is trusted
+	MinSample int
+	// Window is how many of the most recent attempts accuracy is measured over
+	Window int
+	// PromotePercent is the share of the batch swapped for next-difficulty puzzles
+	PromotePercent int
+}
+
+// AutoDifficulty is the configuration used by ApplyAutoDifficulty
+var AutoDifficulty = AutoDifficultyConfig{
+	AccuracyPercent: 85,
+	MinSample:       20,
+	Window:          50,
+	PromotePercent:  25,
+}
+
+// nextDifficulty returns the difficulty one step harder, or "" if there is none
+func nextDifficulty(difficulty string) string {
+	for i, d := range model.Difficulties {
+		if d == difficulty && i+1 < len(model.Difficulties) {
+			return model.Difficulties[i+1]
+		}
+	}
+	return ""
+}
+
+// RecentAccuracy returns the percentage of the user's most recent attempts at the given
+// difficulty that scored, along with how many attempts it was measured over
+func (s *Service) RecentAccuracy(userID, difficulty string, window int) (int, int, error) {
+	var scores []int
+	err := s.db.Select(&scores, `
+		SELECT pr.score FROM progress pr
+		JOIN puzzles p ON p.id = pr.puzzle_id
+		WHERE pr.user_id = ? AND p.difficulty = ? AND pr.attempts > 0
+		ORDER BY pr.updated_at DESC, pr.id DESC
+		LIMIT ?
+	`, userID, difficulty, window)
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(scores) == 0 {
+		return 0, 0, nil
+	}
+
+	correct := 0
+	for _, score := range scores {
+		if score > 0 {
+			correct++
+		}
+	}
+	return correct * 100 / len(scores), len(scores), nil
+}
+
+// ApplyAutoDifficulty promotes part of a daily batch to the next difficulty when the user's
+// recent accuracy on the current one is above AutoDifficulty.AccuracyPercent over at least
+// AutoDifficulty.MinSample attempts. The batch is returned unchanged otherwise, or if no
+// harder puzzles are available.
+func (s *Service) ApplyAutoDifficulty(userID, difficulty string, batch []string) []string {
+	cfg := AutoDifficulty
+	difficulty, err := model.NormalizeDifficulty(difficulty)
+	if err != nil {
+		return batch
+	}
+	harder := nextDifficulty(difficulty)
+	if harder == "" || len(batch) == 0 || cfg.PromotePercent <= 0 {
+		return batch
+	}
+
+	accuracy, sample, err := s.RecentAccuracy(userID, difficulty, cfg.Window)
+	if err != nil {
+		slog.Error("Error computing recent accuracy", "user", userID, "error", err)
+		return batch
+	}
+	if sample < cfg.MinSample || accuracy <= cfg.AccuracyPercent {
+		return batch
+	}
+
+	promote := len(batch) * cfg.PromotePercent / 100
+	if promote == 0 {
+		promote = 1
+	}
+
+	// Prefer harder puzzles the user hasn't seen yet
+	var harderIDs []string
+	err = s.db.Select(&harderIDs, `
+		SELECT p.id FROM puzzles p
+		LEFT JOIN progress pr ON pr.puzzle_id = p.id AND pr.user_id = ?
+		WHERE p.difficulty = ?
+		ORDER BY pr.id IS NOT NULL, RANDOM()
+		LIMIT ?
+	`, userID, harder, promote)
+	if err != nil {
+		slog.Error("Error loading harder puzzles", "user", userID, "difficulty", harder, "error", err)
+		return batch
+	}
+
+	// Swap out the tail of the batch so the first puzzles of the day stay familiar
+	promoted := append([]string{}, batch[:len(batch)-len(harderIDs)]...)
+	return append(promoted, harderIDs...)
+}
+
+// PlanTodayBatch builds today's batch for the plan and applies auto-difficulty to it, so every
+// caller that stores a batch gets the same promotion
+func (s *Service) PlanTodayBatch(userID string, plan *DailyPlan) ([]string, error) {
+	batch, err := s.BuildTodayBatch(userID, plan)
+	if err != nil {
+		return nil, err
+	}
+	return s.ApplyAutoDifficulty(userID, plan.Difficulty, batch), nil
+}
@@ -0,0 +1,57 @@
+package woodpecker
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestApplyAutoDifficulty(t *testing.T) {
+	previous := AutoDifficulty
+	AutoDifficulty = AutoDifficultyConfig{AccuracyPercent: 80, MinSample: 10, Window: 20, PromotePercent: 25}
+	t.Cleanup(func() { AutoDifficulty = previous })
+
+	tests := []struct {
+		name         string
+		attempts     int
+		correct      int
+		wantPromoted int
+	}{
+		{"high accuracy", 10, 10, 2},
+		{"at the threshold", 10, 8, 0},
+		{"struggling", 10, 3, 0},
+		{"too few attempts", 9, 9, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			for i := 0; i < 20; i++ {
+				s.db.MustExec(`INSERT INTO puzzles (id, difficulty) VALUES (?, 'easy'), (?, 'intermediate')`,
+					fmt.Sprintf("easy_%02d", i), fmt.Sprintf("intermediate_%02d", i))
+			}
+			for i := 0; i < tt.attempts; i++ {
+				score := 0
+				if i < tt.correct {
+					score = 1
+				}
+				s.db.MustExec(`INSERT INTO progress (user_id, puzzle_id, attempts, score) VALUES ('alice', ?, 1, ?)`,
+					fmt.Sprintf("easy_%02d", i), score)
+			}
+
+			batch := []string{"easy_10", "easy_11", "easy_12", "easy_13", "easy_14", "easy_15", "easy_16", "easy_17"}
+			got := s.ApplyAutoDifficulty("alice", "easy", batch)
+			if len(got) != len(batch) {
+				t.Fatalf("batch has %d puzzles, want %d", len(got), len(batch))
+			}
+			promoted := 0
+			for _, id := range got {
+				if strings.HasPrefix(id, "intermediate_") {
+					promoted++
+				}
+			}
+			if promoted != tt.wantPromoted {
+				t.Errorf("promoted %d puzzles, want %d: %v", promoted, tt.wantPromoted, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package woodpecker
+
+import "math"
+
+// Spaced repetition parameters, after SM-2
+const (
+	// DefaultEase is the ease factor of a puzzle that has never been reviewed
+	DefaultEase = 2.5
+	// MinEase stops repeatedly failed puzzles from collapsing to a one-day interval forever
+	MinEase = 1.3
+)
+
+// NextReview applies one graded attempt to a puzzle's review interval (in days) and ease, in the
+// style of SM-2. A solve moves the interval through 1 and 6 days and then multiplies it by the
+// ease, which grows a little; a failure sends the puzzle back to a one-day interval and lowers
+// the ease, so failed puzzles come back sooner on every later solve too.
+func NextReview(intervalDays int, ease float64, correct bool) (int, float64) {
+	// An unset ease means the puzzle hasn't been scheduled yet
+	if ease <= 0 {
+		ease = DefaultEase
+	}
+
+	// SM-2 quality: 5 for a solve, 2 for a failure
+	quality := 2.0
+	if correct {
+		quality = 5
+	}
+	ease += 0.1 - (5-quality)*(0.08+(5-quality)*0.02)
+	ease = math.Round(ease*100) / 100
+	if ease < MinEase {
+		ease = MinEase
+	}
+
+	if !correct {
+		return 1, ease
+	}
+	switch {
+	case intervalDays < 1:
+		return 1, ease
+	case intervalDays < 6:
+		return 6, ease
+	default:
+		return int(math.Round(float64(intervalDays) * ease)), ease
+	}
+}
@@ -0,0 +1,43 @@
+package woodpecker
+
+import "testing"
+
+func TestNextReview(t *testing.T) {
+	tests := []struct {
+		name         string
+		intervalDays int
+		ease         float64
+		correct      bool
+		wantInterval int
+		wantEase     float64
+	}{
+		{"first solve", 0, 0, true, 1, 2.6},
+		{"second solve", 1, 2.6, true, 6, 2.7},
+		{"third solve", 6, 2.7, true, 17, 2.8},
+		{"failure resets the interval", 17, 2.8, false, 1, 2.48},
+		{"first failure", 0, 0, false, 1, 2.18},
+		{"ease never drops below the minimum", 1, 1.4, false, 1, MinEase},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			interval, ease := NextReview(tt.intervalDays, tt.ease, tt.correct)
+			if interval != tt.wantInterval || ease != tt.wantEase {
+				t.Errorf("NextReview(%d, %v, %v) = %d, %v; want %d, %v",
+					tt.intervalDays, tt.ease, tt.correct, interval, ease, tt.wantInterval, tt.wantEase)
+			}
+		})
+	}
+}
+
+func TestNextReviewSolvedOutpacesFailed(t *testing.T) {
+	solved, solvedEase := 0, 0.0
+	failed, failedEase := 0, 0.0
+	for i := 0; i < 4; i++ {
+		solved, solvedEase = NextReview(solved, solvedEase, true)
+		failed, failedEase = NextReview(failed, failedEase, false)
+	}
+	if solved <= failed || solvedEase <= failedEase {
+		t.Errorf("solved puzzle at %d days (ease %v), failed at %d days (ease %v); want the solved one longer",
+			solved, solvedEase, failed, failedEase)
+	}
+}
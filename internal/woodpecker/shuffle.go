@@ -0,0 +1,34 @@
+package woodpecker
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"math/rand"
+)
+
+// ShuffleForCycle returns the set's puzzle IDs in a deterministic order for the given cycle.
+// The order is stable for a (set, cycle) pair but changes between cycles, so repeating a set
+// doesn't let the user memorize the sequence.
+func (s *Service) ShuffleForCycle(setID, cycleIndex int) []string {
+	var puzzleIDs []string
+	err := s.db.Select(&puzzleIDs, `SELECT puzzle_id FROM set_puzzles WHERE set_id = ? ORDER BY position`, setID)
+	if err != nil {
+		slog.Error("Error loading puzzles for set", "set", setID, "error", err)
+		return nil
+	}
+
+	rng := rand.New(rand.NewSource(cycleSeed(setID, cycleIndex)))
+	rng.Shuffle(len(puzzleIDs), func(i, j int) {
+		puzzleIDs[i], puzzleIDs[j] = puzzleIDs[j], puzzleIDs[i]
+	})
+
+	return puzzleIDs
+}
+
+// cycleSeed derives a shuffle seed from a set ID and cycle index
+func cycleSeed(setID, cycleIndex int) int64 {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d:%d", setID, cycleIndex)
+	return int64(h.Sum64())
+}
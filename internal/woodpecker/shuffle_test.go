@@ -0,0 +1,66 @@
+package woodpecker
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	_ "modernc.org/sqlite"
+)
+
+// newTestService returns a service on an in-memory database with the tables the tests read
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+	db, err := sqlx.Connect("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	db.MustExec(`CREATE TABLE set_puzzles (set_id INTEGER, puzzle_id TEXT, position INTEGER)`)
+	db.MustExec(`CREATE TABLE puzzles (id TEXT PRIMARY KEY, difficulty TEXT, solution_json TEXT, ticks_json TEXT)`)
+	db.MustExec(`CREATE TABLE progress (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id TEXT, puzzle_id TEXT, attempts INTEGER, score INTEGER,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+	return NewService(db)
+}
+
+func TestShuffleForCycle(t *testing.T) {
+	s := newTestService(t)
+	var want []string
+	for i := 0; i < 20; i++ {
+		id := fmt.Sprintf("p%02d", i)
+		s.db.MustExec(`INSERT INTO set_puzzles (set_id, puzzle_id, position) VALUES (1, ?, ?)`, id, i)
+		want = append(want, id)
+	}
+
+	first := s.ShuffleForCycle(1, 1)
+	if again := s.ShuffleForCycle(1, 1); !reflect.DeepEqual(first, again) {
+		t.Errorf("cycle 1 order changed between calls:\n%v\n%v", first, again)
+	}
+
+	second := s.ShuffleForCycle(1, 2)
+	if reflect.DeepEqual(first, second) {
+		t.Errorf("cycles 1 and 2 have the same order %v", first)
+	}
+
+	for _, order := range [][]string{first, second} {
+		sorted := append([]string(nil), order...)
+		sort.Strings(sorted)
+		if !reflect.DeepEqual(sorted, want) {
+			t.Errorf("order %v is not a permutation of the set", order)
+		}
+	}
+}
+
+func TestShuffleForCycleEmptySet(t *testing.T) {
+	s := newTestService(t)
+	if order := s.ShuffleForCycle(1, 1); len(order) != 0 {
+		t.Errorf("empty set shuffled to %v", order)
+	}
+}
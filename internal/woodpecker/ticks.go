@@ -0,0 +1,26 @@
+package woodpecker
+
+import (
+	"fmt"
+
+	"woodpecker-online/internal/model"
+)
+
+// RecomputeTicks rebuilds a puzzle's ticks from the IsTick flags in its solution tree and
+// overwrites ticks_json, so the two can't drift apart. It returns the new ticks.
+func (s *Service) RecomputeTicks(puzzleID string) ([]string, error) {
+	var solution model.SolutionJSON
+	if err := s.db.Get(&solution, `SELECT solution_json FROM puzzles WHERE id = ?`, puzzleID); err != nil {
+		return nil, err
+	}
+	if solution.ParseErr != nil {
+		return nil, fmt.Errorf("%w: %v", model.ErrSolutionCorrupt, solution.ParseErr)
+	}
+
+	ticks := solution.TickSANs()
+	_, err := s.db.Exec(`UPDATE puzzles SET ticks_json = ? WHERE id = ?`, model.TicksJSON{Ticks: ticks}, puzzleID)
+	if err != nil {
+		return nil, err
+	}
+	return ticks, nil
+}
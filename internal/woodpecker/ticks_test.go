@@ -0,0 +1,55 @@
+package woodpecker
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+
+	"woodpecker-online/internal/model"
+)
+
+func TestRecomputeTicks(t *testing.T) {
+	s := newTestService(t)
+	// Two tick moves, one of them in a side variation, and a stale ticks array
+	s.db.MustExec(`INSERT INTO puzzles (id, solution_json, ticks_json) VALUES ('p1', ?, '["Qh5"]')`, `{"lines":[
+		{"san":"Ra7","isTick":true,"children":[
+			{"san":"h6","children":[{"san":"Ra8+","isTick":true}]},
+			{"san":"h5","children":[{"san":"Ra8+"}]}
+		]}
+	]}`)
+
+	ticks, err := s.RecomputeTicks("p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Ra7", "Ra8+"}
+	if !reflect.DeepEqual(ticks, want) {
+		t.Errorf("ticks = %v, want %v", ticks, want)
+	}
+
+	var stored model.TicksJSON
+	if err := s.db.Get(&stored, `SELECT ticks_json FROM puzzles WHERE id = 'p1'`); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(stored.Ticks, want) {
+		t.Errorf("stored ticks = %v, want %v", stored.Ticks, want)
+	}
+}
+
+func TestRecomputeTicksErrors(t *testing.T) {
+	s := newTestService(t)
+	s.db.MustExec(`INSERT INTO puzzles (id, solution_json, ticks_json) VALUES ('broken', '{"lines":', '["Ra8#"]')`)
+
+	if _, err := s.RecomputeTicks("broken"); !errors.Is(err, model.ErrSolutionCorrupt) {
+		t.Errorf("corrupt solution: err = %v, want ErrSolutionCorrupt", err)
+	}
+	var ticks string
+	if err := s.db.Get(&ticks, `SELECT ticks_json FROM puzzles WHERE id = 'broken'`); err != nil || ticks != `["Ra8#"]` {
+		t.Errorf("corrupt solution overwrote ticks with %q (%v)", ticks, err)
+	}
+
+	if _, err := s.RecomputeTicks("missing"); err != sql.ErrNoRows {
+		t.Errorf("missing puzzle: err = %v, want sql.ErrNoRows", err)
+	}
+}